@@ -6,6 +6,7 @@ import (
 	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -19,6 +20,15 @@ const charset = "0123456789ACDEFGHJKLMNPQRTUVWXYZ"
 
 var dashPositions = []int{5, 10, 14, 18, 22}
 
+// confusables maps characters that are not in charset to the charset
+// characters they are commonly mistaken for when reading or typing a code.
+var confusables = strings.NewReplacer(
+	"O", "0",
+	"I", "1",
+	"S", "5",
+	"B", "8",
+)
+
 // BypassCode is the "raw" form of an Apple Activation Lock Bypass Code.
 // See https://developer.apple.com/documentation/devicemanagement/creating-and-using-bypass-codes
 type BypassCode [16]byte
@@ -116,6 +126,53 @@ func (c BypassCode) Code() (string, error) {
 	return str.String(), nil
 }
 
+// NormalizeCode normalizes a user-entered dash-separated bypass code.
+// The code is upper-cased, characters that are not part of the bypass
+// code character set but are easily confused with one (e.g. "O" for "0")
+// are replaced, and any other characters (like spaces and dashes)
+// are removed. Note the result does not contain dashes.
+func NormalizeCode(code string) string {
+	code = confusables.Replace(strings.ToUpper(code))
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(charset, r) {
+			return r
+		}
+		return -1
+	}, code)
+}
+
+// Verify reports whether the dash-separated "human readable" code
+// matches the hex encoded PBKDF2 derived hash (as escrowed with Apple).
+// Typos in the form of the code are tolerated: case, missing or extra
+// dashes and whitespace, and commonly confused characters are
+// normalized using [NormalizeCode]. An error is returned if the code
+// or hash cannot be decoded.
+func Verify(code, hash string) (bool, error) {
+	want, err := hex.DecodeString(strings.TrimSpace(hash))
+	if err != nil {
+		return false, fmt.Errorf("decoding hash: %w", err)
+	}
+	if len(want) != sha256.Size {
+		return false, fmt.Errorf("invalid hash length: %d", len(want))
+	}
+
+	bc, err := NewFromCode(NormalizeCode(code))
+	if err != nil {
+		return false, fmt.Errorf("decoding code: %w", err)
+	}
+
+	have, err := bc.Hash()
+	if err != nil {
+		return false, fmt.Errorf("hashing code: %w", err)
+	}
+	haveBytes, err := hex.DecodeString(have)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(haveBytes, want) == 1, nil
+}
+
 // convert binary data from one bits-per-byte arrangement to another.
 // Ex: re-arrange 8 bit bytes to groups of 5 when converting to base32.
 // This is a modified helper from a Go implementation of the bech32 format.
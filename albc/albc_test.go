@@ -138,3 +138,39 @@ func TestBypassCode(t *testing.T) {
 	}
 
 }
+
+func TestVerify(t *testing.T) {
+	const hash = "6ab40d5eabe7218ec04182f461005600c7e3426bddd82cdb405bde9a1e0014b5"
+
+	for _, tt := range []struct {
+		code string
+		ok   bool
+		err  bool
+	}{
+		{code: "3UM43-PUYVY-QYD1-UVCC-HEHJ-FKA4", ok: true},
+		{code: "3um43-puyvy-qyd1-uvcc-hehj-fka4", ok: true},
+		{code: " 3UM43 PUYVY QYDI UVCC HEHJ FKA4\n", ok: true},
+		{code: "3UM43PUYVYQYD1UVCCHEHJFKA4", ok: true},
+		{code: "3UM43-PUYVY-QYD1-UVCC-HEHJ-FKA5", ok: false},
+		{code: "8LNYD-DVNKU-GYRC-E6GU-3YFD-CT86", ok: false},
+		{code: "3UM43-PUYVY", err: true},
+	} {
+		ok, err := Verify(tt.code, hash)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.code)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %v", tt.code, err)
+			continue
+		}
+		if have, want := ok, tt.ok; have != want {
+			t.Errorf("%q: have %v, want %v", tt.code, have, want)
+		}
+	}
+
+	if _, err := Verify("3UM43-PUYVY-QYD1-UVCC-HEHJ-FKA4", "invalid"); err == nil {
+		t.Error("expected error for invalid hash")
+	}
+}
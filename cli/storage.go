@@ -4,16 +4,19 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/micromdm/nanodep/storage"
 	"github.com/micromdm/nanodep/storage/diskv"
+	"github.com/micromdm/nanodep/storage/envelope"
 	"github.com/micromdm/nanodep/storage/file"
 	"github.com/micromdm/nanodep/storage/inmem"
 	"github.com/micromdm/nanodep/storage/mysql"
 	"github.com/micromdm/nanodep/storage/pgsql"
+	"github.com/micromdm/nanodep/storage/sqlite"
 )
 
 // Storage parses a storage name and dsn to determine which and return a storage backend.
@@ -39,13 +42,28 @@ func Storage(storageName, dsn, options string) (storage.AllStorage, error) {
 	case "mysql":
 		store, err = mysqlStorage(dsn, options)
 	case "pgsql":
-		store, err = pgsql.New(pgsql.WithDSN(dsn))
+		store, err = pgsqlStorage(dsn, options)
+	case "sqlite":
+		if dsn == "" {
+			dsn = "nanodep.db"
+		}
+		store, err = sqliteStorage(dsn, options)
 	default:
 		return nil, fmt.Errorf("unknown storage: %q", storageName)
 	}
 	return store, err
 }
 
+// EncryptedStorage wraps store to encrypt secrets at rest using the
+// key-encryption keys in the local key file at keyFile.
+func EncryptedStorage(store storage.AllStorage, keyFile string) (*envelope.Storage, error) {
+	keys, err := envelope.LoadLocalKeyFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading key file: %w", err)
+	}
+	return envelope.New(store, keys)
+}
+
 // mysqlStorage builds a MySQL storage backend, parsing any storage options.
 func mysqlStorage(dsn, options string) (*mysql.MySQLStorage, error) {
 	opts := []mysql.Option{mysql.WithDSN(dsn)}
@@ -64,6 +82,12 @@ func mysqlStorage(dsn, options string) (*mysql.MySQLStorage, error) {
 					return nil, fmt.Errorf("invalid value for conn_max_idle_time option: %w", err)
 				}
 				opts = append(opts, mysql.WithConnMaxIdleTime(d))
+			case "migrate":
+				migrate, err := strconv.ParseBool(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for migrate option: %w", err)
+				}
+				opts = append(opts, mysql.WithMigrate(migrate))
 			default:
 				return nil, fmt.Errorf("invalid option: %q", k)
 			}
@@ -72,6 +96,42 @@ func mysqlStorage(dsn, options string) (*mysql.MySQLStorage, error) {
 	return mysql.New(opts...)
 }
 
+// pgsqlStorage builds a PostgreSQL storage backend, parsing any storage options.
+func pgsqlStorage(dsn, options string) (*pgsql.PSQLStorage, error) {
+	opts := []pgsql.Option{pgsql.WithDSN(dsn)}
+	for k, v := range splitOptions(options) {
+		switch k {
+		case "migrate":
+			migrate, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for migrate option: %w", err)
+			}
+			opts = append(opts, pgsql.WithMigrate(migrate))
+		default:
+			return nil, fmt.Errorf("invalid option: %q", k)
+		}
+	}
+	return pgsql.New(opts...)
+}
+
+// sqliteStorage builds a SQLite storage backend, parsing any storage options.
+func sqliteStorage(dsn, options string) (*sqlite.SQLiteStorage, error) {
+	opts := []sqlite.Option{sqlite.WithDSN(dsn)}
+	for k, v := range splitOptions(options) {
+		switch k {
+		case "migrate":
+			migrate, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for migrate option: %w", err)
+			}
+			opts = append(opts, sqlite.WithMigrate(migrate))
+		default:
+			return nil, fmt.Errorf("invalid option: %q", k)
+		}
+	}
+	return sqlite.New(opts...)
+}
+
 // splitOptions splits a comma-separated list of key=value storage options.
 func splitOptions(s string) map[string]string {
 	out := make(map[string]string)
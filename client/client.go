@@ -18,6 +18,10 @@ type Doer interface {
 // Config represents the configuration of a DEP name.
 type Config struct {
 	BaseURL string `json:"base_url,omitempty"`
+
+	// MDMServiceDiscoveryURL is the account-driven enrollment MDM
+	// service discovery URL assigned to the DEP name.
+	MDMServiceDiscoveryURL string `json:"mdm_service_discovery_url,omitempty"`
 }
 
 type ConfigRetriever interface {
@@ -37,11 +41,16 @@ func NewDefaultConfigRetreiver(next ConfigRetriever) *DefaultConfigRetreiver {
 }
 
 // RetrieveConfig retrieves the Config from the wrapped retreiver and returns
-// it. If the config is empty a default config is returned.
+// it. If the config or its base URL is empty the default base URL is used.
 func (c *DefaultConfigRetreiver) RetrieveConfig(ctx context.Context, name string) (*Config, error) {
 	config, err := c.next.RetrieveConfig(ctx, name)
-	if config == nil || config.BaseURL == "" {
+	if config == nil {
 		config = &Config{BaseURL: DefaultBaseURL}
+	} else if config.BaseURL == "" {
+		// copy so as to not modify the wrapped retriever's config
+		configCopy := *config
+		configCopy.BaseURL = DefaultBaseURL
+		config = &configCopy
 	}
 	return config, err
 }
@@ -26,6 +26,11 @@ func TestDefaultConfigRetreiver(t *testing.T) {
 			cfg:         &Config{BaseURL: "foo"},
 			expectedCfg: &Config{BaseURL: "foo"},
 		},
+		{
+			name:        "service-discovery",
+			cfg:         &Config{MDMServiceDiscoveryURL: "https://mdm.example.com/sd"},
+			expectedCfg: &Config{BaseURL: DefaultBaseURL, MDMServiceDiscoveryURL: "https://mdm.example.com/sd"},
+		},
 	} {
 		t.Run(cfg.name, func(t *testing.T) {
 			c := NewDefaultConfigRetreiver(cfgRetriever{cfg: cfg.cfg})
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"encoding/csv"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/micromdm/nanodep/albc"
 )
@@ -12,10 +19,105 @@ import (
 // overridden by -ldflags -X
 var version = "unknown"
 
+// bypassCode contains the forms of a bypass code and optionally the
+// serial number of the device it is intended for.
+type bypassCode struct {
+	Serial string `json:"serial_number,omitempty"`
+	Raw    string `json:"raw"`
+	Code   string `json:"code"`
+	Hash   string `json:"hash"`
+}
+
+func newBypassCode(bc albc.BypassCode, serial string) (*bypassCode, error) {
+	out := &bypassCode{Serial: serial, Raw: hex.EncodeToString(bc[:])}
+	var err error
+	out.Code, err = bc.Code()
+	if err != nil {
+		return nil, err
+	}
+	out.Hash, err = bc.Hash()
+	return out, err
+}
+
+// readSerials reads serial numbers from path, one per line.
+// Empty lines and lines starting with "#" are skipped.
+func readSerials(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var serials []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		serial := strings.TrimSpace(scanner.Text())
+		if serial == "" || strings.HasPrefix(serial, "#") || seen[serial] {
+			continue
+		}
+		seen[serial] = true
+		serials = append(serials, serial)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(serials) < 1 {
+		return nil, errors.New("no serial numbers found")
+	}
+	return serials, nil
+}
+
+func writeCodes(w io.Writer, format string, codes []*bypassCode, withSerials bool) error {
+	switch format {
+	case "text":
+		for i, c := range codes {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if withSerials {
+				fmt.Fprintf(w, "%s  serial_number\n", c.Serial)
+			}
+			fmt.Fprintf(w, "%s  raw\n%s  code\n%s  hash\n", c.Raw, c.Code, c.Hash)
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := []string{"raw", "code", "hash"}
+		if withSerials {
+			header = append([]string{"serial_number"}, header...)
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, c := range codes {
+			record := []string{c.Raw, c.Code, c.Hash}
+			if withSerials {
+				record = append([]string{c.Serial}, record...)
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(codes)
+	default:
+		return fmt.Errorf("invalid format: %s", format)
+	}
+}
+
 func main() {
 	var (
 		flRaw     = flag.String("raw", "", "hex-encoded raw bypass code")
 		flCode    = flag.String("code", "", "dash-separated \"human readable\" bypass code")
+		flVerify  = flag.String("verify", "", "hex-encoded hash to verify -code against")
+		flN       = flag.Int("n", 1, "number of bypass codes to generate")
+		flSerials = flag.String("serials", "", "path to file of serial numbers to generate bypass codes for (one per line)")
+		flFormat  = flag.String("format", "text", "output format: text, csv, or json")
 		flVersion = flag.Bool("version", false, "print version")
 	)
 	flag.Parse()
@@ -25,6 +127,44 @@ func main() {
 		return
 	}
 
+	if *flVerify != "" {
+		if *flCode == "" {
+			log.Fatal("-verify requires -code")
+		}
+		ok, err := albc.Verify(*flCode, *flVerify)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			fmt.Println("bypass code does not match hash")
+			os.Exit(1)
+		}
+		fmt.Println("bypass code matches hash")
+		return
+	}
+
+	switch *flFormat {
+	case "text", "csv", "json":
+	default:
+		log.Fatalf("invalid format: %s", *flFormat)
+	}
+
+	if *flN < 1 {
+		log.Fatal("-n must be at least 1")
+	}
+
+	var serials []string
+	if *flSerials != "" {
+		if *flN != 1 {
+			log.Fatal("cannot specify both -n and -serials")
+		}
+		var err error
+		serials, err = readSerials(*flSerials)
+		if err != nil {
+			log.Fatal(fmt.Errorf("reading serials: %w", err))
+		}
+	}
+
 	var (
 		err error
 		bc  albc.BypassCode
@@ -32,6 +172,8 @@ func main() {
 
 	if *flRaw != "" && *flCode != "" {
 		log.Fatal("cannot specify both raw and code")
+	} else if (*flRaw != "" || *flCode != "") && (*flN != 1 || len(serials) > 0) {
+		log.Fatal("cannot specify raw or code when generating multiple codes")
 	} else if *flRaw == "" && *flCode == "" {
 		bc, err = albc.New()
 		if err != nil {
@@ -53,17 +195,32 @@ func main() {
 		}
 	}
 
-	raw := hex.EncodeToString(bc[:])
+	n := *flN
+	if len(serials) > 0 {
+		n = len(serials)
+	}
 
-	code, err := bc.Code()
-	if err != nil {
-		log.Fatal(err)
+	codes := make([]*bypassCode, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			// the first code was generated (or parsed) above
+			bc, err = albc.New()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		var serial string
+		if len(serials) > 0 {
+			serial = serials[i]
+		}
+		c, err := newBypassCode(bc, serial)
+		if err != nil {
+			log.Fatal(err)
+		}
+		codes = append(codes, c)
 	}
 
-	hash, err := bc.Hash()
-	if err != nil {
+	if err = writeCodes(os.Stdout, *flFormat, codes, len(serials) > 0); err != nil {
 		log.Fatal(err)
 	}
-
-	fmt.Printf("%s  raw\n%s  code\n%s  hash\n", raw, code, hash)
 }
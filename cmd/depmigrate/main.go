@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	stdlog "log"
+	"os"
+	"strings"
+
+	"github.com/micromdm/nanodep/cli"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/bundle"
+
+	"github.com/micromdm/nanolib/log/stdlogfmt"
+)
+
+// overridden by -ldflags -X
+var version = "unknown"
+
+func main() {
+	var (
+		flVersion    = flag.Bool("version", false, "print version")
+		flDebug      = flag.Bool("debug", false, "log debug messages")
+		flSrcStorage = flag.String("src-storage", "filekv", "source storage backend")
+		flSrcDSN     = flag.String("src-storage-dsn", "", "source storage backend data source name")
+		flSrcOptions = flag.String("src-storage-options", "", "source storage backend options")
+		flSrcKeyFile = flag.String("src-storage-key-file", "", "path to key file for decrypting source secrets")
+		flDstStorage = flag.String("dst-storage", "", "destination storage backend")
+		flDstDSN     = flag.String("dst-storage-dsn", "", "destination storage backend data source name")
+		flDstOptions = flag.String("dst-storage-options", "", "destination storage backend options")
+		flDstKeyFile = flag.String("dst-storage-key-file", "", "path to key file for encrypting destination secrets")
+		flNames      = flag.String("names", "", "comma-separated DEP names to migrate (empty to migrate all DEP names)")
+		flExisting   = flag.String("existing", bundle.ExistingSkip, "policy for DEP names existing in the destination: skip, overwrite, or fail")
+		flExport     = flag.String("export", "", "path to export an encrypted bundle of the source DEP names to (instead of a destination storage)")
+		flImport     = flag.String("import", "", "path to import an encrypted bundle of DEP names from (instead of a source storage)")
+		flPassFile   = flag.String("passphrase-file", "", "path to file containing the bundle passphrase")
+		flDryRun     = flag.Bool("dry-run", false, "report what would be migrated without writing to the destination")
+		flVerify     = flag.Bool("verify", false, "verify the destination data after each DEP name is migrated")
+	)
+	flag.Parse()
+
+	if *flVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *flExport != "" && *flImport != "" {
+		fmt.Fprintf(flag.CommandLine.Output(), "cannot both export and import\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *flDstStorage == "" && *flExport == "" {
+		fmt.Fprintf(flag.CommandLine.Output(), "no destination storage provided\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if !bundle.ValidExisting(*flExisting) {
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid existing policy: %s\n", *flExisting)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var passphrase string
+	if *flExport != "" || *flImport != "" {
+		if *flPassFile == "" {
+			fmt.Fprintf(flag.CommandLine.Output(), "bundle passphrase file required\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		passBytes, err := os.ReadFile(*flPassFile)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "reading passphrase file: %v\n", err)
+			os.Exit(1)
+		}
+		passphrase = strings.TrimRight(string(passBytes), "\r\n")
+	}
+
+	logger := stdlogfmt.New(
+		stdlogfmt.WithLogger(stdlog.Default()),
+		stdlogfmt.WithDebugFlag(*flDebug),
+	)
+
+	ctx := context.Background()
+
+	var src storage.AllStorage
+	var err error
+	var names []string
+	if *flImport == "" {
+		src, _, err = newStorage(*flSrcStorage, *flSrcDSN, *flSrcOptions, *flSrcKeyFile)
+		if err != nil {
+			logger.Info("msg", "creating source storage", "err", err)
+			os.Exit(1)
+		}
+
+		if *flNames != "" {
+			names = strings.Split(*flNames, ",")
+		} else {
+			names, err = storage.ListDEPNames(ctx, src)
+			if err != nil {
+				logger.Info("msg", "listing source DEP names", "err", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *flExport != "" {
+		count, err := exportNames(ctx, src, names, *flExport, passphrase)
+		if err != nil {
+			logger.Info("msg", "exporting bundle", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("msg", "exported bundle", "path", *flExport, "count", count)
+		return
+	}
+
+	dst, dstBackend, err := newStorage(*flDstStorage, *flDstDSN, *flDstOptions, *flDstKeyFile)
+	if err != nil {
+		logger.Info("msg", "creating destination storage", "err", err)
+		os.Exit(1)
+	}
+	// existing DEP names are deleted before being overwritten
+	deleter, ok := dstBackend.(storage.DEPNameDeleter)
+	if !ok {
+		logger.Info("msg", "creating destination storage", "err", "storage does not support deleting DEP names")
+		os.Exit(1)
+	}
+
+	m := &migrator{
+		src:      src,
+		dst:      bundle.NewRestorer(dst, deleter),
+		existing: *flExisting,
+		dryRun:   *flDryRun,
+		verify:   *flVerify,
+		logger:   logger,
+	}
+
+	var counts map[string]int
+	if *flImport != "" {
+		var b *bundle.Bundle
+		if b, err = readBundle(*flImport, passphrase); err != nil {
+			logger.Info("msg", "reading bundle", "err", err)
+			os.Exit(1)
+		}
+		logger.Debug("msg", "importing DEP names", "count", len(b.DEPNames), "created_at", b.CreatedAt, "dry_run", *flDryRun)
+		counts, err = m.migrateBundle(ctx, b)
+	} else {
+		logger.Debug("msg", "migrating DEP names", "count", len(names), "dry_run", *flDryRun)
+		counts, err = m.migrateNames(ctx, names)
+	}
+
+	logs := []interface{}{"msg", "migration finished", "dry_run", *flDryRun}
+	for _, result := range []string{
+		bundle.ResultStored,
+		bundle.ResultOverwritten,
+		bundle.ResultWouldStore,
+		bundle.ResultWouldOverwrite,
+		bundle.ResultSkippedExisting,
+		bundle.ResultSkippedEmpty,
+	} {
+		if counts[result] > 0 {
+			logs = append(logs, strings.ReplaceAll(result, " ", "_"), counts[result])
+		}
+	}
+	if err != nil {
+		logger.Info(append(logs, "err", err)...)
+		os.Exit(1)
+	}
+	logger.Info(logs...)
+}
+
+// newStorage creates a storage backend optionally encrypting secrets
+// using the key file at keyFile. The unwrapped storage backend is also
+// returned.
+func newStorage(storageName, dsn, options, keyFile string) (storage.AllStorage, storage.AllStorage, error) {
+	backend, err := cli.Storage(storageName, dsn, options)
+	if err != nil || keyFile == "" {
+		return backend, backend, err
+	}
+	store, err := cli.EncryptedStorage(backend, keyFile)
+	return store, backend, err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/bundle"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// equalTime compares times with the precision of the least precise
+// storage backend.
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func equalTokenPKI(a, b *bundle.TokenPKI) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Cert, b.Cert) && bytes.Equal(a.Key, b.Key)
+}
+
+// compareDEPName returns an error describing the first difference of
+// the copied state in dst from src.
+func compareDEPName(src, dst *bundle.DEPName) error {
+	if src.Tokens != nil {
+		if dst.Tokens == nil {
+			return errors.New("tokens missing")
+		}
+		if src.Tokens.ConsumerKey != dst.Tokens.ConsumerKey ||
+			src.Tokens.ConsumerSecret != dst.Tokens.ConsumerSecret ||
+			src.Tokens.AccessToken != dst.Tokens.AccessToken ||
+			src.Tokens.AccessSecret != dst.Tokens.AccessSecret ||
+			!equalTime(&src.Tokens.AccessTokenExpiry, &dst.Tokens.AccessTokenExpiry) {
+			return errors.New("tokens mismatch")
+		}
+	}
+	if (src.Config == nil) != (dst.Config == nil) || (src.Config != nil && *src.Config != *dst.Config) {
+		return errors.New("config mismatch")
+	}
+	if src.CurrentTokenPKI != nil && !equalTokenPKI(src.CurrentTokenPKI, dst.CurrentTokenPKI) {
+		return errors.New("current token PKI mismatch")
+	}
+	if src.StagingTokenPKI != nil && !equalTokenPKI(src.StagingTokenPKI, dst.StagingTokenPKI) {
+		return errors.New("staging token PKI mismatch")
+	}
+	if src.AssignerProfileUUID != dst.AssignerProfileUUID {
+		return errors.New("assigner profile mismatch")
+	}
+	if src.AssignerProfileUUIDAt != nil && !equalTime(src.AssignerProfileUUIDAt, dst.AssignerProfileUUIDAt) {
+		return errors.New("assigner profile timestamp mismatch")
+	}
+	if src.Cursor != dst.Cursor {
+		return errors.New("cursor mismatch")
+	}
+	return nil
+}
+
+// migrator copies DEP names from a source to a destination storage.
+type migrator struct {
+	src      bundle.Retriever
+	dst      bundle.Restorer
+	existing string
+	dryRun   bool
+	verify   bool
+	logger   log.Logger
+}
+
+// migrate copies DEP name d to the destination storage according to the
+// existing policy. Returns the result of the migration.
+func (m *migrator) migrate(ctx context.Context, d *bundle.DEPName) (string, error) {
+	result, err := bundle.Restore(ctx, m.dst, d, m.existing, m.dryRun)
+	if err != nil {
+		return result, fmt.Errorf("destination: %w", err)
+	}
+
+	if m.verify && (result == bundle.ResultStored || result == bundle.ResultOverwritten) {
+		dstDEPName, err := bundle.Retrieve(ctx, m.dst, d.Name)
+		if err != nil {
+			return result, fmt.Errorf("verifying: destination: %w", err)
+		}
+		if err = compareDEPName(d, dstDEPName); err != nil {
+			return result, fmt.Errorf("verifying: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// migrateNames migrates each of names from the source storage and returns
+// the count of each result. Stops at the first error.
+func (m *migrator) migrateNames(ctx context.Context, names []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, name := range names {
+		d, err := bundle.Retrieve(ctx, m.src, name)
+		if err != nil {
+			return counts, fmt.Errorf("migrating %s: source: %w", name, err)
+		}
+		if err = m.count(ctx, d, counts); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// migrateBundle migrates the DEP names in b and returns the count of each
+// result. Stops at the first error.
+func (m *migrator) migrateBundle(ctx context.Context, b *bundle.Bundle) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, d := range b.DEPNames {
+		if err := m.count(ctx, d, counts); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// count migrates d and counts its result in counts.
+func (m *migrator) count(ctx context.Context, d *bundle.DEPName, counts map[string]int) error {
+	result, err := m.migrate(ctx, d)
+	if err != nil {
+		return fmt.Errorf("migrating %s: %w", d.Name, err)
+	}
+	m.logger.Info("msg", result, "name", d.Name)
+	counts[result]++
+	return nil
+}
+
+// exportNames exports names from the source storage into an encrypted
+// bundle written to path.
+func exportNames(ctx context.Context, src storage.AllStorage, names []string, path, passphrase string) (int, error) {
+	b, err := bundle.Export(ctx, src, names)
+	if err != nil {
+		return 0, err
+	}
+	data, err := bundle.Encrypt(b, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	return len(b.DEPNames), os.WriteFile(path, data, 0600)
+}
+
+// readBundle reads and decrypts the encrypted bundle at path.
+func readBundle(path, passphrase string) (*bundle.Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.Decrypt(data, passphrase)
+}
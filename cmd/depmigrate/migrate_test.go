@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/cryptoutil"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/bundle"
+	"github.com/micromdm/nanodep/storage/inmem"
+	"github.com/micromdm/nanodep/tokenpki"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src, dst := inmem.New(), inmem.New()
+
+	key, cert, err := tokenpki.SelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemCert, pemKey := cryptoutil.PEMCertificate(cert.Raw), cryptoutil.PEMRSAPrivateKey(key)
+	if err = src.StoreTokenPKI(ctx, "a", pemCert, pemKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.UpstageTokenPKI(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	tokens := &client.OAuth1Tokens{
+		ConsumerKey:       "ck",
+		ConsumerSecret:    "cs",
+		AccessToken:       "at",
+		AccessSecret:      "as",
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC(),
+	}
+	if err = src.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.StoreConfig(ctx, "a", &client.Config{BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err = src.StoreAssignerProfileAt(ctx, "a", "profile", modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.StoreCursor(ctx, "a", "cursor"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &migrator{src: src, dst: dst, existing: bundle.ExistingSkip, verify: true, logger: log.NopLogger}
+
+	// dry-run does not write
+	m.dryRun = true
+	counts, err := m.migrateNames(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultWouldStore] != 1 || counts[bundle.ResultSkippedEmpty] != 1 {
+		t.Errorf("dry-run counts: %v", counts)
+	}
+	if _, err = dst.RetrieveAuthTokens(ctx, "a"); err == nil {
+		t.Error("expected no tokens in destination after dry-run")
+	}
+
+	m.dryRun = false
+	counts, err = m.migrateNames(ctx, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultStored] != 1 {
+		t.Errorf("counts: %v", counts)
+	}
+	_, haveModTime, err := dst.RetrieveAssignerProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !haveModTime.Equal(modTime) {
+		t.Errorf("assigner profile timestamp: have %v, want %v", haveModTime, modTime)
+	}
+
+	// existing DEP names
+	counts, err = m.migrateNames(ctx, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultSkippedExisting] != 1 {
+		t.Errorf("skip counts: %v", counts)
+	}
+
+	m.existing = bundle.ExistingFail
+	if _, err = m.migrateNames(ctx, []string{"a"}); !errors.Is(err, bundle.ErrExists) {
+		t.Errorf("have %v, want %v", err, bundle.ErrExists)
+	}
+
+	// overwriting removes data not in the source
+	if err = dst.StoreCursor(ctx, "a", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.StoreCursor(ctx, "a", ""); err != nil {
+		t.Fatal(err)
+	}
+	m.existing = bundle.ExistingOverwrite
+	counts, err = m.migrateNames(ctx, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultOverwritten] != 1 {
+		t.Errorf("overwrite counts: %v", counts)
+	}
+	cursor, err := dst.RetrieveCursor(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != "" {
+		t.Errorf("cursor: have %q, want empty", cursor)
+	}
+
+	// export and import an encrypted bundle
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	count, err := exportNames(ctx, src, []string{"a", "b"}, path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("export count: have %d, want %d", count, 1)
+	}
+	if _, err = readBundle(path, "wrong"); !errors.Is(err, bundle.ErrDecrypt) {
+		t.Errorf("have %v, want %v", err, bundle.ErrDecrypt)
+	}
+	b, err := readBundle(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.dst = inmem.New()
+	counts, err = m.migrateBundle(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultStored] != 1 {
+		t.Errorf("import counts: %v", counts)
+	}
+}
+
+func TestMigrateTokenOnly(t *testing.T) {
+	ctx := context.Background()
+	src, dst := inmem.New(), inmem.New()
+
+	// a DEP name without any token PKI
+	tokens := &client.OAuth1Tokens{
+		ConsumerKey:       "ck",
+		ConsumerSecret:    "cs",
+		AccessToken:       "at",
+		AccessSecret:      "as",
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC(),
+	}
+	if err := src.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.StoreConfig(ctx, "a", &client.Config{BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.StoreCursor(ctx, "a", "cursor"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := storage.ListDEPNames(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := names, []string{"a"}; !slices.Equal(have, want) {
+		t.Fatalf("names: have %v, want %v", have, want)
+	}
+
+	m := &migrator{src: src, dst: dst, existing: bundle.ExistingSkip, verify: true, logger: log.NopLogger}
+	counts, err := m.migrateNames(ctx, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[bundle.ResultStored] != 1 {
+		t.Errorf("counts: %v", counts)
+	}
+
+	haveTokens, err := dst.RetrieveAuthTokens(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if haveTokens.ConsumerKey != tokens.ConsumerKey || haveTokens.AccessSecret != tokens.AccessSecret {
+		t.Errorf("tokens: have %+v, want %+v", haveTokens, tokens)
+	}
+	config, err := dst.RetrieveConfig(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config == nil || config.BaseURL != "http://example.com" {
+		t.Errorf("config: have %+v", config)
+	}
+	cursor, err := dst.RetrieveCursor(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cursor, "cursor"; have != want {
+		t.Errorf("cursor: have %q, want %q", have, want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// newReadiness creates a readiness that checks the connectivity of store.
+func newReadiness(store storage.AllStorage) *dephttp.Readiness {
+	return dephttp.NewReadiness(func(ctx context.Context) error {
+		return storage.Ping(ctx, store)
+	})
+}
+
+// shutdownOnSignal gracefully shuts down srv when the process receives an
+// interrupt or SIGTERM. The readiness is drained first so that load
+// balancers stop sending new requests. In-flight requests are given up to
+// timeout to complete. Finally stop is called (if not nil) and waited on.
+func shutdownOnSignal(srv *http.Server, readiness *dephttp.Readiness, timeout time.Duration, stop func(context.Context), logger log.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Info("msg", "shutting down", "signal", sig, "timeout", timeout)
+		readiness.Drain()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Info("msg", "shutting down server", "err", err)
+		}
+		if stop != nil {
+			stop(ctx)
+		}
+	}()
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	stdslog "log/slog"
@@ -11,12 +14,18 @@ import (
 
 	"github.com/micromdm/nanodep/cli"
 	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
 	dephttp "github.com/micromdm/nanodep/http"
 	"github.com/micromdm/nanodep/http/api"
 	"github.com/micromdm/nanodep/http/apinext"
+	"github.com/micromdm/nanodep/http/auth"
 	"github.com/micromdm/nanodep/log/caller"
 	"github.com/micromdm/nanodep/log/slog"
+	"github.com/micromdm/nanodep/osbeta"
 	"github.com/micromdm/nanodep/proxy"
+	"github.com/micromdm/nanodep/storage/bundle"
+	"github.com/micromdm/nanodep/storage/history"
+	"github.com/micromdm/nanodep/storage/servicediscovery"
 
 	"github.com/google/uuid"
 	"github.com/micromdm/nanolib/envflag"
@@ -28,25 +37,63 @@ var version = "unknown"
 const (
 	apiUsername = "depserver"
 
-	endpointVersion  = "/version"
-	endpointTokens   = "/v1/tokens/"
-	endpointConfig   = "/v1/config/"
-	endpointTokenPKI = "/v1/tokenpki/"
-	endpointAssigner = "/v1/assigner/"
-	endpointMAIDJWT  = "/v1/maidjwt/"
-	endpointALBC     = "/v1/bypasscode"
-	endpointProxy    = "/proxy/"
+	endpointVersion          = "/version"
+	endpointHealth           = "/healthz"
+	endpointReady            = "/readyz"
+	endpointTokens           = "/v1/tokens/"
+	endpointConfig           = "/v1/config/"
+	endpointTokenPKI         = "/v1/tokenpki/"
+	endpointAssigner         = "/v1/assigner/"
+	endpointMAIDJWT          = "/v1/maidjwt/"
+	endpointALBC             = "/v1/bypasscode"
+	endpointDEPNames         = "/v1/dep_names"
+	endpointDEPName          = "/v1/dep_names/"
+	endpointAudit            = "/v1/audit"
+	endpointAPIKeys          = "/v1/apikeys/"
+	endpointAPIKeysList      = "/v1/apikeys"
+	endpointDevices          = "/v1/devices/"
+	endpointProfiles         = "/v1/profiles/"
+	endpointTemplates        = "/v1/profile_templates/"
+	endpointTemplatesList    = "/v1/profile_templates"
+	endpointSync             = "/v1/sync/"
+	endpointExport           = "/v1/export"
+	endpointImport           = "/v1/import"
+	endpointHistory          = "/v1/history/"
+	endpointRollback         = "/v1/rollback/"
+	endpointEscrow           = "/v1/escrow/"
+	endpointServiceDiscovery = "/v1/servicediscovery/"
+	endpointOSBeta           = "/v1/osbeta/"
+	endpointAccount          = "/v1/account/"
+	endpointProxy            = "/proxy/"
 )
 
 func main() {
 	var (
-		flDebug   = flag.Bool("debug", false, "log debug messages")
-		flListen  = flag.String("listen", ":9001", "HTTP listen address")
-		flAPIKey  = flag.String("api", "", "API key for API endpoints")
-		flVersion = flag.Bool("version", false, "print version and exit")
-		flStorage = flag.String("storage", "filekv", "storage backend")
-		flDSN     = flag.String("storage-dsn", "", "storage backend data source name")
-		flOptions = flag.String("storage-options", "", "storage backend options")
+		flDebug     = flag.Bool("debug", false, "log debug messages")
+		flListen    = flag.String("listen", ":9001", "HTTP listen address")
+		flAPIKey    = flag.String("api", "", "API key for API endpoints")
+		flVersion   = flag.Bool("version", false, "print version and exit")
+		flStorage   = flag.String("storage", "filekv", "storage backend")
+		flDSN       = flag.String("storage-dsn", "", "storage backend data source name")
+		flOptions   = flag.String("storage-options", "", "storage backend options")
+		flKeyFile   = flag.String("storage-key-file", "", "path to key file for encrypting secrets at rest")
+		flReencrypt = flag.Bool("storage-reencrypt", false, "re-encrypt stored secrets with the current key and exit")
+		flCache     = flag.Bool("proxy-cache", false, "cache responses of read-only DEP endpoints in the proxy")
+		flCacheTTLs = flag.String("proxy-cache-ttls", "", "comma-separated endpoint=duration proxy cache TTLs")
+		flPolicy    = flag.String("proxy-policy", "", "path to JSON proxy endpoint policy file")
+		flURLTTL    = flag.Duration("proxy-url-ttl", proxy.DefaultURLCacheTTL, "duration to cache DEP name base URLs in the proxy (negative to disable)")
+		flURLPoll   = flag.Duration("proxy-url-poll", proxy.DefaultURLCachePollInterval, "interval to poll storage for updated DEP names to invalidate cached base URLs (0 to disable)")
+		flSync      = flag.Bool("sync", false, "run the DEP device syncer and assigner")
+		flSyncNames = flag.String("sync-names", "", "comma-separated DEP names to sync (empty to discover DEP names with tokens)")
+		flSyncDur   = flag.Duration("sync-duration", 30*time.Minute, "duration between DEP syncs and DEP name discoveries")
+		flSyncLimit = flag.Int("sync-limit", 0, "limit fetch and sync calls to this many devices (0 for server default)")
+		flWebhook   = flag.String("sync-webhook-url", "", "URL to send DEP sync requests to")
+		flTLSCert   = flag.String("tls-cert", "", "path to PEM TLS server certificate (enables TLS)")
+		flTLSKey    = flag.String("tls-key", "", "path to PEM TLS server private key")
+		flClientCA  = flag.String("tls-client-ca", "", "path to PEM CA certificates for verifying TLS client certificates")
+		flClientMap = flag.String("tls-client-map", "", "path to JSON TLS client certificate identity map")
+		flOSBetaTTL = flag.Duration("osbeta-ttl", osbeta.DefaultTTL, "duration to cache OS beta enrollment tokens before refreshing them")
+		flTimeout   = flag.Duration("shutdown-timeout", 30*time.Second, "maximum duration to wait for in-flight requests and syncs on shutdown")
 	)
 	envflag.Parse("NANODEP_", []string{"version"})
 
@@ -55,12 +102,30 @@ func main() {
 		return
 	}
 
-	if *flAPIKey == "" {
+	if *flReencrypt && *flKeyFile == "" {
+		fmt.Fprintf(flag.CommandLine.Output(), "re-encrypting requires a storage key file\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *flAPIKey == "" && *flClientMap == "" && !*flReencrypt {
 		fmt.Fprintf(flag.CommandLine.Output(), "empty API key\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if (*flTLSCert == "") != (*flTLSKey == "") {
+		fmt.Fprintf(flag.CommandLine.Output(), "both TLS certificate and key required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *flClientMap != "" && (*flClientCA == "" || *flTLSCert == "") {
+		fmt.Fprintf(flag.CommandLine.Output(), "TLS client certificate map requires TLS and a client CA\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	level := stdslog.LevelInfo
 	if *flDebug {
 		level = stdslog.LevelDebug
@@ -72,45 +137,361 @@ func main() {
 		logger.Info("msg", "creating storage backend", "err", err)
 		os.Exit(1)
 	}
+	// the unwrapped storage backend is polled for updated DEP names
+	backend := storage
+	optStorage := newOptionalStorage(backend, logger)
+
+	if *flKeyFile != "" {
+		encStorage, err := cli.EncryptedStorage(storage, *flKeyFile)
+		if err != nil {
+			logger.Info("msg", "creating encrypted storage", "err", err)
+			os.Exit(1)
+		}
+		if *flReencrypt {
+			count, err := encStorage.Reencrypt(context.Background())
+			if err != nil {
+				logger.Info("msg", "re-encrypting storage", "count", count, "err", err)
+				os.Exit(1)
+			}
+			logger.Info("msg", "re-encrypted storage", "count", count)
+			return
+		}
+		storage = encStorage
+		if optStorage.escrow != nil {
+			// escrowed bypass codes are encrypted at rest
+			optStorage.escrow = encStorage
+		}
+	} else if optStorage.escrow != nil {
+		// only escrow bypass codes if they are encrypted at rest
+		logger.Info("msg", "bypass code escrow disabled", "reason", "requires -storage-key-file")
+		optStorage.escrow = nil
+	}
+
+	// record the change history of tokens, config, and assigner profiles
+	if optStorage.history != nil {
+		storage = history.New(
+			storage,
+			optStorage.history,
+			history.WithActorFunc(dephttp.AuthIdentity),
+			history.WithLogger(logger.With("component", "history")),
+		)
+	}
+
+	// re-apply the account-driven enrollment MDM service discovery URL
+	// of DEP names when their tokens are renewed
+	storage = servicediscovery.New(
+		storage,
+		godep.NewClient(storage),
+		servicediscovery.WithLogger(logger.With("component", "service-discovery")),
+	)
+
+	var policy *proxy.PolicyConfig
+	if *flPolicy != "" {
+		policy, err = loadPolicy(*flPolicy)
+		if err != nil {
+			logger.Info("msg", "loading proxy policy", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var respCache *proxy.ResponseCache
+	if *flCache {
+		ttls, err := proxy.ParseResponseCacheTTLs(*flCacheTTLs)
+		if err != nil {
+			logger.Info("msg", "parsing proxy cache TTLs", "err", err)
+			os.Exit(1)
+		}
+		respCache = proxy.NewResponseCache(ttls)
+	}
+
+	// the proxy URL cache is shared so that config changes can invalidate it
+	urlCache := proxy.NewURLCache(storage, *flURLTTL)
+	stopURLPoll := func() {}
+	if *flURLTTL >= 0 && *flURLPoll > 0 {
+		// keeps multiple depserver instances sharing storage consistent
+		stopURLPoll = pollURLCacheUpdates(urlCache, backend, *flURLPoll, logger.With("component", "proxy-url-cache"))
+	}
 
 	mux := http.NewServeMux()
 
 	mux.Handle(endpointVersion, dephttp.VersionHandler(version))
 
+	// health endpoints are unauthenticated for use by orchestrators
+	readiness := newReadiness(storage)
+	mux.Handle(endpointHealth, dephttp.HealthHandler())
+	mux.Handle(endpointReady, dephttp.ReadyHandler(readiness, logger.With("handler", "readyz")))
+
+	var tlsReloader *dephttp.TLSReloader
+	if *flTLSCert != "" {
+		tlsReloader, err = dephttp.NewTLSReloader(*flTLSCert, *flTLSKey, *flClientCA)
+		if err != nil {
+			logger.Info("msg", "loading TLS certificates", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var certMapper *auth.CertMapper
+	if *flClientMap != "" {
+		identities, err := loadCertIdentities(*flClientMap)
+		if err == nil {
+			certMapper, err = auth.NewCertMapper(identities)
+		}
+		if err != nil {
+			logger.Info("msg", "loading client certificate map", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if tlsReloader != nil || certMapper != nil {
+		reloadOnHUP(tlsReloader, certMapper, *flClientMap, logger.With("component", "tls"))
+	}
+
+	authenticator := auth.NewAuthenticator(optStorage.apiKeys, apiUsername, *flAPIKey, auth.WithCertMapper(certMapper))
+	authLogger := logger.With("handler", "auth")
+
 	handleStrippedAPI := func(handler http.Handler, endpoint string) {
 		handler = http.StripPrefix(endpoint, handler)
-		handler = dephttp.BasicAuthMiddleware(handler, apiUsername, *flAPIKey, "depserver")
+		handler = auth.Middleware(handler, authenticator, "depserver", authLogger)
 		mux.Handle(endpoint, handler)
 	}
 
+	// scoped requires the API identity to have scope for the DEP name
+	scoped := func(handler http.Handler, scope string) http.Handler {
+		return auth.RequireScope(handler, scope, authLogger)
+	}
+
+	// audit records mutating API requests to the audit log
+	audit := func(handler http.Handler, endpoint string) http.Handler {
+		if optStorage.audit == nil {
+			return handler
+		}
+		return apinext.NewAuditAPIMiddleware(handler, optStorage.audit, endpoint, logger.With("handler", "audit"))
+	}
+
+	// auditAdmin records mutating API requests whose URL path is not a
+	// DEP name to the audit log
+	auditAdmin := func(handler http.Handler, endpoint string) http.Handler {
+		if optStorage.audit == nil {
+			return handler
+		}
+		return apinext.NewAuditAdminAPIMiddleware(handler, optStorage.audit, endpoint, logger.With("handler", "audit"))
+	}
+
+	// auditAll records all API requests to the audit log
+	auditAll := func(handler http.Handler, endpoint string) http.Handler {
+		if optStorage.audit == nil {
+			return handler
+		}
+		return apinext.NewAuditAllAPIMiddleware(handler, optStorage.audit, endpoint, logger.With("handler", "audit"))
+	}
+
+	// storing tokens may change what the DEP API returns for a DEP name
+	var tokenStore api.AuthTokensStore = storage
+	if respCache != nil {
+		tokenStore = proxy.NewFlushingAuthTokensStore(storage, respCache)
+	}
+
 	tokensMux := dephttp.NewMethodMux()
-	tokensMux.Handle("PUT", api.StoreAuthTokensHandler(storage, logger.With("handler", "store-auth-tokens")))
-	tokensMux.Handle("GET", api.RetrieveAuthTokensHandler(storage, logger.With("handler", "retrieve-auth-tokens")))
+	tokensMux.Handle("PUT", audit(scoped(api.StoreAuthTokensHandler(tokenStore, logger.With("handler", "store-auth-tokens"), optStorage.tokensOptions(storage)...), auth.ScopeTokensWrite), endpointTokens))
+	tokensMux.Handle("GET", scoped(api.RetrieveAuthTokensHandler(storage, logger.With("handler", "retrieve-auth-tokens")), auth.ScopeTokensRead))
 	handleStrippedAPI(tokensMux, endpointTokens)
 
 	configMux := dephttp.NewMethodMux()
-	configMux.Handle("GET", api.RetrieveConfigHandler(storage, logger.With("handler", "retrieve-config")))
-	configMux.Handle("PUT", api.StoreConfigHandler(storage, logger.With("handler", "store-config")))
+	configMux.Handle("GET", scoped(api.RetrieveConfigHandler(storage, logger.With("handler", "retrieve-config")), auth.ScopeConfigRead))
+	configMux.Handle("PUT", audit(scoped(api.StoreConfigHandler(
+		proxy.NewInvalidatingConfigStorer(storage, urlCache, respCache),
+		logger.With("handler", "store-config"),
+		api.WithConfigRetriever(storage),
+	), auth.ScopeConfigWrite), endpointConfig))
 	handleStrippedAPI(configMux, endpointConfig)
 
 	tokenPKIMux := dephttp.NewMethodMux()
-	tokenPKIMux.Handle("GET", api.GetCertTokenPKIHandler(storage, logger.With("handler", "get-token-pki")))
-	tokenPKIMux.Handle("PUT", api.DecryptTokenPKIHandler(storage, storage, logger.With("handler", "put-token-pki")))
+	// generating the token PKI replaces the staging PKI so requires write scope
+	tokenPKIMux.Handle("GET", scoped(api.GetCertTokenPKIHandler(storage, logger.With("handler", "get-token-pki")), auth.ScopeTokensWrite))
+	tokenPKIMux.Handle("PUT", audit(scoped(api.DecryptTokenPKIHandler(storage, tokenStore, logger.With("handler", "put-token-pki"), optStorage.tokensOptions(storage)...), auth.ScopeTokensWrite), endpointTokenPKI))
 	handleStrippedAPI(tokenPKIMux, endpointTokenPKI)
 
 	assignerMux := dephttp.NewMethodMux()
-	assignerMux.Handle("GET", api.RetrieveAssignerProfileHandler(storage, logger.With("handler", "retrieve-assigner-profile")))
-	assignerMux.Handle("PUT", api.StoreAssignerProfileHandler(storage, logger.With("handler", "store-assigner-profile")))
+	assignerMux.Handle("GET", scoped(api.RetrieveAssignerProfileHandler(storage, logger.With("handler", "retrieve-assigner-profile")), auth.ScopeConfigRead))
+	assignerMux.Handle("PUT", audit(scoped(api.StoreAssignerProfileHandler(storage, logger.With("handler", "store-assigner-profile")), auth.ScopeConfigWrite), endpointAssigner))
 	handleStrippedAPI(assignerMux, endpointAssigner)
 
 	namesMux := dephttp.NewMethodMux()
-	namesMux.Handle("GET", apinext.NewQueryDEPNamesHandler(storage, logger.With("handler", "query-dep-names")))
-	handleStrippedAPI(namesMux, "/v1/dep_names")
+	namesMux.Handle("GET", auth.RequireGlobalScope(apinext.NewQueryDEPNamesHandler(storage, logger.With("handler", "query-dep-names")), auth.ScopeConfigRead, authLogger))
+	handleStrippedAPI(namesMux, endpointDEPNames)
 
+	if optStorage.deleter != nil {
+		nameMux := dephttp.NewMethodMux()
+		nameMux.Handle("DELETE", audit(scoped(apinext.NewDeleteDEPNameHandler(
+			proxy.NewInvalidatingDEPNameDeleter(optStorage.deleter, urlCache, respCache),
+			logger.With("handler", "delete-dep-name"),
+		), auth.ScopeAdmin), endpointDEPName))
+		handleStrippedAPI(nameMux, endpointDEPName)
+	}
+
+	if optStorage.history != nil {
+		historyMux := dephttp.NewMethodMux()
+		historyMux.Handle("GET", scoped(apinext.NewQueryHistoryHandler(optStorage.history, logger.With("handler", "query-history")), auth.ScopeConfigRead))
+		handleStrippedAPI(historyMux, endpointHistory)
+	}
+
+	if optStorage.auditQuery != nil {
+		auditMux := dephttp.NewMethodMux()
+		auditMux.Handle("GET", auth.RequireGlobalScope(apinext.NewQueryAuditHandler(optStorage.auditQuery, logger.With("handler", "query-audit")), auth.ScopeAdmin, authLogger))
+		handleStrippedAPI(auditMux, endpointAudit)
+	}
+
+	if optStorage.apiKeys != nil {
+		apiKeysMux := dephttp.NewMethodMux()
+		apiKeysMux.Handle("GET", apinext.NewGetAPIKeysHandler(optStorage.apiKeys, logger.With("handler", "get-api-keys")))
+		apiKeysMux.Handle("PUT", auditAdmin(apinext.NewStoreAPIKeyHandler(optStorage.apiKeys, apiUsername, logger.With("handler", "store-api-key")), endpointAPIKeys))
+		apiKeysMux.Handle("DELETE", auditAdmin(apinext.NewDeleteAPIKeyHandler(optStorage.apiKeys, logger.With("handler", "delete-api-key")), endpointAPIKeys))
+		// API key names are not DEP names
+		handleStrippedAPI(auth.RequireGlobalScope(apiKeysMux, auth.ScopeAdmin, authLogger), endpointAPIKeys)
+		handleStrippedAPI(auth.RequireGlobalScope(apiKeysMux, auth.ScopeAdmin, authLogger), endpointAPIKeysList)
+	}
+
+	// exports disclose secrets so are audited even though they are reads
+	exportMux := dephttp.NewMethodMux()
+	exportMux.Handle("GET", auditAll(apinext.NewExportHandler(storage, logger.With("handler", "export")), endpointExport))
+	handleStrippedAPI(auth.RequireGlobalScope(exportMux, auth.ScopeAdmin, authLogger), endpointExport)
+
+	// importing may overwrite DEP names which requires deleting them
+	if optStorage.deleter != nil {
+		importMux := dephttp.NewMethodMux()
+		importMux.Handle("POST", audit(apinext.NewImportHandler(bundle.NewRestorer(storage, optStorage.deleter), logger.With("handler", "import")), endpointImport))
+		handleStrippedAPI(auth.RequireGlobalScope(importMux, auth.ScopeAdmin, authLogger), endpointImport)
+	}
+
+	depClient := godep.NewClient(storage)
+
+	// post wraps handler to only allow the POST method
+	post := func(handler http.Handler) http.Handler {
+		methodMux := dephttp.NewMethodMux()
+		methodMux.Handle("POST", handler)
+		return methodMux
+	}
+
+	if optStorage.history != nil {
+		handleStrippedAPI(post(audit(scoped(apinext.NewRollbackHandler(
+			optStorage.history,
+			proxy.NewInvalidatingConfigStorer(storage, urlCache, respCache),
+			storage,
+			logger.With("handler", "rollback"),
+		), auth.ScopeConfigWrite), endpointRollback)), endpointRollback)
+	}
+
+	// service discovery changes both the config and the DEP API so require both scopes
+	sdMux := dephttp.NewMethodMux()
+	sdMux.Handle("GET", scoped(scoped(apinext.NewGetServiceDiscoveryHandler(depClient, storage, logger.With("handler", "get-service-discovery")), auth.ScopeConfigRead), auth.ScopeProxyRead))
+	sdMux.Handle("PUT", audit(scoped(scoped(apinext.NewAssignServiceDiscoveryHandler(depClient, storage, logger.With("handler", "assign-service-discovery")), auth.ScopeConfigWrite), auth.ScopeProxyWrite), endpointServiceDiscovery))
+	sdMux.Handle("DELETE", audit(scoped(scoped(apinext.NewRemoveServiceDiscoveryHandler(depClient, storage, logger.With("handler", "remove-service-discovery")), auth.ScopeConfigWrite), auth.ScopeProxyWrite), endpointServiceDiscovery))
+	handleStrippedAPI(sdMux, endpointServiceDiscovery)
+
+	// device actions are DEP API operations so use the proxy scopes
+	devicesMux := dephttp.NewSuffixMux()
+	devicesMux.Handle("details", post(scoped(apinext.NewDeviceDetailsHandler(depClient, logger.With("handler", "device-details")), auth.ScopeProxyRead)))
+	devicesMux.Handle("assign", post(audit(scoped(apinext.NewAssignProfileHandler(depClient, logger.With("handler", "assign-profile")), auth.ScopeProxyWrite), endpointDevices+"assign")))
+	devicesMux.Handle("unassign", post(audit(scoped(apinext.NewUnassignProfileHandler(depClient, logger.With("handler", "unassign-profile")), auth.ScopeProxyWrite), endpointDevices+"unassign")))
+	devicesMux.Handle("disown", post(audit(scoped(scoped(apinext.NewDisownDevicesHandler(depClient, logger.With("handler", "disown-devices")), auth.ScopeDisown), auth.ScopeProxyWrite), endpointDevices+"disown")))
+	devicesMux.Handle("activationlock", post(audit(scoped(apinext.NewActivationLockHandler(depClient, logger.With("handler", "activation-lock")), auth.ScopeProxyWrite), endpointDevices+"activationlock")))
+	if optStorage.escrow != nil {
+		devicesMux.Handle("escrowlock", post(audit(scoped(apinext.NewEscrowActivationLockHandler(depClient, optStorage.escrow, logger.With("handler", "escrow-activation-lock")), auth.ScopeProxyWrite), endpointDevices+"escrowlock")))
+
+		// escrowed bypass codes are secrets so reads are audited
+		escrowMux := dephttp.NewMethodMux()
+		escrowMux.Handle("GET", auditAll(
+			scoped(apinext.NewRetrieveBypassCodesHandler(optStorage.escrow, logger.With("handler", "retrieve-bypass-codes")), auth.ScopeEscrowRead),
+			endpointEscrow,
+		))
+		handleStrippedAPI(escrowMux, endpointEscrow)
+	}
+	handleStrippedAPI(devicesMux, endpointDevices)
+
+	// the account detail may be fetched from the DEP API so use the proxy scope
+	if optStorage.accountDetail != nil {
+		accountMux := dephttp.NewMethodMux()
+		accountMux.Handle("GET", scoped(apinext.NewAccountDetailHandler(depClient, optStorage.accountDetail, logger.With("handler", "account-detail")), auth.ScopeProxyRead))
+		handleStrippedAPI(accountMux, endpointAccount)
+	}
+
+	// the OS beta enrollment tokens cache refreshes the DEP names with
+	// cached tokens in the background until shutdown
+	stopOSBeta := func() {}
+	if optStorage.osBeta != nil {
+		osBetaCache := osbeta.New(
+			depClient,
+			optStorage.osBeta,
+			osbeta.WithTTL(*flOSBetaTTL),
+			osbeta.WithLogger(logger.With("component", "osbeta-cache")),
+		)
+		var osBetaCtx context.Context
+		osBetaCtx, stopOSBeta = context.WithCancel(context.Background())
+		go func() {
+			if err := osBetaCache.Run(osBetaCtx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Info("msg", "OS beta tokens cache run", "err", err)
+			}
+		}()
+		osBetaMux := dephttp.NewMethodMux()
+		osBetaMux.Handle("GET", scoped(apinext.NewOSBetaTokensHandler(osBetaCache, logger.With("handler", "osbeta-tokens")), auth.ScopeProxyRead))
+		handleStrippedAPI(osBetaMux, endpointOSBeta)
+	}
+
+	// stopSync stops the sync manager (if running) and waits for it
+	var stopSync func(context.Context)
+
+	if *flSync {
+		syncManager := newSyncManager(depClient, storage, *flSyncNames, *flSyncDur, *flSyncLimit, *flWebhook, logger)
+		syncCtx, cancelSync := context.WithCancel(context.Background())
+		syncDone := make(chan struct{})
+		go func() {
+			defer close(syncDone)
+			if err := syncManager.Run(syncCtx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Info("msg", "sync manager run", "err", err)
+			}
+		}()
+		stopSync = func(ctx context.Context) {
+			cancelSync()
+			select {
+			case <-syncDone:
+			case <-ctx.Done():
+				logger.Info("msg", "timed out waiting for syncers")
+			}
+		}
+
+		// syncing may assign profiles so use the proxy write scope
+		handleStrippedAPI(post(audit(scoped(apinext.NewSyncNowHandler(syncManager, logger.With("handler", "sync-now")), auth.ScopeProxyWrite), endpointSync)), endpointSync)
+	}
+
+	// defining profiles are DEP API operations so use the proxy scopes
+	profileActionsMux := dephttp.NewSuffixMux()
+	profileActionsMux.Handle("define", audit(scoped(apinext.NewDefineProfileHandler(depClient, optStorage.templates, nil, logger.With("handler", "define-profile")), auth.ScopeProxyWrite), endpointProfiles+"define"))
+	profileActionsMux.Handle("assigner", audit(scoped(scoped(apinext.NewDefineProfileHandler(depClient, optStorage.templates, storage, logger.With("handler", "define-assigner-profile")), auth.ScopeConfigWrite), auth.ScopeProxyWrite), endpointProfiles+"assigner"))
+	profilesMux := dephttp.NewMethodMux()
+	profilesMux.Handle("GET", scoped(apinext.NewGetProfileHandler(depClient, logger.With("handler", "get-profile")), auth.ScopeProxyRead))
+	profilesMux.Handle("POST", profileActionsMux)
+	handleStrippedAPI(profilesMux, endpointProfiles)
+
+	if optStorage.templates != nil {
+		templatesMux := dephttp.NewMethodMux()
+		templatesMux.Handle("GET", auth.RequireGlobalScope(apinext.NewGetProfileTemplatesHandler(optStorage.templates, logger.With("handler", "get-profile-templates")), auth.ScopeConfigRead, authLogger))
+		templatesMux.Handle("PUT", auditAdmin(auth.RequireGlobalScope(apinext.NewStoreProfileTemplateHandler(optStorage.templates, logger.With("handler", "store-profile-template")), auth.ScopeConfigWrite, authLogger), endpointTemplates))
+		templatesMux.Handle("DELETE", auditAdmin(auth.RequireGlobalScope(apinext.NewDeleteProfileTemplateHandler(optStorage.templates, logger.With("handler", "delete-profile-template")), auth.ScopeConfigWrite, authLogger), endpointTemplates))
+		// profile template names are not DEP names
+		handleStrippedAPI(templatesMux, endpointTemplates)
+		handleStrippedAPI(templatesMux, endpointTemplatesList)
+	}
+
+	// the bypass code generator is not specific to a DEP name nor
+	// accesses any stored data so only requires authentication
 	handleStrippedAPI(api.NewBypassCodeHandler(), endpointALBC)
 
+	var maidJWTOpts []api.MAIDJWTOption
+	if optStorage.accountDetail != nil {
+		maidJWTOpts = append(maidJWTOpts, api.WithMAIDJWTAccountDetail(optStorage.accountDetail))
+	}
 	handleStrippedAPI(
-		api.NewMAIDJWTHandler(storage, logger.With("handler", "get-maid-jwt"), uuid.NewString),
+		scoped(api.NewMAIDJWTHandler(storage, logger.With("handler", "get-maid-jwt"), uuid.NewString, maidJWTOpts...), auth.ScopeProxyRead),
 		endpointMAIDJWT,
 	)
 
@@ -118,18 +499,54 @@ func main() {
 		client.NewTransport(http.DefaultTransport, http.DefaultClient, storage, nil),
 		storage,
 		logger.With("component", "proxy"),
+		proxy.WithURLCache(urlCache),
 	)
-	var proxyHandler http.Handler = proxy.ProxyDEPNameHandler(p, logger.With("handler", "proxy"))
+	var proxyHandler http.Handler = p
+	if respCache != nil {
+		proxyHandler = proxy.ResponseCacheMiddleware(proxyHandler, respCache, logger.With("handler", "proxy-cache"))
+	}
+	// the policy middleware also answers dry-runs requested by clients
+	proxyHandler = proxy.PolicyMiddleware(proxyHandler, policy, logger.With("handler", "proxy-policy"))
+	proxyHandler = auth.RequireProxyScope(proxyHandler, authLogger)
+	if optStorage.audit != nil {
+		proxyHandler = apinext.NewAuditProxyMiddleware(proxyHandler, optStorage.audit, logger.With("handler", "audit"))
+	}
+	proxyHandler = proxy.ProxyDEPNameHandler(proxyHandler, logger.With("handler", "proxy"))
 	proxyHandler = http.StripPrefix(endpointProxy, proxyHandler)
 	proxyHandler = DelHeaderMiddleware(proxyHandler, "Authorization")
-	proxyHandler = dephttp.BasicAuthMiddleware(proxyHandler, apiUsername, *flAPIKey, "depserver")
+	proxyHandler = auth.Middleware(proxyHandler, authenticator, "depserver", authLogger)
 	mux.Handle(endpointProxy, proxyHandler)
 
 	// init for newTraceID()
 	rand.Seed(time.Now().UnixNano())
 
-	logger.Info("msg", "starting server", "listen", *flListen)
-	err = http.ListenAndServe(*flListen, dephttp.TraceLoggingMiddleware(mux, logger.With("handler", "log"), newTraceID))
+	srv := &http.Server{
+		Addr:    *flListen,
+		Handler: dephttp.TraceLoggingMiddleware(mux, logger.With("handler", "log"), newTraceID),
+	}
+
+	shutdownDone := make(chan struct{})
+	shutdownOnSignal(srv, readiness, *flTimeout, func(ctx context.Context) {
+		defer close(shutdownDone)
+		stopOSBeta()
+		stopURLPoll()
+		if stopSync != nil {
+			stopSync(ctx)
+		}
+	}, logger)
+
+	logger.Info("msg", "starting server", "listen", *flListen, "tls", tlsReloader != nil)
+	if tlsReloader != nil {
+		srv.TLSConfig = tlsReloader.Config()
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		// wait for the graceful shutdown to complete
+		<-shutdownDone
+		err = nil
+	}
 	logs := []interface{}{"msg", "server shutdown"}
 	if err != nil {
 		logs = append(logs, "err", err)
@@ -147,6 +564,19 @@ func newTraceID() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// loadPolicy reads and validates the JSON proxy policy file at path.
+func loadPolicy(path string) (*proxy.PolicyConfig, error) {
+	policyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(proxy.PolicyConfig)
+	if err = json.Unmarshal(policyBytes, policy); err != nil {
+		return nil, fmt.Errorf("decoding policy: %w", err)
+	}
+	return policy, policy.Validate()
+}
+
 // DelHeaderMiddleware deletes header from the HTTP request headers before calling h.
 func DelHeaderMiddleware(h http.Handler, header string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
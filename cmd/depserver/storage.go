@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// optionalStorage contains the optional interfaces implemented by the
+// storage backend. Interfaces not implemented by the backend are nil and
+// the features which require them are disabled.
+type optionalStorage struct {
+	audit         storage.AuditStorer
+	auditQuery    storage.AuditQuery
+	history       storage.HistoryStorer
+	escrow        storage.BypassCodeEscrowStorer
+	osBeta        storage.OSBetaTokensCacheStorer
+	apiKeys       storage.APIKeyStorer
+	deleter       storage.DEPNameDeleter
+	templates     storage.ProfileTemplateStorer
+	accountDetail api.AccountDetailStore
+	bindings      api.DEPNameBindingsFinder
+}
+
+// newOptionalStorage finds the optional interfaces implemented by store.
+// Unsupported features are logged using logger.
+func newOptionalStorage(store storage.AllStorage, logger log.Logger) *optionalStorage {
+	s := new(optionalStorage)
+	s.audit, _ = store.(storage.AuditStorer)
+	s.auditQuery, _ = store.(storage.AuditQuery)
+	s.history, _ = store.(storage.HistoryStorer)
+	s.escrow, _ = store.(storage.BypassCodeEscrowStorer)
+	s.osBeta, _ = store.(storage.OSBetaTokensCacheStorer)
+	s.apiKeys, _ = store.(storage.APIKeyStorer)
+	s.deleter, _ = store.(storage.DEPNameDeleter)
+	s.templates, _ = store.(storage.ProfileTemplateStorer)
+	s.accountDetail, _ = store.(api.AccountDetailStore)
+	s.bindings, _ = store.(api.DEPNameBindingsFinder)
+
+	for _, feature := range []struct {
+		name      string
+		supported bool
+	}{
+		{"audit log", s.audit != nil && s.auditQuery != nil},
+		{"change history", s.history != nil},
+		{"bypass code escrow", s.escrow != nil},
+		{"OS beta tokens cache", s.osBeta != nil},
+		{"API keys", s.apiKeys != nil},
+		{"deleting DEP names", s.deleter != nil},
+		{"profile templates", s.templates != nil},
+		{"account detail", s.accountDetail != nil},
+		{"DEP name bindings", s.bindings != nil},
+	} {
+		if !feature.supported {
+			logger.Info("msg", "storage does not support feature", "feature", feature.name)
+		}
+	}
+	return s
+}
+
+// tokensOptions returns the options of the handlers that store OAuth1
+// tokens supported by the storage backend.
+func (s *optionalStorage) tokensOptions(config client.ConfigRetriever) []api.TokensOption {
+	var opts []api.TokensOption
+	if s.accountDetail != nil {
+		opts = append(opts, api.WithAccountDetail(struct {
+			client.ConfigRetriever
+			api.AccountDetailStorer
+		}{config, s.accountDetail}))
+	}
+	if s.bindings != nil {
+		opts = append(opts, api.WithDEPNameBindings(s.bindings))
+	}
+	return opts
+}
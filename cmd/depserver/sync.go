@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage"
+	depsync "github.com/micromdm/nanodep/sync"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// newSyncManager creates the embedded DEP sync manager.
+// If names is empty then DEP names with tokens are discovered from store.
+func newSyncManager(client *godep.Client, store storage.AllStorage, names string, duration time.Duration, limit int, webhookURL string, logger log.Logger) *depsync.Manager {
+	opts := []depsync.ManagerOption{
+		depsync.WithManagerLogger(logger),
+		depsync.WithManagerDuration(duration),
+	}
+	if names != "" {
+		opts = append(opts, depsync.WithDEPNames(strings.Split(names, ",")...))
+	} else {
+		opts = append(opts, depsync.WithDiscovery(discoverDEPNames(store)))
+	}
+	if limit > 0 {
+		opts = append(opts, depsync.WithSyncerOptions(depsync.WithLimit(limit)))
+	}
+	if webhookURL != "" {
+		webhook := depsync.NewWebhook(webhookURL)
+		opts = append(opts, depsync.WithManagerCallback(webhook.CallWebhook))
+	}
+	return depsync.NewManager(client, store, opts...)
+}
+
+// discoverDEPNames returns a discovery function that returns all DEP
+// names in store that have OAuth tokens.
+// This includes DEP names without a token PKI.
+func discoverDEPNames(store storage.DEPNamesQuery) depsync.DiscoverFunc {
+	return func(ctx context.Context) ([]string, error) {
+		names, err := storage.ListDEPNames(ctx, store)
+		if err != nil || len(names) < 1 {
+			// an empty DEP names filter would match all DEP names
+			return nil, err
+		}
+		hasTokens := true
+		return storage.AllDEPNames(ctx, store, &storage.DEPNamesQueryFilter{DEPNames: names, HasTokens: &hasTokens})
+	}
+}
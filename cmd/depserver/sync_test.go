@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/cryptoutil"
+	"github.com/micromdm/nanodep/storage/inmem"
+	"github.com/micromdm/nanodep/tokenpki"
+)
+
+func TestDiscoverDEPNames(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	// no DEP names
+	names, err := discoverDEPNames(store)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) > 0 {
+		t.Errorf("expected no DEP names: %v", names)
+	}
+
+	// a DEP name with only tokens
+	if err = store.StoreAuthTokens(ctx, "a", &client.OAuth1Tokens{ConsumerKey: "ck"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a DEP name with only a token PKI
+	key, cert, err := tokenpki.SelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.StoreTokenPKI(ctx, "b", cryptoutil.PEMCertificate(cert.Raw), cryptoutil.PEMRSAPrivateKey(key)); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err = discoverDEPNames(store)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := names, []string{"a"}; !slices.Equal(have, want) {
+		t.Errorf("names: have %v, want %v", have, want)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/http/auth"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// loadCertIdentities reads the JSON TLS client certificate identity
+// mapping file at path.
+func loadCertIdentities(path string) ([]auth.CertIdentity, error) {
+	mapBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var identities []auth.CertIdentity
+	if err = json.Unmarshal(mapBytes, &identities); err != nil {
+		return nil, fmt.Errorf("decoding client certificate map: %w", err)
+	}
+	return identities, nil
+}
+
+// reloadOnHUP reloads the TLS certificates and the TLS client certificate
+// identity mapping when the process receives a SIGHUP.
+// Either of tlsReloader or certMapper may be nil.
+func reloadOnHUP(tlsReloader *dephttp.TLSReloader, certMapper *auth.CertMapper, certMapPath string, logger log.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if tlsReloader != nil {
+				if err := tlsReloader.Reload(); err != nil {
+					logger.Info("msg", "reloading TLS certificates", "err", err)
+				} else {
+					logger.Info("msg", "reloaded TLS certificates")
+				}
+			}
+			if certMapper != nil {
+				identities, err := loadCertIdentities(certMapPath)
+				if err == nil {
+					err = certMapper.Set(identities)
+				}
+				if err != nil {
+					logger.Info("msg", "reloading client certificate map", "err", err)
+				} else {
+					logger.Info("msg", "reloaded client certificate map", "identities", len(identities))
+				}
+			}
+		}
+	}()
+}
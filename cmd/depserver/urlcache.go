@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/proxy"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// pollURLCacheUpdates starts polling store for updated DEP names to
+// invalidate their urlCache entries if store supports it. Returns a
+// function that stops polling.
+func pollURLCacheUpdates(urlCache *proxy.URLCache, store storage.AllStorage, interval time.Duration, logger log.Logger) (stop func()) {
+	query, ok := store.(storage.DEPNamesUpdatedQuery)
+	if !ok {
+		logger.Debug("msg", "storage does not support polling for updated DEP names")
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := urlCache.PollUpdates(ctx, query, interval, logger); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Info("msg", "polling updated DEP names", "err", err)
+		}
+	}()
+	return cancel
+}
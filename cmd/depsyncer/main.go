@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	stdlog "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -13,6 +15,8 @@ import (
 
 	"github.com/micromdm/nanodep/cli"
 	"github.com/micromdm/nanodep/godep"
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/storage"
 	depsync "github.com/micromdm/nanodep/sync"
 
 	"github.com/micromdm/nanolib/log/stdlogfmt"
@@ -34,8 +38,11 @@ func main() {
 		flStorage = flag.String("storage", "filekv", "storage backend")
 		flDSN     = flag.String("storage-dsn", "", "storage backend data source name")
 		flOptions = flag.String("storage-options", "", "storage backend options")
+		flKeyFile = flag.String("storage-key-file", "", "path to key file for encrypting secrets at rest")
 		flWebhook = flag.String("webhook-url", "", "URL to send requests to")
 		flUA      = flag.String("user-agent", godep.UserAgent, "User-Agent string to use")
+		flListen  = flag.String("listen", "", "HTTP listen address for health endpoints (empty to disable)")
+		flTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "maximum duration to wait for in-flight assigner and webhook calls on shutdown")
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <DEPname1> [DEPname2 [...]]\nFlags:\n", os.Args[0])
@@ -59,19 +66,44 @@ func main() {
 		stdlogfmt.WithDebugFlag(*flDebug),
 	)
 
-	storage, err := cli.Storage(*flStorage, *flDSN, *flOptions)
+	store, err := cli.Storage(*flStorage, *flDSN, *flOptions)
 	if err != nil {
 		logger.Info("msg", "creating storage backend", "err", err)
 		os.Exit(1)
 	}
 
-	var webhook *Webhook
+	if *flKeyFile != "" {
+		store, err = cli.EncryptedStorage(store, *flKeyFile)
+		if err != nil {
+			logger.Info("msg", "creating encrypted storage", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var webhook *depsync.Webhook
 	if *flWebhook != "" {
-		webhook = NewWebhook(*flWebhook)
+		webhook = depsync.NewWebhook(*flWebhook)
 	}
 
 	ctx, cancelCtx := context.WithCancel(context.Background())
 
+	readiness := dephttp.NewReadiness(func(ctx context.Context) error {
+		return storage.Ping(ctx, store)
+	})
+	var srv *http.Server
+	if *flListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", dephttp.HealthHandler())
+		mux.Handle("/readyz", dephttp.ReadyHandler(readiness, logger.With("handler", "readyz")))
+		srv = &http.Server{Addr: *flListen, Handler: mux}
+		go func() {
+			logger.Info("msg", "starting health server", "listen", *flListen)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Info("msg", "health server", "err", err)
+			}
+		}()
+	}
+
 	// we keep an array of channels to broadcast our syncnow signal
 	// for each DEP name we're running a syncer for
 	var (
@@ -118,15 +150,19 @@ func main() {
 			case syscall.SIGHUP:
 				sendSyncNows()
 			case os.Interrupt, syscall.SIGTERM:
+				readiness.Drain()
 				cancelCtx()
 			}
 		}
 	}()
 
-	client := godep.NewClient(storage, godep.WithUserAgent(*flUA))
+	client := godep.NewClient(store, godep.WithUserAgent(*flUA))
 
 	var wg sync.WaitGroup
 
+	// tracks in-flight assigner and webhook calls
+	var cbWG sync.WaitGroup
+
 	for _, name := range flag.Args()[0:] {
 		// we're attaching this to a callback which is called from
 		// a goroutine. so we need to re-initialize the variable scope.
@@ -142,20 +178,26 @@ func main() {
 		assigner := depsync.NewAssigner(
 			client,
 			name,
-			storage,
+			store,
 			assignerOpts...,
 		)
 
 		// create the callback (that calls the assigner and webhook)
 		callback := func(ctx context.Context, isFetch bool, resp *godep.FetchDeviceResponseJson) error {
+			// finish processing the response even if we're shutting down
+			ctx = context.WithoutCancel(ctx)
+			cbWG.Add(1)
 			go func() {
+				defer cbWG.Done()
 				err := assigner.ProcessDeviceResponse(ctx, resp)
 				if err != nil {
 					logger.Info("msg", "assigner process device response", "err", err)
 				}
 			}()
 			if webhook != nil {
+				cbWG.Add(1)
 				go func() {
+					defer cbWG.Done()
 					err := webhook.CallWebhook(ctx, name, isFetch, resp)
 					if err != nil {
 						logger.Info("msg", "calling webhook", "err", err)
@@ -186,7 +228,7 @@ func main() {
 		syncer := depsync.NewSyncer(
 			client,
 			name,
-			storage,
+			store,
 			syncerOpts...,
 		)
 
@@ -203,4 +245,22 @@ func main() {
 	}
 
 	wg.Wait()
+
+	// wait for in-flight assigner and webhook calls
+	done := make(chan struct{})
+	go func() {
+		cbWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(*flTimeout):
+		logger.Info("msg", "timed out waiting for assigner and webhook calls")
+	}
+
+	if srv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *flTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}
 }
@@ -23,3 +23,28 @@ func (c *Client) AssignAccountDrivenEnrollmentProfile(ctx context.Context, name
 	}
 	return c.Do(ctx, name, http.MethodPost, "/account-driven-enrollment/profile", req, nil)
 }
+
+// AccountDrivenEnrollmentProfile uses the Apple "Get Account-Driven
+// Enrollment Service Discovery" API endpoint to get the MDM service
+// discovery URL of the assigned account-driven enrollment profile.
+// See https://developer.apple.com/documentation/devicemanagement/get-account-driven-enrollment-profile
+func (c *Client) AccountDrivenEnrollmentProfile(ctx context.Context, name string) (string, error) {
+	// the response has the same form as the assign request
+	resp := new(AccountDrivenEnrollmentProfileRequestJson)
+	err := c.Do(ctx, name, http.MethodGet, "/account-driven-enrollment/profile", nil, resp)
+	return resp.MdmServiceDiscoveryUrl, err
+}
+
+// RemoveAccountDrivenEnrollmentProfile uses the Apple "Remove
+// Account-Driven Enrollment Service Discovery" API endpoint to remove
+// the assigned account-driven enrollment profile.
+// See https://developer.apple.com/documentation/devicemanagement/remove-account-driven-enrollment-profile
+func (c *Client) RemoveAccountDrivenEnrollmentProfile(ctx context.Context, name string) error {
+	return c.Do(ctx, name, http.MethodDelete, "/account-driven-enrollment/profile", nil, nil)
+}
+
+// IsAccountDrivenEnrollmentProfileNotFound returns true if err indicates
+// no account-driven enrollment profile is assigned.
+func IsAccountDrivenEnrollmentProfileNotFound(err error) bool {
+	return httpErrorContains(err, http.StatusNotFound, "")
+}
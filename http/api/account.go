@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+)
+
+// AccountDetail is the DEP API account detail of a DEP name.
+type AccountDetail struct {
+	godep.AccountDetailJson
+
+	// FetchedAt is the time the account detail was fetched from the DEP API.
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+type AccountDetailStorer interface {
+	// StoreAccountDetail stores the account detail of name (DEP name).
+	// A nil detail clears any stored account detail.
+	StoreAccountDetail(ctx context.Context, name string, detail *AccountDetail) error
+}
+
+type AccountDetailRetriever interface {
+	// RetrieveAccountDetail retrieves the account detail of name (DEP name).
+	// If the DEP name or account detail does not exist then a nil
+	// account detail and nil error should be returned.
+	RetrieveAccountDetail(ctx context.Context, name string) (*AccountDetail, error)
+}
+
+type AccountDetailStore interface {
+	AccountDetailRetriever
+	AccountDetailStorer
+}
+
+// AccountDetailFetcher fetches the account detail of a DEP name.
+type AccountDetailFetcher interface {
+	AccountDetail(ctx context.Context, name string) (*godep.AccountDetailJson, error)
+}
+
+// FetchAccountDetail fetches the account detail of name (DEP name)
+// using fetcher.
+func FetchAccountDetail(ctx context.Context, fetcher AccountDetailFetcher, name string) (*AccountDetail, error) {
+	detail, err := fetcher.AccountDetail(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountDetail{AccountDetailJson: *detail, FetchedAt: time.Now().UTC()}, nil
+}
+
+// IsAuthError returns true if err indicates the DEP API rejected the
+// OAuth1 tokens of a DEP name.
+func IsAuthError(err error) bool {
+	var authErr *client.AuthError
+	return errors.As(err, &authErr)
+}
+
+// tokensClientStorage serves a single set of not yet stored OAuth1
+// tokens to a DEP API client.
+type tokensClientStorage struct {
+	client.ConfigRetriever
+	tokens *client.OAuth1Tokens
+}
+
+func (s *tokensClientStorage) RetrieveAuthTokens(context.Context, string) (*client.OAuth1Tokens, error) {
+	return s.tokens, nil
+}
+
+// AccountDetailTokensStore retrieves configs and stores account details.
+type AccountDetailTokensStore interface {
+	client.ConfigRetriever
+	AccountDetailStorer
+}
+
+// TokensOption configures the handlers that store DEP OAuth1 tokens.
+type TokensOption func(*tokensConfig)
+
+type tokensConfig struct {
+	detailStore    AccountDetailTokensStore
+	bindingsFinder DEPNameBindingsFinder
+}
+
+// WithAccountDetail verifies uploaded OAuth1 tokens by fetching the
+// account detail of the DEP name with them before they are stored.
+// Tokens the DEP API fails to authenticate are rejected. The account
+// detail is stored in store after the tokens are stored.
+func WithAccountDetail(store AccountDetailTokensStore) TokensOption {
+	return func(c *tokensConfig) {
+		c.detailStore = store
+	}
+}
+
+func newTokensConfig(opts []TokensOption) *tokensConfig {
+	c := new(tokensConfig)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// fetchAccountDetail fetches the account detail of name using tokens.
+// A nil account detail is returned if account details are not enabled.
+func (c *tokensConfig) fetchAccountDetail(ctx context.Context, name string, tokens *client.OAuth1Tokens) (*AccountDetail, error) {
+	if c.detailStore == nil {
+		return nil, nil
+	}
+	depClient := godep.NewClient(&tokensClientStorage{ConfigRetriever: c.detailStore, tokens: tokens})
+	return FetchAccountDetail(ctx, depClient, name)
+}
@@ -8,10 +8,15 @@ import (
 
 // jsonError writes err as JSON and to w.
 func jsonError(w http.ResponseWriter, err error) {
+	jsonErrorStatus(w, err, http.StatusInternalServerError)
+}
+
+// jsonErrorStatus writes err as JSON and to w with HTTP status.
+func jsonErrorStatus(w http.ResponseWriter, err error, status int) {
 	jsonErr := &struct {
 		Err string `json:"error"`
 	}{Err: err.Error()}
 	w.Header().Set("Content-type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(jsonErr)
 }
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// ErrDuplicateDEPServer occurs when incoming tokens are for a DEP server
+// (i.e. the MDM server in the ABM/ASM/BE portal) that is already bound
+// to another DEP name. Multiple DEP names syncing the same DEP server
+// contend over its device cursor and assigned profiles.
+var ErrDuplicateDEPServer = errors.New("DEP server already bound to other DEP names")
+
+// ErrUnknownDEPServer occurs when the DEP server of incoming tokens can
+// not be determined (i.e. fetching its account detail failed) so its
+// DEP name bindings can not be checked.
+var ErrUnknownDEPServer = errors.New("DEP server UUID unknown")
+
+// DEPNameBinding is a DEP name bound to a DEP server.
+type DEPNameBinding struct {
+	Name string `json:"name"`
+
+	// SameConsumerKey is true if the OAuth1 tokens of the DEP name
+	// have the same consumer key.
+	SameConsumerKey bool `json:"same_consumer_key"`
+
+	// SameServerUUID is true if the stored account detail of the DEP
+	// name has the same server UUID.
+	SameServerUUID bool `json:"same_server_uuid"`
+}
+
+type DEPNameBindingsFinder interface {
+	// FindDEPNameBindings finds the DEP names whose OAuth1 tokens have
+	// consumerKey or whose account detail has serverUUID.
+	// Empty consumerKey or serverUUID values do not match.
+	FindDEPNameBindings(ctx context.Context, consumerKey, serverUUID string) ([]DEPNameBinding, error)
+}
+
+// WithDEPNameBindings rejects tokens whose consumer key or account
+// detail server UUID (see [WithAccountDetail]) match those of another
+// DEP name found using finder. The existing bindings are returned in
+// the response. If account details are enabled then tokens whose
+// server UUID can not be determined are also rejected.
+// The "force" URL parameter overrides these checks.
+func WithDEPNameBindings(finder DEPNameBindingsFinder) TokensOption {
+	return func(c *tokensConfig) {
+		c.bindingsFinder = finder
+	}
+}
+
+// findOtherBindings finds the DEP names other than name that are bound
+// to the DEP server of consumerKey or serverUUID.
+// Nil is returned if bindings are not checked.
+func (c *tokensConfig) findOtherBindings(ctx context.Context, name, consumerKey, serverUUID string) ([]DEPNameBinding, error) {
+	if c.bindingsFinder == nil {
+		return nil, nil
+	}
+	bindings, err := c.bindingsFinder.FindDEPNameBindings(ctx, consumerKey, serverUUID)
+	if err != nil {
+		return nil, err
+	}
+	bindings = slices.DeleteFunc(bindings, func(b DEPNameBinding) bool {
+		return b.Name == name
+	})
+	slices.SortFunc(bindings, func(a, b DEPNameBinding) int {
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		}
+		return 0
+	})
+	return bindings, nil
+}
+
+// bindingsError writes ErrDuplicateDEPServer and the existing bindings
+// as JSON to w.
+func bindingsError(w http.ResponseWriter, bindings []DEPNameBinding) {
+	jsonErr := &struct {
+		Err      string           `json:"error"`
+		Bindings []DEPNameBinding `json:"bindings"`
+	}{Err: ErrDuplicateDEPServer.Error(), Bindings: bindings}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(jsonErr)
+}
@@ -48,13 +48,35 @@ type ConfigStorer interface {
 	StoreConfig(ctx context.Context, name string, config *client.Config) error
 }
 
+// StoreConfigOption configures the config store handler.
+type StoreConfigOption func(*storeConfigConfig)
+
+type storeConfigConfig struct {
+	retriever client.ConfigRetriever
+}
+
+// WithConfigRetriever keeps the MDM service discovery URL of the existing
+// config, retrieved using retriever, if the request omits the URL.
+// Otherwise the entire config is overwritten.
+func WithConfigRetriever(retriever client.ConfigRetriever) StoreConfigOption {
+	return func(c *storeConfigConfig) {
+		c.retriever = retriever
+	}
+}
+
 // StoreConfigHandler stores the DEP server config for the DEP
-// name in the path.
+// name in the path. See [WithConfigRetriever] for keeping the MDM service
+// discovery URL of the existing config.
 //
 // Note the whole URL path is used as the DEP name. This necessitates
 // stripping the URL prefix before using this handler. Also note we expose Go
 // errors to the output as this is meant for "API" users.
-func StoreConfigHandler(store ConfigStorer, logger log.Logger) http.HandlerFunc {
+func StoreConfigHandler(store ConfigStorer, logger log.Logger, opts ...StoreConfigOption) http.HandlerFunc {
+	c := new(storeConfigConfig)
+	for _, opt := range opts {
+		opt(c)
+	}
+	retriever := c.retriever
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := ctxlog.Logger(r.Context(), logger)
 		if r.URL.Path == "" {
@@ -63,15 +85,19 @@ func StoreConfigHandler(store ConfigStorer, logger log.Logger) http.HandlerFunc
 			return
 		}
 		logger = logger.With("name", r.URL.Path)
-		config := new(client.Config)
-		err := json.NewDecoder(r.Body).Decode(config)
+		req := new(struct {
+			client.Config
+			// distinguishes an absent URL from an empty URL
+			MDMServiceDiscoveryURL *string `json:"mdm_service_discovery_url"`
+		})
+		err := json.NewDecoder(r.Body).Decode(req)
 		if err != nil {
 			logger.Info("msg", "decoding request body", "err", err)
 			jsonError(w, err)
 			return
 		}
 		defer r.Body.Close()
-		if config.BaseURL == "" {
+		if req.BaseURL == "" {
 			err = errors.New("empty base URL")
 		}
 		if err != nil {
@@ -79,6 +105,20 @@ func StoreConfigHandler(store ConfigStorer, logger log.Logger) http.HandlerFunc
 			jsonError(w, err)
 			return
 		}
+		config := &req.Config
+		if req.MDMServiceDiscoveryURL != nil {
+			config.MDMServiceDiscoveryURL = *req.MDMServiceDiscoveryURL
+		} else if retriever != nil {
+			existing, err := retriever.RetrieveConfig(r.Context(), r.URL.Path)
+			if err != nil {
+				logger.Info("msg", "retrieving config", "err", err)
+				jsonError(w, err)
+				return
+			}
+			if existing != nil {
+				config.MDMServiceDiscoveryURL = existing.MDMServiceDiscoveryURL
+			}
+		}
 		err = store.StoreConfig(r.Context(), r.URL.Path, config)
 		if err != nil {
 			logger.Info("msg", "storing config", "err", err)
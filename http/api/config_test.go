@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type configStore map[string]*client.Config
+
+func (s configStore) RetrieveConfig(_ context.Context, name string) (*client.Config, error) {
+	return s[name], nil
+}
+
+func (s configStore) StoreConfig(_ context.Context, name string, config *client.Config) error {
+	s[name] = config
+	return nil
+}
+
+func TestStoreConfigHandler(t *testing.T) {
+	const url = "https://mdm.example.com/.well-known/com.apple.remotemanagement"
+
+	for _, tc := range []struct {
+		name     string
+		existing *client.Config
+		body     string
+		want     string
+	}{
+		{"no existing config", nil, `{"base_url":"https://a.example.com/"}`, ""},
+		{"keeps existing URL", &client.Config{BaseURL: "https://a.example.com/", MDMServiceDiscoveryURL: url}, `{"base_url":"https://b.example.com/"}`, url},
+		{"replaces existing URL", &client.Config{BaseURL: "https://a.example.com/", MDMServiceDiscoveryURL: url}, `{"base_url":"https://b.example.com/","mdm_service_discovery_url":"https://other.example.com/"}`, "https://other.example.com/"},
+		{"clears existing URL", &client.Config{BaseURL: "https://a.example.com/", MDMServiceDiscoveryURL: url}, `{"base_url":"https://b.example.com/","mdm_service_discovery_url":""}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := configStore{}
+			if tc.existing != nil {
+				store["a"] = tc.existing
+			}
+			r := httptest.NewRequest("PUT", "/", strings.NewReader(tc.body))
+			r.URL.Path = "a"
+			w := httptest.NewRecorder()
+			StoreConfigHandler(store, log.NopLogger, WithConfigRetriever(store)).ServeHTTP(w, r)
+			if have, want := w.Code, http.StatusOK; have != want {
+				t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+			}
+			if store["a"] == nil {
+				t.Fatal("config not stored")
+			}
+			if have, want := store["a"].MDMServiceDiscoveryURL, tc.want; have != want {
+				t.Errorf("MDM service discovery URL: have %q, want %q", have, want)
+			}
+		})
+	}
+
+	// without a retriever the entire config is overwritten
+	store := configStore{"a": &client.Config{BaseURL: "https://a.example.com/", MDMServiceDiscoveryURL: url}}
+	r := httptest.NewRequest("PUT", "/", strings.NewReader(`{"base_url":"https://b.example.com/"}`))
+	r.URL.Path = "a"
+	w := httptest.NewRecorder()
+	StoreConfigHandler(store, log.NopLogger).ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	if have, want := store["a"].MDMServiceDiscoveryURL, ""; have != want {
+		t.Errorf("MDM service discovery URL: have %q, want %q", have, want)
+	}
+}
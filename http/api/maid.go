@@ -16,11 +16,28 @@ type MAIDJWTStorage interface {
 	godep.ClientStorage
 }
 
+// MAIDJWTOption configures the MAID JWT handler.
+type MAIDJWTOption func(*maidJWTConfig)
+
+type maidJWTConfig struct {
+	detailStore AccountDetailStore
+}
+
+// WithMAIDJWTAccountDetail uses the account detail stored in store for
+// the server UUID. If no account detail is stored the account detail
+// queried from the DEP API is stored.
+func WithMAIDJWTAccountDetail(store AccountDetailStore) MAIDJWTOption {
+	return func(c *maidJWTConfig) {
+		c.detailStore = store
+	}
+}
+
 // NewMAIDJWTHandler returns a JWT for DEP Access Management.
 // This JWT should be returned for use with an MDM client's CheckIn "GetToken" message.
-// Note: this queries the DEP API "live" if a server_uuid query paramter is not provided.
-// A cache of some sort may be a future strategy.
-func NewMAIDJWTHandler(store MAIDJWTStorage, logger log.Logger, newJTI func() string) http.HandlerFunc {
+// Note: if a server_uuid query paramter is not provided the server UUID
+// of the stored account detail is used (see [WithMAIDJWTAccountDetail]).
+// Otherwise this queries the DEP API "live".
+func NewMAIDJWTHandler(store MAIDJWTStorage, logger log.Logger, newJTI func() string, opts ...MAIDJWTOption) http.HandlerFunc {
 	if store == nil {
 		panic("nil store")
 	}
@@ -30,6 +47,10 @@ func NewMAIDJWTHandler(store MAIDJWTStorage, logger log.Logger, newJTI func() st
 	if newJTI == nil {
 		panic("nil new JTI")
 	}
+	config := new(maidJWTConfig)
+	for _, opt := range opts {
+		opt(config)
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := ctxlog.Logger(r.Context(), logger)
 		if r.URL.Path == "" {
@@ -43,12 +64,29 @@ func NewMAIDJWTHandler(store MAIDJWTStorage, logger log.Logger, newJTI func() st
 
 		serverUUID := r.URL.Query().Get("server_uuid")
 		if serverUUID == "" {
-			client := godep.NewClient(store)
-			detail, err := client.AccountDetail(r.Context(), name)
-			if err != nil {
-				logger.Info("msg", "getting account detail", "err", err)
-				jsonError(w, err)
-				return
+			var detail *AccountDetail
+			var err error
+			if config.detailStore != nil {
+				detail, err = config.detailStore.RetrieveAccountDetail(r.Context(), name)
+				if err != nil {
+					logger.Info("msg", "retrieving account detail", "err", err)
+					jsonError(w, err)
+					return
+				}
+			}
+
+			if detail == nil || detail.ServerUuid == nil {
+				detail, err = FetchAccountDetail(r.Context(), godep.NewClient(store), name)
+				if err != nil {
+					logger.Info("msg", "getting account detail", "err", err)
+					jsonError(w, err)
+					return
+				}
+				if config.detailStore != nil {
+					if err = config.detailStore.StoreAccountDetail(r.Context(), name, detail); err != nil {
+						logger.Info("msg", "storing account detail", "err", err)
+					}
+				}
 			}
 
 			if detail.ServerUuid == nil {
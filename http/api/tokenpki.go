@@ -106,12 +106,16 @@ func GetCertTokenPKIHandler(store TokenPKIStorer, logger log.Logger) http.Handle
 
 // DecryptTokenPKIHandler reads the Apple-provided encrypted token ".p7m" file
 // from the request body and decrypts it with the keypair generated from
-// GetCertTokenPKIHandler.
+// GetCertTokenPKIHandler. See [WithAccountDetail] for verifying the
+// decrypted tokens with the DEP API before they are stored and
+// [WithDEPNameBindings] for rejecting tokens of DEP servers bound to
+// other DEP names.
 //
 // Note the whole URL path is used as the DEP name. This necessitates
 // stripping the URL prefix before using this handler. Also note we expose Go
 // errors to the output as this is meant for "API" users.
-func DecryptTokenPKIHandler(store DecryptTokenPKIStorage, tokenStore AuthTokensStore, logger log.Logger) http.HandlerFunc {
+func DecryptTokenPKIHandler(store DecryptTokenPKIStorage, tokenStore AuthTokensStore, logger log.Logger, opts ...TokensOption) http.HandlerFunc {
+	config := newTokensConfig(opts)
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := ctxlog.Logger(r.Context(), logger)
 		if r.URL.Path == "" {
@@ -160,13 +164,15 @@ func DecryptTokenPKIHandler(store DecryptTokenPKIStorage, tokenStore AuthTokensS
 			return
 		}
 		// decryption and unmarshal of tokens successful, now "upgrade"
-		// our staging token PKI to the real thing.
-		err = store.UpstageTokenPKI(r.Context(), r.URL.Path)
-		if err != nil {
-			logger.Info("msg", "upstaging token PKI", "err", err)
-			jsonError(w, err)
-			return
+		// our staging token PKI to the real thing once the tokens have
+		// been checked and just before they are stored.
+		upstage := func(ctx context.Context) error {
+			err := store.UpstageTokenPKI(ctx, r.URL.Path)
+			if err != nil {
+				logger.Info("msg", "upstaging token PKI", "err", err)
+			}
+			return err
 		}
-		storeTokens(r.Context(), logger, r.URL.Path, tokens, tokenStore, w, force)
+		storeTokens(r.Context(), logger, r.URL.Path, tokens, tokenStore, w, force, config, upstage)
 	}
 }
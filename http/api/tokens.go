@@ -61,12 +61,15 @@ func RetrieveAuthTokensHandler(store client.AuthTokensRetriever, logger log.Logg
 }
 
 // StoreAuthTokensHandler reads DEP server OAuth1 tokens as a JSON body and
-// saves them using store.
+// saves them using store. See [WithAccountDetail] for verifying the tokens
+// with the DEP API before they are stored and [WithDEPNameBindings] for
+// rejecting tokens of DEP servers bound to other DEP names.
 //
 // Note the whole URL path is used as the DEP name. This necessitates
 // stripping the URL prefix before using this handler. Also note we expose Go
 // errors to the output as this is meant for "API" users.
-func StoreAuthTokensHandler(store AuthTokensStore, logger log.Logger) http.HandlerFunc {
+func StoreAuthTokensHandler(store AuthTokensStore, logger log.Logger, opts ...TokensOption) http.HandlerFunc {
+	config := newTokensConfig(opts)
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger := ctxlog.Logger(r.Context(), logger)
 		if r.URL.Path == "" {
@@ -84,11 +87,14 @@ func StoreAuthTokensHandler(store AuthTokensStore, logger log.Logger) http.Handl
 			return
 		}
 		defer r.Body.Close()
-		storeTokens(r.Context(), logger, r.URL.Path, tokens, store, w, force)
+		storeTokens(r.Context(), logger, r.URL.Path, tokens, store, w, force, config, nil)
 	}
 }
 
-func storeTokens(ctx context.Context, logger log.Logger, name string, tokens *client.OAuth1Tokens, store AuthTokensStore, w http.ResponseWriter, force bool) {
+// storeTokens checks and stores tokens for name (DEP name) and writes the
+// response to w. If beforeStore is not nil it is called just before
+// storing the tokens and aborts storing them if it returns an error.
+func storeTokens(ctx context.Context, logger log.Logger, name string, tokens *client.OAuth1Tokens, store AuthTokensStore, w http.ResponseWriter, force bool, config *tokensConfig, beforeStore func(context.Context) error) {
 	if !tokens.Valid() {
 		logger.Info("msg", "checking auth token validity", "err", "invalid tokens")
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -112,13 +118,67 @@ func storeTokens(ctx context.Context, logger log.Logger, name string, tokens *cl
 			return
 		}
 	}
-	err := store.StoreAuthTokens(ctx, name, tokens)
+	detail, err := config.fetchAccountDetail(ctx, name, tokens)
+	if IsAuthError(err) {
+		logger.Info("msg", "verifying auth tokens", "err", err)
+		jsonErrorStatus(w, err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		// the DEP API may just be unavailable so store the tokens anyway
+		logger.Info("msg", "fetching account detail; proceeding to store", "err", err)
+	}
+	if !force {
+		var serverUUID string
+		if detail != nil && detail.ServerUuid != nil {
+			serverUUID = *detail.ServerUuid
+		}
+		if serverUUID == "" && config.detailStore != nil && config.bindingsFinder != nil {
+			// tokens of a DEP server bound to another DEP name
+			// could otherwise slip through
+			logger.Info(
+				"msg", "checking DEP name bindings (use force to bypass)",
+				"err", ErrUnknownDEPServer,
+			)
+			jsonErrorStatus(w, ErrUnknownDEPServer, http.StatusBadGateway)
+			return
+		}
+		bindings, err := config.findOtherBindings(ctx, name, tokens.ConsumerKey, serverUUID)
+		if err != nil {
+			logger.Info("msg", "finding DEP name bindings", "err", err)
+			jsonError(w, err)
+			return
+		} else if len(bindings) > 0 {
+			logger.Info(
+				"msg", "checking DEP name bindings (use force to bypass)",
+				"err", ErrDuplicateDEPServer,
+				"bindings", len(bindings),
+			)
+			bindingsError(w, bindings)
+			return
+		}
+	}
+	if beforeStore != nil {
+		if err = beforeStore(ctx); err != nil {
+			jsonError(w, err)
+			return
+		}
+	}
+	err = store.StoreAuthTokens(ctx, name, tokens)
 	if err != nil {
 		logger.Info("msg", "storing auth tokens", "err", err)
 		jsonError(w, err)
 		return
 	}
 	logger.Debug("msg", "stored auth tokens")
+	if config.detailStore != nil {
+		// if fetching failed this clears any account detail of previous
+		// tokens so that it is fetched again when next retrieved
+		if err = config.detailStore.StoreAccountDetail(ctx, name, detail); err != nil {
+			logger.Info("msg", "storing account detail", "err", err)
+		} else {
+			logger.Debug("msg", "stored account detail", "cleared", detail == nil)
+		}
+	}
 	w.Header().Set("Content-type", "application/json")
 	err = json.NewEncoder(w).Encode(tokens)
 	if err != nil {
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type tokensStore struct {
+	config  *client.Config
+	tokens  map[string]*client.OAuth1Tokens
+	details map[string]*AccountDetail
+}
+
+func (s *tokensStore) RetrieveConfig(_ context.Context, _ string) (*client.Config, error) {
+	return s.config, nil
+}
+
+func (s *tokensStore) RetrieveAuthTokens(_ context.Context, name string) (*client.OAuth1Tokens, error) {
+	return s.tokens[name], nil
+}
+
+func (s *tokensStore) StoreAuthTokens(_ context.Context, name string, tokens *client.OAuth1Tokens) error {
+	s.tokens[name] = tokens
+	return nil
+}
+
+func (s *tokensStore) StoreAccountDetail(_ context.Context, name string, detail *AccountDetail) error {
+	if detail == nil {
+		delete(s.details, name)
+		return nil
+	}
+	s.details[name] = detail
+	return nil
+}
+
+func (s *tokensStore) FindDEPNameBindings(_ context.Context, _, _ string) ([]DEPNameBinding, error) {
+	return nil, nil
+}
+
+func TestStoreAuthTokensAccountDetailUnavailable(t *testing.T) {
+	// the DEP API can not be reached
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	serverUUID := "4A0B1136DA3447E89C2486F4D342E5BB"
+	store := &tokensStore{
+		config: &client.Config{BaseURL: srv.URL},
+		tokens: make(map[string]*client.OAuth1Tokens),
+		// account detail of previous tokens
+		details: map[string]*AccountDetail{"a": {AccountDetailJson: godep.AccountDetailJson{ServerUuid: &serverUUID}}},
+	}
+
+	r := httptest.NewRequest("PUT", "/", strings.NewReader(`{"consumer_key":"ck","consumer_secret":"cs","access_token":"at","access_secret":"as"}`))
+	r.URL.Path = "a"
+	w := httptest.NewRecorder()
+	StoreAuthTokensHandler(store, log.NopLogger, WithAccountDetail(store)).ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	if store.tokens["a"] == nil {
+		t.Fatal("tokens not stored")
+	}
+
+	// the account detail is cleared to be fetched again later
+	if detail, ok := store.details["a"]; ok {
+		t.Errorf("expected no account detail: %+v", detail)
+	}
+}
+
+func TestStoreAuthTokensUnknownDEPServer(t *testing.T) {
+	// the DEP API can not be reached
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	store := &tokensStore{
+		config:  &client.Config{BaseURL: srv.URL},
+		tokens:  make(map[string]*client.OAuth1Tokens),
+		details: make(map[string]*AccountDetail),
+	}
+	handler := StoreAuthTokensHandler(store, log.NopLogger, WithAccountDetail(store), WithDEPNameBindings(store))
+
+	for _, tc := range []struct {
+		target string
+		status int
+	}{
+		// DEP name bindings can not be checked without the server UUID
+		{"/", http.StatusBadGateway},
+		{"/?force=1", http.StatusOK},
+	} {
+		r := httptest.NewRequest("PUT", tc.target, strings.NewReader(`{"consumer_key":"ck","consumer_secret":"cs","access_token":"at","access_secret":"as"}`))
+		r.URL.Path = "a"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if have, want := w.Code, tc.status; have != want {
+			t.Fatalf("%s: status: have %d, want %d: %s", tc.target, have, want, w.Body.String())
+		}
+		if have, want := store.tokens["a"] != nil, tc.status == http.StatusOK; have != want {
+			t.Errorf("%s: tokens stored: have %v, want %v", tc.target, have, want)
+		}
+	}
+}
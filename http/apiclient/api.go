@@ -0,0 +1,406 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Pagination is the pagination parameters of API queries.
+// Zero values are not sent.
+type Pagination struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+func (p *Pagination) setQuery(q url.Values) {
+	if p == nil {
+		return
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		q.Set("offset", strconv.Itoa(p.Offset))
+	}
+	if p.Cursor != "" {
+		q.Set("cursor", p.Cursor)
+	}
+}
+
+// defaultPageSize is the page size used when iterating all pages.
+const defaultPageSize = 100
+
+// Version returns the version of the running depserver.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	resp := new(struct {
+		Version string `json:"version"`
+	})
+	return resp.Version, c.Do(ctx, http.MethodGet, "version", nil, nil, resp)
+}
+
+// Ready checks the readiness of the running depserver including its
+// storage connectivity. An [HTTPError] is returned if it is not ready.
+func (c *Client) Ready(ctx context.Context) error {
+	return c.Do(ctx, http.MethodGet, "readyz", nil, nil, nil)
+}
+
+// forceQuery returns the query for endpoints supporting the "force" parameter.
+func forceQuery(force bool) url.Values {
+	if force {
+		return url.Values{"force": []string{"1"}}
+	}
+	return nil
+}
+
+// RetrieveTokens returns the DEP OAuth1 tokens of DEP name.
+func (c *Client) RetrieveTokens(ctx context.Context, name string) (*OAuth1TokensJson, error) {
+	resp := new(OAuth1TokensJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/tokens/"+url.PathEscape(name), nil, nil, resp)
+}
+
+// StoreTokens stores the DEP OAuth1 tokens of DEP name.
+// If force is true the consumer key mismatch and DEP server binding checks
+// are bypassed. Tokens of a DEP server bound to other DEP names are
+// otherwise rejected with a 409 status (see [DuplicateDEPServerErrorJson])
+// and tokens whose DEP server could not be determined with a 502 status.
+func (c *Client) StoreTokens(ctx context.Context, name string, tokens *OAuth1TokensJson, force bool) (*OAuth1TokensJson, error) {
+	resp := new(OAuth1TokensJson)
+	return resp, c.Do(ctx, http.MethodPut, "v1/tokens/"+url.PathEscape(name), forceQuery(force), tokens, resp)
+}
+
+// RetrieveConfig returns the config of DEP name.
+func (c *Client) RetrieveConfig(ctx context.Context, name string) (*ConfigJson, error) {
+	resp := new(ConfigJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/config/"+url.PathEscape(name), nil, nil, resp)
+}
+
+// RetrieveAccountDetail returns the stored DEP API account detail of DEP
+// name. If fetch is true the account detail is fetched from the DEP API
+// and stored first.
+func (c *Client) RetrieveAccountDetail(ctx context.Context, name string, fetch bool) (*AccountDetailJson, error) {
+	var q url.Values
+	if fetch {
+		q = url.Values{"fetch": []string{"true"}}
+	}
+	resp := new(AccountDetailJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/account/"+url.PathEscape(name), q, nil, resp)
+}
+
+// StoreConfig stores the config of DEP name.
+func (c *Client) StoreConfig(ctx context.Context, name string, config *ConfigJson) (*ConfigJson, error) {
+	resp := new(ConfigJson)
+	return resp, c.Do(ctx, http.MethodPut, "v1/config/"+url.PathEscape(name), nil, config, resp)
+}
+
+// GenerateTokenPKI generates and stores a new staging token PKI keypair
+// for DEP name and returns the PEM-encoded certificate. The certificate
+// is uploaded to the Apple portal to encrypt the DEP OAuth1 tokens.
+// Empty cn or zero validityDays use the server defaults.
+func (c *Client) GenerateTokenPKI(ctx context.Context, name, cn string, validityDays int) ([]byte, error) {
+	q := url.Values{}
+	if cn != "" {
+		q.Set("cn", cn)
+	}
+	if validityDays > 0 {
+		q.Set("validity_days", strconv.Itoa(validityDays))
+	}
+	pemCert, _, err := c.doRaw(ctx, http.MethodGet, "v1/tokenpki/"+url.PathEscape(name), q, "", nil)
+	return pemCert, err
+}
+
+// DecryptTokenPKI decrypts the encrypted DEP OAuth1 tokens (the contents
+// of the .p7m file downloaded from the Apple portal) for DEP name using
+// the staging token PKI and stores them. The decrypted tokens are returned.
+// If force is true the consumer key mismatch and DEP server binding checks
+// are bypassed. Tokens of a DEP server bound to other DEP names are
+// otherwise rejected with a 409 status (see [DuplicateDEPServerErrorJson]).
+func (c *Client) DecryptTokenPKI(ctx context.Context, name string, p7m []byte, force bool) (*OAuth1TokensJson, error) {
+	respBytes, _, err := c.doRaw(ctx, http.MethodPut, "v1/tokenpki/"+url.PathEscape(name), forceQuery(force), "application/pkcs7-mime", p7m)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(OAuth1TokensJson)
+	if err = json.Unmarshal(respBytes, resp); err != nil {
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	return resp, nil
+}
+
+// RetrieveAssignerProfile returns the assigner profile UUID of DEP name.
+func (c *Client) RetrieveAssignerProfile(ctx context.Context, name string) (string, error) {
+	resp := new(AssignerProfileUUIDJson)
+	err := c.Do(ctx, http.MethodGet, "v1/assigner/"+url.PathEscape(name), nil, nil, resp)
+	if err != nil || resp.ProfileUuid == nil {
+		return "", err
+	}
+	return *resp.ProfileUuid, nil
+}
+
+// StoreAssignerProfile stores the assigner profile UUID of DEP name.
+func (c *Client) StoreAssignerProfile(ctx context.Context, name, profileUUID string) error {
+	q := url.Values{"profile_uuid": []string{profileUUID}}
+	return c.Do(ctx, http.MethodPut, "v1/assigner/"+url.PathEscape(name), q, nil, nil)
+}
+
+// MAIDJWT is a Managed Apple ID Managed Access JWT.
+type MAIDJWT struct {
+	// Token is the signed JWT.
+	Token      string
+	ServerUUID string
+	JTI        string
+}
+
+// GetMAIDJWT generates a Managed Apple ID Managed Access JWT for DEP name.
+// If serverUUID is empty depserver looks it up using the DEP API.
+func (c *Client) GetMAIDJWT(ctx context.Context, name, serverUUID string) (*MAIDJWT, error) {
+	q := url.Values{}
+	if serverUUID != "" {
+		q.Set("server_uuid", serverUUID)
+	}
+	token, header, err := c.doRaw(ctx, http.MethodGet, "v1/maidjwt/"+url.PathEscape(name), q, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MAIDJWT{
+		Token:      string(token),
+		ServerUUID: header.Get("X-Server-Uuid"),
+		JTI:        header.Get("X-Jwt-Jti"),
+	}, nil
+}
+
+// GetBypassCode generates a new Activation Lock bypass code if both code
+// and raw are empty. Otherwise the provided code (dash-separated) or raw
+// (hex-encoded) form of an existing bypass code is decoded.
+func (c *Client) GetBypassCode(ctx context.Context, code, raw string) (*BypassCodeResponseJson, error) {
+	q := url.Values{}
+	if code != "" {
+		q.Set("code", code)
+	}
+	if raw != "" {
+		q.Set("raw", raw)
+	}
+	resp := new(BypassCodeResponseJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/bypasscode", q, nil, resp)
+}
+
+// DEPNamesFilter is the filter of DEP names queries.
+// Zero values are not sent.
+type DEPNamesFilter struct {
+	DEPNames       []string
+	NamePrefix     string
+	HasTokens      *bool
+	ExpiringBefore *time.Time
+
+	// BaseURL, if not nil, filters by config base URL.
+	// An empty string matches DEP names without a configured base URL.
+	BaseURL *string
+}
+
+func (f *DEPNamesFilter) setQuery(q url.Values) {
+	if f == nil {
+		return
+	}
+	for _, name := range f.DEPNames {
+		q.Add("dep_name", name)
+	}
+	if f.NamePrefix != "" {
+		q.Set("name_prefix", f.NamePrefix)
+	}
+	if f.HasTokens != nil {
+		q.Set("has_tokens", strconv.FormatBool(*f.HasTokens))
+	}
+	if f.ExpiringBefore != nil {
+		q.Set("expiring_before", f.ExpiringBefore.Format(time.RFC3339))
+	}
+	if f.BaseURL != nil {
+		q.Set("base_url", *f.BaseURL)
+	}
+}
+
+// QueryDEPNames queries a single page of DEP names.
+func (c *Client) QueryDEPNames(ctx context.Context, filter *DEPNamesFilter, p *Pagination) (*DEPNamesQueryResponseJson, error) {
+	q := url.Values{}
+	filter.setQuery(q)
+	p.setQuery(q)
+	resp := new(DEPNamesQueryResponseJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/dep_names", q, nil, resp)
+}
+
+// AllDEPNames queries every page of DEP names and returns their details.
+func (c *Client) AllDEPNames(ctx context.Context, filter *DEPNamesFilter) ([]DEPNameDetailsJson, error) {
+	var ret []DEPNameDetailsJson
+	p := &Pagination{Limit: defaultPageSize}
+	for {
+		resp, err := c.QueryDEPNames(ctx, filter, p)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, resp.Details...)
+		if len(resp.DepNames) < p.Limit {
+			return ret, nil
+		}
+		if resp.NextCursor != nil && *resp.NextCursor != "" {
+			p.Cursor = *resp.NextCursor
+		} else {
+			p.Offset += len(resp.DepNames)
+		}
+	}
+}
+
+// DeleteDEPName deletes the stored data of DEP name.
+// If no parts are provided then all data is deleted.
+func (c *Client) DeleteDEPName(ctx context.Context, name string, parts ...string) error {
+	q := url.Values{"confirm": []string{name}}
+	for _, part := range parts {
+		q.Add("part", part)
+	}
+	return c.Do(ctx, http.MethodDelete, "v1/dep_names/"+url.PathEscape(name), q, nil, nil)
+}
+
+// AuditFilter is the filter of audit log queries.
+// Zero values are not sent.
+type AuditFilter struct {
+	DEPNames []string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f *AuditFilter) setQuery(q url.Values) {
+	if f == nil {
+		return
+	}
+	for _, name := range f.DEPNames {
+		q.Add("dep_name", name)
+	}
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		q.Set("until", f.Until.Format(time.RFC3339))
+	}
+}
+
+// QueryAudit queries a single page of the audit log.
+func (c *Client) QueryAudit(ctx context.Context, filter *AuditFilter, p *Pagination) (*AuditQueryResponseJson, error) {
+	q := url.Values{}
+	filter.setQuery(q)
+	p.setQuery(q)
+	resp := new(AuditQueryResponseJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/audit", q, nil, resp)
+}
+
+// AllAuditEvents queries every page of the audit log.
+func (c *Client) AllAuditEvents(ctx context.Context, filter *AuditFilter) ([]AuditEventJson, error) {
+	var ret []AuditEventJson
+	p := &Pagination{Limit: defaultPageSize}
+	for {
+		resp, err := c.QueryAudit(ctx, filter, p)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, resp.Events...)
+		if len(resp.Events) < p.Limit {
+			return ret, nil
+		}
+		if resp.NextCursor != nil && *resp.NextCursor != "" {
+			p.Cursor = *resp.NextCursor
+		} else {
+			p.Offset += len(resp.Events)
+		}
+	}
+}
+
+// ListAPIKeys returns all API keys. Secrets are not returned.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKeyJson, error) {
+	var resp []APIKeyJson
+	return resp, c.Do(ctx, http.MethodGet, "v1/apikeys", nil, nil, &resp)
+}
+
+// RetrieveAPIKey returns the API key called name. The secret is not returned.
+func (c *Client) RetrieveAPIKey(ctx context.Context, name string) (*APIKeyJson, error) {
+	resp := new(APIKeyJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/apikeys/"+url.PathEscape(name), nil, nil, resp)
+}
+
+// StoreAPIKey creates or replaces the API key called name.
+// The returned API key includes the newly generated secret.
+func (c *Client) StoreAPIKey(ctx context.Context, name string, key *APIKeyRequestJson) (*APIKeyJson, error) {
+	resp := new(APIKeyJson)
+	return resp, c.Do(ctx, http.MethodPut, "v1/apikeys/"+url.PathEscape(name), nil, key, resp)
+}
+
+// DeleteAPIKey deletes the API key called name.
+func (c *Client) DeleteAPIKey(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodDelete, "v1/apikeys/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// SyncNow requests an immediate device sync of DEP name from the depserver
+// embedded syncer. If fetch is true the cursor is cleared and all devices
+// are fetched again.
+func (c *Client) SyncNow(ctx context.Context, name string, fetch bool) error {
+	var q url.Values
+	if fetch {
+		q = url.Values{"fetch": []string{"true"}}
+	}
+	return c.Do(ctx, http.MethodPost, "v1/sync/"+url.PathEscape(name), q, nil, nil)
+}
+
+// QueryHistory queries a single page of the change history of DEP name,
+// newest first. If kind is not empty only entries of that kind are
+// returned.
+func (c *Client) QueryHistory(ctx context.Context, name, kind string, p *Pagination) (*HistoryQueryResponseJson, error) {
+	q := url.Values{}
+	if kind != "" {
+		q.Set("kind", kind)
+	}
+	p.setQuery(q)
+	resp := new(HistoryQueryResponseJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/history/"+url.PathEscape(name), q, nil, resp)
+}
+
+// Rollback restores the config or assigner profile of DEP name to the
+// value of the history entry with id. The restored entry is returned.
+func (c *Client) Rollback(ctx context.Context, name, id string) (*HistoryEntryJson, error) {
+	resp := new(HistoryEntryJson)
+	return resp, c.Do(ctx, http.MethodPost, "v1/rollback/"+url.PathEscape(name), url.Values{"id": []string{id}}, nil, resp)
+}
+
+// RetrieveServiceDiscovery returns the account-driven enrollment MDM
+// service discovery URL stored for DEP name and the URL assigned in the
+// DEP API.
+func (c *Client) RetrieveServiceDiscovery(ctx context.Context, name string) (*ServiceDiscoveryResponseJson, error) {
+	resp := new(ServiceDiscoveryResponseJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/servicediscovery/"+url.PathEscape(name), nil, nil, resp)
+}
+
+// AssignServiceDiscovery assigns the account-driven enrollment MDM
+// service discovery URL for DEP name using the DEP API and stores it.
+func (c *Client) AssignServiceDiscovery(ctx context.Context, name, mdmServiceDiscoveryURL string) (*ServiceDiscoveryResponseJson, error) {
+	req := &ServiceDiscoveryRequestJson{MdmServiceDiscoveryUrl: mdmServiceDiscoveryURL}
+	resp := new(ServiceDiscoveryResponseJson)
+	return resp, c.Do(ctx, http.MethodPut, "v1/servicediscovery/"+url.PathEscape(name), nil, req, resp)
+}
+
+// RemoveServiceDiscovery removes the account-driven enrollment profile
+// of DEP name using the DEP API and removes the stored URL.
+func (c *Client) RemoveServiceDiscovery(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodDelete, "v1/servicediscovery/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// RetrieveOSBetaTokens returns the (possibly cached) OS beta enrollment
+// tokens of DEP name. If os is not empty only tokens for that OS are
+// returned.
+func (c *Client) RetrieveOSBetaTokens(ctx context.Context, name, os string) (*OSBetaTokensJson, error) {
+	var q url.Values
+	if os != "" {
+		q = url.Values{"os": []string{os}}
+	}
+	resp := new(OSBetaTokensJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/osbeta/"+url.PathEscape(name), q, nil, resp)
+}
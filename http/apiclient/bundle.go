@@ -0,0 +1,68 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// passphraseHeader matches the depserver bundle passphrase header.
+const passphraseHeader = "X-Nanodep-Passphrase"
+
+// Export exports DEP names into a bundle encrypted with passphrase.
+// If filter is nil then all DEP names are exported.
+func (c *Client) Export(ctx context.Context, passphrase string, filter *DEPNamesFilter) ([]byte, error) {
+	q := url.Values{}
+	filter.setQuery(q)
+	req, err := c.newRequest(ctx, http.MethodGet, "v1/export", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(passphraseHeader, passphrase)
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return data, nil
+}
+
+// Import imports the DEP names of an encrypted bundle previously
+// exported with [Client.Export]. Existing is the policy for DEP names
+// which already exist: "skip", "overwrite", or "fail". An empty existing
+// uses the depserver default.
+func (c *Client) Import(ctx context.Context, passphrase string, data []byte, existing string, dryRun bool) (*ImportResponseJson, error) {
+	q := url.Values{}
+	if existing != "" {
+		q.Set("existing", existing)
+	}
+	if dryRun {
+		q.Set("dry_run", strconv.FormatBool(dryRun))
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "v1/import", q, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(passphraseHeader, passphrase)
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ret := new(ImportResponseJson)
+	if err = json.NewDecoder(resp.Body).Decode(ret); err != nil {
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	return ret, nil
+}
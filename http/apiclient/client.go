@@ -0,0 +1,230 @@
+// Package apiclient is a typed Go client for the NanoDEP depserver API.
+// The request and response models are generated from the OpenAPI
+// specification in docs/openapi.yaml.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultUsername is the HTTP Basic username for the depserver API
+	// key given by the depserver -api flag.
+	DefaultUsername = "depserver"
+
+	UserAgent = "nanodep-apiclient/0"
+)
+
+// HTTPError encapsulates an HTTP response error from depserver.
+type HTTPError struct {
+	Body       []byte
+	Status     string
+	StatusCode int
+
+	// Response is the decoded JSON error response. It is nil if the
+	// response body was not a JSON error response (for example errors
+	// passed through from the DEP API by the proxy).
+	Response *ErrorResponseJson
+}
+
+// Error returns the HTTP error as an error string.
+func (e *HTTPError) Error() string {
+	if e.Response != nil {
+		return fmt.Sprintf("depserver API error: %s: %s", e.Status, e.Response.Error)
+	}
+	return fmt.Sprintf("depserver API error: %s: %s", e.Status, string(e.Body))
+}
+
+// NewHTTPError creates and returns a new HTTPError from r.
+// JSON response bodies are decoded into [ErrorResponseJson].
+// Note this reads r.Body (limited to 1 KiB) and the caller is responsible for closing it.
+func NewHTTPError(r *http.Response) error {
+	body, readErr := io.ReadAll(io.LimitReader(r.Body, 1024))
+	err := &HTTPError{
+		Body:       body,
+		Status:     r.Status,
+		StatusCode: r.StatusCode,
+	}
+	if readErr != nil {
+		return fmt.Errorf("reading body of HTTP error: %v: %w", err, readErr)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		errResp := new(ErrorResponseJson)
+		if json.Unmarshal(body, errResp) == nil && errResp.Error != "" {
+			err.Response = errResp
+		}
+	}
+	return err
+}
+
+// IsStatus reports whether err is an [HTTPError] with status code.
+func IsStatus(err error, status int) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == status
+}
+
+// Client is a depserver API client.
+type Client struct {
+	baseURL  *url.URL
+	client   *http.Client
+	username string
+	apiKey   string
+	ua       string
+}
+
+// Options change the configuration of the Client.
+type Option func(*Client)
+
+// WithUserAgent sets the the HTTP User-Agent string to be used on each request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.ua = ua
+	}
+}
+
+// WithClient configures the HTTP client to be used.
+// If not set then http.DefaultClient is used.
+func WithClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithUsername sets the HTTP Basic username (i.e. the API key name).
+// If not set then [DefaultUsername] is used.
+func WithUsername(username string) Option {
+	return func(c *Client) {
+		c.username = username
+	}
+}
+
+// New creates a new depserver API client. The baseURL is the URL of
+// the running depserver and apiKey is the API key (secret) used for
+// HTTP Basic authentication. If apiKey is empty no credentials are sent
+// which is useful with TLS client certificate authentication configured
+// using [WithClient].
+func New(baseURL, apiKey string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	c := &Client{
+		baseURL:  u,
+		client:   http.DefaultClient,
+		username: DefaultUsername,
+		apiKey:   apiKey,
+		ua:       UserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// newRequest creates a new authenticated request for the depserver
+// API path (relative to the base URL) and query.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.baseURL.JoinPath(path)
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.SetBasicAuth(c.username, c.apiKey)
+	}
+	if c.ua != "" {
+		req.Header.Set("User-Agent", c.ua)
+	}
+	return req, nil
+}
+
+// do executes req returning the response if it has a 2xx status.
+// Otherwise an [HTTPError] is returned and the response body is closed.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, NewHTTPError(resp)
+	}
+	return resp, nil
+}
+
+// Do executes a request to the depserver API path (relative to the base URL).
+// We encode in to JSON and decode any returned body as JSON to out.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		bodyBytes, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(bodyBytes)
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if out != nil {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding response body: %w", err)
+		}
+	}
+	return nil
+}
+
+// doRaw executes a request with a raw body returning the raw response body.
+func (c *Client) doRaw(ctx context.Context, method, path string, query url.Values, contentType string, in []byte) ([]byte, http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		body = bytes.NewReader(in)
+	}
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return respBytes, resp.Header, nil
+}
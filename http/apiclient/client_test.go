@@ -0,0 +1,155 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/proxy"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	var names []string
+	for i := 0; i < 250; i++ {
+		names = append(names, fmt.Sprintf("name%03d", i))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/config/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/config/my name" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte(`{"base_url":"http://example.com/"}`))
+	})
+	mux.HandleFunc("/v1/tokens/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"it was sunny outside"}`))
+	})
+	mux.HandleFunc("/v1/dep_names", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if r.URL.Query().Get("has_tokens") != "true" {
+			t.Error("missing has_tokens filter")
+		}
+		resp := new(DEPNamesQueryResponseJson)
+		for i := offset; i < offset+limit && i < len(names); i++ {
+			resp.DepNames = append(resp.DepNames, names[i])
+			resp.Details = append(resp.Details, DEPNameDetailsJson{Name: &names[i]})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	// the depserver proxy policy middleware answers dry-run requests
+	var proxied int
+	proxyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		if r.URL.Path != "/profile" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if have, want := r.URL.Query().Get("profile_uuid"), "ABC"; have != want {
+			t.Errorf("profile_uuid: have %q, want %q", have, want)
+		}
+		if r.Header.Get(dryRunHeader) != "" {
+			t.Error("dry-run header proxied")
+		}
+		w.Write([]byte(`{"profile_name":"test"}`))
+	})
+	mux.Handle("/proxy/", http.StripPrefix("/proxy/", proxy.ProxyDEPNameHandler(
+		proxy.PolicyMiddleware(proxyHandler, nil, log.NopLogger),
+		log.NopLogger,
+	)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != DefaultUsername || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := c.RetrieveConfig(ctx, "my name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseUrl == nil || *config.BaseUrl != "http://example.com/" {
+		t.Errorf("unexpected config: %v", config.BaseUrl)
+	}
+
+	_, err = c.RetrieveTokens(ctx, "name1")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected HTTPError: %v", err)
+	}
+	if httpErr.Response == nil || httpErr.Response.Error != "it was sunny outside" {
+		t.Errorf("unexpected error response: %v", httpErr)
+	}
+	if !IsStatus(err, http.StatusInternalServerError) {
+		t.Errorf("unexpected status: %d", httpErr.StatusCode)
+	}
+
+	hasTokens := true
+	details, err := c.AllDEPNames(ctx, &DEPNamesFilter{HasTokens: &hasTokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(details), len(names); have != want {
+		t.Fatalf("details: have %d, want %d", have, want)
+	}
+	if have, want := *details[len(details)-1].Name, names[len(names)-1]; have != want {
+		t.Errorf("last name: have %q, want %q", have, want)
+	}
+
+	// read-only dry-run requests are proxied
+	profile, err := c.ProxyGetProfile(WithDryRun(ctx), "name1", "ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProfileName == nil || *profile.ProfileName != "test" {
+		t.Errorf("unexpected profile name: %v", profile.ProfileName)
+	}
+
+	// mutating dry-run requests are not proxied
+	resp, err := c.ProxyRequest(WithDryRun(ctx), "name1", http.MethodPost, "/devices/disown", strings.NewReader(`{"devices":["SERIAL1"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get(dryRunHeader) == "" {
+		t.Error("missing dry-run header")
+	}
+	dryRun := new(proxy.DryRunResponse)
+	if err = json.NewDecoder(resp.Body).Decode(dryRun); err != nil {
+		t.Fatal(err)
+	}
+	if !dryRun.DryRun || dryRun.Endpoint != "/devices/disown" {
+		t.Errorf("unexpected dry-run response: %+v", dryRun)
+	}
+	if have, want := proxied, 1; have != want {
+		t.Errorf("proxied: have %d, want %d", have, want)
+	}
+
+	c, err = New(srv.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.RetrieveConfig(ctx, "name1"); !IsStatus(err, http.StatusUnauthorized) {
+		t.Errorf("expected unauthorized: %v", err)
+	}
+}
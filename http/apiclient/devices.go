@@ -0,0 +1,139 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+)
+
+// DeviceErrors contains the error of each serial number whose DEP API
+// request failed.
+type DeviceErrors struct {
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// DeviceDetailsResponse is the response of the device details endpoint.
+type DeviceDetailsResponse struct {
+	godep.DeviceListResponseJson
+	DeviceErrors
+}
+
+// DeviceStatusResponse is the response of the device endpoints returning
+// a status for each serial number.
+type DeviceStatusResponse struct {
+	godep.DeviceStatusResponseJson
+	DeviceErrors
+}
+
+// AssignProfileResponse is the response of the profile assignment endpoint.
+type AssignProfileResponse struct {
+	godep.AssignProfileResponseJson
+	DeviceErrors
+}
+
+// devicesPath returns the device API path of action for DEP name.
+func devicesPath(name, action string) string {
+	return "v1/devices/" + url.PathEscape(name) + "/" + action
+}
+
+// DeviceDetails returns the details of devices of DEP name.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) DeviceDetails(ctx context.Context, name string, serials ...string) (*DeviceDetailsResponse, error) {
+	req := &DevicesRequestJson{Devices: serials}
+	resp := new(DeviceDetailsResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "details"), nil, req, resp)
+}
+
+// AssignProfile assigns profileUUID to devices of DEP name.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) AssignProfile(ctx context.Context, name, profileUUID string, serials ...string) (*AssignProfileResponse, error) {
+	req := &DevicesRequestJson{Devices: serials, ProfileUuid: &profileUUID}
+	resp := new(AssignProfileResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "assign"), nil, req, resp)
+}
+
+// UnassignProfile removes the profile assignment of devices of DEP name.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) UnassignProfile(ctx context.Context, name string, serials ...string) (*DeviceStatusResponse, error) {
+	req := &DevicesRequestJson{Devices: serials}
+	resp := new(DeviceStatusResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "unassign"), nil, req, resp)
+}
+
+// DisownDevices disowns devices of DEP name.
+// WARNING: This will permanantly remove devices from the ABM/ASM/ABE instance.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) DisownDevices(ctx context.Context, name string, serials ...string) (*DeviceStatusResponse, error) {
+	req := &DevicesRequestJson{Devices: serials}
+	resp := new(DeviceStatusResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "disown"), nil, req, resp)
+}
+
+// ActivationLock enables Activation Lock on devices of DEP name.
+// The escrowKey and lostMessage can be empty.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) ActivationLock(ctx context.Context, name, escrowKey, lostMessage string, serials ...string) (*DeviceStatusResponse, error) {
+	req := &DevicesRequestJson{Devices: serials}
+	if escrowKey != "" {
+		req.EscrowKey = &escrowKey
+	}
+	if lostMessage != "" {
+		req.LostMessage = &lostMessage
+	}
+	resp := new(DeviceStatusResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "activationlock"), nil, req, resp)
+}
+
+// EscrowActivationLockResponse is the response of the escrowed Activation
+// Lock endpoint.
+type EscrowActivationLockResponse struct {
+	DeviceStatusResponse
+
+	// UnescrowedCodes contains the bypass codes of devices which were
+	// Activation Locked but whose codes failed to be stored as escrowed.
+	// These codes may only be escrowed as pending codes.
+	UnescrowedCodes map[string]string `json:"unescrowed_codes,omitempty"`
+}
+
+// EscrowActivationLock enables Activation Lock on devices of DEP name with
+// a newly generated bypass code for each device which depserver escrows.
+// The lostMessage can be empty.
+// Note that if every DEP API request fails an [HTTPError] is returned.
+func (c *Client) EscrowActivationLock(ctx context.Context, name, lostMessage string, serials ...string) (*EscrowActivationLockResponse, error) {
+	req := &DevicesRequestJson{Devices: serials}
+	if lostMessage != "" {
+		req.LostMessage = &lostMessage
+	}
+	resp := new(EscrowActivationLockResponse)
+	return resp, c.Do(ctx, http.MethodPost, devicesPath(name, "escrowlock"), nil, req, resp)
+}
+
+// EscrowedBypassCode is the escrowed Activation Lock bypass code of a device.
+type EscrowedBypassCode struct {
+	DEPName string `json:"dep_name"`
+	Serial  string `json:"serial_number"`
+	Code    string `json:"code"`
+
+	// PendingCode is a bypass code the device is being Activation Locked
+	// with which is not yet confirmed. The device may be locked with
+	// either code.
+	PendingCode string    `json:"pending_code,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BypassCodesResponse is the response of the escrowed bypass codes endpoint.
+type BypassCodesResponse struct {
+	BypassCodes map[string]EscrowedBypassCode `json:"bypass_codes,omitempty"`
+	DeviceErrors
+}
+
+// RetrieveBypassCodes returns the escrowed Activation Lock bypass codes of
+// devices of DEP name. Devices without escrowed codes are returned in the
+// errors. Note that if no codes are found an [HTTPError] is returned.
+func (c *Client) RetrieveBypassCodes(ctx context.Context, name string, serials ...string) (*BypassCodesResponse, error) {
+	resp := new(BypassCodesResponse)
+	return resp, c.Do(ctx, http.MethodGet, "v1/escrow/"+url.PathEscape(name), url.Values{"serial": serials}, nil, resp)
+}
@@ -0,0 +1,29 @@
+package apiclient
+
+//go:generate oa2js -o APIKey.json ../../docs/openapi.yaml APIKey
+//go:generate oa2js -o APIKeyRequest.json ../../docs/openapi.yaml APIKeyRequest
+//go:generate oa2js -o AccountDetail.json ../../docs/openapi.yaml AccountDetail
+//go:generate oa2js -o AssignerProfileUUID.json ../../docs/openapi.yaml AssignerProfileUUID
+//go:generate oa2js -o AuditEvent.json ../../docs/openapi.yaml AuditEvent
+//go:generate oa2js -o AuditQueryResponse.json ../../docs/openapi.yaml AuditQueryResponse
+//go:generate oa2js -o BypassCodeResponse.json ../../docs/openapi.yaml BypassCodeResponse
+//go:generate oa2js -o Config.json ../../docs/openapi.yaml Config
+//go:generate oa2js -o DEPNameBinding.json ../../docs/openapi.yaml DEPNameBinding
+//go:generate oa2js -o DEPNameDetails.json ../../docs/openapi.yaml DEPNameDetails
+//go:generate oa2js -o DEPNamesQueryResponse.json ../../docs/openapi.yaml DEPNamesQueryResponse
+//go:generate oa2js -o DevicesRequest.json ../../docs/openapi.yaml DevicesRequest
+//go:generate oa2js -o DuplicateDEPServerError.json ../../docs/openapi.yaml DuplicateDEPServerError
+//go:generate oa2js -o ErrorResponse.json ../../docs/openapi.yaml ErrorResponse
+//go:generate oa2js -o HistoryEntry.json ../../docs/openapi.yaml HistoryEntry
+//go:generate oa2js -o HistoryQueryResponse.json ../../docs/openapi.yaml HistoryQueryResponse
+//go:generate oa2js -o ImportResponse.json ../../docs/openapi.yaml ImportResponse
+//go:generate oa2js -o ImportResult.json ../../docs/openapi.yaml ImportResult
+//go:generate oa2js -o OAuth1Tokens.json ../../docs/openapi.yaml OAuth1Tokens
+//go:generate oa2js -o OSBetaToken.json ../../docs/openapi.yaml OSBetaToken
+//go:generate oa2js -o OSBetaTokens.json ../../docs/openapi.yaml OSBetaTokens
+//go:generate oa2js -o ProfileRequest.json ../../docs/openapi.yaml ProfileRequest
+//go:generate oa2js -o ProfileTemplate.json ../../docs/openapi.yaml ProfileTemplate
+//go:generate oa2js -o ServiceDiscoveryRequest.json ../../docs/openapi.yaml ServiceDiscoveryRequest
+//go:generate oa2js -o ServiceDiscoveryResponse.json ../../docs/openapi.yaml ServiceDiscoveryResponse
+//go:generate go-jsonschema -p $GOPACKAGE --tags json --only-models --output schema.go APIKey.json APIKeyRequest.json AccountDetail.json AssignerProfileUUID.json AuditEvent.json AuditQueryResponse.json BypassCodeResponse.json Config.json DEPNameBinding.json DEPNameDetails.json DEPNamesQueryResponse.json DevicesRequest.json DuplicateDEPServerError.json ErrorResponse.json HistoryEntry.json HistoryQueryResponse.json ImportResponse.json ImportResult.json OAuth1Tokens.json OSBetaToken.json OSBetaTokens.json ProfileRequest.json ProfileTemplate.json ServiceDiscoveryRequest.json ServiceDiscoveryResponse.json
+//go:generate rm -f APIKey.json APIKeyRequest.json AccountDetail.json AssignerProfileUUID.json AuditEvent.json AuditQueryResponse.json BypassCodeResponse.json Config.json DEPNameBinding.json DEPNameDetails.json DEPNamesQueryResponse.json DevicesRequest.json DuplicateDEPServerError.json ErrorResponse.json HistoryEntry.json HistoryQueryResponse.json ImportResponse.json ImportResult.json OAuth1Tokens.json OSBetaToken.json OSBetaTokens.json ProfileRequest.json ProfileTemplate.json ServiceDiscoveryRequest.json ServiceDiscoveryResponse.json
@@ -0,0 +1,81 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/micromdm/nanodep/godep"
+)
+
+// profilesPath returns the profile API path of action for DEP name.
+func profilesPath(name, action string) string {
+	p := "v1/profiles/" + url.PathEscape(name)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
+
+// GetProfile returns the profile with profileUUID of DEP name from the DEP API.
+func (c *Client) GetProfile(ctx context.Context, name, profileUUID string) (*godep.ProfileJson, error) {
+	q := url.Values{"profile_uuid": []string{profileUUID}}
+	resp := new(godep.ProfileJson)
+	return resp, c.Do(ctx, http.MethodGet, profilesPath(name, ""), q, nil, resp)
+}
+
+// profileRequest is a [ProfileRequestJson] with a typed DEP profile.
+type profileRequest struct {
+	Profile *godep.ProfileJson `json:"profile"`
+}
+
+// DefineProfile defines profile for DEP name using the DEP API.
+// If assign is true the defined profile UUID is also stored as the
+// assigner profile UUID of DEP name.
+func (c *Client) DefineProfile(ctx context.Context, name string, profile *godep.ProfileJson, assign bool) (*godep.DefineProfileResponseJson, error) {
+	resp := new(godep.DefineProfileResponseJson)
+	return resp, c.Do(ctx, http.MethodPost, profilesPath(name, defineAction(assign)), nil, &profileRequest{Profile: profile}, resp)
+}
+
+// DefineProfileFromTemplate defines a profile for DEP name from the stored
+// profile template with vars substituted using the DEP API.
+// If assign is true the defined profile UUID is also stored as the
+// assigner profile UUID of DEP name.
+func (c *Client) DefineProfileFromTemplate(ctx context.Context, name, template string, vars map[string]string, assign bool) (*godep.DefineProfileResponseJson, error) {
+	req := &ProfileRequestJson{Template: &template, Variables: vars}
+	resp := new(godep.DefineProfileResponseJson)
+	return resp, c.Do(ctx, http.MethodPost, profilesPath(name, defineAction(assign)), nil, req, resp)
+}
+
+func defineAction(assign bool) string {
+	if assign {
+		return "assigner"
+	}
+	return "define"
+}
+
+// ListProfileTemplates returns the names of all profile templates.
+func (c *Client) ListProfileTemplates(ctx context.Context) ([]string, error) {
+	var resp []string
+	return resp, c.Do(ctx, http.MethodGet, "v1/profile_templates", nil, nil, &resp)
+}
+
+// RetrieveProfileTemplate returns the profile template called name.
+func (c *Client) RetrieveProfileTemplate(ctx context.Context, name string) (*ProfileTemplateJson, error) {
+	resp := new(ProfileTemplateJson)
+	return resp, c.Do(ctx, http.MethodGet, "v1/profile_templates/"+url.PathEscape(name), nil, nil, resp)
+}
+
+// StoreProfileTemplate creates or replaces the profile template called
+// name. The template is DEP profile JSON with optional "${VARIABLE}"
+// placeholders inside JSON strings.
+func (c *Client) StoreProfileTemplate(ctx context.Context, name string, template []byte) (*ProfileTemplateJson, error) {
+	resp := new(ProfileTemplateJson)
+	return resp, c.Do(ctx, http.MethodPut, "v1/profile_templates/"+url.PathEscape(name), nil, json.RawMessage(template), resp)
+}
+
+// DeleteProfileTemplate deletes the profile template called name.
+func (c *Client) DeleteProfileTemplate(ctx context.Context, name string) error {
+	return c.Do(ctx, http.MethodDelete, "v1/profile_templates/"+url.PathEscape(name), nil, nil, nil)
+}
@@ -0,0 +1,113 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/micromdm/nanodep/godep"
+)
+
+// dryRunHeader matches the depserver proxy dry-run header.
+const dryRunHeader = "X-Nanodep-Dry-Run"
+
+type ctxKeyDryRun struct{}
+
+// WithDryRun creates a new context from ctx that marks proxied DEP API
+// requests as dry-runs. The depserver proxy answers mutating dry-run
+// requests itself without sending them to the DEP server. Requests denied
+// by the proxy policy are still denied and read-only requests are proxied
+// as normal.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyDryRun{}, true)
+}
+
+// proxyPath returns the depserver proxy path of the (escaped) DEP API
+// endpoint for DEP name.
+func proxyPath(name, endpoint string) string {
+	return "proxy/" + url.PathEscape(name) + "/" + strings.TrimPrefix(endpoint, "/")
+}
+
+// ProxyRequest sends a request to the DEP API endpoint (e.g. "/account"),
+// which may include a query string, for DEP name through the depserver
+// proxy. The response is returned if it has a 2xx status and the caller
+// is responsible for closing its body. Otherwise an [HTTPError] is returned.
+func (c *Client) ProxyRequest(ctx context.Context, name, method, endpoint string, body io.Reader) (*http.Response, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing endpoint: %w", err)
+	}
+	req, err := c.newRequest(ctx, method, proxyPath(name, endpointURL.EscapedPath()), endpointURL.Query(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if dryRun, _ := ctx.Value(ctxKeyDryRun{}).(bool); dryRun {
+		req.Header.Set(dryRunHeader, "1")
+	}
+	return c.do(req)
+}
+
+// ProxyDo sends a request to the DEP API endpoint for DEP name through
+// the depserver proxy. We encode in to JSON and decode any returned body
+// as JSON to out.
+func (c *Client) ProxyDo(ctx context.Context, name, method, endpoint string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		bodyBytes, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(bodyBytes)
+	}
+
+	resp, err := c.ProxyRequest(ctx, name, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding response body: %w", err)
+		}
+	}
+	return nil
+}
+
+// ProxyAccountDetail returns the DEP account details of DEP name
+// through the depserver proxy.
+func (c *Client) ProxyAccountDetail(ctx context.Context, name string) (*godep.AccountDetailJson, error) {
+	resp := new(godep.AccountDetailJson)
+	return resp, c.ProxyDo(ctx, name, http.MethodGet, "/account", nil, resp)
+}
+
+// ProxyDeviceDetails returns the details of devices of DEP name
+// through the depserver proxy.
+func (c *Client) ProxyDeviceDetails(ctx context.Context, name string, serials ...string) (*godep.DeviceListResponseJson, error) {
+	req := &godep.DeviceListRequestJson{Devices: serials}
+	resp := new(godep.DeviceListResponseJson)
+	return resp, c.ProxyDo(ctx, name, http.MethodPost, "/devices", req, resp)
+}
+
+// ProxyGetProfile returns the profile with profileUUID of DEP name
+// through the depserver proxy.
+func (c *Client) ProxyGetProfile(ctx context.Context, name, profileUUID string) (*godep.ProfileJson, error) {
+	resp := new(godep.ProfileJson)
+	return resp, c.ProxyDo(ctx, name, http.MethodGet, "/profile?profile_uuid="+url.QueryEscape(profileUUID), nil, resp)
+}
+
+// ProxyAssignProfile assigns profileUUID to devices of DEP name
+// through the depserver proxy.
+func (c *Client) ProxyAssignProfile(ctx context.Context, name, profileUUID string, serials ...string) (*godep.AssignProfileResponseJson, error) {
+	req := &godep.ProfileServiceRequestJson{ProfileUuid: &profileUUID, Devices: serials}
+	resp := new(godep.AssignProfileResponseJson)
+	return resp, c.ProxyDo(ctx, name, http.MethodPost, "/profile/devices", req, resp)
+}
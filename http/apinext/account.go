@@ -0,0 +1,64 @@
+package apinext
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/micromdm/nanodep/http/api"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// NewAccountDetailHandler returns a handler that returns the stored DEP
+// API account detail of a DEP name. The account detail is stored when
+// the tokens of the DEP name are uploaded. If no account detail is stored
+// or the "fetch" query parameter is true it is fetched from the DEP API
+// and stored.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewAccountDetailHandler(depClient api.AccountDetailFetcher, store api.AccountDetailStore, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		var fetch bool
+		if v := r.URL.Query().Get("fetch"); v != "" {
+			var err error
+			if fetch, err = strconv.ParseBool(v); err != nil {
+				logAndWriteJSONError(logger, w, "parsing fetch param", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		var detail *api.AccountDetail
+		if !fetch {
+			var err error
+			if detail, err = store.RetrieveAccountDetail(r.Context(), r.URL.Path); err != nil {
+				logAndWriteJSONError(logger, w, "retrieving account detail", err, 0)
+				return
+			}
+		}
+
+		if detail == nil {
+			var err error
+			if detail, err = api.FetchAccountDetail(r.Context(), depClient, r.URL.Path); err != nil {
+				logAndWriteJSONError(logger, w, "fetching account detail", err, http.StatusBadGateway)
+				return
+			}
+			if err = store.StoreAccountDetail(r.Context(), r.URL.Path, detail); err != nil {
+				logAndWriteJSONError(logger, w, "storing account detail", err, 0)
+				return
+			}
+			logger.Debug("msg", "stored account detail")
+		}
+
+		writeJSON(w, detail, http.StatusOK, logger)
+	}
+}
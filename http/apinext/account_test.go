@@ -0,0 +1,70 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeAccountDetailFetcher struct {
+	calls      int
+	serverName string
+}
+
+func (f *fakeAccountDetailFetcher) AccountDetail(context.Context, string) (*godep.AccountDetailJson, error) {
+	f.calls++
+	serverUUID := "4A0B1136DA3447E89C2486F4D342E5BB"
+	serverName := f.serverName
+	return &godep.AccountDetailJson{ServerUuid: &serverUUID, ServerName: &serverName}, nil
+}
+
+func getAccountDetail(t *testing.T, handler http.Handler, query string) *api.AccountDetail {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/mdmserver1"+query, nil)
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	detail := new(api.AccountDetail)
+	if err := json.NewDecoder(w.Body).Decode(detail); err != nil {
+		t.Fatal(err)
+	}
+	return detail
+}
+
+func TestAccountDetail(t *testing.T) {
+	depClient := &fakeAccountDetailFetcher{serverName: "server1"}
+	handler := NewAccountDetailHandler(depClient, inmem.New(), log.NopLogger)
+
+	// not stored: fetched and stored
+	if detail := getAccountDetail(t, handler, ""); *detail.ServerName != "server1" || detail.FetchedAt.IsZero() {
+		t.Errorf("unexpected account detail: %+v", detail)
+	}
+
+	// stored: not fetched
+	depClient.serverName = "server2"
+	if detail := getAccountDetail(t, handler, ""); *detail.ServerName != "server1" {
+		t.Errorf("expected stored account detail, have: %s", *detail.ServerName)
+	}
+	if have, want := depClient.calls, 1; have != want {
+		t.Errorf("fetch calls: have %d, want %d", have, want)
+	}
+
+	// forced fetch
+	if detail := getAccountDetail(t, handler, "?fetch=true"); *detail.ServerName != "server2" {
+		t.Errorf("expected fetched account detail, have: %s", *detail.ServerName)
+	}
+	if detail := getAccountDetail(t, handler, ""); *detail.ServerName != "server2" {
+		t.Errorf("expected stored account detail, have: %s", *detail.ServerName)
+	}
+}
@@ -0,0 +1,165 @@
+package apinext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/http/auth"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// APIKeyRequest is the request body for creating or replacing an API key.
+type APIKeyRequest struct {
+	Scopes   []string `json:"scopes"`
+	DEPNames []string `json:"dep_names,omitempty"`
+}
+
+// APIKeyResponse describes an API key.
+// The secret is only returned when the key is created or replaced.
+type APIKeyResponse struct {
+	Name      string    `json:"name"`
+	Secret    string    `json:"secret,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	DEPNames  []string  `json:"dep_names,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAPIKeyResponse(key *storage.APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		DEPNames:  key.DEPNames,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+// NewGetAPIKeysHandler returns a handler that returns an API key or,
+// if no name is provided, lists all API keys.
+// Secret hashes are never returned.
+//
+// Note the whole URL path is used as the API key name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewGetAPIKeysHandler(store storage.APIKeyStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		if r.URL.Path == "" {
+			keys, err := store.ListAPIKeys(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "listing API keys", err, 0)
+				return
+			}
+			ret := []*APIKeyResponse{}
+			for i := range keys {
+				ret = append(ret, newAPIKeyResponse(&keys[i]))
+			}
+			writeJSON(w, ret, http.StatusOK, logger)
+			return
+		}
+
+		key, err := store.RetrieveAPIKey(r.Context(), r.URL.Path)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "retrieving API key", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving API key", err, 0)
+			return
+		}
+		writeJSON(w, newAPIKeyResponse(key), http.StatusOK, logger)
+	}
+}
+
+// NewStoreAPIKeyHandler returns a handler that creates or replaces an
+// API key from an [APIKeyRequest] JSON body. A new secret is generated
+// and returned in the response. It is not possible to retrieve it later.
+// The adminUsername API key name is rejected as it would be shadowed by
+// the static admin credentials.
+//
+// Note the whole URL path is used as the API key name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewStoreAPIKeyHandler(store storage.APIKeyStorer, adminUsername string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" || strings.Contains(r.URL.Path, "/") {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("invalid API key name"), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == adminUsername {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("reserved API key name"), http.StatusBadRequest)
+			return
+		}
+
+		req := new(APIKeyRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			logAndWriteJSONError(logger, w, "decoding request", err, http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Scopes) < 1 {
+			logAndWriteJSONError(logger, w, "validating scopes", errors.New("no scopes"), http.StatusBadRequest)
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !slices.Contains(auth.Scopes, scope) {
+				logAndWriteJSONError(logger, w, "validating scopes", fmt.Errorf("invalid scope: %s", scope), http.StatusBadRequest)
+				return
+			}
+		}
+
+		secret, err := auth.GenerateSecret()
+		if err != nil {
+			logAndWriteJSONError(logger, w, "generating secret", err, 0)
+			return
+		}
+
+		key := &storage.APIKey{
+			Name:       r.URL.Path,
+			SecretHash: auth.HashSecret(secret),
+			Scopes:     req.Scopes,
+			DEPNames:   req.DEPNames,
+			CreatedAt:  time.Now().UTC().Truncate(time.Second),
+		}
+		if err = store.StoreAPIKey(r.Context(), key); err != nil {
+			logAndWriteJSONError(logger, w, "storing API key", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "stored API key", "scopes", strings.Join(key.Scopes, ","))
+
+		ret := newAPIKeyResponse(key)
+		ret.Secret = secret
+		writeJSON(w, ret, http.StatusOK, logger)
+	}
+}
+
+// NewDeleteAPIKeyHandler returns a handler that deletes an API key.
+//
+// Note the whole URL path is used as the API key name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewDeleteAPIKeyHandler(store storage.APIKeyStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		err := store.DeleteAPIKey(r.Context(), r.URL.Path)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "deleting API key", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "deleting API key", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "deleted API key")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,30 @@
+package apinext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestStoreAPIKeyAdminUsername(t *testing.T) {
+	store := inmem.New()
+	handler := http.StripPrefix("/v1/apikeys/", NewStoreAPIKeyHandler(store, "depserver", log.NopLogger))
+
+	r := httptest.NewRequest("PUT", "/v1/apikeys/depserver", strings.NewReader(`{"scopes":["admin"]}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusBadRequest; have != want {
+		t.Errorf("status: have %d, want %d", have, want)
+	}
+	if _, err := store.RetrieveAPIKey(context.Background(), "depserver"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected not found, got: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package apinext
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/proxy"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// statusRecorder captures the HTTP status written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap supports http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// auditBodySummary are the request body fields recorded in the audit log.
+// Note that we never record the whole body as it may contain secrets.
+type auditBodySummary struct {
+	Devices     []string `json:"devices"`
+	Device      string   `json:"device"`
+	ProfileUUID string   `json:"profile_uuid"`
+}
+
+// newAuditEvent assembles an audit event for r.
+// The request body is read (and replaced) to summarize it.
+func newAuditEvent(r *http.Request, name, endpoint string) *storage.AuditEvent {
+	event := &storage.AuditEvent{
+		Timestamp: time.Now().UTC(),
+		DEPName:   name,
+		Method:    r.Method,
+		Endpoint:  endpoint,
+		Identity:  dephttp.AuthIdentity(r.Context()),
+	}
+
+	var err error
+	event.ClientIP, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		event.ClientIP = r.RemoteAddr
+	}
+
+	if r.Body != nil {
+		body, err := dephttp.ReadAllAndReplaceBody(r)
+		summary := new(auditBodySummary)
+		// the body may not be JSON: only summarize it if it is
+		if err == nil && json.Unmarshal(body, summary) == nil {
+			event.Serials = summary.Devices
+			if summary.Device != "" {
+				event.Serials = append(event.Serials, summary.Device)
+			}
+			event.ProfileUUID = summary.ProfileUUID
+		}
+	}
+	if event.ProfileUUID == "" {
+		event.ProfileUUID = r.URL.Query().Get("profile_uuid")
+	}
+	if len(event.Serials) < 1 {
+		event.Serials = r.URL.Query()["serial"]
+	}
+
+	return event
+}
+
+// serveAndAudit calls next and stores the audit event with the response status.
+func serveAndAudit(next http.Handler, store storage.AuditStorer, logger log.Logger, w http.ResponseWriter, r *http.Request, event *storage.AuditEvent) {
+	rec := &statusRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+	event.Status = rec.status
+	if event.Status == 0 {
+		event.Status = http.StatusOK
+	}
+	// the proxy policy middleware marks dry-run responses
+	event.DryRun = rec.Header().Get(proxy.DryRunHeader) != ""
+
+	if err := store.StoreAuditEvent(r.Context(), event); err != nil {
+		ctxlog.Logger(r.Context(), logger).Info(
+			"msg", "storing audit event",
+			"name", event.DEPName,
+			"endpoint", event.Endpoint,
+			"err", err,
+		)
+	}
+}
+
+// NewAuditProxyMiddleware records mutating Apple DEP API requests passing
+// through the proxy to the audit log.
+//
+// The DEP name is read from the request context and the request URL path,
+// normalized with [proxy.CleanEndpoint], is used as the DEP API endpoint.
+// This means it should wrap the handler called by [proxy.ProxyDEPNameHandler].
+func NewAuditProxyMiddleware(next http.Handler, store storage.AuditStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !proxy.IsMutating(r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		event := newAuditEvent(r, client.GetName(r.Context()), proxy.CleanEndpoint(r.URL.Path))
+		serveAndAudit(next, store, logger, w, r, event)
+	}
+}
+
+// NewAuditAPIMiddleware records mutating (non-GET) requests to API endpoint
+// to the audit log.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this middleware.
+func NewAuditAPIMiddleware(next http.Handler, store storage.AuditStorer, endpoint string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		event := newAuditEvent(r, r.URL.Path, endpoint)
+		serveAndAudit(next, store, logger, w, r, event)
+	}
+}
+
+// NewAuditAllAPIMiddleware is like [NewAuditAPIMiddleware] but records
+// all requests including reads. Use for endpoints whose reads disclose
+// secrets.
+func NewAuditAllAPIMiddleware(next http.Handler, store storage.AuditStorer, endpoint string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		event := newAuditEvent(r, r.URL.Path, endpoint)
+		serveAndAudit(next, store, logger, w, r, event)
+	}
+}
+
+// NewAuditAdminAPIMiddleware is like [NewAuditAPIMiddleware] for API
+// endpoints whose URL path is not a DEP name, e.g. API key names. No DEP
+// name is recorded and the URL path is instead appended to endpoint.
+func NewAuditAdminAPIMiddleware(next http.Handler, store storage.AuditStorer, endpoint string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		event := newAuditEvent(r, "", endpoint+r.URL.Path)
+		serveAndAudit(next, store, logger, w, r, event)
+	}
+}
+
+// NewQueryAuditHandler returns a handler that queries the audit log.
+func NewQueryAuditHandler(store storage.AuditQuery, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		p, err := paginationFromQuery(r.URL.Query())
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing pagination params", err, http.StatusBadRequest)
+			return
+		}
+
+		filter := &storage.AuditQueryFilter{
+			DEPNames: r.URL.Query()["dep_name"],
+		}
+
+		if sinceRaw := r.URL.Query().Get("since"); sinceRaw != "" {
+			since, err := time.Parse(time.RFC3339, sinceRaw)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "parsing since param", err, http.StatusBadRequest)
+				return
+			}
+			filter.Since = &since
+		}
+
+		if untilRaw := r.URL.Query().Get("until"); untilRaw != "" {
+			until, err := time.Parse(time.RFC3339, untilRaw)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "parsing until param", err, http.StatusBadRequest)
+				return
+			}
+			filter.Until = &until
+		}
+
+		ret, err := store.QueryAuditEvents(r.Context(), &storage.AuditQueryRequest{
+			Filter:     filter,
+			Pagination: p,
+		})
+		if err != nil {
+			logAndWriteJSONError(logger, w, "querying audit events", err, 0)
+			return
+		}
+
+		logger.Debug("msg", fmt.Sprintf("queried audit events: %d", len(ret.Events)))
+
+		writeJSON(w, ret, http.StatusOK, logger)
+	}
+}
@@ -0,0 +1,144 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/proxy"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestAuditProxyDryRun(t *testing.T) {
+	store := inmem.New()
+	policy := &proxy.PolicyConfig{DEPNames: map[string]*proxy.Policy{
+		"dryrun": {DryRun: true},
+	}}
+	var proxied int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		w.Write([]byte(`{}`))
+	})
+	handler := NewAuditProxyMiddleware(proxy.PolicyMiddleware(next, policy, log.NopLogger), store, log.NopLogger)
+
+	for _, name := range []string{"dryrun", "live"} {
+		r := httptest.NewRequest("POST", "/devices/disown", strings.NewReader(`{"devices":["SERIAL1"]}`))
+		r = r.WithContext(client.WithName(r.Context(), name))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if have, want := w.Code, http.StatusOK; have != want {
+			t.Fatalf("status: have %d, want %d", have, want)
+		}
+	}
+	if have, want := proxied, 1; have != want {
+		t.Errorf("proxied: have %d, want %d", have, want)
+	}
+
+	r := httptest.NewRequest("GET", "/?dep_name=dryrun&dep_name=live", nil)
+	w := httptest.NewRecorder()
+	NewQueryAuditHandler(store, log.NopLogger).ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	resp := new(storage.AuditQueryResult)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(resp.Events), 2; have != want {
+		t.Fatalf("events: have %d, want %d", have, want)
+	}
+	for _, event := range resp.Events {
+		if have, want := event.DryRun, event.DEPName == "dryrun"; have != want {
+			t.Errorf("dry-run for %s: have %v, want %v", event.DEPName, have, want)
+		}
+		if have, want := event.Serials, []string{"SERIAL1"}; len(have) != 1 || have[0] != want[0] {
+			t.Errorf("serials for %s: have %v, want %v", event.DEPName, have, want)
+		}
+	}
+}
+
+func TestAuditProxyCleanEndpoint(t *testing.T) {
+	store := inmem.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	handler := NewAuditProxyMiddleware(next, store, log.NopLogger)
+
+	for _, path := range []string{"//devices/disown", "/devices/disown/", "/devices/./disown"} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"devices":["SERIAL1"]}`))
+		r.URL.Path = path
+		r = r.WithContext(client.WithName(r.Context(), "clean"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if have, want := w.Code, http.StatusOK; have != want {
+			t.Fatalf("%s: status: have %d, want %d", path, have, want)
+		}
+	}
+
+	// non-canonical paths to read-only endpoints are not audited
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	r.URL.Path = "//devices/"
+	r = r.WithContext(client.WithName(r.Context(), "clean"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	resp, err := store.QueryAuditEvents(context.Background(), &storage.AuditQueryRequest{Filter: &storage.AuditQueryFilter{DEPNames: []string{"clean"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(resp.Events), 3; have != want {
+		t.Fatalf("events: have %d, want %d", have, want)
+	}
+	for _, event := range resp.Events {
+		if have, want := event.Endpoint, "/devices/disown"; have != want {
+			t.Errorf("endpoint: have %q, want %q", have, want)
+		}
+	}
+}
+
+func TestAuditAdminAPI(t *testing.T) {
+	store := inmem.New()
+	mux := dephttp.NewMethodMux()
+	mux.Handle("PUT", NewStoreAPIKeyHandler(store, "depserver", log.NopLogger))
+	mux.Handle("DELETE", NewDeleteAPIKeyHandler(store, log.NopLogger))
+	handler := http.StripPrefix("/v1/apikeys/", NewAuditAdminAPIMiddleware(mux, store, "/v1/apikeys/", log.NopLogger))
+
+	for _, tc := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{"PUT", `{"scopes":["proxy:read"]}`, http.StatusOK},
+		{"DELETE", "", http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(tc.method, "/v1/apikeys/key1", strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if have, want := w.Code, tc.status; have != want {
+			t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+		}
+	}
+
+	res, err := store.QueryAuditEvents(context.Background(), &storage.AuditQueryRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(res.Events), 2; have != want {
+		t.Fatalf("events: have %d, want %d", have, want)
+	}
+	for _, event := range res.Events {
+		if have, want := event.Endpoint, "/v1/apikeys/key1"; have != want {
+			t.Errorf("endpoint: have %q, want %q", have, want)
+		}
+		if event.DEPName != "" {
+			t.Errorf("unexpected DEP name: %q", event.DEPName)
+		}
+	}
+}
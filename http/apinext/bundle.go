@@ -0,0 +1,176 @@
+package apinext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/bundle"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// PassphraseHeader is the HTTP header containing the passphrase for
+// encrypting and decrypting exported bundles.
+const PassphraseHeader = "X-Nanodep-Passphrase"
+
+// maxBundleSize is the maximum size of an imported bundle.
+const maxBundleSize = 32 << 20
+
+// ExportStorage retrieves and queries DEP names for exporting.
+type ExportStorage interface {
+	bundle.Retriever
+	storage.DEPNamesQuery
+}
+
+// NewExportHandler returns a handler that exports DEP names into an
+// encrypted bundle. The DEP names are selected using the same query
+// parameters as the DEP names query. If "dep_name" parameters are given
+// then only those DEP names are exported and the other filters are ignored.
+// The bundle is encrypted with the passphrase in the [PassphraseHeader].
+func NewExportHandler(store ExportStorage, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		passphrase := r.Header.Get(PassphraseHeader)
+		if passphrase == "" {
+			logAndWriteJSONError(logger, w, "validating passphrase", bundle.ErrEmptyPassphrase, http.StatusBadRequest)
+			return
+		}
+
+		filter, err := depNamesFilterFromQuery(r.URL.Query())
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing filter params", err, http.StatusBadRequest)
+			return
+		}
+
+		names := filter.DEPNames
+		if len(names) < 1 {
+			names, err = storage.AllDEPNames(r.Context(), store, filter)
+			if err != nil {
+				logAndWriteJSONError(logger, w, "querying DEP names", err, 0)
+				return
+			}
+		}
+
+		b, err := bundle.Export(r.Context(), store, names)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "exporting DEP names", err, 0)
+			return
+		}
+
+		data, err := bundle.Encrypt(b, passphrase)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "encrypting bundle", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "exported DEP names", "count", len(b.DEPNames))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(
+			`attachment; filename="nanodep-%s.json"`,
+			b.CreatedAt.Format("20060102T150405Z"),
+		))
+		if _, err = w.Write(data); err != nil {
+			logger.Info("msg", "writing body", "err", err)
+		}
+	}
+}
+
+// ImportResult is the result of importing a DEP name.
+type ImportResult struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+// ImportResponse is the response of importing a bundle.
+type ImportResponse struct {
+	CreatedAt time.Time      `json:"created_at"`
+	DryRun    bool           `json:"dry_run"`
+	Results   []ImportResult `json:"results"`
+}
+
+// NewImportHandler returns a handler that imports DEP names from the
+// encrypted bundle in the request body. The bundle is decrypted with the
+// passphrase in the [PassphraseHeader]. The "existing" query parameter
+// sets the policy for DEP names which already exist: skip (the default),
+// overwrite, or fail. Nothing is imported if any DEP name exists with the
+// fail policy. Setting the "dry_run" query parameter to true only
+// reports what would be imported.
+func NewImportHandler(store bundle.Restorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		passphrase := r.Header.Get(PassphraseHeader)
+		if passphrase == "" {
+			logAndWriteJSONError(logger, w, "validating passphrase", bundle.ErrEmptyPassphrase, http.StatusBadRequest)
+			return
+		}
+
+		existing := bundle.ExistingSkip
+		if r.URL.Query().Has("existing") {
+			existing = r.URL.Query().Get("existing")
+		}
+		if !bundle.ValidExisting(existing) {
+			logAndWriteJSONError(logger, w, "validating existing param", fmt.Errorf("invalid existing policy: %s", existing), http.StatusBadRequest)
+			return
+		}
+
+		var dryRun bool
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				logAndWriteJSONError(logger, w, "parsing dry_run param", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading body", err, http.StatusBadRequest)
+			return
+		}
+
+		b, err := bundle.Decrypt(data, passphrase)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "decrypting bundle", err, http.StatusBadRequest)
+			return
+		}
+
+		ret := &ImportResponse{CreatedAt: b.CreatedAt, DryRun: dryRun}
+
+		// check all DEP names before changing any
+		for _, d := range b.DEPNames {
+			result, err := bundle.Restore(r.Context(), store, d, existing, true)
+			if errors.Is(err, bundle.ErrExists) {
+				logAndWriteJSONError(logger, w, "checking DEP name "+d.Name, err, http.StatusConflict)
+				return
+			} else if err != nil {
+				logAndWriteJSONError(logger, w, "checking DEP name "+d.Name, err, 0)
+				return
+			}
+			ret.Results = append(ret.Results, ImportResult{Name: d.Name, Result: result})
+		}
+
+		if !dryRun {
+			for i, d := range b.DEPNames {
+				result, err := bundle.Restore(r.Context(), store, d, existing, false)
+				if err != nil {
+					logAndWriteJSONError(logger, w, "importing DEP name "+d.Name, err, 0)
+					return
+				}
+				ret.Results[i].Result = result
+			}
+		}
+
+		logger.Debug("msg", "imported DEP names", "count", len(ret.Results), "dry_run", dryRun)
+
+		writeJSON(w, ret, http.StatusOK, logger)
+	}
+}
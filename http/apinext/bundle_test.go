@@ -0,0 +1,91 @@
+package apinext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src, dst := inmem.New(), inmem.New()
+	if err := src.StoreCursor(ctx, "mdmserver1", "cursor"); err != nil {
+		t.Fatal(err)
+	}
+
+	// export
+	r := httptest.NewRequest("GET", "/?dep_name=mdmserver1", nil)
+	r.URL.Path = ""
+	w := httptest.NewRecorder()
+	NewExportHandler(src, log.NopLogger).ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusBadRequest; have != want {
+		t.Fatalf("missing passphrase status: have %d, want %d", have, want)
+	}
+	r.Header.Set(PassphraseHeader, "secret")
+	w = httptest.NewRecorder()
+	NewExportHandler(src, log.NopLogger).ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("export status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	exported := w.Body.Bytes()
+
+	doImport := func(passphrase, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/"+query, bytes.NewReader(exported))
+		r.URL.Path = ""
+		r.Header.Set(PassphraseHeader, passphrase)
+		w := httptest.NewRecorder()
+		NewImportHandler(dst, log.NopLogger).ServeHTTP(w, r)
+		return w
+	}
+
+	for _, test := range []struct {
+		name       string
+		passphrase string
+		query      string
+		status     int
+		result     string
+	}{
+		{"wrong-passphrase", "wrong", "", http.StatusBadRequest, ""},
+		{"invalid-existing", "secret", "?existing=maybe", http.StatusBadRequest, ""},
+		{"dry-run", "secret", "?dry_run=true", http.StatusOK, "would store"},
+		{"import", "secret", "", http.StatusOK, "stored"},
+		{"skip", "secret", "", http.StatusOK, "skipped existing"},
+		{"fail", "secret", "?existing=fail", http.StatusConflict, ""},
+		{"overwrite", "secret", "?existing=overwrite", http.StatusOK, "overwritten"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := doImport(test.passphrase, test.query)
+			if have, want := w.Code, test.status; have != want {
+				t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+			}
+			if test.result == "" {
+				return
+			}
+			ret := new(ImportResponse)
+			if err := json.NewDecoder(w.Body).Decode(ret); err != nil {
+				t.Fatal(err)
+			}
+			if len(ret.Results) != 1 || ret.Results[0].Name != "mdmserver1" {
+				t.Fatalf("results: %v", ret.Results)
+			}
+			if have, want := ret.Results[0].Result, test.result; have != want {
+				t.Errorf("result: have %q, want %q", have, want)
+			}
+		})
+	}
+
+	cursor, err := dst.RetrieveCursor(ctx, "mdmserver1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cursor, "cursor"; have != want {
+		t.Errorf("cursor: have %q, want %q", have, want)
+	}
+}
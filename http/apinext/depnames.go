@@ -1,9 +1,13 @@
 package apinext
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/micromdm/nanodep/storage"
 
@@ -11,46 +15,36 @@ import (
 	"github.com/micromdm/nanolib/log/ctxlog"
 )
 
+// DEPNamesQueryResponse is the response of the DEP names query.
+type DEPNamesQueryResponse struct {
+	DEPNames []string `json:"dep_names"`
+
+	// Details contains the metadata of each DEP name in DEPNames.
+	Details []storage.DEPNameDetails `json:"details,omitempty"`
+
+	storage.PaginationNextCursor
+}
+
 // NewQueryDEPNamesHandler returns a handler that queries DEP names.
 func NewQueryDEPNamesHandler(store storage.DEPNamesQuery, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		p := new(storage.Pagination)
-
 		logger := ctxlog.Logger(r.Context(), logger)
 
-		var err error
-		// extract and set pagination limit
-		if limitRaw := r.URL.Query().Get("limit"); limitRaw != "" {
-			limit, err := strconv.Atoi(limitRaw)
-			if err != nil {
-				logAndWriteJSONError(logger, w, "converting limit param", err, http.StatusBadRequest)
-				return
-			}
-
-			p.Limit = &limit
-		}
-
-		// extract and set pagination offset
-		if offsetRaw := r.URL.Query().Get("offset"); offsetRaw != "" {
-			offset, err := strconv.Atoi(offsetRaw)
-			if err != nil {
-				logAndWriteJSONError(logger, w, "converting offset param", err, http.StatusBadRequest)
-				return
-			}
-
-			p.Offset = &offset
+		p, err := paginationFromQuery(r.URL.Query())
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing pagination params", err, http.StatusBadRequest)
+			return
 		}
 
-		// extract and set pagination cursor
-		if cursorRaw := r.URL.Query().Get("cursor"); cursorRaw != "" {
-			p.Cursor = &cursorRaw
+		filter, err := depNamesFilterFromQuery(r.URL.Query())
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing filter params", err, http.StatusBadRequest)
+			return
 		}
 
 		// assemble the query request
 		q := &storage.DEPNamesQueryRequest{
-			Filter: &storage.DEPNamesQueryFilter{
-				DEPNames: r.URL.Query()["dep_name"],
-			},
+			Filter:     filter,
 			Pagination: p,
 		}
 
@@ -65,6 +59,111 @@ func NewQueryDEPNamesHandler(store storage.DEPNamesQuery, logger log.Logger) htt
 		logger.Debug("msg", fmt.Sprintf("queried DEP names: %d", len(ret.DEPNames)))
 
 		// output the return
-		writeJSON(w, ret, http.StatusOK, logger)
+		writeJSON(w, &DEPNamesQueryResponse{
+			DEPNames:             ret.Names(),
+			Details:              ret.DEPNames,
+			PaginationNextCursor: ret.PaginationNextCursor,
+		}, http.StatusOK, logger)
+	}
+}
+
+// depNamesFilterFromQuery parses the DEP names query filter from q.
+func depNamesFilterFromQuery(q url.Values) (*storage.DEPNamesQueryFilter, error) {
+	filter := &storage.DEPNamesQueryFilter{
+		DEPNames:   q["dep_name"],
+		NamePrefix: q.Get("name_prefix"),
+	}
+
+	if q.Has("has_tokens") {
+		hasTokens, err := strconv.ParseBool(q.Get("has_tokens"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing has_tokens: %w", err)
+		}
+		filter.HasTokens = &hasTokens
+	}
+
+	if q.Has("expiring_before") {
+		expiringBefore, err := time.Parse(time.RFC3339, q.Get("expiring_before"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing expiring_before: %w", err)
+		}
+		filter.ExpiringBefore = &expiringBefore
+	}
+
+	if q.Has("base_url") {
+		baseURL := q.Get("base_url")
+		filter.BaseURL = &baseURL
+	}
+
+	return filter, nil
+}
+
+// NewDeleteDEPNameHandler returns a handler that deletes DEP name data.
+// The "confirm" query parameter must match the DEP name. Optional "part"
+// query parameters select which data parts to delete, otherwise all
+// data for the DEP name is deleted.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewDeleteDEPNameHandler(store storage.DEPNameDeleter, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Query().Get("confirm") != r.URL.Path {
+			logAndWriteJSONError(logger, w, "confirming deletion", errors.New("confirm parameter does not match DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		parts := r.URL.Query()["part"]
+		if err := storage.ValidateParts(parts); err != nil {
+			logAndWriteJSONError(logger, w, "validating parts", err, http.StatusBadRequest)
+			return
+		}
+
+		if err := store.DeleteDEPName(r.Context(), r.URL.Path, parts...); err != nil {
+			logAndWriteJSONError(logger, w, "deleting DEP name", err, 0)
+			return
+		}
+
+		logger.Info("msg", "deleted DEP name", "parts", strings.Join(parts, ","))
+
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// paginationFromQuery extracts the pagination parameters from q.
+func paginationFromQuery(q url.Values) (*storage.Pagination, error) {
+	p := new(storage.Pagination)
+
+	// extract and set pagination limit
+	if limitRaw := q.Get("limit"); limitRaw != "" {
+		limit, err := strconv.Atoi(limitRaw)
+		if err != nil {
+			return nil, fmt.Errorf("converting limit param: %w", err)
+		}
+
+		p.Limit = &limit
+	}
+
+	// extract and set pagination offset
+	if offsetRaw := q.Get("offset"); offsetRaw != "" {
+		offset, err := strconv.Atoi(offsetRaw)
+		if err != nil {
+			return nil, fmt.Errorf("converting offset param: %w", err)
+		}
+
+		p.Offset = &offset
+	}
+
+	// extract and set pagination cursor
+	if cursorRaw := q.Get("cursor"); cursorRaw != "" {
+		p.Cursor = &cursorRaw
+	}
+
+	return p, nil
+}
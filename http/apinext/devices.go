@@ -0,0 +1,409 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+const (
+	// DeviceChunkSize is the maximum number of serial numbers sent in
+	// a single DEP API request. Apple limits the device and profile
+	// endpoints to 1000 devices per request.
+	DeviceChunkSize = 1000
+
+	// MaxDevices is the maximum number of serial numbers accepted in a
+	// single device API request.
+	MaxDevices = 100000
+
+	// MaxActivationLockDevices is the maximum number of serial numbers
+	// accepted in a single Activation Lock API request. The DEP API only
+	// supports a single device per Activation Lock request.
+	MaxActivationLockDevices = 100
+
+	// ActivationLockConcurrency is the maximum number of concurrent DEP
+	// API requests made for a single Activation Lock API request.
+	ActivationLockConcurrency = 4
+
+	// ActivationLockTimeout is the timeout of each DEP API request made
+	// for an Activation Lock API request.
+	ActivationLockTimeout = 30 * time.Second
+)
+
+// chunkLimits limits the DEP API requests made for a device API request.
+type chunkLimits struct {
+	// size is the maximum number of serial numbers per DEP API request.
+	size int
+
+	// concurrency is the maximum number of concurrent DEP API requests.
+	// Requests are made sequentially if less than two.
+	concurrency int
+
+	// timeout is the timeout of each DEP API request, if positive.
+	timeout time.Duration
+}
+
+// deviceChunkLimits limits the DEP API requests of the device endpoints.
+var deviceChunkLimits = chunkLimits{size: DeviceChunkSize}
+
+// activationLockChunkLimits limits the DEP API requests of the
+// Activation Lock endpoints.
+var activationLockChunkLimits = chunkLimits{
+	size:        1, // the DEP API only supports a single device
+	concurrency: ActivationLockConcurrency,
+	timeout:     ActivationLockTimeout,
+}
+
+// serialRe matches valid device serial numbers.
+var serialRe = regexp.MustCompile(`^[A-Za-z0-9]{1,64}$`)
+
+// DevicesRequest is the request body of the device API endpoints.
+type DevicesRequest struct {
+	// Devices are the device serial numbers.
+	Devices []string `json:"devices"`
+
+	// ProfileUUID is the profile to assign. Only used for assigning profiles.
+	ProfileUUID string `json:"profile_uuid,omitempty"`
+
+	// EscrowKey and LostMessage are optional. Only used for Activation Lock.
+	EscrowKey   string `json:"escrow_key,omitempty"`
+	LostMessage string `json:"lost_message,omitempty"`
+}
+
+// DeviceErrors contains the error of each serial number whose DEP API
+// request failed.
+type DeviceErrors struct {
+	Errors map[string]string `json:"errors,omitempty"`
+
+	// mu protects the response from concurrent DEP API requests.
+	mu sync.Mutex
+}
+
+func (e *DeviceErrors) setError(serials []string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Errors == nil {
+		e.Errors = make(map[string]string)
+	}
+	for _, serial := range serials {
+		e.Errors[serial] = err.Error()
+	}
+}
+
+// DeviceDetailsResponse is the response of the device details endpoint.
+type DeviceDetailsResponse struct {
+	godep.DeviceListResponseJson
+	DeviceErrors
+}
+
+func (r *DeviceDetailsResponse) set(devices map[string]godep.DeviceJson) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Devices == nil {
+		r.Devices = make(map[string]godep.DeviceJson)
+	}
+	for serial, device := range devices {
+		r.Devices[serial] = device
+	}
+}
+
+// DeviceStatusResponse is the response of the device endpoints returning
+// a status for each serial number.
+type DeviceStatusResponse struct {
+	godep.DeviceStatusResponseJson
+	DeviceErrors
+}
+
+func (r *DeviceStatusResponse) set(serial string, status godep.DeviceStatusResponseJsonDevicesValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Devices == nil {
+		r.Devices = make(map[string]godep.DeviceStatusResponseJsonDevicesValue)
+	}
+	r.Devices[serial] = status
+}
+
+// AssignProfileResponse is the response of the profile assignment endpoint.
+type AssignProfileResponse struct {
+	godep.AssignProfileResponseJson
+	DeviceErrors
+}
+
+func (r *AssignProfileResponse) set(profileUUID string, devices map[string]godep.AssignProfileResponseJsonDevicesValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ProfileUuid = &profileUUID
+	if r.Devices == nil {
+		r.Devices = make(map[string]godep.AssignProfileResponseJsonDevicesValue)
+	}
+	for serial, status := range devices {
+		r.Devices[serial] = status
+	}
+}
+
+// validateSerials trims, de-duplicates, and validates serials.
+func validateSerials(serials []string) ([]string, error) {
+	if len(serials) < 1 {
+		return nil, errors.New("no devices")
+	}
+	if len(serials) > MaxDevices {
+		return nil, fmt.Errorf("too many devices: %d (max %d)", len(serials), MaxDevices)
+	}
+	seen := make(map[string]struct{}, len(serials))
+	ret := make([]string, 0, len(serials))
+	for _, serial := range serials {
+		serial = strings.TrimSpace(serial)
+		if !serialRe.MatchString(serial) {
+			return nil, fmt.Errorf("invalid serial number: %q", serial)
+		}
+		if _, ok := seen[serial]; ok {
+			continue
+		}
+		seen[serial] = struct{}{}
+		ret = append(ret, serial)
+	}
+	return ret, nil
+}
+
+// validateActivationLock limits the number of devices of an Activation
+// Lock request as each device is a separate DEP API request.
+func validateActivationLock(req *DevicesRequest) error {
+	if len(req.Devices) > MaxActivationLockDevices {
+		return fmt.Errorf("too many devices: %d (max %d)", len(req.Devices), MaxActivationLockDevices)
+	}
+	return nil
+}
+
+// chunkSerials splits serials into chunks of at most size.
+func chunkSerials(serials []string, size int) (chunks [][]string) {
+	for len(serials) > size {
+		chunks = append(chunks, serials[:size])
+		serials = serials[size:]
+	}
+	return append(chunks, serials)
+}
+
+// deviceHandler decodes and validates a devices request and calls fn with
+// each chunk of serial numbers. Errors returned from fn are recorded for
+// the serial numbers of the chunk. The result of fn is written as JSON.
+// If every chunk failed the HTTP status is 502 Bad Gateway.
+// If limits allow concurrent chunks then fn must be safe to call
+// concurrently, e.g. by only modifying the result under its lock.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix (and action suffix) before using this handler.
+func deviceHandler[T any](logger log.Logger, limits chunkLimits, validate func(*DevicesRequest) error, fn func(ctx context.Context, name string, req *DevicesRequest, serials []string, ret *T) error, errs func(*T) *DeviceErrors) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		req := new(DevicesRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			logAndWriteJSONError(logger, w, "decoding request", err, http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if req.Devices, err = validateSerials(req.Devices); err != nil {
+			logAndWriteJSONError(logger, w, "validating devices", err, http.StatusBadRequest)
+			return
+		}
+		if validate != nil {
+			if err = validate(req); err != nil {
+				logAndWriteJSONError(logger, w, "validating request", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		ret := new(T)
+		var failed atomic.Int64
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, max(limits.concurrency, 1))
+		chunks := chunkSerials(req.Devices, limits.size)
+		for _, chunk := range chunks {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				ctx := r.Context()
+				if limits.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, limits.timeout)
+					defer cancel()
+				}
+				if err := fn(ctx, r.URL.Path, req, chunk, ret); err != nil {
+					logger.Info("msg", "device request", "devices", len(chunk), "err", err)
+					errs(ret).setError(chunk, err)
+					failed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		logger.Debug(
+			"msg", "device request",
+			"devices", len(req.Devices),
+			"chunks", len(chunks),
+			"failed", failed.Load(),
+		)
+
+		status := http.StatusOK
+		if int(failed.Load()) == len(chunks) {
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, ret, status, logger)
+	}
+}
+
+// DeviceDetailser retrieves device details from the DEP API.
+type DeviceDetailser interface {
+	DeviceDetails(ctx context.Context, name string, serials ...string) (*godep.DeviceListResponseJson, error)
+}
+
+// NewDeviceDetailsHandler returns a handler that retrieves the details
+// of devices from the DEP API.
+func NewDeviceDetailsHandler(client DeviceDetailser, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, deviceChunkLimits, nil,
+		func(ctx context.Context, name string, _ *DevicesRequest, serials []string, ret *DeviceDetailsResponse) error {
+			resp, err := client.DeviceDetails(ctx, name, serials...)
+			if err != nil {
+				return err
+			}
+			ret.set(resp.Devices)
+			return nil
+		},
+		func(ret *DeviceDetailsResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
+
+// ProfileAssigner assigns profiles to devices using the DEP API.
+type ProfileAssigner interface {
+	AssignProfile(ctx context.Context, name, uuid string, serials ...string) (*godep.AssignProfileResponseJson, error)
+}
+
+// NewAssignProfileHandler returns a handler that assigns a profile to
+// devices using the DEP API.
+func NewAssignProfileHandler(client ProfileAssigner, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, deviceChunkLimits,
+		func(req *DevicesRequest) error {
+			if req.ProfileUUID == "" {
+				return errors.New("missing profile UUID")
+			}
+			return nil
+		},
+		func(ctx context.Context, name string, req *DevicesRequest, serials []string, ret *AssignProfileResponse) error {
+			resp, err := client.AssignProfile(ctx, name, req.ProfileUUID, serials...)
+			if err != nil {
+				failed := make(map[string]godep.AssignProfileResponseJsonDevicesValue, len(serials))
+				for _, serial := range serials {
+					failed[serial] = godep.AssignProfileResponseJsonDevicesValueFAILED
+				}
+				ret.set(req.ProfileUUID, failed)
+				return err
+			}
+			ret.set(req.ProfileUUID, resp.Devices)
+			return nil
+		},
+		func(ret *AssignProfileResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
+
+// ProfileRemover removes (unassigns) profiles from devices using the DEP API.
+type ProfileRemover interface {
+	RemoveProfile(ctx context.Context, name string, serials ...string) (*godep.ClearProfileResponseJson, error)
+}
+
+// NewUnassignProfileHandler returns a handler that removes profile
+// assignments from devices using the DEP API.
+func NewUnassignProfileHandler(client ProfileRemover, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, deviceChunkLimits, nil,
+		func(ctx context.Context, name string, _ *DevicesRequest, serials []string, ret *DeviceStatusResponse) error {
+			resp, err := client.RemoveProfile(ctx, name, serials...)
+			if err != nil {
+				for _, serial := range serials {
+					ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				}
+				return err
+			}
+			for serial, status := range resp.Devices {
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValue(status))
+			}
+			return nil
+		},
+		func(ret *DeviceStatusResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
+
+// DeviceDisowner disowns devices using the DEP API.
+type DeviceDisowner interface {
+	DisownDevices(ctx context.Context, name string, serials ...string) (*godep.DeviceStatusResponseJson, error)
+}
+
+// NewDisownDevicesHandler returns a handler that disowns devices using
+// the DEP API.
+// WARNING: This will permanantly remove devices from the ABM/ASM/ABE instance.
+func NewDisownDevicesHandler(client DeviceDisowner, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, deviceChunkLimits, nil,
+		func(ctx context.Context, name string, _ *DevicesRequest, serials []string, ret *DeviceStatusResponse) error {
+			resp, err := client.DisownDevices(ctx, name, serials...)
+			if err != nil {
+				for _, serial := range serials {
+					ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				}
+				return err
+			}
+			for serial, status := range resp.Devices {
+				ret.set(serial, status)
+			}
+			return nil
+		},
+		func(ret *DeviceStatusResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
+
+// ActivationLocker enables Activation Lock on devices using the DEP API.
+type ActivationLocker interface {
+	ActivationLock(ctx context.Context, name string, device, escrowKey, lostMessage string) (*godep.ActivationLockStatusResponseJson, error)
+}
+
+// NewActivationLockHandler returns a handler that enables Activation Lock
+// on devices using the DEP API. The DEP API only supports a single device
+// per request so the response status of each device is the DEP API
+// "response_status" of its request. At most [MaxActivationLockDevices]
+// devices are accepted. Up to [ActivationLockConcurrency] devices are
+// locked concurrently, each limited to [ActivationLockTimeout].
+func NewActivationLockHandler(client ActivationLocker, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, activationLockChunkLimits, validateActivationLock,
+		func(ctx context.Context, name string, req *DevicesRequest, serials []string, ret *DeviceStatusResponse) error {
+			// chunk size of 1 means only a single serial
+			serial := serials[0]
+			resp, err := client.ActivationLock(ctx, name, serial, req.EscrowKey, req.LostMessage)
+			if err != nil {
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				return err
+			}
+			ret.set(serial, godep.DeviceStatusResponseJsonDevicesValue(resp.ResponseStatus))
+			return nil
+		},
+		func(ret *DeviceStatusResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
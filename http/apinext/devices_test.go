@@ -0,0 +1,230 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeDisowner struct {
+	calls int
+	fail  string
+}
+
+func (f *fakeDisowner) DisownDevices(_ context.Context, name string, serials ...string) (*godep.DeviceStatusResponseJson, error) {
+	f.calls++
+	if len(serials) > DeviceChunkSize {
+		return nil, fmt.Errorf("too many serials: %d", len(serials))
+	}
+	resp := &godep.DeviceStatusResponseJson{Devices: make(map[string]godep.DeviceStatusResponseJsonDevicesValue)}
+	for _, serial := range serials {
+		if serial == f.fail {
+			return nil, errors.New("chunk failed")
+		}
+		resp.Devices[serial] = godep.DeviceStatusResponseJsonDevicesValueSUCCESS
+	}
+	return resp, nil
+}
+
+func TestDeviceHandler(t *testing.T) {
+	var serials []string
+	for i := 0; i < 2500; i++ {
+		serials = append(serials, fmt.Sprintf("SERIAL%05d", i))
+	}
+	// duplicates should be removed
+	serials = append(serials, serials[0])
+
+	client := &fakeDisowner{fail: serials[2100]}
+	handler := NewDisownDevicesHandler(client, log.NopLogger)
+
+	body, _ := json.Marshal(&DevicesRequest{Devices: serials})
+	r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(string(body)))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	if have, want := client.calls, 3; have != want {
+		t.Errorf("calls: have %d, want %d", have, want)
+	}
+
+	resp := new(DeviceStatusResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(resp.Devices), 2500; have != want {
+		t.Errorf("devices: have %d, want %d", have, want)
+	}
+	if have, want := resp.Devices[serials[0]], godep.DeviceStatusResponseJsonDevicesValueSUCCESS; have != want {
+		t.Errorf("status: have %q, want %q", have, want)
+	}
+	// the whole third chunk failed
+	if have, want := resp.Devices[serials[2499]], godep.DeviceStatusResponseJsonDevicesValueFAILED; have != want {
+		t.Errorf("status: have %q, want %q", have, want)
+	}
+	if have, want := len(resp.Errors), 500; have != want {
+		t.Errorf("errors: have %d, want %d", have, want)
+	}
+
+	for _, test := range []struct {
+		name    string
+		devices []string
+	}{
+		{"empty", nil},
+		{"invalid", []string{"ABC", "not a serial"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			body, _ := json.Marshal(&DevicesRequest{Devices: test.devices})
+			r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(string(body)))
+			r.URL.Path = "mdmserver1"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if have, want := w.Code, http.StatusBadRequest; have != want {
+				t.Errorf("status: have %d, want %d", have, want)
+			}
+		})
+	}
+}
+
+type fakeAssigner struct{}
+
+func (f *fakeAssigner) AssignProfile(_ context.Context, name, uuid string, serials ...string) (*godep.AssignProfileResponseJson, error) {
+	resp := &godep.AssignProfileResponseJson{Devices: make(map[string]godep.AssignProfileResponseJsonDevicesValue)}
+	for _, serial := range serials {
+		resp.Devices[serial] = godep.AssignProfileResponseJsonDevicesValueSUCCESS
+	}
+	return resp, nil
+}
+
+func TestAssignProfileChunks(t *testing.T) {
+	var serials []string
+	for i := 0; i < 2500; i++ {
+		serials = append(serials, fmt.Sprintf("SERIAL%05d", i))
+	}
+
+	// the results of all three chunks are merged
+	handler := NewAssignProfileHandler(&fakeAssigner{}, log.NopLogger)
+
+	body, _ := json.Marshal(&DevicesRequest{Devices: serials, ProfileUUID: "43277A13FBCA0CFC"})
+	r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(string(body)))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	resp := new(AssignProfileResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(resp.Devices), 2500; have != want {
+		t.Errorf("devices: have %d, want %d", have, want)
+	}
+	if resp.ProfileUuid == nil || *resp.ProfileUuid != "43277A13FBCA0CFC" {
+		t.Errorf("unexpected profile UUID: %v", resp.ProfileUuid)
+	}
+}
+
+type countingActivationLocker struct {
+	calls int
+}
+
+func (f *countingActivationLocker) ActivationLock(_ context.Context, name string, device, escrowKey, lostMessage string) (*godep.ActivationLockStatusResponseJson, error) {
+	f.calls++
+	return &godep.ActivationLockStatusResponseJson{SerialNumber: device, ResponseStatus: "SUCCESS"}, nil
+}
+
+func TestActivationLockMaxDevices(t *testing.T) {
+	var serials []string
+	for i := 0; i <= MaxActivationLockDevices; i++ {
+		serials = append(serials, fmt.Sprintf("SERIAL%05d", i))
+	}
+	body, _ := json.Marshal(&DevicesRequest{Devices: serials})
+
+	client := new(countingActivationLocker)
+	for _, handler := range []http.Handler{
+		NewActivationLockHandler(client, log.NopLogger),
+		NewEscrowActivationLockHandler(client, inmem.New(), log.NopLogger),
+	} {
+		r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(string(body)))
+		r.URL.Path = "mdmserver1"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if have, want := w.Code, http.StatusBadRequest; have != want {
+			t.Errorf("status: have %d, want %d", have, want)
+		}
+	}
+	if client.calls > 0 {
+		t.Errorf("unexpected Activation Lock requests: %d", client.calls)
+	}
+}
+
+// blockingActivationLocker blocks until the request context is done
+// and tracks the number of concurrent requests.
+type blockingActivationLocker struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (f *blockingActivationLocker) ActivationLock(ctx context.Context, name string, device, escrowKey, lostMessage string) (*godep.ActivationLockStatusResponseJson, error) {
+	f.mu.Lock()
+	f.active++
+	f.maxActive = max(f.maxActive, f.active)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestActivationLockLimits(t *testing.T) {
+	defer func(limits chunkLimits) { activationLockChunkLimits = limits }(activationLockChunkLimits)
+	activationLockChunkLimits.timeout = 10 * time.Millisecond
+
+	var serials []string
+	for i := 0; i < 2*ActivationLockConcurrency; i++ {
+		serials = append(serials, fmt.Sprintf("SERIAL%05d", i))
+	}
+	body, _ := json.Marshal(&DevicesRequest{Devices: serials})
+
+	client := new(blockingActivationLocker)
+	r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(string(body)))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	NewActivationLockHandler(client, log.NopLogger).ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusBadGateway; have != want {
+		t.Errorf("status: have %d, want %d", have, want)
+	}
+	resp := new(DeviceStatusResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, serial := range serials {
+		if have, want := resp.Errors[serial], context.DeadlineExceeded.Error(); have != want {
+			t.Errorf("error for %s: have %q, want %q", serial, have, want)
+		}
+	}
+	if have, want := client.maxActive, ActivationLockConcurrency; have != want {
+		t.Errorf("concurrent requests: have %d, want %d", have, want)
+	}
+}
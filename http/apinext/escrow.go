@@ -0,0 +1,191 @@
+package apinext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/micromdm/nanodep/albc"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// activationLockSuccess is the DEP API Activation Lock response status
+// of a successfully locked device.
+const activationLockSuccess = "SUCCESS"
+
+// EscrowActivationLockResponse is the response of the escrowed Activation
+// Lock endpoint.
+type EscrowActivationLockResponse struct {
+	DeviceStatusResponse
+
+	// UnescrowedCodes contains the bypass codes of devices which were
+	// Activation Locked but whose codes failed to be stored as escrowed.
+	// These codes may only be escrowed as pending codes.
+	UnescrowedCodes map[string]string `json:"unescrowed_codes,omitempty"`
+}
+
+// newBypassCode generates a new random bypass code and returns its
+// "human readable" form and hash.
+func newBypassCode() (string, string, error) {
+	bc, err := albc.New()
+	if err != nil {
+		return "", "", err
+	}
+	code, err := bc.Code()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := bc.Hash()
+	return code, hash, err
+}
+
+// NewEscrowActivationLockHandler returns a handler that enables
+// Activation Lock on devices using the DEP API with a newly generated
+// bypass code for each device. The bypass code of each device is
+// escrowed in store as pending before the device is locked and replaces
+// the escrowed code once the device is successfully locked. Pending codes
+// of devices which were not locked are cleared. The pending code is kept
+// if the outcome is unknown (e.g. the DEP API request failed).
+//
+// The DEP API only supports a single device per request so the response
+// status of each device is the DEP API "response_status" of its request.
+// At most [MaxActivationLockDevices] devices are accepted and locked
+// concurrently like [NewActivationLockHandler].
+// Codes which could not be escrowed after locking are returned in the response.
+func NewEscrowActivationLockHandler(client ActivationLocker, store storage.BypassCodeEscrowStorer, logger log.Logger) http.HandlerFunc {
+	return deviceHandler(logger, activationLockChunkLimits,
+		func(req *DevicesRequest) error {
+			if req.EscrowKey != "" {
+				return errors.New("escrow key must not be provided")
+			}
+			return validateActivationLock(req)
+		},
+		func(ctx context.Context, name string, req *DevicesRequest, serials []string, ret *EscrowActivationLockResponse) error {
+			// chunk size of 1 means only a single serial
+			serial := serials[0]
+			code, hash, err := newBypassCode()
+			if err != nil {
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				return fmt.Errorf("generating bypass code: %w", err)
+			}
+
+			// keep any existing code as the device remains locked with
+			// it should this lock fail
+			escrow, err := store.RetrieveBypassCode(ctx, name, serial)
+			if errors.Is(err, storage.ErrNotFound) {
+				escrow = &storage.EscrowedBypassCode{DEPName: name, Serial: serial}
+			} else if err != nil {
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				return fmt.Errorf("retrieving bypass code: %w", err)
+			}
+
+			// escrow the code before locking the device with it so
+			// the code is never lost. stores must complete even if
+			// the request is canceled or times out.
+			storeCtx := context.WithoutCancel(ctx)
+			escrow.PendingCode = code
+			if err = store.StoreBypassCode(storeCtx, escrow); err != nil {
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				return fmt.Errorf("storing pending bypass code: %w", err)
+			}
+
+			resp, err := client.ActivationLock(ctx, name, serial, hash, req.LostMessage)
+			if err != nil {
+				// the device may have been locked: keep the pending code
+				ret.set(serial, godep.DeviceStatusResponseJsonDevicesValueFAILED)
+				return err
+			}
+			ret.set(serial, godep.DeviceStatusResponseJsonDevicesValue(resp.ResponseStatus))
+
+			if resp.ResponseStatus != activationLockSuccess {
+				// the device was not locked with the pending code
+				escrow.PendingCode = ""
+				if escrow.Code == "" {
+					err = store.DeleteBypassCode(storeCtx, name, serial)
+				} else {
+					err = store.StoreBypassCode(storeCtx, escrow)
+				}
+				if err != nil {
+					return fmt.Errorf("clearing pending bypass code: %w", err)
+				}
+				return nil
+			}
+
+			escrow.Code = code
+			escrow.PendingCode = ""
+			escrow.CreatedAt = time.Now().UTC()
+			if err = store.StoreBypassCode(storeCtx, escrow); err != nil {
+				// the code remains escrowed as pending
+				ret.mu.Lock()
+				if ret.UnescrowedCodes == nil {
+					ret.UnescrowedCodes = make(map[string]string)
+				}
+				ret.UnescrowedCodes[serial] = code
+				ret.mu.Unlock()
+				return fmt.Errorf("storing bypass code: %w", err)
+			}
+			return nil
+		},
+		func(ret *EscrowActivationLockResponse) *DeviceErrors { return &ret.DeviceErrors },
+	)
+}
+
+// BypassCodesResponse is the response of the escrowed bypass codes endpoint.
+type BypassCodesResponse struct {
+	BypassCodes map[string]*storage.EscrowedBypassCode `json:"bypass_codes,omitempty"`
+	DeviceErrors
+}
+
+// NewRetrieveBypassCodesHandler returns a handler that retrieves the
+// escrowed bypass codes of the devices in the "serial" query parameters.
+// If no codes are found the HTTP status is 404 Not Found.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewRetrieveBypassCodesHandler(store storage.BypassCodeEscrowStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		serials, err := validateSerials(r.URL.Query()["serial"])
+		if err != nil {
+			logAndWriteJSONError(logger, w, "validating devices", err, http.StatusBadRequest)
+			return
+		}
+
+		ret := &BypassCodesResponse{BypassCodes: make(map[string]*storage.EscrowedBypassCode)}
+		for _, serial := range serials {
+			escrow, err := store.RetrieveBypassCode(r.Context(), r.URL.Path, serial)
+			if errors.Is(err, storage.ErrNotFound) {
+				ret.setError([]string{serial}, errors.New("bypass code not found"))
+				continue
+			} else if err != nil {
+				logAndWriteJSONError(logger, w, "retrieving bypass code", err, 0)
+				return
+			}
+			ret.BypassCodes[serial] = escrow
+		}
+
+		logger.Info(
+			"msg", "retrieved bypass codes",
+			"devices", len(serials),
+			"found", len(ret.BypassCodes),
+		)
+
+		status := http.StatusOK
+		if len(ret.BypassCodes) < 1 {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, ret, status, logger)
+	}
+}
@@ -0,0 +1,210 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/micromdm/nanodep/albc"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeActivationLocker struct {
+	mu     sync.Mutex
+	hashes map[string]string
+	locked string
+	failed string
+}
+
+func (f *fakeActivationLocker) ActivationLock(_ context.Context, name string, device, escrowKey, lostMessage string) (*godep.ActivationLockStatusResponseJson, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hashes == nil {
+		f.hashes = make(map[string]string)
+	}
+	f.hashes[device] = escrowKey
+	if device == f.failed {
+		return nil, errors.New("request failed")
+	}
+	resp := &godep.ActivationLockStatusResponseJson{SerialNumber: device, ResponseStatus: activationLockSuccess}
+	if device == f.locked {
+		resp.ResponseStatus = "DEVICE_ALREADY_LOCKED"
+	}
+	return resp, nil
+}
+
+func TestEscrowActivationLock(t *testing.T) {
+	store := inmem.New()
+	client := &fakeActivationLocker{locked: "SERIAL3"}
+	handler := NewEscrowActivationLockHandler(client, store, log.NopLogger)
+
+	r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(`{"devices":["SERIAL1","SERIAL2","SERIAL3"]}`))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	resp := new(EscrowActivationLockResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := resp.Devices["SERIAL1"], godep.DeviceStatusResponseJsonDevicesValueSUCCESS; have != want {
+		t.Errorf("status: have %q, want %q", have, want)
+	}
+	if len(resp.UnescrowedCodes) > 0 {
+		t.Errorf("unexpected unescrowed codes: %v", resp.UnescrowedCodes)
+	}
+
+	// the escrowed code must match the hash the device was locked with
+	for _, serial := range []string{"SERIAL1", "SERIAL2"} {
+		escrow, err := store.RetrieveBypassCode(context.Background(), "mdmserver1", serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if escrow.PendingCode != "" {
+			t.Errorf("unexpected pending code: %q", escrow.PendingCode)
+		}
+		checkBypassCodeHash(t, escrow.Code, client.hashes[serial])
+	}
+
+	// devices which failed to lock are not escrowed
+	if _, err := store.RetrieveBypassCode(context.Background(), "mdmserver1", "SERIAL3"); err == nil {
+		t.Error("expected no escrowed code")
+	}
+
+	retrieve := NewRetrieveBypassCodesHandler(store, log.NopLogger)
+	r = httptest.NewRequest("GET", "/mdmserver1?serial=SERIAL1&serial=SERIAL3", nil)
+	r.URL.Path = "mdmserver1"
+	w = httptest.NewRecorder()
+	retrieve.ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	codes := new(BypassCodesResponse)
+	if err := json.NewDecoder(w.Body).Decode(codes); err != nil {
+		t.Fatal(err)
+	}
+	if codes.BypassCodes["SERIAL1"] == nil || codes.BypassCodes["SERIAL1"].Code == "" {
+		t.Error("missing bypass code")
+	}
+	if _, ok := codes.Errors["SERIAL3"]; !ok {
+		t.Error("missing error for device without bypass code")
+	}
+
+	r = httptest.NewRequest("GET", "/mdmserver1?serial=SERIAL3", nil)
+	r.URL.Path = "mdmserver1"
+	w = httptest.NewRecorder()
+	retrieve.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusNotFound; have != want {
+		t.Errorf("status: have %d, want %d", have, want)
+	}
+}
+
+// confirmFailingEscrowStore fails to store escrowed codes without a
+// pending code, i.e. confirmed or cleared codes.
+type confirmFailingEscrowStore struct {
+	storage.BypassCodeEscrowStorer
+}
+
+func (s *confirmFailingEscrowStore) StoreBypassCode(ctx context.Context, escrow *storage.EscrowedBypassCode) error {
+	if escrow.PendingCode == "" {
+		return errors.New("store failed")
+	}
+	return s.BypassCodeEscrowStorer.StoreBypassCode(ctx, escrow)
+}
+
+func checkBypassCodeHash(t *testing.T, code, want string) {
+	t.Helper()
+	bc, err := albc.NewFromCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bc.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != want {
+		t.Errorf("hash: have %q, want %q", hash, want)
+	}
+}
+
+func TestEscrowActivationLockPending(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	client := &fakeActivationLocker{locked: "SERIAL1", failed: "SERIAL2"}
+
+	existing := &storage.EscrowedBypassCode{DEPName: "mdmserver1", Serial: "SERIAL1", Code: "00000-11111-2222-3333-4444-5555"}
+	if err := store.StoreBypassCode(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewEscrowActivationLockHandler(client, &confirmFailingEscrowStore{store}, log.NopLogger)
+	r := httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(`{"devices":["SERIAL1","SERIAL2","SERIAL3"]}`))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if have, want := w.Code, http.StatusBadGateway; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	resp := new(EscrowActivationLockResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// a device which was not locked keeps its existing code
+	// (clearing the pending code failed in this store)
+	escrow, err := store.RetrieveBypassCode(ctx, "mdmserver1", "SERIAL1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := escrow.Code, existing.Code; have != want {
+		t.Errorf("code: have %q, want %q", have, want)
+	}
+
+	// the pending code is kept if the outcome is unknown
+	escrow, err = store.RetrieveBypassCode(ctx, "mdmserver1", "SERIAL2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Code != "" {
+		t.Errorf("unexpected code: %q", escrow.Code)
+	}
+	checkBypassCodeHash(t, escrow.PendingCode, client.hashes["SERIAL2"])
+
+	// a locked device whose code failed to be stored keeps the pending
+	// code and returns it
+	escrow, err = store.RetrieveBypassCode(ctx, "mdmserver1", "SERIAL3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := resp.UnescrowedCodes["SERIAL3"], escrow.PendingCode; have != want {
+		t.Errorf("unescrowed code: have %q, want %q", have, want)
+	}
+	checkBypassCodeHash(t, escrow.PendingCode, client.hashes["SERIAL3"])
+
+	// clearing the pending code of a device which was not locked
+	handler = NewEscrowActivationLockHandler(client, store, log.NopLogger)
+	r = httptest.NewRequest("POST", "/mdmserver1", strings.NewReader(`{"devices":["SERIAL1"]}`))
+	r.URL.Path = "mdmserver1"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	escrow, err = store.RetrieveBypassCode(ctx, "mdmserver1", "SERIAL1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Code != existing.Code || escrow.PendingCode != "" {
+		t.Errorf("codes: have %q and %q, want %q and none", escrow.Code, escrow.PendingCode, existing.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package apinext
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/history"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// NewQueryHistoryHandler returns a handler that queries the change
+// history of a DEP name. The history may be limited to a kind with the
+// "kind" query parameter.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewQueryHistoryHandler(store storage.HistoryStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		kind := r.URL.Query().Get("kind")
+		if err := storage.ValidateHistoryKind(kind); err != nil {
+			logAndWriteJSONError(logger, w, "validating kind", err, http.StatusBadRequest)
+			return
+		}
+
+		p, err := paginationFromQuery(r.URL.Query())
+		if err != nil {
+			logAndWriteJSONError(logger, w, "parsing pagination params", err, http.StatusBadRequest)
+			return
+		}
+
+		ret, err := store.QueryHistory(r.Context(), &storage.HistoryQueryRequest{
+			DEPName:    r.URL.Path,
+			Kind:       kind,
+			Pagination: p,
+		})
+		if err != nil {
+			logAndWriteJSONError(logger, w, "querying history", err, 0)
+			return
+		}
+
+		logger.Debug("msg", fmt.Sprintf("queried history entries: %d", len(ret.Entries)))
+
+		writeJSON(w, ret, http.StatusOK, logger)
+	}
+}
+
+// NewRollbackHandler returns a handler that rolls back the config or
+// assigner profile of a DEP name to the value of the history entry in
+// the "id" query parameter. The restored history entry is returned.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewRollbackHandler(store storage.HistoryStorer, configStorer api.ConfigStorer, assignerStorer api.AssignerProfileStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			logAndWriteJSONError(logger, w, "validating id", errors.New("missing history entry id"), http.StatusBadRequest)
+			return
+		}
+		logger = logger.With("id", id)
+
+		entry, err := history.Rollback(r.Context(), store, configStorer, assignerStorer, r.URL.Path, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "rolling back", err, http.StatusNotFound)
+			return
+		} else if errors.Is(err, history.ErrRollbackUnsupported) {
+			logAndWriteJSONError(logger, w, "rolling back", err, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "rolling back", err, 0)
+			return
+		}
+
+		logger.Info("msg", "rolled back", "kind", entry.Kind)
+
+		writeJSON(w, entry, http.StatusOK, logger)
+	}
+}
@@ -0,0 +1,91 @@
+package apinext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/osbeta"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// OSBetaTokensGetter gets the (possibly cached) OS beta enrollment tokens.
+type OSBetaTokensGetter interface {
+	Tokens(ctx context.Context, name string) (*osbeta.Tokens, error)
+}
+
+var seedBuildTokenOSes = []godep.SeedBuildTokenJsonOs{
+	godep.SeedBuildTokenJsonOsHomePodOS,
+	godep.SeedBuildTokenJsonOsIOS,
+	godep.SeedBuildTokenJsonOsOSX,
+	godep.SeedBuildTokenJsonOsTvOS,
+	godep.SeedBuildTokenJsonOsVisionOS,
+	godep.SeedBuildTokenJsonOsWatchOS,
+}
+
+// parseSeedBuildTokenOS case-insensitively parses s into a token OS.
+func parseSeedBuildTokenOS(s string) (godep.SeedBuildTokenJsonOs, error) {
+	for _, os := range seedBuildTokenOSes {
+		if strings.EqualFold(s, string(os)) {
+			return os, nil
+		}
+	}
+	return "", fmt.Errorf("invalid OS: %s", s)
+}
+
+// filterSeedBuildTokens returns the tokens for os.
+func filterSeedBuildTokens(tokens []godep.SeedBuildTokenJson, os godep.SeedBuildTokenJsonOs) []godep.SeedBuildTokenJson {
+	var filtered []godep.SeedBuildTokenJson
+	for _, token := range tokens {
+		if token.Os != nil && *token.Os == os {
+			filtered = append(filtered, token)
+		}
+	}
+	return filtered
+}
+
+// NewOSBetaTokensHandler returns a handler that returns the OS beta
+// enrollment tokens of a DEP name. The tokens can optionally be filtered
+// by OS using the "os" query parameter. If AppleSeed for IT is turned
+// off for the organization no tokens are returned and the
+// "seed_for_it_turned_off" response field is true.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewOSBetaTokensHandler(getter OSBetaTokensGetter, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		var os godep.SeedBuildTokenJsonOs
+		if v := r.URL.Query().Get("os"); v != "" {
+			var err error
+			if os, err = parseSeedBuildTokenOS(v); err != nil {
+				logAndWriteJSONError(logger, w, "parsing OS", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		tokens, err := getter.Tokens(r.Context(), r.URL.Path)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "getting OS beta enrollment tokens", err, http.StatusBadGateway)
+			return
+		}
+
+		if os != "" {
+			tokens.BetaEnrollmentTokens = filterSeedBuildTokens(tokens.BetaEnrollmentTokens, os)
+			tokens.SeedBuildTokens = filterSeedBuildTokens(tokens.SeedBuildTokens, os)
+		}
+
+		writeJSON(w, tokens, http.StatusOK, logger)
+	}
+}
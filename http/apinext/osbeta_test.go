@@ -0,0 +1,92 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/osbeta"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeOSBetaTokensGetter struct {
+	tokens *osbeta.Tokens
+}
+
+func (f *fakeOSBetaTokensGetter) Tokens(context.Context, string) (*osbeta.Tokens, error) {
+	// return a copy as the handler filters the token lists
+	tokens := *f.tokens
+	return &tokens, nil
+}
+
+func newSeedBuildToken(os godep.SeedBuildTokenJsonOs, title string) godep.SeedBuildTokenJson {
+	return godep.SeedBuildTokenJson{Os: &os, Title: &title, Token: &title}
+}
+
+func TestOSBetaTokens(t *testing.T) {
+	getter := &fakeOSBetaTokensGetter{tokens: &osbeta.Tokens{
+		GetSeedBuildTokenResponseJson: godep.GetSeedBuildTokenResponseJson{
+			BetaEnrollmentTokens: []godep.SeedBuildTokenJson{
+				newSeedBuildToken(godep.SeedBuildTokenJsonOsIOS, "iOS 27 Beta"),
+				newSeedBuildToken(godep.SeedBuildTokenJsonOsOSX, "macOS 27 Beta"),
+			},
+		},
+	}}
+	handler := NewOSBetaTokensHandler(getter, log.NopLogger)
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		titles []string
+	}{
+		{"", http.StatusOK, []string{"iOS 27 Beta", "macOS 27 Beta"}},
+		{"?os=osx", http.StatusOK, []string{"macOS 27 Beta"}},
+		{"?os=tvOS", http.StatusOK, nil},
+		{"?os=beos", http.StatusBadRequest, nil},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/mdmserver1"+tc.query, nil)
+			r.URL.Path = "mdmserver1"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if have, want := w.Code, tc.status; have != want {
+				t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			resp := new(osbeta.Tokens)
+			if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+				t.Fatal(err)
+			}
+			if have, want := len(resp.BetaEnrollmentTokens), len(tc.titles); have != want {
+				t.Fatalf("tokens: have %d, want %d", have, want)
+			}
+			for i, token := range resp.BetaEnrollmentTokens {
+				if have, want := *token.Title, tc.titles[i]; have != want {
+					t.Errorf("title: have %q, want %q", have, want)
+				}
+			}
+		})
+	}
+
+	getter.tokens = &osbeta.Tokens{SeedForITTurnedOff: true}
+	r := httptest.NewRequest("GET", "/mdmserver1", nil)
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d", have, want)
+	}
+	resp := new(osbeta.Tokens)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.SeedForITTurnedOff {
+		t.Error("expected AppleSeed for IT turned off")
+	}
+}
@@ -0,0 +1,315 @@
+package apinext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// TemplateVarDEPName is the profile template variable that is always
+// substituted with the DEP name.
+const TemplateVarDEPName = "DEP_NAME"
+
+// templateVarRe matches "${VARIABLE}" profile template placeholders.
+var templateVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// SubstituteTemplate replaces the "${VARIABLE}" placeholders in the JSON
+// template with the values in vars. Placeholders must be inside JSON
+// strings as the values are JSON string-escaped. An error is returned
+// if any placeholder has no value.
+func SubstituteTemplate(template []byte, vars map[string]string) ([]byte, error) {
+	var missing []string
+	ret := templateVarRe.ReplaceAllFunc(template, func(placeholder []byte) []byte {
+		name := string(templateVarRe.FindSubmatch(placeholder)[1])
+		value, ok := vars[name]
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return placeholder
+		}
+		// cannot fail encoding a string
+		valueJSON, _ := json.Marshal(value)
+		return valueJSON[1 : len(valueJSON)-1]
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing template variables: %s", strings.Join(missing, ", "))
+	}
+	return ret, nil
+}
+
+// ProfileRequest is the request body for defining a profile.
+// Exactly one of Profile or Template must be provided.
+type ProfileRequest struct {
+	// Profile is the DEP profile JSON.
+	Profile json.RawMessage `json:"profile,omitempty"`
+
+	// Template is the name of a stored profile template.
+	Template string `json:"template,omitempty"`
+
+	// Variables are substituted into the profile template.
+	// The DEP_NAME variable is always set to the DEP name.
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// ProfileGetter retrieves profiles from the DEP API.
+type ProfileGetter interface {
+	GetProfile(ctx context.Context, name, uuid string) (*godep.ProfileJson, error)
+}
+
+// NewGetProfileHandler returns a handler that retrieves the profile
+// given by the "profile_uuid" query parameter from the DEP API.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewGetProfileHandler(client ProfileGetter, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		profileUUID := r.URL.Query().Get("profile_uuid")
+		if profileUUID == "" {
+			logAndWriteJSONError(logger, w, "validating profile UUID", errors.New("missing profile UUID"), http.StatusBadRequest)
+			return
+		}
+
+		profile, err := client.GetProfile(r.Context(), r.URL.Path, profileUUID)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "getting profile", err, http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, profile, http.StatusOK, logger)
+	}
+}
+
+// ProfileDefiner defines profiles using the DEP API.
+type ProfileDefiner interface {
+	DefineProfile(ctx context.Context, name string, profile *godep.ProfileJson) (*godep.DefineProfileResponseJson, error)
+}
+
+// profileFromRequest assembles the DEP profile from req for DEP name.
+func profileFromRequest(ctx context.Context, req *ProfileRequest, name string, templates storage.ProfileTemplateStorer) (*godep.ProfileJson, error) {
+	if (len(req.Profile) > 0) == (req.Template != "") {
+		return nil, errors.New("exactly one of profile or template required")
+	}
+	profileJSON := []byte(req.Profile)
+	if req.Template != "" {
+		if templates == nil {
+			return nil, errors.New("profile templates not supported")
+		}
+		template, err := templates.RetrieveProfileTemplate(ctx, req.Template)
+		if err != nil {
+			return nil, fmt.Errorf("retrieving profile template: %w", err)
+		}
+		vars := map[string]string{TemplateVarDEPName: name}
+		for k, v := range req.Variables {
+			vars[k] = v
+		}
+		if profileJSON, err = SubstituteTemplate(template.Template, vars); err != nil {
+			return nil, err
+		}
+	}
+	profile := new(godep.ProfileJson)
+	if err := json.Unmarshal(profileJSON, profile); err != nil {
+		return nil, fmt.Errorf("decoding profile: %w", err)
+	}
+	if profile.ProfileName == nil || *profile.ProfileName == "" {
+		return nil, errors.New("missing profile name")
+	}
+	return profile, nil
+}
+
+// NewDefineProfileHandler returns a handler that defines a profile using
+// the DEP API from a [ProfileRequest] JSON body. The profile is either
+// provided directly or from a stored profile template in templates (if
+// not nil). If assigner is not nil then the defined profile UUID is stored
+// as the assigner profile UUID of the DEP name.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix (and action suffix) before using this handler.
+func NewDefineProfileHandler(client ProfileDefiner, templates storage.ProfileTemplateStorer, assigner api.AssignerProfileStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		req := new(ProfileRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			logAndWriteJSONError(logger, w, "decoding request", err, http.StatusBadRequest)
+			return
+		}
+
+		profile, err := profileFromRequest(r.Context(), req, r.URL.Path, templates)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "assembling profile", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "assembling profile", err, http.StatusBadRequest)
+			return
+		}
+
+		resp, err := client.DefineProfile(r.Context(), r.URL.Path, profile)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "defining profile", err, http.StatusBadGateway)
+			return
+		}
+		if resp.ProfileUuid == nil || *resp.ProfileUuid == "" {
+			logAndWriteJSONError(logger, w, "defining profile", errors.New("empty profile UUID"), http.StatusBadGateway)
+			return
+		}
+
+		logger = logger.With("profile_uuid", *resp.ProfileUuid, "template", req.Template)
+		logger.Debug("msg", "defined profile")
+
+		if assigner != nil {
+			if err = assigner.StoreAssignerProfile(r.Context(), r.URL.Path, *resp.ProfileUuid); err != nil {
+				logAndWriteJSONError(logger, w, "storing assigner profile", err, 0)
+				return
+			}
+			logger.Debug("msg", "stored assigner profile")
+		}
+
+		writeJSON(w, resp, http.StatusOK, logger)
+	}
+}
+
+// ProfileTemplateResponse describes a profile template.
+type ProfileTemplateResponse struct {
+	Name      string          `json:"name"`
+	Template  json.RawMessage `json:"template"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// NewGetProfileTemplatesHandler returns a handler that returns a profile
+// template or, if no name is provided, lists all profile template names.
+//
+// Note the whole URL path is used as the template name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewGetProfileTemplatesHandler(store storage.ProfileTemplateStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger)
+
+		if r.URL.Path == "" {
+			names, err := store.ListProfileTemplates(r.Context())
+			if err != nil {
+				logAndWriteJSONError(logger, w, "listing profile templates", err, 0)
+				return
+			}
+			writeJSON(w, names, http.StatusOK, logger)
+			return
+		}
+
+		template, err := store.RetrieveProfileTemplate(r.Context(), r.URL.Path)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "retrieving profile template", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving profile template", err, 0)
+			return
+		}
+		writeJSON(w, &ProfileTemplateResponse{
+			Name:      template.Name,
+			Template:  template.Template,
+			UpdatedAt: template.UpdatedAt,
+		}, http.StatusOK, logger)
+	}
+}
+
+// NewStoreProfileTemplateHandler returns a handler that creates or
+// replaces a profile template. The request body is the DEP profile JSON
+// with optional "${VARIABLE}" placeholders inside JSON strings.
+//
+// Note the whole URL path is used as the template name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewStoreProfileTemplateHandler(store storage.ProfileTemplateStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("template", r.URL.Path)
+
+		if r.URL.Path == "" || strings.Contains(r.URL.Path, "/") {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("invalid profile template name"), http.StatusBadRequest)
+			return
+		}
+
+		templateJSON, err := io.ReadAll(r.Body)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "reading request", err, http.StatusBadRequest)
+			return
+		}
+		templateJSON = bytes.TrimSpace(templateJSON)
+
+		// substitute placeholder values to check the template decodes
+		vars := make(map[string]string)
+		for _, m := range templateVarRe.FindAllSubmatch(templateJSON, -1) {
+			vars[string(m[1])] = ""
+		}
+		profileJSON, _ := SubstituteTemplate(templateJSON, vars)
+		if err = json.Unmarshal(profileJSON, new(godep.ProfileJson)); err != nil {
+			logAndWriteJSONError(logger, w, "validating template", err, http.StatusBadRequest)
+			return
+		}
+
+		template := &storage.ProfileTemplate{
+			Name:      r.URL.Path,
+			Template:  templateJSON,
+			UpdatedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err = store.StoreProfileTemplate(r.Context(), template); err != nil {
+			logAndWriteJSONError(logger, w, "storing profile template", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "stored profile template")
+
+		writeJSON(w, &ProfileTemplateResponse{
+			Name:      template.Name,
+			Template:  template.Template,
+			UpdatedAt: template.UpdatedAt,
+		}, http.StatusOK, logger)
+	}
+}
+
+// NewDeleteProfileTemplateHandler returns a handler that deletes a profile template.
+//
+// Note the whole URL path is used as the template name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewDeleteProfileTemplateHandler(store storage.ProfileTemplateStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("template", r.URL.Path)
+
+		err := store.DeleteProfileTemplate(r.Context(), r.URL.Path)
+		if errors.Is(err, storage.ErrNotFound) {
+			logAndWriteJSONError(logger, w, "deleting profile template", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "deleting profile template", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "deleted profile template")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
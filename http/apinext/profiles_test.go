@@ -0,0 +1,32 @@
+package apinext
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSubstituteTemplate(t *testing.T) {
+	template := []byte(`{"profile_name":"${DEP_NAME} profile","url":"https://${HOST}/mdm/${DEP_NAME}"}`)
+
+	profileJSON, err := SubstituteTemplate(template, map[string]string{
+		"DEP_NAME": `a "quoted" name`,
+		"HOST":     "mdm.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := make(map[string]string)
+	if err = json.Unmarshal(profileJSON, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := profile["profile_name"], `a "quoted" name profile`; have != want {
+		t.Errorf("profile_name: have %q, want %q", have, want)
+	}
+	if have, want := profile["url"], `https://mdm.example.com/mdm/a "quoted" name`; have != want {
+		t.Errorf("url: have %q, want %q", have, want)
+	}
+
+	if _, err = SubstituteTemplate(template, map[string]string{"DEP_NAME": "x"}); err == nil {
+		t.Error("expected missing variable error")
+	}
+}
@@ -0,0 +1,211 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/http/api"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// ServiceDiscoveryRequest is the request body for setting the
+// account-driven enrollment MDM service discovery URL of a DEP name.
+type ServiceDiscoveryRequest struct {
+	MDMServiceDiscoveryURL string `json:"mdm_service_discovery_url"`
+}
+
+// ServiceDiscoveryResponse is the account-driven enrollment MDM service
+// discovery status of a DEP name.
+type ServiceDiscoveryResponse struct {
+	// MDMServiceDiscoveryURL is the URL stored in the DEP name config.
+	MDMServiceDiscoveryURL string `json:"mdm_service_discovery_url,omitempty"`
+
+	// AppleMDMServiceDiscoveryURL is the URL currently assigned in the
+	// DEP API.
+	AppleMDMServiceDiscoveryURL string `json:"apple_mdm_service_discovery_url,omitempty"`
+
+	// InSync is true if the stored and assigned URLs are the same.
+	InSync bool `json:"in_sync"`
+}
+
+func newServiceDiscoveryResponse(configURL, appleURL string) *ServiceDiscoveryResponse {
+	return &ServiceDiscoveryResponse{
+		MDMServiceDiscoveryURL:      configURL,
+		AppleMDMServiceDiscoveryURL: appleURL,
+		InSync:                      configURL == appleURL,
+	}
+}
+
+// ServiceDiscoveryConfigStorer retrieves and stores DEP name configs.
+type ServiceDiscoveryConfigStorer interface {
+	client.ConfigRetriever
+	api.ConfigStorer
+}
+
+// ServiceDiscoveryGetter gets the account-driven enrollment profile
+// using the DEP API.
+type ServiceDiscoveryGetter interface {
+	AccountDrivenEnrollmentProfile(ctx context.Context, name string) (string, error)
+}
+
+// ServiceDiscoveryAssigner assigns the account-driven enrollment profile
+// using the DEP API.
+type ServiceDiscoveryAssigner interface {
+	AssignAccountDrivenEnrollmentProfile(ctx context.Context, name string, mdmServiceDiscoveryURL string) error
+}
+
+// ServiceDiscoveryRemover removes the account-driven enrollment profile
+// using the DEP API.
+type ServiceDiscoveryRemover interface {
+	RemoveAccountDrivenEnrollmentProfile(ctx context.Context, name string) error
+}
+
+// validateServiceDiscoveryURL checks that u is an absolute HTTPS URL.
+func validateServiceDiscoveryURL(u string) error {
+	if u == "" {
+		return errors.New("missing MDM service discovery URL")
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("parsing MDM service discovery URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return errors.New("MDM service discovery URL must be an absolute HTTPS URL")
+	}
+	return nil
+}
+
+// NewGetServiceDiscoveryHandler returns a handler that compares the MDM
+// service discovery URL stored in the config of a DEP name with the URL
+// currently assigned in the DEP API.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewGetServiceDiscoveryHandler(depClient ServiceDiscoveryGetter, store client.ConfigRetriever, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		config, err := store.RetrieveConfig(r.Context(), r.URL.Path)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving config", err, 0)
+			return
+		}
+		var configURL string
+		if config != nil {
+			configURL = config.MDMServiceDiscoveryURL
+		}
+
+		appleURL, err := depClient.AccountDrivenEnrollmentProfile(r.Context(), r.URL.Path)
+		if err != nil && !godep.IsAccountDrivenEnrollmentProfileNotFound(err) {
+			logAndWriteJSONError(logger, w, "getting account-driven enrollment profile", err, http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, newServiceDiscoveryResponse(configURL, appleURL), http.StatusOK, logger)
+	}
+}
+
+// NewAssignServiceDiscoveryHandler returns a handler that assigns the
+// MDM service discovery URL from a [ServiceDiscoveryRequest] JSON body
+// using the DEP API and then stores it in the config of the DEP name.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewAssignServiceDiscoveryHandler(depClient ServiceDiscoveryAssigner, store ServiceDiscoveryConfigStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		req := new(ServiceDiscoveryRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			logAndWriteJSONError(logger, w, "decoding request", err, http.StatusBadRequest)
+			return
+		}
+		if err := validateServiceDiscoveryURL(req.MDMServiceDiscoveryURL); err != nil {
+			logAndWriteJSONError(logger, w, "validating request", err, http.StatusBadRequest)
+			return
+		}
+
+		config, err := store.RetrieveConfig(r.Context(), r.URL.Path)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving config", err, 0)
+			return
+		}
+		if config == nil {
+			config = new(client.Config)
+		}
+
+		// assign first so that the stored URL is only changed once Apple has accepted it
+		if err = depClient.AssignAccountDrivenEnrollmentProfile(r.Context(), r.URL.Path, req.MDMServiceDiscoveryURL); err != nil {
+			logAndWriteJSONError(logger, w, "assigning account-driven enrollment profile", err, http.StatusBadGateway)
+			return
+		}
+
+		config.MDMServiceDiscoveryURL = req.MDMServiceDiscoveryURL
+		if err = store.StoreConfig(r.Context(), r.URL.Path, config); err != nil {
+			logAndWriteJSONError(logger, w, "storing config", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "assigned MDM service discovery URL")
+
+		writeJSON(w, newServiceDiscoveryResponse(config.MDMServiceDiscoveryURL, req.MDMServiceDiscoveryURL), http.StatusOK, logger)
+	}
+}
+
+// NewRemoveServiceDiscoveryHandler returns a handler that removes the
+// account-driven enrollment profile using the DEP API and then removes
+// the MDM service discovery URL from the config of the DEP name.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewRemoveServiceDiscoveryHandler(depClient ServiceDiscoveryRemover, store ServiceDiscoveryConfigStorer, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		err := depClient.RemoveAccountDrivenEnrollmentProfile(r.Context(), r.URL.Path)
+		if err != nil && !godep.IsAccountDrivenEnrollmentProfileNotFound(err) {
+			logAndWriteJSONError(logger, w, "removing account-driven enrollment profile", err, http.StatusBadGateway)
+			return
+		}
+
+		config, err := store.RetrieveConfig(r.Context(), r.URL.Path)
+		if err != nil {
+			logAndWriteJSONError(logger, w, "retrieving config", err, 0)
+			return
+		}
+		if config != nil && config.MDMServiceDiscoveryURL != "" {
+			config.MDMServiceDiscoveryURL = ""
+			if err = store.StoreConfig(r.Context(), r.URL.Path, config); err != nil {
+				logAndWriteJSONError(logger, w, "storing config", err, 0)
+				return
+			}
+		}
+
+		logger.Debug("msg", "removed MDM service discovery URL")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
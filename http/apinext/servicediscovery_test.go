@@ -0,0 +1,118 @@
+package apinext
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage/inmem"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeServiceDiscovery struct {
+	url string
+}
+
+func (f *fakeServiceDiscovery) AccountDrivenEnrollmentProfile(context.Context, string) (string, error) {
+	if f.url == "" {
+		return "", &godep.HTTPError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return f.url, nil
+}
+
+func (f *fakeServiceDiscovery) AssignAccountDrivenEnrollmentProfile(_ context.Context, _ string, url string) error {
+	f.url = url
+	return nil
+}
+
+func (f *fakeServiceDiscovery) RemoveAccountDrivenEnrollmentProfile(context.Context, string) error {
+	f.url = ""
+	return nil
+}
+
+func getServiceDiscovery(t *testing.T, handler http.Handler) *ServiceDiscoveryResponse {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/mdmserver1", nil)
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	resp := new(ServiceDiscoveryResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServiceDiscovery(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	depClient := &fakeServiceDiscovery{}
+	const url = "https://mdm.example.com/.well-known/com.apple.remotemanagement"
+
+	if err := store.StoreConfig(ctx, "mdmserver1", &client.Config{BaseURL: "https://dep.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := NewGetServiceDiscoveryHandler(depClient, store, log.NopLogger)
+	if resp := getServiceDiscovery(t, get); !resp.InSync || resp.MDMServiceDiscoveryURL != "" {
+		t.Errorf("unexpected status: %+v", resp)
+	}
+
+	assign := NewAssignServiceDiscoveryHandler(depClient, store, log.NopLogger)
+	for _, body := range []string{`{}`, `{"mdm_service_discovery_url":"http://mdm.example.com/"}`} {
+		r := httptest.NewRequest("PUT", "/mdmserver1", strings.NewReader(body))
+		r.URL.Path = "mdmserver1"
+		w := httptest.NewRecorder()
+		assign.ServeHTTP(w, r)
+		if have, want := w.Code, http.StatusBadRequest; have != want {
+			t.Errorf("%s: status: have %d, want %d", body, have, want)
+		}
+	}
+
+	r := httptest.NewRequest("PUT", "/mdmserver1", strings.NewReader(`{"mdm_service_discovery_url":"`+url+`"}`))
+	r.URL.Path = "mdmserver1"
+	w := httptest.NewRecorder()
+	assign.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+
+	config, err := store.RetrieveConfig(ctx, "mdmserver1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := config.MDMServiceDiscoveryURL, url; have != want {
+		t.Errorf("config URL: have %q, want %q", have, want)
+	}
+	// the rest of the config is retained
+	if have, want := config.BaseURL, "https://dep.example.com/"; have != want {
+		t.Errorf("base URL: have %q, want %q", have, want)
+	}
+
+	// assigned outside of nanodep
+	depClient.url = "https://other.example.com/"
+	if resp := getServiceDiscovery(t, get); resp.InSync || resp.AppleMDMServiceDiscoveryURL != depClient.url {
+		t.Errorf("unexpected status: %+v", resp)
+	}
+
+	remove := NewRemoveServiceDiscoveryHandler(depClient, store, log.NopLogger)
+	r = httptest.NewRequest("DELETE", "/mdmserver1", nil)
+	r.URL.Path = "mdmserver1"
+	w = httptest.NewRecorder()
+	remove.ServeHTTP(w, r)
+	if have, want := w.Code, http.StatusNoContent; have != want {
+		t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+	}
+	if resp := getServiceDiscovery(t, get); !resp.InSync || resp.MDMServiceDiscoveryURL != "" || resp.AppleMDMServiceDiscoveryURL != "" {
+		t.Errorf("unexpected status: %+v", resp)
+	}
+}
@@ -0,0 +1,59 @@
+package apinext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	depsync "github.com/micromdm/nanodep/sync"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// SyncNower asks the syncer of a DEP name to sync immediately.
+type SyncNower interface {
+	// SyncNow triggers an immediate sync of DEP name. If fetch is true
+	// the cursor is cleared and all devices are fetched again.
+	SyncNow(ctx context.Context, name string, fetch bool) error
+}
+
+// NewSyncNowHandler returns a handler that triggers an immediate sync of
+// a DEP name. A full fetch of all devices is requested by setting the
+// "fetch" query parameter to true. The sync happens asynchronously.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this handler.
+func NewSyncNowHandler(syncer SyncNower, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := ctxlog.Logger(r.Context(), logger).With("name", r.URL.Path)
+
+		if r.URL.Path == "" {
+			logAndWriteJSONError(logger, w, "validating name", errors.New("missing DEP name"), http.StatusBadRequest)
+			return
+		}
+
+		var fetch bool
+		if v := r.URL.Query().Get("fetch"); v != "" {
+			var err error
+			if fetch, err = strconv.ParseBool(v); err != nil {
+				logAndWriteJSONError(logger, w, "parsing fetch param", err, http.StatusBadRequest)
+				return
+			}
+		}
+
+		err := syncer.SyncNow(r.Context(), r.URL.Path, fetch)
+		if errors.Is(err, depsync.ErrNotRunning) {
+			logAndWriteJSONError(logger, w, "triggering sync", err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			logAndWriteJSONError(logger, w, "triggering sync", err, 0)
+			return
+		}
+
+		logger.Debug("msg", "triggered sync", "fetch", fetch)
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,56 @@
+package apinext
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	depsync "github.com/micromdm/nanodep/sync"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeSyncNower struct {
+	name  string
+	fetch bool
+}
+
+func (f *fakeSyncNower) SyncNow(_ context.Context, name string, fetch bool) error {
+	if name != "mdmserver1" {
+		return depsync.ErrNotRunning
+	}
+	f.name = name
+	f.fetch = fetch
+	return nil
+}
+
+func TestSyncNowHandler(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		path   string
+		query  string
+		status int
+		fetch  bool
+	}{
+		{"sync", "mdmserver1", "", http.StatusAccepted, false},
+		{"fetch", "mdmserver1", "?fetch=true", http.StatusAccepted, true},
+		{"invalid-fetch", "mdmserver1", "?fetch=maybe", http.StatusBadRequest, false},
+		{"not-running", "mdmserver2", "", http.StatusNotFound, false},
+		{"missing-name", "", "", http.StatusBadRequest, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			syncer := new(fakeSyncNower)
+			r := httptest.NewRequest("POST", "/"+test.path+test.query, nil)
+			r.URL.Path = test.path
+			w := httptest.NewRecorder()
+			NewSyncNowHandler(syncer, log.NopLogger).ServeHTTP(w, r)
+			if have, want := w.Code, test.status; have != want {
+				t.Fatalf("status: have %d, want %d: %s", have, want, w.Body.String())
+			}
+			if have, want := syncer.fetch, test.fetch; have != want {
+				t.Errorf("fetch: have %v, want %v", have, want)
+			}
+		})
+	}
+}
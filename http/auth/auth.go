@@ -0,0 +1,295 @@
+// Package auth authenticates and authorizes API requests using API keys
+// with scopes and optional DEP name restrictions.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/proxy"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// API key scopes.
+const (
+	// ScopeAdmin grants all permissions including managing API keys.
+	ScopeAdmin = "admin"
+
+	ScopeTokensRead  = "tokens:read"
+	ScopeTokensWrite = "tokens:write"
+	ScopeConfigRead  = "config:read"
+	ScopeConfigWrite = "config:write"
+	ScopeProxyRead   = "proxy:read"
+	ScopeProxyWrite  = "proxy:write"
+
+	// ScopeDisown is required (in addition to ScopeProxyWrite for the
+	// proxy) to disown devices.
+	ScopeDisown = "disown"
+
+	// ScopeEscrowRead is required to retrieve escrowed Activation Lock
+	// bypass codes.
+	ScopeEscrowRead = "escrow:read"
+)
+
+// Scopes are all valid scopes.
+var Scopes = []string{
+	ScopeAdmin,
+	ScopeTokensRead,
+	ScopeTokensWrite,
+	ScopeConfigRead,
+	ScopeConfigWrite,
+	ScopeProxyRead,
+	ScopeProxyWrite,
+	ScopeDisown,
+	ScopeEscrowRead,
+}
+
+// ErrInvalidCredentials is returned when API credentials do not match.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity is an authenticated API caller.
+type Identity struct {
+	Name   string
+	Scopes []string
+
+	// DEPNames, if not empty, restricts the identity to these DEP names.
+	DEPNames []string
+}
+
+// Permitted reports whether the identity has scope for DEP name.
+// An empty name means the request is not specific to a DEP name and
+// is only permitted for identities not restricted to DEP names.
+func (i *Identity) Permitted(scope, name string) bool {
+	if i == nil {
+		return false
+	}
+	if len(i.DEPNames) > 0 && (name == "" || !slices.Contains(i.DEPNames, name)) {
+		return false
+	}
+	return slices.Contains(i.Scopes, ScopeAdmin) || slices.Contains(i.Scopes, scope)
+}
+
+type ctxKeyIdentity struct{}
+
+// NewContext creates a new context from ctx with identity associated.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, ctxKeyIdentity{}, identity)
+}
+
+// FromContext retrieves the identity from ctx.
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(ctxKeyIdentity{}).(*Identity)
+	return identity
+}
+
+// HashSecret returns the hex-encoded SHA-256 hash of an API key secret.
+// API key secrets are randomly generated with high entropy so a
+// fast hash is sufficient.
+func HashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// GenerateSecret generates a new random API key secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APIKeyRetriever retrieves API keys.
+type APIKeyRetriever interface {
+	// RetrieveAPIKey retrieves the API key called name.
+	// [storage.ErrNotFound] should be returned if the key does not exist.
+	RetrieveAPIKey(ctx context.Context, name string) (*storage.APIKey, error)
+}
+
+// Authenticator authenticates API credentials.
+type Authenticator struct {
+	store APIKeyRetriever
+
+	adminUsername string
+	adminPassword []byte
+
+	certs *CertMapper
+}
+
+// AuthenticatorOption configures an Authenticator.
+type AuthenticatorOption func(*Authenticator)
+
+// WithCertMapper authenticates requests with verified TLS client
+// certificates using the identities of m.
+func WithCertMapper(m *CertMapper) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.certs = m
+	}
+}
+
+// NewAuthenticator creates a new authenticator. API keys are retrieved
+// from store. Additionally the static adminUsername and adminPassword
+// authenticate as an identity with the [ScopeAdmin] scope.
+func NewAuthenticator(store APIKeyRetriever, adminUsername, adminPassword string, opts ...AuthenticatorOption) *Authenticator {
+	a := &Authenticator{
+		store:         store,
+		adminUsername: adminUsername,
+		adminPassword: []byte(adminPassword),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(a)
+		}
+	}
+	return a
+}
+
+// Authenticate checks the username and password against the static admin
+// credentials and stored API keys.
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	if username == a.adminUsername && len(a.adminPassword) > 0 {
+		if subtle.ConstantTimeCompare([]byte(password), a.adminPassword) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		return &Identity{Name: username, Scopes: []string{ScopeAdmin}}, nil
+	}
+	if a.store == nil {
+		return nil, ErrInvalidCredentials
+	}
+	key, err := a.store.RetrieveAPIKey(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(password)), []byte(key.SecretHash)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Name: key.Name, Scopes: key.Scopes, DEPNames: key.DEPNames}, nil
+}
+
+// AuthenticateTLS returns the identity mapped to the verified TLS client
+// certificate of cs. Nil is returned if there is no verified certificate
+// or it has no mapped identity.
+func (a *Authenticator) AuthenticateTLS(cs *tls.ConnectionState) *Identity {
+	if a.certs == nil || cs == nil || len(cs.VerifiedChains) < 1 || len(cs.VerifiedChains[0]) < 1 {
+		return nil
+	}
+	return a.certs.Identity(cs.VerifiedChains[0][0])
+}
+
+// Middleware authenticates HTTP Basic credentials using a.
+// If no credentials are provided then a verified TLS client certificate
+// with a mapped identity is used instead.
+// The authenticated identity is set in the request context for use
+// by [RequireScope] and [RequireProxyScope] and its name as the API
+// identity for [dephttp.AuthIdentity].
+func Middleware(next http.Handler, a *Authenticator, realm string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		var identity *Identity
+		var err error
+		if ok {
+			identity, err = a.Authenticate(r.Context(), u, p)
+		} else if identity = a.AuthenticateTLS(r.TLS); identity != nil {
+			ok = true
+		}
+		if !ok || errors.Is(err, ErrInvalidCredentials) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			ctxlog.Logger(r.Context(), logger).Info("msg", "authenticating", "username", u, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		ctx := NewContext(r.Context(), identity)
+		ctx = dephttp.WithAuthIdentity(ctx, identity.Name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// forbidden logs and responds to a request that is not permitted.
+func forbidden(w http.ResponseWriter, r *http.Request, logger log.Logger, scope, name string) {
+	ctxlog.Logger(r.Context(), logger).Info(
+		"msg", "not permitted",
+		"identity", dephttp.AuthIdentity(r.Context()),
+		"scope", scope,
+		"name", name,
+	)
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// RequireScope only calls next if the authenticated identity has scope
+// for the DEP name.
+//
+// Note the whole URL path is used as the DEP name. This necessitates
+// stripping the URL prefix before using this middleware.
+func RequireScope(next http.Handler, scope string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !FromContext(r.Context()).Permitted(scope, r.URL.Path) {
+			forbidden(w, r, logger, scope, r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireGlobalScope only calls next if the authenticated identity has
+// scope and is not restricted to specific DEP names. It is intended for
+// requests not specific to a DEP name.
+func RequireGlobalScope(next http.Handler, scope string, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !FromContext(r.Context()).Permitted(scope, "") {
+			forbidden(w, r, logger, scope, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// ProxyScopes returns the scopes required for a proxied DEP API request.
+// The endpoint is normalized with [proxy.CleanEndpoint].
+func ProxyScopes(method, endpoint string) []string {
+	endpoint = proxy.CleanEndpoint(endpoint)
+	if !proxy.IsMutating(method, endpoint) {
+		return []string{ScopeProxyRead}
+	}
+	if endpoint == "/devices/disown" {
+		return []string{ScopeProxyWrite, ScopeDisown}
+	}
+	return []string{ScopeProxyWrite}
+}
+
+// RequireProxyScope only calls next if the authenticated identity has
+// the scopes required for the proxied DEP API request.
+//
+// The DEP name is read from the request context and the request URL path
+// is used as the DEP API endpoint. This means it should wrap the handler
+// called by [proxy.ProxyDEPNameHandler].
+func RequireProxyScope(next http.Handler, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := FromContext(r.Context())
+		name := client.GetName(r.Context())
+		for _, scope := range ProxyScopes(r.Method, r.URL.Path) {
+			if !identity.Permitted(scope, name) {
+				forbidden(w, r, logger, scope, name)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
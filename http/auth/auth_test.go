@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+type mapKeyStore map[string]*storage.APIKey
+
+func (s mapKeyStore) RetrieveAPIKey(_ context.Context, name string) (*storage.APIKey, error) {
+	key, ok := s[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return key, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := mapKeyStore{
+		"helpdesk": {
+			Name:       "helpdesk",
+			SecretHash: HashSecret("hdsecret"),
+			Scopes:     []string{ScopeProxyRead},
+			DEPNames:   []string{"a"},
+		},
+	}
+	a := NewAuthenticator(store, "depserver", "supersecret")
+
+	identity, err := a.Authenticate(ctx, "depserver", "supersecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Permitted(ScopeDisown, "b") || !identity.Permitted(ScopeAdmin, "") {
+		t.Error("admin identity should be permitted everything")
+	}
+
+	for _, creds := range [][2]string{
+		{"depserver", "wrong"},
+		{"helpdesk", "supersecret"},
+		{"helpdesk", "wrong"},
+		{"unknown", "hdsecret"},
+	} {
+		if _, err = a.Authenticate(ctx, creds[0], creds[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected invalid credentials, got: %v", creds[0], err)
+		}
+	}
+
+	identity, err = a.Authenticate(ctx, "helpdesk", "hdsecret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		scope, name string
+		permitted   bool
+	}{
+		{ScopeProxyRead, "a", true},
+		{ScopeProxyRead, "b", false},
+		{ScopeProxyRead, "", false},
+		{ScopeProxyWrite, "a", false},
+		{ScopeAdmin, "a", false},
+	} {
+		if have := identity.Permitted(tc.scope, tc.name); have != tc.permitted {
+			t.Errorf("%s for %q: have %v, want %v", tc.scope, tc.name, have, tc.permitted)
+		}
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) < 40 || HashSecret(secret) == HashSecret(secret+"x") {
+		t.Error("unexpected secret or hash")
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// CertIdentity maps verified TLS client certificates to an API identity.
+// Exactly one of Subject or CommonName must be set.
+type CertIdentity struct {
+	// Subject matches the full certificate subject distinguished name
+	// in RFC 2253 form (e.g. "CN=mdm1,O=Example Inc.").
+	Subject string `json:"subject,omitempty"`
+
+	// CommonName matches the certificate subject common name.
+	CommonName string `json:"common_name,omitempty"`
+
+	// Name is the API identity name. Defaults to the common name of
+	// the certificate subject.
+	Name string `json:"name,omitempty"`
+
+	Scopes []string `json:"scopes"`
+
+	// DEPNames, if not empty, restricts the identity to these DEP names.
+	DEPNames []string `json:"dep_names,omitempty"`
+}
+
+// Validate checks that c is a valid mapping.
+func (c *CertIdentity) Validate() error {
+	if (c.Subject == "") == (c.CommonName == "") {
+		return errors.New("exactly one of subject or common name required")
+	}
+	if len(c.Scopes) < 1 {
+		return errors.New("no scopes")
+	}
+	for _, scope := range c.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+	return nil
+}
+
+// match reports whether cert matches c.
+func (c *CertIdentity) match(cert *x509.Certificate) bool {
+	if c.Subject != "" {
+		return cert.Subject.String() == c.Subject
+	}
+	return cert.Subject.CommonName == c.CommonName
+}
+
+// CertMapper maps verified TLS client certificates to API identities.
+// It is safe for concurrent use.
+type CertMapper struct {
+	mu         sync.RWMutex
+	identities []CertIdentity
+}
+
+// NewCertMapper creates a new CertMapper from identities.
+func NewCertMapper(identities []CertIdentity) (*CertMapper, error) {
+	m := new(CertMapper)
+	return m, m.Set(identities)
+}
+
+// Set validates and replaces the identities of m.
+func (m *CertMapper) Set(identities []CertIdentity) error {
+	for i := range identities {
+		if err := identities[i].Validate(); err != nil {
+			return fmt.Errorf("identity %d: %w", i, err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.identities = identities
+	return nil
+}
+
+// Identity returns the API identity of the first mapping matching cert.
+// Nil is returned if no mapping matches.
+// The certificate is assumed to have been verified.
+func (m *CertMapper) Identity(cert *x509.Certificate) *Identity {
+	if m == nil || cert == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.identities {
+		if !c.match(cert) {
+			continue
+		}
+		name := c.Name
+		if name == "" {
+			name = cert.Subject.CommonName
+		}
+		return &Identity{Name: name, Scopes: c.Scopes, DEPNames: c.DEPNames}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestCertMapper(t *testing.T) {
+	if _, err := NewCertMapper([]CertIdentity{{CommonName: "a", Scopes: []string{"invalid"}}}); err == nil {
+		t.Error("expected invalid scope error")
+	}
+	if _, err := NewCertMapper([]CertIdentity{{Subject: "CN=a", CommonName: "a", Scopes: []string{ScopeAdmin}}}); err == nil {
+		t.Error("expected subject and common name error")
+	}
+
+	m, err := NewCertMapper([]CertIdentity{
+		{Subject: "CN=mdm1,O=Example", Name: "mdm-one", Scopes: []string{ScopeAdmin}},
+		{CommonName: "mdm1", Scopes: []string{ScopeProxyRead}, DEPNames: []string{"a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(nil, "depserver", "", WithCertMapper(m))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "mdm1", Organization: []string{"Example"}}}
+	identity := a.AuthenticateTLS(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}})
+	if identity == nil || identity.Name != "mdm-one" || !identity.Permitted(ScopeAdmin, "") {
+		t.Errorf("unexpected identity: %v", identity)
+	}
+
+	cert = &x509.Certificate{Subject: pkix.Name{CommonName: "mdm1"}}
+	identity = a.AuthenticateTLS(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}})
+	if identity == nil || identity.Name != "mdm1" || identity.Permitted(ScopeProxyRead, "b") || !identity.Permitted(ScopeProxyRead, "a") {
+		t.Errorf("unexpected identity: %v", identity)
+	}
+
+	// unverified certificates are not authenticated
+	if identity = a.AuthenticateTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); identity != nil {
+		t.Errorf("unexpected identity: %v", identity)
+	}
+
+	cert = &x509.Certificate{Subject: pkix.Name{CommonName: "mdm2"}}
+	if identity = a.AuthenticateTLS(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}); identity != nil {
+		t.Errorf("unexpected identity: %v", identity)
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestProxyScopes(t *testing.T) {
+	for _, tc := range []struct {
+		method, endpoint string
+		scopes           []string
+	}{
+		{"GET", "/account", []string{ScopeProxyRead}},
+		{"POST", "/server/devices", []string{ScopeProxyRead}},
+		{"POST", "/server/devices/", []string{ScopeProxyRead}},
+		{"POST", "/profile", []string{ScopeProxyWrite}},
+		{"POST", "/devices/disown", []string{ScopeProxyWrite, ScopeDisown}},
+		{"POST", "/devices/disown/", []string{ScopeProxyWrite, ScopeDisown}},
+		{"POST", "//devices/disown", []string{ScopeProxyWrite, ScopeDisown}},
+		{"POST", "/devices//disown", []string{ScopeProxyWrite, ScopeDisown}},
+		{"POST", "/devices/./disown", []string{ScopeProxyWrite, ScopeDisown}},
+	} {
+		if have := ProxyScopes(tc.method, tc.endpoint); !slices.Equal(have, tc.scopes) {
+			t.Errorf("%s %s: have %v, want %v", tc.method, tc.endpoint, have, tc.scopes)
+		}
+	}
+}
+
+func TestRequireProxyScopeDisown(t *testing.T) {
+	var called bool
+	handler := RequireProxyScope(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}), log.NopLogger)
+
+	for _, endpoint := range []string{"/devices/disown", "/devices/disown/", "//devices/disown"} {
+		for _, tc := range []struct {
+			scopes []string
+			status int
+		}{
+			{[]string{ScopeProxyWrite}, http.StatusForbidden},
+			{[]string{ScopeProxyWrite, ScopeDisown}, http.StatusOK},
+		} {
+			called = false
+			r := httptest.NewRequest("POST", "/", nil)
+			r.URL.Path = endpoint
+			ctx := client.WithName(r.Context(), "mdmserver1")
+			ctx = NewContext(ctx, &Identity{Name: "test", Scopes: tc.scopes})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(ctx))
+			if have, want := w.Code, tc.status; have != want {
+				t.Errorf("%s %v: status: have %d, want %d", endpoint, tc.scopes, have, want)
+			}
+			if have, want := called, tc.status == http.StatusOK; have != want {
+				t.Errorf("%s %v: called: have %v, want %v", endpoint, tc.scopes, have, want)
+			}
+		}
+	}
+}
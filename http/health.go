@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// readyCheckTimeout is the maximum duration of the readiness checks.
+const readyCheckTimeout = 5 * time.Second
+
+// ErrShuttingDown is returned from readiness checks when the service is
+// shutting down.
+var ErrShuttingDown = errors.New("shutting down")
+
+// Readiness tracks whether a service is ready to serve requests.
+// It is safe for concurrent use.
+type Readiness struct {
+	checks   []func(context.Context) error
+	draining atomic.Bool
+}
+
+// NewReadiness creates a new Readiness that is ready as long as all
+// checks succeed and the service is not shutting down.
+func NewReadiness(checks ...func(context.Context) error) *Readiness {
+	return &Readiness{checks: checks}
+}
+
+// Drain marks the service as shutting down. Subsequent readiness checks fail.
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+// Check returns an error if the service is not ready.
+func (r *Readiness) Check(ctx context.Context) error {
+	if r.draining.Load() {
+		return ErrShuttingDown
+	}
+	for _, check := range r.checks {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStatus writes a simple JSON status response.
+func writeStatus(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		w.Write([]byte(`{"status":"ok"}`))
+	} else {
+		w.Write([]byte(`{"status":"unavailable"}`))
+	}
+}
+
+// HealthHandler returns a liveness handler. It responds OK for as long as
+// the process is able to serve HTTP requests. Dependencies (like storage)
+// are deliberately not checked so that their outages do not cause restarts.
+func HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK)
+	}
+}
+
+// ReadyHandler returns a readiness handler. It responds with 503 Service
+// Unavailable if the readiness checks of ready fail.
+func ReadyHandler(ready *Readiness, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		defer cancel()
+		if err := ready.Check(ctx); err != nil {
+			ctxlog.Logger(r.Context(), logger).Info("msg", "readiness check", "err", err)
+			writeStatus(w, http.StatusServiceUnavailable)
+			return
+		}
+		writeStatus(w, http.StatusOK)
+	}
+}
@@ -25,7 +25,22 @@ func ReadAllAndReplaceBody(r *http.Request) ([]byte, error) {
 	return b, nil
 }
 
+type ctxKeyAuthIdentity struct{}
+
+// WithAuthIdentity creates a new context from ctx with the authenticated
+// API identity associated.
+func WithAuthIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, ctxKeyAuthIdentity{}, identity)
+}
+
+// AuthIdentity retrieves the authenticated API identity from ctx.
+func AuthIdentity(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKeyAuthIdentity{}).(string)
+	return v
+}
+
 // BasicAuthMiddleware is a simple HTTP plain authentication middleware.
+// The authenticated username is set as the API identity in the request context.
 func BasicAuthMiddleware(next http.Handler, username, password, realm string) http.HandlerFunc {
 	uBytes := []byte(username)
 	pBytes := []byte(password)
@@ -36,7 +51,7 @@ func BasicAuthMiddleware(next http.Handler, username, password, realm string) ht
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithAuthIdentity(r.Context(), u)))
 	}
 }
 
@@ -2,6 +2,8 @@ package http
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 )
 
@@ -48,3 +50,67 @@ func (mux *MethodMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	next.ServeHTTP(w, r)
 }
+
+// SuffixMux is an HTTP request multiplexer.
+// It matches the last URL path segment of each incoming request against
+// a list of registered suffixes and calls the handler that matches. The
+// suffix (and its preceding slash) is stripped from the request URL path
+// so that handlers can use the remaining URL path as e.g. the DEP name.
+type SuffixMux struct {
+	suffixesMu sync.RWMutex
+	suffixes   map[string]http.Handler
+}
+
+// NewSuffixMux creates a new SuffixMux.
+func NewSuffixMux() *SuffixMux { return new(SuffixMux) }
+
+// Handle registers the handler for the given suffix.
+// If handler already exists for the given suffix, Handle panics.
+func (mux *SuffixMux) Handle(suffix string, handler http.Handler) {
+	if suffix == "" || strings.Contains(suffix, "/") {
+		panic("http: invalid suffix")
+	}
+	if handler == nil {
+		panic("http: nil handler")
+	}
+	mux.suffixesMu.Lock()
+	defer mux.suffixesMu.Unlock()
+	if mux.suffixes == nil {
+		mux.suffixes = make(map[string]http.Handler)
+	} else if _, exists := mux.suffixes[suffix]; exists {
+		panic("http: multiple registrations for " + suffix)
+	}
+	mux.suffixes[suffix] = handler
+}
+
+func (mux *SuffixMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var next http.Handler
+	prefix, suffix, found := cutLast(r.URL.Path, "/")
+	if found {
+		mux.suffixesMu.RLock()
+		if mux.suffixes != nil {
+			next = mux.suffixes[suffix]
+		}
+		mux.suffixesMu.RUnlock()
+	}
+	if next == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// shallow copy the request and URL like http.StripPrefix
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = prefix
+	r2.URL.RawPath = ""
+	next.ServeHTTP(w, r2)
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+)
+
+// TLSReloader loads the server certificate and optional client CA
+// certificates from files and supports reloading them at runtime.
+// It is safe for concurrent use.
+type TLSReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu     sync.RWMutex
+	config *tls.Config
+}
+
+// NewTLSReloader creates a new TLSReloader and loads the PEM certificate
+// and key files. If clientCAFile is not empty then TLS client certificates
+// are requested and verified against its PEM CA certificates.
+func NewTLSReloader(certFile, keyFile, clientCAFile string) (*TLSReloader, error) {
+	r := &TLSReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	return r, r.Reload()
+}
+
+// Reload loads the certificate, key, and client CA files again.
+// The previous configuration stays in use if an error is returned.
+func (r *TLSReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if r.clientCAFile != "" {
+		caPEM, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caPEM) {
+			return errors.New("no client CA certificates found")
+		}
+		// client certificates are optional to support other authentication
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = config
+	return nil
+}
+
+// Config returns a TLS server config that uses the most recently loaded
+// certificates for each new connection.
+func (r *TLSReloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.config, nil
+		},
+	}
+}
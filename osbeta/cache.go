@@ -0,0 +1,254 @@
+// Package osbeta provides a storage-backed cache of the DEP API OS beta
+// enrollment tokens of DEP names.
+package osbeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// DefaultTTL is the default duration cached tokens are fresh for.
+const DefaultTTL = time.Hour
+
+// Fetcher fetches the OS beta enrollment tokens from the DEP API.
+type Fetcher interface {
+	OSBetaEnrollmentTokens(ctx context.Context, name string) (*godep.GetSeedBuildTokenResponseJson, error)
+}
+
+// Tokens are the (possibly cached) OS beta enrollment tokens of a DEP name.
+type Tokens struct {
+	godep.GetSeedBuildTokenResponseJson
+
+	// SeedForITTurnedOff is true if the organization does not allow
+	// beta access. No tokens are available.
+	SeedForITTurnedOff bool `json:"seed_for_it_turned_off"`
+
+	// FetchedAt is the time the tokens were fetched from the DEP API.
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Cache caches the OS beta enrollment tokens of DEP names in storage.
+type Cache struct {
+	fetcher Fetcher
+	store   storage.OSBetaTokensCacheStorer
+	ttl     time.Duration
+	logger  log.Logger
+	now     func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // per DEP name fetch locks
+}
+
+// Option configures the cache.
+type Option func(*Cache)
+
+// WithTTL sets the duration cached tokens are fresh for.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger log.Logger) Option {
+	return func(c *Cache) {
+		c.logger = logger
+	}
+}
+
+// New creates a new cache of the OS beta enrollment tokens fetched using
+// fetcher and stored in store.
+func New(fetcher Fetcher, store storage.OSBetaTokensCacheStorer, opts ...Option) *Cache {
+	if fetcher == nil {
+		panic("nil fetcher")
+	}
+	if store == nil {
+		panic("nil store")
+	}
+	c := &Cache{
+		fetcher: fetcher,
+		store:   store,
+		ttl:     DefaultTTL,
+		logger:  log.NopLogger,
+		now:     time.Now,
+		locks:   make(map[string]*sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// lock locks the fetch lock of name.
+// The returned function unlocks it.
+func (c *Cache) lock(name string) func() {
+	c.mu.Lock()
+	l, ok := c.locks[name]
+	if !ok {
+		l = new(sync.Mutex)
+		c.locks[name] = l
+	}
+	c.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// tokensFromCached decodes cached into Tokens.
+func tokensFromCached(cached *storage.CachedOSBetaTokens) (*Tokens, error) {
+	tokens := &Tokens{
+		SeedForITTurnedOff: cached.SeedForITTurnedOff,
+		FetchedAt:          cached.FetchedAt,
+	}
+	if len(cached.Response) > 0 {
+		if err := json.Unmarshal(cached.Response, &tokens.GetSeedBuildTokenResponseJson); err != nil {
+			return nil, fmt.Errorf("decoding cached response: %w", err)
+		}
+	}
+	return tokens, nil
+}
+
+// retrieve retrieves and decodes the cached tokens of name.
+// Nil tokens are returned if no tokens are cached.
+func (c *Cache) retrieve(ctx context.Context, name string) (*Tokens, error) {
+	cached, err := c.store.RetrieveOSBetaTokens(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("retrieving cached tokens: %w", err)
+	}
+	return tokensFromCached(cached)
+}
+
+// isGone reports whether err means the tokens of a DEP name can no
+// longer be fetched because its OAuth tokens are missing or rejected.
+func isGone(err error) bool {
+	var authErr *client.AuthError
+	if errors.As(err, &authErr) {
+		return authErr.StatusCode >= 400 && authErr.StatusCode < 500
+	}
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// fetch fetches the tokens of name from the DEP API and stores them.
+// If the DEP name is gone (see [isGone]) its cached tokens are deleted
+// so that they are no longer refreshed.
+func (c *Cache) fetch(ctx context.Context, name string) (*Tokens, error) {
+	cached := &storage.CachedOSBetaTokens{DEPName: name, FetchedAt: c.now().UTC()}
+	resp, err := c.fetcher.OSBetaEnrollmentTokens(ctx, name)
+	if godep.IsAppleSeedForITTurnedOff(err) {
+		cached.SeedForITTurnedOff = true
+	} else if err != nil {
+		if isGone(err) {
+			if delErr := c.store.DeleteOSBetaTokens(ctx, name); delErr != nil {
+				ctxlog.Logger(ctx, c.logger).Info(
+					"msg", "deleting cached tokens",
+					"name", name,
+					"err", delErr,
+				)
+			}
+		}
+		return nil, fmt.Errorf("fetching tokens: %w", err)
+	} else if cached.Response, err = json.Marshal(resp); err != nil {
+		return nil, fmt.Errorf("encoding response: %w", err)
+	}
+	if err = c.store.StoreOSBetaTokens(ctx, cached); err != nil {
+		return nil, fmt.Errorf("storing cached tokens: %w", err)
+	}
+	return tokensFromCached(cached)
+}
+
+// Tokens returns the OS beta enrollment tokens of DEP name. Cached tokens
+// are returned if they are fresh, otherwise they are fetched from the DEP
+// API and cached. If fetching fails stale cached tokens are returned
+// unless the DEP name is gone.
+func (c *Cache) Tokens(ctx context.Context, name string) (*Tokens, error) {
+	unlock := c.lock(name)
+	defer unlock()
+
+	tokens, err := c.retrieve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tokens != nil && c.now().Before(tokens.FetchedAt.Add(c.ttl)) {
+		return tokens, nil
+	}
+
+	fetched, err := c.fetch(ctx, name)
+	if err != nil && tokens != nil && !isGone(err) {
+		ctxlog.Logger(ctx, c.logger).Info(
+			"msg", "using stale cached tokens",
+			"name", name,
+			"err", err,
+		)
+		return tokens, nil
+	}
+	return fetched, err
+}
+
+// Refresh fetches the OS beta enrollment tokens of DEP name from the
+// DEP API and caches them.
+func (c *Cache) Refresh(ctx context.Context, name string) error {
+	unlock := c.lock(name)
+	defer unlock()
+	_, err := c.fetch(ctx, name)
+	return err
+}
+
+// Run refreshes the cached tokens of all DEP names in storage every half
+// TTL in the background so that requests are served from the cache.
+// Tokens fetched less than half a TTL ago (e.g. by another instance
+// sharing the storage) are skipped. Run blocks until ctx is done.
+func (c *Cache) Run(ctx context.Context) error {
+	if c.ttl <= 0 {
+		return errors.New("invalid TTL")
+	}
+	ticker := time.NewTicker(c.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := c.refreshAll(ctx); err != nil {
+			c.logger.Info("msg", "listing cached OS beta tokens", "err", err)
+		}
+	}
+}
+
+// refreshAll refreshes the cached tokens of the DEP names in storage
+// that were fetched at least half a TTL ago.
+func (c *Cache) refreshAll(ctx context.Context) error {
+	names, err := c.store.ListOSBetaTokensNames(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		logger := c.logger.With("name", name)
+		tokens, err := c.retrieve(ctx, name)
+		if err != nil {
+			logger.Info("msg", "refreshing OS beta tokens", "err", err)
+			continue
+		} else if tokens == nil || c.now().Before(tokens.FetchedAt.Add(c.ttl/2)) {
+			// deleted since listing or still fresh
+			continue
+		}
+		if err = c.Refresh(ctx, name); err != nil {
+			logger.Info("msg", "refreshing OS beta tokens", "err", err)
+		} else {
+			logger.Debug("msg", "refreshed OS beta tokens")
+		}
+	}
+	return nil
+}
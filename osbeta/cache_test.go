@@ -0,0 +1,207 @@
+package osbeta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+)
+
+type fakeFetcher struct {
+	calls int
+	resp  *godep.GetSeedBuildTokenResponseJson
+	err   error
+}
+
+func (f *fakeFetcher) OSBetaEnrollmentTokens(_ context.Context, _ string) (*godep.GetSeedBuildTokenResponseJson, error) {
+	f.calls++
+	return f.resp, f.err
+}
+
+func newTokensResponse(title string) *godep.GetSeedBuildTokenResponseJson {
+	os := godep.SeedBuildTokenJsonOsIOS
+	token := "token-" + title
+	return &godep.GetSeedBuildTokenResponseJson{
+		BetaEnrollmentTokens: []godep.SeedBuildTokenJson{{Os: &os, Title: &title, Token: &token}},
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &fakeFetcher{resp: newTokensResponse("a")}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(fetcher, inmem.New(), WithTTL(time.Hour))
+	c.now = func() time.Time { return now }
+
+	tokens, err := c.Tokens(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("fetch calls: have %d, want %d", fetcher.calls, 1)
+	}
+	if len(tokens.BetaEnrollmentTokens) != 1 || *tokens.BetaEnrollmentTokens[0].Title != "a" {
+		t.Errorf("unexpected tokens: %+v", tokens.BetaEnrollmentTokens)
+	}
+	if !tokens.FetchedAt.Equal(now) {
+		t.Errorf("fetched at: have %v, want %v", tokens.FetchedAt, now)
+	}
+
+	// fresh: served from the cache
+	now = now.Add(30 * time.Minute)
+	fetcher.resp = newTokensResponse("b")
+	tokens, err = c.Tokens(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("fetch calls: have %d, want %d", fetcher.calls, 1)
+	}
+	if *tokens.BetaEnrollmentTokens[0].Title != "a" {
+		t.Errorf("expected cached tokens, have: %s", *tokens.BetaEnrollmentTokens[0].Title)
+	}
+
+	// stale: fetched again
+	now = now.Add(time.Hour)
+	tokens, err = c.Tokens(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.calls != 2 {
+		t.Errorf("fetch calls: have %d, want %d", fetcher.calls, 2)
+	}
+	if *tokens.BetaEnrollmentTokens[0].Title != "b" {
+		t.Errorf("expected fetched tokens, have: %s", *tokens.BetaEnrollmentTokens[0].Title)
+	}
+
+	// stale and fetch fails: stale tokens served
+	now = now.Add(2 * time.Hour)
+	fetcher.err = errors.New("fetch error")
+	tokens, err = c.Tokens(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tokens.BetaEnrollmentTokens[0].Title != "b" {
+		t.Errorf("expected stale tokens, have: %s", *tokens.BetaEnrollmentTokens[0].Title)
+	}
+
+	// nothing cached and fetch fails: error
+	if _, err = c.Tokens(ctx, "test2"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCacheSeedForITTurnedOff(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &fakeFetcher{err: &godep.HTTPError{
+		Body:       []byte("APPLE_SEED_FOR_IT_TURNED_OFF"),
+		Status:     http.StatusText(http.StatusForbidden),
+		StatusCode: http.StatusForbidden,
+	}}
+	c := New(fetcher, inmem.New())
+
+	for i := 0; i < 2; i++ {
+		tokens, err := c.Tokens(ctx, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tokens.SeedForITTurnedOff {
+			t.Error("expected AppleSeed for IT turned off")
+		}
+		if len(tokens.BetaEnrollmentTokens) > 0 {
+			t.Errorf("unexpected tokens: %+v", tokens.BetaEnrollmentTokens)
+		}
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("fetch calls: have %d, want %d", fetcher.calls, 1)
+	}
+}
+
+func TestCacheGone(t *testing.T) {
+	ctx := context.Background()
+	for _, goneErr := range []error{
+		fmt.Errorf("retrieving auth tokens: %w", storage.ErrNotFound),
+		&client.AuthError{Status: http.StatusText(http.StatusForbidden), StatusCode: http.StatusForbidden},
+	} {
+		t.Run(goneErr.Error(), func(t *testing.T) {
+			fetcher := &fakeFetcher{resp: newTokensResponse("a")}
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			store := inmem.New()
+			c := New(fetcher, store, WithTTL(time.Hour))
+			c.now = func() time.Time { return now }
+
+			if _, err := c.Tokens(ctx, "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			// stale and the DEP name is gone: error and no longer cached
+			now = now.Add(2 * time.Hour)
+			fetcher.err = goneErr
+			if _, err := c.Tokens(ctx, "test"); err == nil {
+				t.Error("expected error")
+			}
+			if _, err := store.RetrieveOSBetaTokens(ctx, "test"); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRefreshAll(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &fakeFetcher{resp: newTokensResponse("a")}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := inmem.New()
+	c := New(fetcher, store, WithTTL(time.Hour))
+	c.now = func() time.Time { return now }
+
+	if _, err := c.Tokens(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed fetches are not cached and so not refreshed
+	fetcher.err = errors.New("fetch error")
+	if _, err := c.Tokens(ctx, "b"); err == nil {
+		t.Error("expected error")
+	}
+	fetcher.err = nil
+	names, err := store.ListOSBetaTokensNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "a" {
+		t.Errorf("names: have %v, want [a]", names)
+	}
+
+	// fresh tokens are skipped
+	now = now.Add(10 * time.Minute)
+	if err = c.refreshAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := fetcher.calls, 2; have != want {
+		t.Errorf("fetch calls: have %d, want %d", have, want)
+	}
+
+	now = now.Add(30 * time.Minute)
+	fetcher.resp = newTokensResponse("b")
+	if err = c.refreshAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := fetcher.calls, 3; have != want {
+		t.Errorf("fetch calls: have %d, want %d", have, want)
+	}
+	tokens, err := c.Tokens(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tokens.BetaEnrollmentTokens[0].Title != "b" {
+		t.Errorf("expected refreshed tokens, have: %s", *tokens.BetaEnrollmentTokens[0].Title)
+	}
+}
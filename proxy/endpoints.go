@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+)
+
+// readOnlyEndpoints are DEP API endpoints that use a non-GET HTTP method
+// but do not modify anything.
+var readOnlyEndpoints = map[string]struct{}{
+	"/session":        {},
+	"/server/devices": {},
+	"/devices/sync":   {},
+	"/devices":        {},
+}
+
+// IsMutating reports whether an Apple DEP API request for method and
+// endpoint (the URL path) may modify data on the DEP server.
+// Unknown non-GET requests are considered mutating.
+// The endpoint is normalized with [CleanEndpoint].
+func IsMutating(method, endpoint string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	_, ok := readOnlyEndpoints[CleanEndpoint(endpoint)]
+	return !ok
+}
+
+// CleanEndpoint normalizes a DEP API endpoint (URL path) for matching.
+// Duplicate slashes, trailing slashes, and dot elements are removed so
+// that e.g. "//devices/disown/" matches "/devices/disown".
+func CleanEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return ""
+	}
+	return path.Clean("/" + endpoint)
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// DryRunHeader is set in the HTTP response of dry-run requests.
+// Clients may also set it in requests to request a dry-run.
+const DryRunHeader = "X-Nanodep-Dry-Run"
+
+// PolicyRule matches DEP API requests by HTTP method and endpoint.
+type PolicyRule struct {
+	// Method is the HTTP method to match. Empty or "*" matches any method.
+	Method string `json:"method,omitempty"`
+
+	// Endpoint is the DEP API endpoint (URL path) to match.
+	// It may be a [path.Match] pattern like "/profile/*".
+	// Empty matches any endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Match reports whether method and endpoint match the rule.
+func (r PolicyRule) Match(method, endpoint string) bool {
+	if r.Method != "" && r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	if r.Endpoint == "" {
+		return true
+	}
+	matched, err := path.Match(r.Endpoint, endpoint)
+	return err == nil && matched
+}
+
+// Validate checks the rule for a malformed endpoint pattern.
+func (r PolicyRule) Validate() error {
+	if _, err := path.Match(r.Endpoint, ""); err != nil {
+		return fmt.Errorf("invalid endpoint pattern %q: %w", r.Endpoint, err)
+	}
+	return nil
+}
+
+// Policy allows or denies proxy requests.
+type Policy struct {
+	// Allow, if not empty, allows only requests matching any rule.
+	Allow []PolicyRule `json:"allow,omitempty"`
+
+	// Deny denies requests matching any rule.
+	// Deny rules take precedence over allow rules.
+	Deny []PolicyRule `json:"deny,omitempty"`
+
+	// DryRun answers mutating requests locally rather than sending them
+	// to the DEP server.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Allowed reports whether a request for method and endpoint is allowed.
+// The endpoint is normalized with [CleanEndpoint] before matching.
+// A nil policy allows all requests.
+func (p *Policy) Allowed(method, endpoint string) bool {
+	return p.allowed(method, CleanEndpoint(endpoint))
+}
+
+// allowed is like Allowed but endpoint must already be normalized.
+func (p *Policy) allowed(method, endpoint string) bool {
+	if p == nil {
+		return true
+	}
+	for _, rule := range p.Deny {
+		if rule.Match(method, endpoint) {
+			return false
+		}
+	}
+	if len(p.Allow) < 1 {
+		return true
+	}
+	for _, rule := range p.Allow {
+		if rule.Match(method, endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the rules of the policy.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, rules := range [][]PolicyRule{p.Allow, p.Deny} {
+		for _, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PolicyConfig is the proxy policy for all DEP names and API identities.
+// A request must be allowed by every policy that applies to it and
+// is a dry-run if any policy that applies to it is.
+type PolicyConfig struct {
+	// Default applies to all requests.
+	Default *Policy `json:"default,omitempty"`
+
+	// DEPNames are policies applied to requests for specific DEP names.
+	DEPNames map[string]*Policy `json:"dep_names,omitempty"`
+
+	// Identities are policies applied to requests from specific
+	// authenticated API identities (i.e. API keys).
+	Identities map[string]*Policy `json:"identities,omitempty"`
+}
+
+// Validate checks all policies of the config.
+func (c *PolicyConfig) Validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default policy: %w", err)
+	}
+	for name, p := range c.DEPNames {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policy for DEP name %s: %w", name, err)
+		}
+	}
+	for identity, p := range c.Identities {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policy for identity %s: %w", identity, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate reports whether a request is allowed and whether it should be
+// treated as a dry-run. Only mutating requests can be dry-runs.
+// The endpoint is normalized with [CleanEndpoint] before matching.
+func (c *PolicyConfig) Evaluate(name, identity, method, endpoint string) (allowed, dryRun bool) {
+	if c == nil {
+		return true, false
+	}
+	endpoint = CleanEndpoint(endpoint)
+	policies := []*Policy{c.Default, c.DEPNames[name], c.Identities[identity]}
+	allowed = true
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		if !p.allowed(method, endpoint) {
+			allowed = false
+		}
+		if p.DryRun {
+			dryRun = true
+		}
+	}
+	return allowed, dryRun && IsMutating(method, endpoint)
+}
+
+// DryRunResponse is the synthesized response to a dry-run request.
+// It describes the request that would have been sent to the DEP server.
+type DryRunResponse struct {
+	DryRun   bool            `json:"dry_run"`
+	DEPName  string          `json:"dep_name"`
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Query    string          `json:"query,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+// PolicyMiddleware enforces policy for DEP API requests to next.
+// Denied requests are answered with an HTTP 403 Forbidden status.
+// Dry-run requests are answered with a [DryRunResponse] and are not
+// passed to next. Besides the policy, mutating requests which have the
+// [DryRunHeader] request header set are dry-runs. The header is removed
+// before requests are passed to next. A nil policy allows all requests.
+//
+// The DEP name is read from the request context and the request URL path
+// is used as the DEP API endpoint. This means it should wrap the handler
+// called by [ProxyDEPNameHandler].
+func PolicyMiddleware(next http.Handler, policy *PolicyConfig, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := client.GetName(r.Context())
+		identity := dephttp.AuthIdentity(r.Context())
+		allowed, dryRun := policy.Evaluate(name, identity, r.Method, r.URL.Path)
+
+		// the client may request a dry-run of requests the policy allows
+		if r.Header.Get(DryRunHeader) != "" {
+			r.Header.Del(DryRunHeader)
+			dryRun = dryRun || IsMutating(r.Method, r.URL.Path)
+		}
+
+		logger := ctxlog.Logger(r.Context(), logger).With(
+			"name", name,
+			"method", r.Method,
+			"endpoint", r.URL.Path,
+		)
+
+		if !allowed {
+			logger.Info("msg", "denied by proxy policy", "identity", identity)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if !dryRun {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resp := &DryRunResponse{
+			DryRun:   true,
+			DEPName:  name,
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+			Query:    r.URL.RawQuery,
+		}
+		if r.Body != nil {
+			body, err := dephttp.ReadAllAndReplaceBody(r)
+			if err != nil {
+				logger.Info("msg", "reading body", "err", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			if len(body) > 0 {
+				if json.Valid(body) {
+					resp.Body = body
+				} else {
+					// non-JSON bodies are encoded as a JSON string
+					resp.Body, _ = json.Marshal(string(body))
+				}
+			}
+		}
+
+		logger.Info("msg", "dry-run proxy request")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(DryRunHeader, "1")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Info("msg", "encoding dry-run response", "err", err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	config := &PolicyConfig{
+		Default: &Policy{
+			Deny: []PolicyRule{{Method: "POST", Endpoint: "/devices/disown"}},
+		},
+		DEPNames: map[string]*Policy{
+			"readonly": {Allow: []PolicyRule{{Method: "GET"}, {Endpoint: "/devices"}}},
+			"staging":  {DryRun: true},
+		},
+		Identities: map[string]*Policy{
+			"ops": {Deny: []PolicyRule{{Endpoint: "/profile"}, {Endpoint: "/profile/*"}}},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, identity, method, endpoint string
+		allowed, dryRun                  bool
+	}{
+		{"a", "", "POST", "/devices", true, false},
+		{"a", "", "POST", "/devices/disown", false, false},
+		{"a", "ops", "POST", "/profile", false, false},
+		{"a", "ops", "PUT", "/profile/devices", false, false},
+		{"a", "ops", "GET", "/account", true, false},
+		{"readonly", "", "GET", "/account", true, false},
+		{"readonly", "", "POST", "/devices", true, false},
+		{"readonly", "", "POST", "/profile", false, false},
+		{"staging", "", "POST", "/profile", true, true},
+		{"staging", "", "POST", "/devices", true, false},
+		{"staging", "", "GET", "/account", true, false},
+		// endpoint variants are normalized before matching
+		{"a", "", "POST", "/devices/disown/", false, false},
+		{"a", "", "POST", "//devices/disown", false, false},
+		{"a", "", "POST", "/devices//disown", false, false},
+		{"a", "", "POST", "/devices/./disown", false, false},
+		{"a", "", "POST", "/devices/x/../disown", false, false},
+		{"a", "ops", "POST", "/profile/", false, false},
+		{"a", "ops", "PUT", "//profile/devices/", false, false},
+		{"staging", "", "POST", "/profile/", true, true},
+	} {
+		allowed, dryRun := config.Evaluate(tc.name, tc.identity, tc.method, tc.endpoint)
+		if allowed != tc.allowed || dryRun != tc.dryRun {
+			t.Errorf("%s %s %s %s: have allowed=%v dryRun=%v, want allowed=%v dryRun=%v",
+				tc.name, tc.identity, tc.method, tc.endpoint, allowed, dryRun, tc.allowed, tc.dryRun)
+		}
+	}
+
+	var nilConfig *PolicyConfig
+	if allowed, dryRun := nilConfig.Evaluate("a", "", "POST", "/devices/disown"); !allowed || dryRun {
+		t.Error("nil policy config should allow all requests")
+	}
+}
+
+func TestPolicyMiddlewareDryRun(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler should not be called")
+	})
+	config := &PolicyConfig{Default: &Policy{DryRun: true}}
+	handler := PolicyMiddleware(next, config, log.NopLogger)
+
+	r := httptest.NewRequest("POST", "/devices/disown", strings.NewReader(`{"devices":["SERIAL1"]}`))
+	ctx := client.WithName(r.Context(), "test")
+	ctx = dephttp.WithAuthIdentity(ctx, "depserver")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r.WithContext(ctx))
+
+	if have, want := w.Code, http.StatusOK; have != want {
+		t.Fatalf("status: have %d, want %d", have, want)
+	}
+	if w.Header().Get(DryRunHeader) == "" {
+		t.Error("missing dry-run header")
+	}
+	resp := new(DryRunResponse)
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.DryRun || resp.DEPName != "test" || resp.Endpoint != "/devices/disown" {
+		t.Errorf("unexpected dry-run response: %+v", resp)
+	}
+	if have, want := string(resp.Body), `{"devices":["SERIAL1"]}`; have != want {
+		t.Errorf("body: have %s, want %s", have, want)
+	}
+}
+
+func TestPolicyMiddlewareRequestDryRun(t *testing.T) {
+	var proxied []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(DryRunHeader) != "" {
+			t.Error("dry-run header passed to next handler")
+		}
+		proxied = append(proxied, r.URL.Path)
+	})
+	config := &PolicyConfig{Default: &Policy{Deny: []PolicyRule{{Endpoint: "/devices/disown"}}}}
+
+	for _, tc := range []struct {
+		policy   *PolicyConfig
+		method   string
+		endpoint string
+		status   int
+		dryRun   bool
+	}{
+		{nil, "POST", "/devices/disown", http.StatusOK, true},
+		{config, "POST", "/profile/devices", http.StatusOK, true},
+		// denied requests stay denied
+		{config, "POST", "/devices/disown", http.StatusForbidden, false},
+		// read-only requests are proxied
+		{config, "GET", "/account", http.StatusOK, false},
+	} {
+		proxied = nil
+		handler := PolicyMiddleware(next, tc.policy, log.NopLogger)
+		r := httptest.NewRequest(tc.method, tc.endpoint, strings.NewReader(`{"devices":["SERIAL1"]}`))
+		r.Header.Set(DryRunHeader, "1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(client.WithName(r.Context(), "test")))
+
+		if have, want := w.Code, tc.status; have != want {
+			t.Errorf("%s %s: status: have %d, want %d", tc.method, tc.endpoint, have, want)
+		}
+		if have, want := w.Header().Get(DryRunHeader) != "", tc.dryRun; have != want {
+			t.Errorf("%s %s: dry-run: have %v, want %v", tc.method, tc.endpoint, have, want)
+		}
+		if have, want := len(proxied) > 0, tc.status == http.StatusOK && !tc.dryRun; have != want {
+			t.Errorf("%s %s: proxied: have %v, want %v", tc.method, tc.endpoint, have, want)
+		}
+	}
+}
+
+func TestCleanEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint, want string
+	}{
+		{"", ""},
+		{"/", "/"},
+		{"/devices/disown", "/devices/disown"},
+		{"/devices/disown/", "/devices/disown"},
+		{"//devices/disown", "/devices/disown"},
+		{"/devices//disown//", "/devices/disown"},
+		{"devices/disown", "/devices/disown"},
+		{"/devices/../devices/disown", "/devices/disown"},
+	} {
+		if have := CleanEndpoint(tc.endpoint); have != tc.want {
+			t.Errorf("%q: have %q, want %q", tc.endpoint, have, tc.want)
+		}
+	}
+}
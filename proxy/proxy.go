@@ -8,7 +8,6 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
-	"sync"
 
 	"github.com/micromdm/nanodep/client"
 
@@ -16,14 +15,38 @@ import (
 	"github.com/micromdm/nanolib/log/ctxlog"
 )
 
+type config struct {
+	urlCache *URLCache
+}
+
+// Option configures the NanoDEP ReverseProxy.
+type Option func(*config)
+
+// WithURLCache configures the proxy to resolve DEP name base URLs using
+// cache. This allows sharing the cache in order to invalidate entries
+// when configs change. If not set then a new URLCache with the default
+// TTL is used.
+func WithURLCache(cache *URLCache) Option {
+	return func(c *config) {
+		c.urlCache = cache
+	}
+}
+
 // New creates new NanoDEP ReverseProxy. It dispatches requests using transport
 // which should be a NanoDEP RoundTripper transport (which handles
 // authentication and session management). DEP name configurations are retrieved
 // using store and logger is used for logging.
-func New(transport http.RoundTripper, store client.ConfigRetriever, logger log.Logger) *httputil.ReverseProxy {
+func New(transport http.RoundTripper, store client.ConfigRetriever, logger log.Logger, opts ...Option) *httputil.ReverseProxy {
+	cfg := new(config)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.urlCache == nil {
+		cfg.urlCache = NewURLCache(store, 0)
+	}
 	return &httputil.ReverseProxy{
 		Transport:    transport,
-		Director:     newDirector(store, logger.With("function", "director")),
+		Director:     newDirector(cfg.urlCache, logger.With("function", "director")),
 		ErrorHandler: newErrorHandler(logger.With("msg", "proxy error")),
 	}
 }
@@ -55,13 +78,11 @@ func newErrorHandler(logger log.Logger) func(http.ResponseWriter, *http.Request,
 
 // newDirector creates a new httputil.ReverseProxy director which dynamically
 // resolves the destination server based on the config. The config name is
-// retrieved from the request context using client.GetName. We also implement
-// a parsed URL cache (which means the proxy may not be aware of underlying
-// config changes).
-func newDirector(store client.ConfigRetriever, logger log.Logger) func(*http.Request) {
-	urlCache := make(map[string]*url.URL)
-	urlCacheMu := sync.RWMutex{}
-	store = client.NewDefaultConfigRetreiver(store)
+// retrieved from the request context using client.GetName. The parsed URLs
+// are cached in urlCache which expires entries after a TTL (which means the
+// proxy may not be immediately aware of underlying config changes unless the
+// cache entries are invalidated).
+func newDirector(urlCache *URLCache, logger log.Logger) func(*http.Request) {
 	return func(req *http.Request) {
 		name := client.GetName(req.Context())
 		if name == "" {
@@ -71,26 +92,16 @@ func newDirector(store client.ConfigRetriever, logger log.Logger) func(*http.Req
 			return
 		}
 
-		// attempt to read the URL from urlCache, or retreive it from store
-		urlCacheMu.RLock()
-		url := urlCache[name]
-		urlCacheMu.RUnlock()
-		if url == nil {
-			logger := ctxlog.Logger(req.Context(), logger).With("name", name)
-			config, err := store.RetrieveConfig(req.Context(), name)
-			if err != nil {
-				logger.Info("msg", "retrieve config", "err", err)
-			}
-			url, err = url.Parse(config.BaseURL)
-			if err != nil {
-				logger.Info("msg", "parse", "err", err)
-				// this will probably lead to a very broken proxy.
-				// but we can't really do anything about it here.
-				return
-			}
-			urlCacheMu.Lock()
-			urlCache[name] = url
-			urlCacheMu.Unlock()
+		url, err := urlCache.URL(req.Context(), name)
+		if err != nil {
+			ctxlog.Logger(req.Context(), logger).Info(
+				"msg", "resolving DEP name URL",
+				"name", name,
+				"err", err,
+			)
+			// this will probably lead to a very broken proxy.
+			// but we can't really do anything about it here.
+			return
 		}
 
 		// perform our actual request modifications (i.e. swapping in the
@@ -116,13 +127,14 @@ func newCopiedRequest(r *http.Request) *http.Request {
 //
 // For example if the request URL path is "hello/world/" then "hello" is the
 // DEP name and is set in the request context and "/world/" is then set in the
-// HTTP request passed onto p.
+// HTTP request passed onto next (which is typically the NanoDEP
+// ReverseProxy, possibly wrapped in middleware).
 //
 // Note the very beginning of the URL path is used as the DEP name. This
 // necessitates stripping the URL prefix before using this handler. Note also
 // that DEP names with a "/" or "%2F" are likely to cause issues as we naively
 // search and cut by "/" in the path.
-func ProxyDEPNameHandler(p *httputil.ReverseProxy, logger log.Logger) http.HandlerFunc {
+func ProxyDEPNameHandler(next http.Handler, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		r2 := newCopiedRequest(r)
 
@@ -148,7 +160,7 @@ func ProxyDEPNameHandler(p *httputil.ReverseProxy, logger log.Logger) http.Handl
 
 		logger.Debug("msg", "proxy serve", "name", name, "endpoint", endpoint)
 
-		p.ServeHTTP(w, r2.WithContext(client.WithName(r2.Context(), name)))
+		next.ServeHTTP(w, r2.WithContext(client.WithName(r2.Context(), name)))
 	}
 }
 
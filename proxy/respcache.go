@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	dephttp "github.com/micromdm/nanodep/http"
+	"github.com/micromdm/nanodep/http/api"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// CacheStatusHeader is set in proxy responses when the response cache is
+// enabled. It is either "HIT" or "MISS" for cacheable endpoints.
+const CacheStatusHeader = "X-Nanodep-Cache"
+
+// cacheableEndpoints are the idempotent DEP API endpoints whose responses
+// may be cached and their HTTP method.
+var cacheableEndpoints = map[string]string{
+	"/account": http.MethodGet,
+	"/profile": http.MethodGet,
+	"/devices": http.MethodPost, // device details
+}
+
+// DefaultResponseCacheTTLs returns the default response cache TTLs
+// keyed by DEP API endpoint.
+func DefaultResponseCacheTTLs() map[string]time.Duration {
+	return map[string]time.Duration{
+		"/account": 5 * time.Minute,
+		"/profile": 5 * time.Minute,
+		"/devices": time.Minute,
+	}
+}
+
+// ParseResponseCacheTTLs parses a comma-separated list of endpoint=duration
+// pairs into response cache TTLs. For example: "/account=10m,/devices=30s".
+// Only the account, profile, and device details endpoints may be cached.
+// Endpoints not listed use their default TTL.
+func ParseResponseCacheTTLs(s string) (map[string]time.Duration, error) {
+	ttls := DefaultResponseCacheTTLs()
+	if s == "" {
+		return ttls, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		endpoint, ttlRaw, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid endpoint TTL: %q", pair)
+		}
+		if _, ok := cacheableEndpoints[endpoint]; !ok {
+			return nil, fmt.Errorf("endpoint not cacheable: %s", endpoint)
+		}
+		ttl, err := time.ParseDuration(ttlRaw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing TTL for %s: %w", endpoint, err)
+		}
+		ttls[endpoint] = ttl
+	}
+	return ttls, nil
+}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// ResponseCache caches DEP API responses of idempotent endpoints per DEP name.
+type ResponseCache struct {
+	ttls map[string]time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// entries are keyed by DEP name then request key
+	entries map[string]map[string]*cachedResponse
+	// gens are incremented per DEP name on every flush
+	gens map[string]uint64
+}
+
+// NewResponseCache creates a new response cache using the endpoint TTLs.
+// An endpoint with a zero or negative TTL is not cached.
+func NewResponseCache(ttls map[string]time.Duration) *ResponseCache {
+	return &ResponseCache{
+		ttls:    ttls,
+		now:     time.Now,
+		entries: make(map[string]map[string]*cachedResponse),
+		gens:    make(map[string]uint64),
+	}
+}
+
+// ttl returns the TTL for method and endpoint if it is cacheable.
+func (c *ResponseCache) ttl(method, endpoint string) (time.Duration, bool) {
+	if cacheableEndpoints[endpoint] != method {
+		return 0, false
+	}
+	ttl := c.ttls[endpoint]
+	return ttl, ttl > 0
+}
+
+func (c *ResponseCache) get(name, key string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.entries[name][key]
+	if !ok || !c.now().Before(resp.expires) {
+		return nil
+	}
+	return resp
+}
+
+// generation returns the flush generation of DEP name.
+func (c *ResponseCache) generation(name string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[name]
+}
+
+// set caches resp unless DEP name was flushed since generation gen.
+func (c *ResponseCache) set(name, key string, gen uint64, resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[name] != gen {
+		// flushed while the response was in flight
+		return
+	}
+	entries, ok := c.entries[name]
+	if !ok {
+		entries = make(map[string]*cachedResponse)
+		c.entries[name] = entries
+	}
+	// prune expired entries so the cache does not grow unbounded
+	now := c.now()
+	for k, v := range entries {
+		if !now.Before(v.expires) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = resp
+}
+
+// Flush removes all cached responses for DEP name.
+func (c *ResponseCache) Flush(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+	c.gens[name]++
+}
+
+// FlushingAuthTokensStore wraps an auth tokens store and flushes the
+// DEP name's cached responses after every auth tokens are stored.
+type FlushingAuthTokensStore struct {
+	api.AuthTokensStore
+	cache *ResponseCache
+}
+
+// NewFlushingAuthTokensStore creates a new FlushingAuthTokensStore
+// that stores auth tokens using next and flushes responses in cache.
+func NewFlushingAuthTokensStore(next api.AuthTokensStore, cache *ResponseCache) *FlushingAuthTokensStore {
+	if next == nil {
+		panic("nil auth tokens store")
+	}
+	if cache == nil {
+		panic("nil response cache")
+	}
+	return &FlushingAuthTokensStore{AuthTokensStore: next, cache: cache}
+}
+
+// StoreAuthTokens stores tokens for name (DEP name) and flushes
+// the cached responses for name.
+func (s *FlushingAuthTokensStore) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
+	// flush even on error: we may have partially written
+	defer s.cache.Flush(name)
+	return s.AuthTokensStore.StoreAuthTokens(ctx, name, tokens)
+}
+
+// cacheKey hashes the request method, endpoint, query, and body.
+func cacheKey(r *http.Request, endpoint string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + endpoint + "\n" + r.URL.RawQuery + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bufferingRecorder writes through to a ResponseWriter and also
+// buffers the response status and body.
+type bufferingRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferingRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bufferingRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap supports http.ResponseController.
+func (r *bufferingRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// ResponseCacheMiddleware serves cacheable DEP API requests from cache,
+// if present, otherwise from next caching successful responses.
+// Mutating requests flush the cache for the DEP name.
+//
+// The DEP name is read from the request context and the cleaned request
+// URL path (see [CleanEndpoint]) is used as the DEP API endpoint. This means it should wrap the handler
+// called by [ProxyDEPNameHandler].
+func ResponseCacheMiddleware(next http.Handler, cache *ResponseCache, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := client.GetName(r.Context())
+		endpoint := CleanEndpoint(r.URL.Path)
+		logger := ctxlog.Logger(r.Context(), logger).With("name", name, "endpoint", endpoint)
+
+		if IsMutating(r.Method, r.URL.Path) {
+			// flush before and after the request: responses of requests
+			// in flight during either flush are not cached
+			cache.Flush(name)
+			defer cache.Flush(name)
+			logger.Debug("msg", "flushing response cache")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ttl, ok := cache.ttl(r.Method, endpoint)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = dephttp.ReadAllAndReplaceBody(r)
+			if err != nil {
+				logger.Info("msg", "reading body", "err", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+		key := cacheKey(r, endpoint, body)
+
+		if resp := cache.get(name, key); resp != nil {
+			logger.Debug("msg", "response cache hit")
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(CacheStatusHeader, "HIT")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+
+		w.Header().Set(CacheStatusHeader, "MISS")
+		gen := cache.generation(name)
+		rec := &bufferingRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK {
+			return
+		}
+		header := w.Header().Clone()
+		header.Del(CacheStatusHeader)
+		cache.set(name, key, gen, &cachedResponse{
+			status:  rec.status,
+			header:  header,
+			body:    rec.body.Bytes(),
+			expires: cache.now().Add(ttl),
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestResponseCache(t *testing.T) {
+	var calls int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"calls":` + strconv.Itoa(calls) + `}`))
+	})
+	ttls, err := ParseResponseCacheTTLs("/devices=30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewResponseCache(ttls)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	handler := ResponseCacheMiddleware(next, cache, log.NopLogger)
+
+	serve := func(name, method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r = r.WithContext(client.WithName(r.Context(), name))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	check := func(w *httptest.ResponseRecorder, status, body string, wantCalls int) {
+		t.Helper()
+		if have := w.Header().Get(CacheStatusHeader); have != status {
+			t.Errorf("cache status: have %q, want %q", have, status)
+		}
+		if have := w.Body.String(); have != body {
+			t.Errorf("body: have %q, want %q", have, body)
+		}
+		if calls != wantCalls {
+			t.Errorf("calls: have %d, want %d", calls, wantCalls)
+		}
+	}
+
+	check(serve("a", "GET", "/account", ""), "MISS", `{"calls":1}`, 1)
+	check(serve("a", "GET", "/account", ""), "HIT", `{"calls":1}`, 1)
+
+	// different DEP name, query, and body are different keys
+	check(serve("b", "GET", "/account", ""), "MISS", `{"calls":2}`, 2)
+	check(serve("a", "GET", "/profile?profile_uuid=1", ""), "MISS", `{"calls":3}`, 3)
+	check(serve("a", "GET", "/profile?profile_uuid=1", ""), "HIT", `{"calls":3}`, 3)
+	check(serve("a", "POST", "/devices", `{"devices":["1"]}`), "MISS", `{"calls":4}`, 4)
+	check(serve("a", "POST", "/devices", `{"devices":["2"]}`), "MISS", `{"calls":5}`, 5)
+	check(serve("a", "POST", "/devices", `{"devices":["1"]}`), "HIT", `{"calls":4}`, 5)
+
+	// per-endpoint TTL expiry
+	now = now.Add(time.Minute)
+	check(serve("a", "POST", "/devices", `{"devices":["1"]}`), "MISS", `{"calls":6}`, 6)
+	check(serve("a", "GET", "/account", ""), "HIT", `{"calls":1}`, 6)
+
+	// endpoints are cleaned before matching
+	check(serve("a", "GET", "//account/", ""), "HIT", `{"calls":1}`, 6)
+
+	// uncacheable endpoints are passed through
+	check(serve("a", "POST", "/devices/sync", ""), "", `{"calls":7}`, 7)
+
+	// mutating requests flush the cache for the DEP name only
+	check(serve("a", "POST", "/profile", "{}"), "", `{"calls":8}`, 8)
+	check(serve("a", "GET", "/account", ""), "MISS", `{"calls":9}`, 9)
+	check(serve("b", "GET", "/account", ""), "HIT", `{"calls":2}`, 9)
+
+	if _, err := ParseResponseCacheTTLs("/devices/disown=1m"); err == nil {
+		t.Error("expected error for uncacheable endpoint")
+	}
+}
+
+func TestResponseCacheFlushRace(t *testing.T) {
+	cache := NewResponseCache(DefaultResponseCacheTTLs())
+	var calls int
+	var flush bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if flush {
+			// simulate a mutating request completing while in flight
+			cache.Flush("a")
+		}
+		w.Write([]byte(`{}`))
+	})
+	handler := ResponseCacheMiddleware(next, cache, log.NopLogger)
+
+	serve := func() string {
+		r := httptest.NewRequest("GET", "/account", nil)
+		r = r.WithContext(client.WithName(r.Context(), "a"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get(CacheStatusHeader)
+	}
+
+	flush = true
+	serve()
+	// the response fetched during the flush must not be cached
+	flush = false
+	if have, want := serve(), "MISS"; have != want {
+		t.Errorf("cache status: have %q, want %q", have, want)
+	}
+	if have, want := serve(), "HIT"; have != want {
+		t.Errorf("cache status: have %q, want %q", have, want)
+	}
+	if have, want := calls, 2; have != want {
+		t.Errorf("calls: have %d, want %d", have, want)
+	}
+}
+
+type nopAuthTokensStore struct{}
+
+func (nopAuthTokensStore) RetrieveAuthTokens(context.Context, string) (*client.OAuth1Tokens, error) {
+	return nil, nil
+}
+
+func (nopAuthTokensStore) StoreAuthTokens(context.Context, string, *client.OAuth1Tokens) error {
+	return nil
+}
+
+func TestResponseCacheFlushStores(t *testing.T) {
+	ctx := context.Background()
+	cache := NewResponseCache(DefaultResponseCacheTTLs())
+	urlCache := NewURLCache(&countingConfigStore{}, time.Minute)
+
+	for _, store := range []func() error{
+		func() error {
+			return NewInvalidatingConfigStorer(&countingConfigStore{}, urlCache, cache).StoreConfig(ctx, "a", &client.Config{})
+		},
+		func() error {
+			return NewFlushingAuthTokensStore(nopAuthTokensStore{}, cache).StoreAuthTokens(ctx, "a", &client.OAuth1Tokens{})
+		},
+	} {
+		gen := cache.generation("a")
+		cache.set("a", "key", gen, &cachedResponse{expires: time.Now().Add(time.Minute)})
+		if err := store(); err != nil {
+			t.Fatal(err)
+		}
+		if cache.get("a", "key") != nil {
+			t.Error("expected response to be flushed")
+		}
+	}
+}
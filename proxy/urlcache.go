@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+const (
+	// DefaultURLCacheTTL is the default duration a parsed DEP name base URL is cached.
+	DefaultURLCacheTTL = 5 * time.Minute
+
+	// DefaultURLCachePollInterval is the default interval between
+	// polls of the storage backend for updated DEP names.
+	DefaultURLCachePollInterval = 10 * time.Second
+
+	// urlCachePollOverlap is subtracted from the time of each poll to
+	// also catch updates committed late (e.g. by long transactions).
+	urlCachePollOverlap = 5 * time.Second
+)
+
+type urlCacheEntry struct {
+	url     *url.URL
+	expires time.Time
+}
+
+// URLCache caches the parsed base URLs of DEP name configs.
+// Entries expire after a TTL and can be explicitly invalidated (for
+// example when a DEP name's config is changed).
+type URLCache struct {
+	store client.ConfigRetriever
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]urlCacheEntry
+	// gens are incremented by every invalidation of a DEP name. URLs
+	// retrieved while their DEP name's generation changed may be out
+	// of date and are not cached.
+	gens map[string]uint64
+}
+
+// NewURLCache creates a new URLCache which retrieves DEP name configs
+// from store. Cached URLs expire after ttl. If ttl is zero then
+// DefaultURLCacheTTL is used. A negative ttl disables caching.
+func NewURLCache(store client.ConfigRetriever, ttl time.Duration) *URLCache {
+	if store == nil {
+		panic("nil store")
+	}
+	if ttl == 0 {
+		ttl = DefaultURLCacheTTL
+	}
+	return &URLCache{
+		store:   client.NewDefaultConfigRetreiver(store),
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]urlCacheEntry),
+		gens:    make(map[string]uint64),
+	}
+}
+
+// URL returns the parsed base URL for name (DEP name).
+// The URL is retrieved and parsed from the config store if it is not
+// already cached or if the cached entry has expired.
+func (c *URLCache) URL(ctx context.Context, name string) (*url.URL, error) {
+	now := c.now()
+	c.mu.RLock()
+	entry, ok := c.entries[name]
+	gen := c.gens[name]
+	c.mu.RUnlock()
+	if ok && now.Before(entry.expires) {
+		return entry.url, nil
+	}
+
+	config, err := c.store.RetrieveConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		// an invalidation during retrieval may have raced our read
+		if c.gens[name] == gen {
+			c.entries[name] = urlCacheEntry{url: u, expires: now.Add(c.ttl)}
+		}
+		c.mu.Unlock()
+	}
+	return u, nil
+}
+
+// Invalidate removes the cached URL for name (DEP name).
+// The next call to URL for name will retrieve the config from the store.
+func (c *URLCache) Invalidate(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.gens[name]++
+	c.mu.Unlock()
+}
+
+// PollUpdates invalidates the cached URLs of DEP names updated in the
+// storage backend by querying it for updated DEP names every interval.
+// This keeps multiple depserver instances sharing the same storage
+// consistent: a config changed on one instance is picked up by the
+// others within interval rather than once their entries expire.
+// PollUpdates runs until ctx is done and returns its error.
+func (c *URLCache) PollUpdates(ctx context.Context, query storage.DEPNamesUpdatedQuery, interval time.Duration, logger log.Logger) error {
+	if query == nil {
+		panic("nil updated DEP names query")
+	}
+	if interval <= 0 {
+		interval = DefaultURLCachePollInterval
+	}
+	// establish the storage backend time to poll from
+	_, since, err := query.QueryDEPNamesUpdatedSince(ctx, time.Now())
+	if err != nil {
+		logger.Info("msg", "querying updated DEP names", "err", err)
+		// fallback to our own clock for the first poll
+		since = time.Now()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		names, now, err := query.QueryDEPNamesUpdatedSince(ctx, since.Add(-urlCachePollOverlap))
+		if err != nil {
+			// keep since to retry the same window on the next poll
+			logger.Info("msg", "querying updated DEP names", "err", err)
+			continue
+		}
+		for _, name := range names {
+			c.Invalidate(name)
+		}
+		if len(names) > 0 {
+			logger.Debug("msg", "invalidated updated DEP names", "count", len(names))
+		}
+		since = now
+	}
+}
+
+// InvalidatingConfigStorer wraps a config storer and invalidates the
+// DEP name's URL cache entry (and, optionally, cached responses) after
+// every config is stored.
+type InvalidatingConfigStorer struct {
+	next      api.ConfigStorer
+	cache     *URLCache
+	respCache *ResponseCache
+}
+
+// NewInvalidatingConfigStorer creates a new InvalidatingConfigStorer
+// that stores configs using next and invalidates entries in cache.
+// If respCache is not nil then its responses for the DEP name are
+// flushed, too.
+func NewInvalidatingConfigStorer(next api.ConfigStorer, cache *URLCache, respCache *ResponseCache) *InvalidatingConfigStorer {
+	if next == nil {
+		panic("nil config storer")
+	}
+	if cache == nil {
+		panic("nil URL cache")
+	}
+	return &InvalidatingConfigStorer{next: next, cache: cache, respCache: respCache}
+}
+
+// StoreConfig stores config for name (DEP name) and invalidates
+// the cached URL and responses for name.
+func (s *InvalidatingConfigStorer) StoreConfig(ctx context.Context, name string, config *client.Config) error {
+	// invalidate even on error: we may have partially written
+	defer func() {
+		s.cache.Invalidate(name)
+		if s.respCache != nil {
+			s.respCache.Flush(name)
+		}
+	}()
+	return s.next.StoreConfig(ctx, name, config)
+}
+
+// InvalidatingDEPNameDeleter wraps a DEP name deleter and invalidates the
+// DEP name's URL cache entry (and, optionally, cached responses) after
+// DEP name data is deleted.
+type InvalidatingDEPNameDeleter struct {
+	next      storage.DEPNameDeleter
+	cache     *URLCache
+	respCache *ResponseCache
+}
+
+// NewInvalidatingDEPNameDeleter creates a new InvalidatingDEPNameDeleter
+// that deletes using next and invalidates entries in cache. If respCache
+// is not nil then its responses for the DEP name are flushed, too.
+func NewInvalidatingDEPNameDeleter(next storage.DEPNameDeleter, cache *URLCache, respCache *ResponseCache) *InvalidatingDEPNameDeleter {
+	if next == nil {
+		panic("nil DEP name deleter")
+	}
+	if cache == nil {
+		panic("nil URL cache")
+	}
+	return &InvalidatingDEPNameDeleter{next: next, cache: cache, respCache: respCache}
+}
+
+// DeleteDEPName deletes the data parts of DEP name and invalidates
+// the cached URL and responses for name.
+func (s *InvalidatingDEPNameDeleter) DeleteDEPName(ctx context.Context, name string, parts ...string) error {
+	// invalidate even on error: we may have partially deleted
+	defer func() {
+		s.cache.Invalidate(name)
+		if s.respCache != nil {
+			s.respCache.Flush(name)
+		}
+	}()
+	return s.next.DeleteDEPName(ctx, name, parts...)
+}
@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type countingConfigStore struct {
+	config    *client.Config
+	retrieved int
+}
+
+func (s *countingConfigStore) RetrieveConfig(_ context.Context, _ string) (*client.Config, error) {
+	s.retrieved++
+	return s.config, nil
+}
+
+func (s *countingConfigStore) StoreConfig(_ context.Context, _ string, config *client.Config) error {
+	s.config = config
+	return nil
+}
+
+// racingConfigStore invalidates the cache while retrieving to simulate
+// a config stored concurrently with an in-flight retrieval.
+type racingConfigStore struct {
+	countingConfigStore
+	cache *URLCache
+	// other invalidates this DEP name instead, if set
+	other string
+}
+
+func (s *racingConfigStore) RetrieveConfig(ctx context.Context, name string) (*client.Config, error) {
+	config, err := s.countingConfigStore.RetrieveConfig(ctx, name)
+	if s.cache != nil {
+		if s.other != "" {
+			name = s.other
+		}
+		s.cache.Invalidate(name)
+	}
+	return config, err
+}
+
+func TestURLCacheInvalidateRace(t *testing.T) {
+	ctx := context.Background()
+	store := &racingConfigStore{countingConfigStore: countingConfigStore{config: &client.Config{BaseURL: "https://a.example.com/"}}}
+	cache := NewURLCache(store, time.Minute)
+	store.cache = cache
+
+	if _, err := cache.URL(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the URL retrieved during the invalidation must not be cached
+	store.cache = nil
+	store.config = &client.Config{BaseURL: "https://b.example.com/"}
+	u, err := cache.URL(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "b.example.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+	if have, want := store.retrieved, 2; have != want {
+		t.Errorf("retrieved: have %d, want %d", have, want)
+	}
+}
+
+func TestURLCacheInvalidateOther(t *testing.T) {
+	ctx := context.Background()
+	store := &racingConfigStore{countingConfigStore: countingConfigStore{config: &client.Config{BaseURL: "https://a.example.com/"}}, other: "other"}
+	cache := NewURLCache(store, time.Minute)
+	store.cache = cache
+
+	if _, err := cache.URL(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// invalidating another DEP name must not prevent caching
+	if _, err := cache.URL(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := store.retrieved, 1; have != want {
+		t.Errorf("retrieved: have %d, want %d", have, want)
+	}
+}
+
+func TestURLCache(t *testing.T) {
+	ctx := context.Background()
+	store := &countingConfigStore{config: &client.Config{BaseURL: "https://a.example.com/"}}
+	cache := NewURLCache(store, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	u, err := cache.URL(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "a.example.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+
+	// should be cached
+	if _, err = cache.URL(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := store.retrieved, 1; have != want {
+		t.Errorf("retrieved: have %d, want %d", have, want)
+	}
+
+	// storing a config should invalidate the entry
+	err = NewInvalidatingConfigStorer(store, cache, nil).StoreConfig(ctx, "test", &client.Config{BaseURL: "https://b.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = cache.URL(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "b.example.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+	if have, want := store.retrieved, 2; have != want {
+		t.Errorf("retrieved: have %d, want %d", have, want)
+	}
+
+	// expire the entry
+	store.config = &client.Config{BaseURL: "https://c.example.com/"}
+	now = now.Add(2 * time.Minute)
+	u, err = cache.URL(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "c.example.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+
+	// default config
+	store.config = nil
+	cache.Invalidate("test")
+	u, err = cache.URL(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "mdmenrollment.apple.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+}
+
+type fakeUpdatedQuery struct {
+	names []string
+	now   time.Time
+	since chan time.Time
+}
+
+func (q *fakeUpdatedQuery) QueryDEPNamesUpdatedSince(ctx context.Context, since time.Time) ([]string, time.Time, error) {
+	select {
+	case q.since <- since:
+	case <-ctx.Done():
+	}
+	return q.names, q.now, nil
+}
+
+func TestURLCachePollUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &countingConfigStore{config: &client.Config{BaseURL: "https://a.example.com/"}}
+	cache := NewURLCache(store, time.Hour)
+	if _, err := cache.URL(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance changes the config
+	store.config = &client.Config{BaseURL: "https://b.example.com/"}
+
+	now := time.Now()
+	query := &fakeUpdatedQuery{names: []string{"test"}, now: now, since: make(chan time.Time)}
+	done := make(chan error)
+	go func() { done <- cache.PollUpdates(ctx, query, time.Millisecond, log.NopLogger) }()
+	<-query.since // establishes the storage time
+	if have, want := <-query.since, now.Add(-urlCachePollOverlap); !have.Equal(want) {
+		t.Errorf("since: have %v, want %v", have, want)
+	}
+	<-query.since // the first poll has invalidated
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	u, err := cache.URL(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := u.Host, "b.example.com"; have != want {
+		t.Errorf("host: have %q, want %q", have, want)
+	}
+}
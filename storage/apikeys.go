@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey is a stored API credential.
+type APIKey struct {
+	// Name identifies the API key. It is used as the HTTP Basic
+	// authentication username.
+	Name string `json:"name"`
+
+	// SecretHash is the hex-encoded SHA-256 hash of the API key secret.
+	// The secret itself is never stored.
+	SecretHash string `json:"secret_hash,omitempty"`
+
+	// Scopes are the permissions granted to the API key.
+	Scopes []string `json:"scopes"`
+
+	// DEPNames, if not empty, restricts the API key to these DEP names.
+	DEPNames []string `json:"dep_names,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKeyStorer stores and retrieves API keys.
+type APIKeyStorer interface {
+	// StoreAPIKey stores key, overwriting any existing key with the same name.
+	StoreAPIKey(ctx context.Context, key *APIKey) error
+
+	// RetrieveAPIKey retrieves the API key called name.
+	// [ErrNotFound] is returned if the key does not exist.
+	RetrieveAPIKey(ctx context.Context, name string) (*APIKey, error)
+
+	// DeleteAPIKey deletes the API key called name.
+	// [ErrNotFound] is returned if the key does not exist.
+	DeleteAPIKey(ctx context.Context, name string) error
+
+	// ListAPIKeys returns all API keys sorted by name.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// AuditEvent is a single entry in the audit log of mutating operations.
+type AuditEvent struct {
+	// Timestamp is the time the operation was performed.
+	Timestamp time.Time `json:"timestamp"`
+
+	DEPName string `json:"dep_name"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Endpoint is the API endpoint or, for proxied requests, the Apple
+	// DEP API endpoint path.
+	Endpoint string `json:"endpoint"`
+
+	// Identity is the authenticated API identity of the caller.
+	Identity string `json:"identity,omitempty"`
+
+	ClientIP string `json:"client_ip,omitempty"`
+
+	// Serials are the device serial numbers in the request, if any.
+	Serials []string `json:"serials,omitempty"`
+
+	// ProfileUUID is the profile UUID in the request, if any.
+	ProfileUUID string `json:"profile_uuid,omitempty"`
+
+	// Status is the HTTP status code of the response. For proxied
+	// requests this is the status returned from Apple.
+	Status int `json:"status"`
+
+	// DryRun is true if the request was answered locally by a proxy
+	// dry-run policy rather than sent to Apple.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type AuditStorer interface {
+	// StoreAuditEvent appends event to the audit log.
+	StoreAuditEvent(ctx context.Context, event *AuditEvent) error
+}
+
+// AuditQueryFilter is the filter parameters for querying the audit log.
+type AuditQueryFilter struct {
+	// DEPNames limits the events to these DEP names.
+	DEPNames []string `json:"dep_names,omitempty"`
+
+	// Since limits the events to those at or after this time.
+	Since *time.Time `json:"since,omitempty"`
+
+	// Until limits the events to those before this time.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// AuditQueryRequest is the parameters for querying the audit log.
+type AuditQueryRequest struct {
+	Filter     *AuditQueryFilter `json:"filter,omitempty"`
+	Pagination *Pagination       `json:"pagination,omitempty"`
+}
+
+// AuditQueryResult is the resulting paginated audit log query.
+// Events are in chronological order.
+type AuditQueryResult struct {
+	Events []AuditEvent `json:"events"`
+
+	PaginationNextCursor
+}
+
+type AuditQuery interface {
+	// QueryAuditEvents queries and returns audit log events.
+	QueryAuditEvents(ctx context.Context, req *AuditQueryRequest) (*AuditQueryResult, error)
+}
+
+// Match reports whether event matches the filter f.
+// A nil filter matches all events.
+func (f *AuditQueryFilter) Match(event *AuditEvent) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.DEPNames) > 0 {
+		var found bool
+		for _, name := range f.DEPNames {
+			if name == event.DEPName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Since != nil && event.Timestamp.Before(*f.Since) {
+		return false
+	}
+	if f.Until != nil && !event.Timestamp.Before(*f.Until) {
+		return false
+	}
+	return true
+}
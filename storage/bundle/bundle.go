@@ -0,0 +1,314 @@
+// Package bundle exports and restores the complete state of DEP names.
+//
+// The state of a DEP name is its OAuth tokens, config, staging and current
+// token PKI, assigner profile, and sync cursor. The state of multiple DEP
+// names can be exported to a passphrase-encrypted bundle file for backups
+// or copied between storage backends.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/sync"
+)
+
+// Retriever retrieves the state of DEP names.
+type Retriever interface {
+	client.AuthTokensRetriever
+	client.ConfigRetriever
+	api.TokenPKIStagingRetriever
+	api.TokenPKICurrentRetriever
+	sync.AssignerProfileRetriever
+	RetrieveCursor(ctx context.Context, name string) (string, error)
+}
+
+// Storer stores the state of DEP names.
+// If it also implements [storage.AssignerProfileTimestampStorer] then
+// assigner profile timestamps are preserved.
+type Storer interface {
+	api.AuthTokensStorer
+	api.ConfigStorer
+	api.TokenPKIStorer
+	api.TokenPKIUpstager
+	api.AssignerProfileStorer
+	StoreCursor(ctx context.Context, name string, cursor string) error
+}
+
+// Restorer retrieves, stores, and deletes the state of DEP names.
+type Restorer interface {
+	Retriever
+	Storer
+	storage.DEPNameDeleter
+}
+
+// restorer combines a storage with a separate DEP name deleter.
+type restorer struct {
+	storage.AllStorage
+	storage.DEPNameDeleter
+}
+
+// NewRestorer creates a Restorer which deletes DEP names using deleter
+// and otherwise uses store. Useful when store is a storage wrapper and
+// deleter is the wrapped storage backend.
+func NewRestorer(store storage.AllStorage, deleter storage.DEPNameDeleter) Restorer {
+	return &restorer{AllStorage: store, DEPNameDeleter: deleter}
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp if the storage supports it.
+// Otherwise the current time is used.
+func (r *restorer) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	return storage.StoreAssignerProfileAt(ctx, r.AllStorage, name, profileUUID, modTime)
+}
+
+// TokenPKI is a PEM certificate and private key.
+type TokenPKI struct {
+	Cert []byte `json:"cert"`
+	Key  []byte `json:"key"`
+}
+
+// DEPName is the state of a DEP name.
+type DEPName struct {
+	Name string `json:"name"`
+
+	Tokens *client.OAuth1Tokens `json:"tokens,omitempty"`
+	Config *client.Config       `json:"config,omitempty"`
+
+	StagingTokenPKI *TokenPKI `json:"staging_tokenpki,omitempty"`
+	CurrentTokenPKI *TokenPKI `json:"current_tokenpki,omitempty"`
+
+	AssignerProfileUUID   string     `json:"assigner_profile_uuid,omitempty"`
+	AssignerProfileUUIDAt *time.Time `json:"assigner_profile_uuid_at,omitempty"`
+
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Empty reports whether d has no state.
+func (d *DEPName) Empty() bool {
+	return d.Tokens == nil &&
+		d.Config == nil &&
+		d.StagingTokenPKI == nil &&
+		d.CurrentTokenPKI == nil &&
+		d.AssignerProfileUUID == "" &&
+		d.Cursor == ""
+}
+
+// Retrieve retrieves the state of DEP name from store.
+func Retrieve(ctx context.Context, store Retriever, name string) (*DEPName, error) {
+	d := &DEPName{Name: name}
+
+	tokens, err := store.RetrieveAuthTokens(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("retrieving tokens: %w", err)
+	} else if err == nil {
+		d.Tokens = tokens
+	}
+
+	config, err := store.RetrieveConfig(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving config: %w", err)
+	}
+	if config != nil && *config != (client.Config{}) {
+		d.Config = config
+	}
+
+	if d.StagingTokenPKI, err = retrieveTokenPKI(ctx, store.RetrieveStagingTokenPKI, name); err != nil {
+		return nil, fmt.Errorf("retrieving staging token PKI: %w", err)
+	}
+
+	if d.CurrentTokenPKI, err = retrieveTokenPKI(ctx, store.RetrieveCurrentTokenPKI, name); err != nil {
+		return nil, fmt.Errorf("retrieving current token PKI: %w", err)
+	}
+
+	profileUUID, modTime, err := store.RetrieveAssignerProfile(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving assigner profile: %w", err)
+	}
+	if profileUUID != "" {
+		d.AssignerProfileUUID = profileUUID
+		if !modTime.IsZero() {
+			d.AssignerProfileUUIDAt = &modTime
+		}
+	}
+
+	if d.Cursor, err = store.RetrieveCursor(ctx, name); err != nil {
+		return nil, fmt.Errorf("retrieving cursor: %w", err)
+	}
+
+	return d, nil
+}
+
+// retrieveTokenPKI retrieves a token PKI using retrieve.
+// Nil is returned if the token PKI does not exist.
+func retrieveTokenPKI(ctx context.Context, retrieve func(context.Context, string) ([]byte, []byte, error), name string) (*TokenPKI, error) {
+	pemCert, pemKey, err := retrieve(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(pemCert) < 1 {
+		return nil, nil
+	}
+	return &TokenPKI{Cert: pemCert, Key: pemKey}, nil
+}
+
+// Store stores the state of the DEP name d in store.
+// Only the non-empty parts of d are stored.
+//
+// The current token PKI can only be stored by upstaging it. If d has a
+// current but no staging token PKI then the staging token PKI will be
+// the same as the current token PKI.
+func Store(ctx context.Context, store Storer, d *DEPName) error {
+	if d == nil || d.Name == "" {
+		return errors.New("missing DEP name")
+	}
+	name := d.Name
+
+	if d.CurrentTokenPKI != nil {
+		if err := store.StoreTokenPKI(ctx, name, d.CurrentTokenPKI.Cert, d.CurrentTokenPKI.Key); err != nil {
+			return fmt.Errorf("storing current token PKI: %w", err)
+		}
+		if err := store.UpstageTokenPKI(ctx, name); err != nil {
+			return fmt.Errorf("upstaging current token PKI: %w", err)
+		}
+	}
+
+	if d.StagingTokenPKI != nil {
+		if err := store.StoreTokenPKI(ctx, name, d.StagingTokenPKI.Cert, d.StagingTokenPKI.Key); err != nil {
+			return fmt.Errorf("storing staging token PKI: %w", err)
+		}
+	}
+
+	if d.Tokens != nil {
+		if err := store.StoreAuthTokens(ctx, name, d.Tokens); err != nil {
+			return fmt.Errorf("storing tokens: %w", err)
+		}
+	}
+
+	if d.Config != nil {
+		if err := store.StoreConfig(ctx, name, d.Config); err != nil {
+			return fmt.Errorf("storing config: %w", err)
+		}
+	}
+
+	if d.AssignerProfileUUID != "" {
+		var err error
+		if ts, ok := store.(storage.AssignerProfileTimestampStorer); ok && d.AssignerProfileUUIDAt != nil {
+			err = ts.StoreAssignerProfileAt(ctx, name, d.AssignerProfileUUID, *d.AssignerProfileUUIDAt)
+		} else {
+			err = store.StoreAssignerProfile(ctx, name, d.AssignerProfileUUID)
+		}
+		if err != nil {
+			return fmt.Errorf("storing assigner profile: %w", err)
+		}
+	}
+
+	if d.Cursor != "" {
+		if err := store.StoreCursor(ctx, name, d.Cursor); err != nil {
+			return fmt.Errorf("storing cursor: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Policies for DEP names which already exist when restoring.
+const (
+	ExistingSkip      = "skip"
+	ExistingOverwrite = "overwrite"
+	ExistingFail      = "fail"
+)
+
+// ValidExisting reports whether existing is a valid existing policy.
+func ValidExisting(existing string) bool {
+	switch existing {
+	case ExistingSkip, ExistingOverwrite, ExistingFail:
+		return true
+	}
+	return false
+}
+
+// ErrExists is returned when restoring a DEP name which already exists
+// and the existing policy is to fail.
+var ErrExists = errors.New("DEP name exists")
+
+// Results of restoring a DEP name.
+const (
+	ResultStored          = "stored"
+	ResultWouldStore      = "would store"
+	ResultOverwritten     = "overwritten"
+	ResultWouldOverwrite  = "would overwrite"
+	ResultSkippedExisting = "skipped existing"
+	ResultSkippedEmpty    = "skipped empty"
+)
+
+// Restore stores the state of the DEP name d in store according to the
+// existing policy and returns the result. A DEP name exists if it has any
+// state in store. Overwriting first deletes all existing state of the
+// DEP name. If dryRun is true then store is not changed.
+func Restore(ctx context.Context, store Restorer, d *DEPName, existing string, dryRun bool) (string, error) {
+	if d == nil || d.Name == "" {
+		return "", errors.New("missing DEP name")
+	}
+	if d.Empty() {
+		return ResultSkippedEmpty, nil
+	}
+
+	current, err := Retrieve(ctx, store, d.Name)
+	if err != nil {
+		return "", err
+	}
+	result, wouldResult := ResultStored, ResultWouldStore
+	if !current.Empty() {
+		switch existing {
+		case ExistingSkip:
+			return ResultSkippedExisting, nil
+		case ExistingOverwrite:
+			result, wouldResult = ResultOverwritten, ResultWouldOverwrite
+		default:
+			return "", ErrExists
+		}
+	}
+
+	if dryRun {
+		return wouldResult, nil
+	}
+
+	if result == ResultOverwritten {
+		// remove any state not in d
+		if err = store.DeleteDEPName(ctx, d.Name); err != nil {
+			return "", fmt.Errorf("deleting DEP name: %w", err)
+		}
+	}
+
+	return result, Store(ctx, store, d)
+}
+
+// Bundle is the exported state of multiple DEP names.
+type Bundle struct {
+	CreatedAt time.Time  `json:"created_at"`
+	DEPNames  []*DEPName `json:"dep_names"`
+}
+
+// Export retrieves the state of names from store into a new bundle.
+// DEP names without any state are not included.
+func Export(ctx context.Context, store Retriever, names []string) (*Bundle, error) {
+	b := &Bundle{CreatedAt: time.Now().UTC()}
+	for _, name := range names {
+		d, err := Retrieve(ctx, store, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if !d.Empty() {
+			b.DEPNames = append(b.DEPNames, d)
+		}
+	}
+	return b, nil
+}
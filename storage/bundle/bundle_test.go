@@ -0,0 +1,64 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage/inmem"
+)
+
+func TestEncrypt(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	if err := store.StoreConfig(ctx, "a", &client.Config{BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreCursor(ctx, "a", "cursor"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Export(ctx, store, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(b.DEPNames), 1; have != want {
+		t.Fatalf("DEP names: have %d, want %d", have, want)
+	}
+
+	if _, err = Encrypt(b, ""); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("have %v, want %v", err, ErrEmptyPassphrase)
+	}
+	data, err := Encrypt(b, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := Decrypt(data, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.DEPNames, b2.DEPNames) || !b.CreatedAt.Equal(b2.CreatedAt) {
+		t.Error("decrypted bundle mismatch")
+	}
+
+	if _, err = Decrypt(data, "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("have %v, want %v", err, ErrDecrypt)
+	}
+
+	// the header is authenticated
+	f := new(encryptedFile)
+	if err = json.Unmarshal(data, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Iterations++
+	if data, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Decrypt(data, "secret"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("have %v, want %v", err, ErrDecrypt)
+	}
+}
@@ -0,0 +1,137 @@
+package bundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	fileType    = "nanodep-bundle"
+	fileVersion = 1
+	fileKDF     = "pbkdf2-sha256"
+
+	// iterations is the number of PBKDF2 iterations for new bundles.
+	iterations = 600000
+
+	// minIterations and maxIterations bound the PBKDF2 iterations of
+	// bundles being decrypted to prevent downgrades and excessive work.
+	minIterations = 100000
+	maxIterations = 10000000
+)
+
+var (
+	// ErrEmptyPassphrase is returned when encrypting or decrypting
+	// a bundle with an empty passphrase.
+	ErrEmptyPassphrase = errors.New("empty passphrase")
+
+	// ErrDecrypt is returned when a bundle cannot be decrypted.
+	ErrDecrypt = errors.New("incorrect passphrase or corrupt bundle")
+)
+
+// encryptedFile is the JSON file format of encrypted bundles.
+type encryptedFile struct {
+	Type       string `json:"type"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+
+	// Ciphertext is the AES-256-GCM encrypted JSON bundle prefixed
+	// with the nonce.
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// additionalData returns the authenticated header data of f.
+func (f *encryptedFile) additionalData() []byte {
+	return fmt.Appendf(nil, "%s.v%d.%s.%d", f.Type, f.Version, f.KDF, f.Iterations)
+}
+
+func newAEAD(passphrase string, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts b with a key derived from passphrase.
+// The returned encrypted bundle is JSON.
+func Encrypt(b *Bundle, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	f := &encryptedFile{
+		Type:       fileType,
+		Version:    fileVersion,
+		KDF:        fileKDF,
+		Iterations: iterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err = rand.Read(f.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	f.Ciphertext = aead.Seal(nonce, nonce, plaintext, f.additionalData())
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Decrypt decrypts the encrypted bundle data with a key derived from passphrase.
+func Decrypt(data []byte, passphrase string) (*Bundle, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	f := new(encryptedFile)
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("decoding bundle: %w", err)
+	}
+	if f.Type != fileType {
+		return nil, fmt.Errorf("invalid bundle type: %q", f.Type)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported bundle version: %d", f.Version)
+	}
+	if f.KDF != fileKDF {
+		return nil, fmt.Errorf("unsupported bundle KDF: %q", f.KDF)
+	}
+	if f.Iterations < minIterations || f.Iterations > maxIterations {
+		return nil, fmt.Errorf("invalid bundle KDF iterations: %d", f.Iterations)
+	}
+	aead, err := newAEAD(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := f.Ciphertext[:aead.NonceSize()], f.Ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, f.additionalData())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	b := new(Bundle)
+	if err = json.Unmarshal(plaintext, b); err != nil {
+		return nil, fmt.Errorf("decoding decrypted bundle: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// DEP name data parts which can be individually deleted.
+const (
+	// PartTokens are the OAuth1 tokens and the account detail and
+	// OS beta enrollment tokens fetched with them.
+	PartTokens = "tokens"
+
+	// PartConfig is the config (i.e. base URL).
+	PartConfig = "config"
+
+	// PartTokenPKI are both the current and staging token PKI
+	// certificates and private keys.
+	PartTokenPKI = "tokenpki"
+
+	// PartAssigner is the assigner profile UUID and its timestamp.
+	PartAssigner = "assigner"
+
+	// PartCursor is the syncer cursor.
+	PartCursor = "cursor"
+)
+
+// AllParts are all DEP name data parts.
+var AllParts = []string{
+	PartTokens,
+	PartConfig,
+	PartTokenPKI,
+	PartAssigner,
+	PartCursor,
+}
+
+// ValidateParts checks that parts only contains valid DEP name data parts.
+func ValidateParts(parts []string) error {
+	for _, part := range parts {
+		if !slices.Contains(AllParts, part) {
+			return fmt.Errorf("invalid part: %s", part)
+		}
+	}
+	return nil
+}
+
+// AllPartsSelected reports whether parts is empty (implying all parts)
+// or includes all DEP name data parts.
+func AllPartsSelected(parts []string) bool {
+	for _, part := range AllParts {
+		if len(parts) > 0 && !slices.Contains(parts, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// DEPNameDeleter deletes DEP name data.
+// The change history and escrowed bypass codes of a DEP name are never
+// deleted: they are kept for audit purposes.
+type DEPNameDeleter interface {
+	// DeleteDEPName deletes the data parts of DEP name.
+	// If no parts are provided all data for the DEP name is deleted.
+	// Deleting a DEP name (or parts) that do not exist is not an error.
+	DeleteDEPName(ctx context.Context, name string, parts ...string) error
+}
@@ -1,12 +1,84 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/cryptoutil"
+)
 
 // DEPNamesQueryFilter is the filter parameters for querying DEP names.
+// All specified filters must match. Only DEP names with a staged
+// (uploaded) token PKI certificate are query-able unless any filter
+// other than DEPNames is specified. See [DEPNamesQueryFilter.IncludesUnstaged].
 type DEPNamesQueryFilter struct {
 	// DEPNames specifies which DEP names to query for.
 	// DEP names in this list which exists are returned.
 	DEPNames []string `json:"dep_names"`
+
+	// HasTokens, if not nil, matches DEP names by whether they have
+	// OAuth tokens.
+	HasTokens *bool `json:"has_tokens,omitempty"`
+
+	// ExpiringBefore, if not nil, matches DEP names with OAuth tokens
+	// whose access token expires before this time.
+	ExpiringBefore *time.Time `json:"expiring_before,omitempty"`
+
+	// BaseURL, if not nil, matches DEP names whose config base URL is
+	// exactly this value. An empty string matches DEP names without a
+	// configured base URL.
+	BaseURL *string `json:"base_url,omitempty"`
+
+	// NamePrefix, if not empty, matches DEP names starting with it.
+	NamePrefix string `json:"name_prefix,omitempty"`
+}
+
+// MatchesDetails reports whether the filter matches on DEP name details
+// other than the name. If not then only [DEPNamesQueryFilter.MatchName]
+// needs to be checked.
+func (f *DEPNamesQueryFilter) MatchesDetails() bool {
+	return f != nil && (f.HasTokens != nil || f.ExpiringBefore != nil || f.BaseURL != nil)
+}
+
+// IncludesUnstaged reports whether DEP names without a staged (uploaded)
+// token PKI certificate can match the filter. This is the case if any of
+// the has tokens, expiring before, base URL, or name prefix filters are
+// specified. Otherwise only DEP names with a staged certificate are
+// query-able.
+func (f *DEPNamesQueryFilter) IncludesUnstaged() bool {
+	return f.MatchesDetails() || (f != nil && f.NamePrefix != "")
+}
+
+// MatchName reports whether name matches the DEP names and name prefix
+// filters. A nil filter matches all DEP names.
+func (f *DEPNamesQueryFilter) MatchName(name string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.DEPNames) > 0 && !slices.Contains(f.DEPNames, name) {
+		return false
+	}
+	return strings.HasPrefix(name, f.NamePrefix)
+}
+
+// Match reports whether d matches the filter.
+// A nil filter matches all DEP names.
+func (f *DEPNamesQueryFilter) Match(d *DEPNameDetails) bool {
+	if !f.MatchName(d.Name) {
+		return false
+	}
+	if f.HasTokens != nil && *f.HasTokens != d.HasTokens {
+		return false
+	}
+	if f.ExpiringBefore != nil && (d.AccessTokenExpiry == nil || !d.AccessTokenExpiry.Before(*f.ExpiringBefore)) {
+		return false
+	}
+	if f.BaseURL != nil && *f.BaseURL != d.BaseURL {
+		return false
+	}
+	return true
 }
 
 // DEPNamesQueryRequest is the parameters for querying DEP names.
@@ -15,14 +87,138 @@ type DEPNamesQueryRequest struct {
 	Pagination *Pagination          `json:"pagination,omitempty"`
 }
 
+// DEPNameDetails is the metadata of a DEP name.
+// Secrets (tokens and private keys) are never included.
+type DEPNameDetails struct {
+	Name string `json:"name"`
+
+	HasTokens         bool       `json:"has_tokens"`
+	AccessTokenExpiry *time.Time `json:"access_token_expiry,omitempty"`
+
+	// ConsumerKeyPrefix is the first few characters of the consumer key.
+	// This can help identify tokens without revealing the whole key.
+	ConsumerKeyPrefix string `json:"consumer_key_prefix,omitempty"`
+
+	BaseURL string `json:"base_url,omitempty"`
+
+	HasStagingTokenPKI bool       `json:"has_staging_tokenpki"`
+	StagingCertExpiry  *time.Time `json:"staging_cert_expiry,omitempty"`
+	HasCurrentTokenPKI bool       `json:"has_current_tokenpki"`
+	CurrentCertExpiry  *time.Time `json:"current_cert_expiry,omitempty"`
+
+	AssignerProfileUUID   string     `json:"assigner_profile_uuid,omitempty"`
+	AssignerProfileUUIDAt *time.Time `json:"assigner_profile_uuid_at,omitempty"`
+
+	HasCursor bool `json:"has_cursor"`
+
+	// CreatedAt and UpdatedAt are only set if the storage backend
+	// tracks them.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// consumerKeyPrefixLength is the number of consumer key characters
+// included in DEP name details.
+const consumerKeyPrefixLength = 12
+
+// SetConsumerKey sets the consumer key prefix from the consumer key.
+func (d *DEPNameDetails) SetConsumerKey(consumerKey string) {
+	if len(consumerKey) > consumerKeyPrefixLength {
+		consumerKey = consumerKey[:consumerKeyPrefixLength]
+	}
+	d.ConsumerKeyPrefix = consumerKey
+}
+
+// SetTokenPKI sets the presence and certificate expiry of the staging or
+// current token PKI from the PEM certificate. An empty certificate
+// indicates the token PKI does not exist.
+func (d *DEPNameDetails) SetTokenPKI(staging bool, pemCert []byte) {
+	if len(pemCert) < 1 {
+		return
+	}
+	var expiry *time.Time
+	if cert, err := cryptoutil.CertificateFromPEM(pemCert); err == nil {
+		expiry = &cert.NotAfter
+	}
+	if staging {
+		d.HasStagingTokenPKI = true
+		d.StagingCertExpiry = expiry
+	} else {
+		d.HasCurrentTokenPKI = true
+		d.CurrentCertExpiry = expiry
+	}
+}
+
 // DEPNamesQueryResult is the resulting paginated of the DEP names query.
 type DEPNamesQueryResult struct {
-	DEPNames []string `json:"dep_names"`
+	// DEPNames contains the metadata of each matching DEP name.
+	DEPNames []DEPNameDetails `json:"dep_names"`
 
 	PaginationNextCursor
 }
 
+// Names returns the names of the DEP names in the result.
+func (r *DEPNamesQueryResult) Names() []string {
+	names := make([]string, 0, len(r.DEPNames))
+	for _, d := range r.DEPNames {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
 type DEPNamesQuery interface {
-	// QueryDEPNames queries and returns DEP names.
+	// QueryDEPNames queries and returns DEP names and their details.
 	QueryDEPNames(ctx context.Context, req *DEPNamesQueryRequest) (*DEPNamesQueryResult, error)
 }
+
+// DEPNamesUpdatedQuery finds recently updated DEP names.
+// Storage backends shared by multiple instances may optionally implement
+// it so that instances can invalidate their caches of DEP name data.
+type DEPNamesUpdatedQuery interface {
+	// QueryDEPNamesUpdatedSince returns the DEP names updated at or
+	// after since. The current time of the storage backend is also
+	// returned for use as since in the next query.
+	QueryDEPNamesUpdatedSince(ctx context.Context, since time.Time) (names []string, now time.Time, err error)
+}
+
+// DEPNamesLister lists every DEP name.
+// Storage backends may optionally implement it.
+type DEPNamesLister interface {
+	// ListDEPNames returns the sorted names of all DEP names with any
+	// stored data. Unlike [DEPNamesQuery] this includes DEP names
+	// without a staging token PKI.
+	ListDEPNames(ctx context.Context) ([]string, error)
+}
+
+// ListDEPNames returns all DEP names of q if it implements [DEPNamesLister].
+// Otherwise it falls back to all DEP names returned by the DEP names query
+// of q which may exclude DEP names without a staging token PKI.
+// Storage wrappers can use this to forward to the storage they wrap.
+func ListDEPNames(ctx context.Context, q DEPNamesQuery) ([]string, error) {
+	if l, ok := q.(DEPNamesLister); ok {
+		return l.ListDEPNames(ctx)
+	}
+	return AllDEPNames(ctx, q, nil)
+}
+
+// AllDEPNames pages through the DEP names query of q and returns all DEP
+// names matching filter.
+func AllDEPNames(ctx context.Context, q DEPNamesQuery, filter *DEPNamesQueryFilter) ([]string, error) {
+	offset, limit := 0, 100
+	req := &DEPNamesQueryRequest{
+		Filter:     filter,
+		Pagination: &Pagination{Offset: &offset, Limit: &limit},
+	}
+	var names []string
+	for {
+		res, err := q.QueryDEPNames(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, res.Names()...)
+		if len(res.DEPNames) < limit {
+			return names, nil
+		}
+		offset += len(res.DEPNames)
+	}
+}
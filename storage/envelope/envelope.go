@@ -0,0 +1,335 @@
+// Package envelope provides a storage wrapper that encrypts secrets at rest
+// using envelope encryption.
+//
+// Each secret is encrypted with its own random AES-256-GCM data key. The data
+// key is wrapped (encrypted) by a key-encryption key from a [KeyProvider] and
+// stored alongside the ciphertext. Secrets are bound to their DEP name and
+// field so encrypted values cannot be swapped between DEP names.
+//
+// Encrypted are the OAuth consumer and access secrets, the token PKI
+// private keys, and escrowed Activation Lock bypass codes. Existing unencrypted values are read as-is and encrypted when
+// next written or re-encrypted.
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage"
+)
+
+// ErrEscrowUnsupported is returned when escrowing bypass codes with a
+// wrapped storage that does not support escrow.
+var ErrEscrowUnsupported = errors.New("bypass code escrow not supported by storage")
+
+const (
+	// prefix marks encrypted values.
+	prefix = "nanodep-enc:v1:"
+
+	// sep separates the parts of encrypted values.
+	sep = ":"
+
+	// maxCachedKeys limits the number of cached unwrapped data keys.
+	maxCachedKeys = 1024
+)
+
+// fields of the encrypted secrets used as additional authenticated data.
+const (
+	fieldConsumerSecret    = "consumer_secret"
+	fieldAccessSecret      = "access_secret"
+	fieldTokenPKIKey       = "tokenpki_key"
+	fieldBypassCode        = "bypass_code"
+	fieldPendingBypassCode = "pending_bypass_code"
+)
+
+// Storage wraps storage.AllStorage and encrypts secrets at rest.
+type Storage struct {
+	storage.AllStorage
+	keys KeyProvider
+
+	// caches unwrapped data keys as unwrapping may call out to a KMS
+	cacheMu sync.RWMutex
+	cache   map[string][]byte
+}
+
+// New creates a new Storage that encrypts the secrets stored in store
+// using keys.
+func New(store storage.AllStorage, keys KeyProvider) (*Storage, error) {
+	if store == nil {
+		return nil, errors.New("nil storage")
+	}
+	if keys == nil {
+		return nil, errors.New("nil key provider")
+	}
+	return &Storage{
+		AllStorage: store,
+		keys:       keys,
+		cache:      make(map[string][]byte),
+	}, nil
+}
+
+// IsEncrypted reports whether value is an encrypted value.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// keyID returns the key-encryption key ID of the encrypted value.
+func keyID(value string) string {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), sep)
+	if len(parts) != 3 {
+		return ""
+	}
+	id, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	return string(id)
+}
+
+func additionalData(name, field string) []byte {
+	return []byte(name + "\x00" + field)
+}
+
+// encrypt encrypts plaintext for the field of DEP name with a new data key.
+// Empty values are not encrypted.
+func (s *Storage) encrypt(ctx context.Context, name, field, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), additionalData(name, field))
+	if err != nil {
+		return "", err
+	}
+	id, wrappedKey, err := s.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrapping data key: %w", err)
+	}
+	return prefix + strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(id)),
+		base64.RawURLEncoding.EncodeToString(wrappedKey),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+	}, sep), nil
+}
+
+// decrypt decrypts the encrypted value for the field of DEP name.
+// Unencrypted values are returned as-is.
+func (s *Storage) decrypt(ctx context.Context, name, field, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), sep)
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted value")
+	}
+	var decoded [3][]byte
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return "", fmt.Errorf("decoding encrypted value: %w", err)
+		}
+	}
+	dataKey, err := s.unwrapKey(ctx, string(decoded[0]), decoded[1])
+	if err != nil {
+		return "", fmt.Errorf("unwrapping data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, decoded[2], additionalData(name, field))
+	if err != nil {
+		return "", fmt.Errorf("decrypting %s: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// unwrapKey unwraps the data key using the cache if possible.
+func (s *Storage) unwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	cacheKey := keyID + sep + string(wrappedKey)
+	s.cacheMu.RLock()
+	dataKey, ok := s.cache[cacheKey]
+	s.cacheMu.RUnlock()
+	if ok {
+		return dataKey, nil
+	}
+	dataKey, err := s.keys.UnwrapKey(ctx, keyID, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if len(s.cache) >= maxCachedKeys {
+		s.cache = make(map[string][]byte)
+	}
+	s.cache[cacheKey] = dataKey
+	return dataKey, nil
+}
+
+// StoreAuthTokens encrypts the secrets of tokens and stores them for name (DEP name).
+func (s *Storage) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
+	if tokens == nil {
+		return s.AllStorage.StoreAuthTokens(ctx, name, tokens)
+	}
+	encTokens := *tokens
+	var err error
+	if encTokens.ConsumerSecret, err = s.encrypt(ctx, name, fieldConsumerSecret, tokens.ConsumerSecret); err != nil {
+		return err
+	}
+	if encTokens.AccessSecret, err = s.encrypt(ctx, name, fieldAccessSecret, tokens.AccessSecret); err != nil {
+		return err
+	}
+	return s.AllStorage.StoreAuthTokens(ctx, name, &encTokens)
+}
+
+// RetrieveAuthTokens retrieves the tokens for name (DEP name) and decrypts their secrets.
+func (s *Storage) RetrieveAuthTokens(ctx context.Context, name string) (*client.OAuth1Tokens, error) {
+	tokens, err := s.AllStorage.RetrieveAuthTokens(ctx, name)
+	if err != nil || tokens == nil {
+		return tokens, err
+	}
+	if tokens.ConsumerSecret, err = s.decrypt(ctx, name, fieldConsumerSecret, tokens.ConsumerSecret); err != nil {
+		return nil, err
+	}
+	if tokens.AccessSecret, err = s.decrypt(ctx, name, fieldAccessSecret, tokens.AccessSecret); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// StoreTokenPKI encrypts pemKey and stores the staging token PKI for name (DEP name).
+func (s *Storage) StoreTokenPKI(ctx context.Context, name string, pemCert []byte, pemKey []byte) error {
+	encKey, err := s.encrypt(ctx, name, fieldTokenPKIKey, string(pemKey))
+	if err != nil {
+		return err
+	}
+	return s.AllStorage.StoreTokenPKI(ctx, name, pemCert, []byte(encKey))
+}
+
+// RetrieveStagingTokenPKI retrieves the staging token PKI for name (DEP name)
+// and decrypts its key.
+func (s *Storage) RetrieveStagingTokenPKI(ctx context.Context, name string) ([]byte, []byte, error) {
+	pemCert, pemKey, err := s.AllStorage.RetrieveStagingTokenPKI(ctx, name)
+	if err != nil {
+		return pemCert, pemKey, err
+	}
+	key, err := s.decrypt(ctx, name, fieldTokenPKIKey, string(pemKey))
+	return pemCert, []byte(key), err
+}
+
+// RetrieveCurrentTokenPKI retrieves the current token PKI for name (DEP name)
+// and decrypts its key.
+func (s *Storage) RetrieveCurrentTokenPKI(ctx context.Context, name string) ([]byte, []byte, error) {
+	pemCert, pemKey, err := s.AllStorage.RetrieveCurrentTokenPKI(ctx, name)
+	if err != nil {
+		return pemCert, pemKey, err
+	}
+	key, err := s.decrypt(ctx, name, fieldTokenPKIKey, string(pemKey))
+	return pemCert, []byte(key), err
+}
+
+// bypassCodeField returns the field of the bypass code of the device with
+// serial. Binds encrypted bypass codes to their device.
+func bypassCodeField(serial string) string {
+	return fieldBypassCode + ":" + serial
+}
+
+// pendingBypassCodeField returns the field of the pending bypass code of
+// the device with serial.
+func pendingBypassCodeField(serial string) string {
+	return fieldPendingBypassCode + ":" + serial
+}
+
+// escrowStorer returns the wrapped storage as a bypass code escrow storer.
+// An error is returned if the wrapped storage does not support escrow.
+func (s *Storage) escrowStorer() (storage.BypassCodeEscrowStorer, error) {
+	escrowStorer, ok := s.AllStorage.(storage.BypassCodeEscrowStorer)
+	if !ok {
+		return nil, ErrEscrowUnsupported
+	}
+	return escrowStorer, nil
+}
+
+// StoreBypassCode encrypts the escrowed and pending bypass codes and stores them.
+func (s *Storage) StoreBypassCode(ctx context.Context, escrow *storage.EscrowedBypassCode) error {
+	escrowStorer, err := s.escrowStorer()
+	if err != nil {
+		return err
+	}
+	encEscrow := *escrow
+	if encEscrow.Code, err = s.encrypt(ctx, escrow.DEPName, bypassCodeField(escrow.Serial), escrow.Code); err != nil {
+		return err
+	}
+	if encEscrow.PendingCode, err = s.encrypt(ctx, escrow.DEPName, pendingBypassCodeField(escrow.Serial), escrow.PendingCode); err != nil {
+		return err
+	}
+	return escrowStorer.StoreBypassCode(ctx, &encEscrow)
+}
+
+// RetrieveBypassCode retrieves the escrowed bypass code of the device with
+// serial of DEP name and decrypts it and any pending bypass code.
+func (s *Storage) RetrieveBypassCode(ctx context.Context, name, serial string) (*storage.EscrowedBypassCode, error) {
+	escrowStorer, err := s.escrowStorer()
+	if err != nil {
+		return nil, err
+	}
+	escrow, err := escrowStorer.RetrieveBypassCode(ctx, name, serial)
+	if err != nil {
+		return nil, err
+	}
+	if escrow.Code, err = s.decrypt(ctx, name, bypassCodeField(serial), escrow.Code); err != nil {
+		return nil, err
+	}
+	if escrow.PendingCode, err = s.decrypt(ctx, name, pendingBypassCodeField(serial), escrow.PendingCode); err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// ListBypassCodeSerials returns the serial numbers of the devices of DEP
+// name with escrowed bypass codes in the wrapped storage.
+func (s *Storage) ListBypassCodeSerials(ctx context.Context, name string) ([]string, error) {
+	escrowStorer, err := s.escrowStorer()
+	if err != nil {
+		return nil, err
+	}
+	return escrowStorer.ListBypassCodeSerials(ctx, name)
+}
+
+// DeleteBypassCode deletes the escrowed bypass code of the device with
+// serial of DEP name from the wrapped storage.
+func (s *Storage) DeleteBypassCode(ctx context.Context, name, serial string) error {
+	escrowStorer, err := s.escrowStorer()
+	if err != nil {
+		return err
+	}
+	return escrowStorer.DeleteBypassCode(ctx, name, serial)
+}
+
+// Ping pings the wrapped storage.
+func (s *Storage) Ping(ctx context.Context) error {
+	return storage.Ping(ctx, s.AllStorage)
+}
+
+// ListDEPNames lists all DEP names of the wrapped storage.
+func (s *Storage) ListDEPNames(ctx context.Context) ([]string, error) {
+	return storage.ListDEPNames(ctx, s.AllStorage)
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp if the wrapped storage supports it.
+// Otherwise the current time is used.
+func (s *Storage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	return storage.StoreAssignerProfileAt(ctx, s.AllStorage, name, profileUUID, modTime)
+}
@@ -0,0 +1,373 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/cryptoutil"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+	"github.com/micromdm/nanodep/storage/kv"
+	"github.com/micromdm/nanodep/storage/sqlite"
+	"github.com/micromdm/nanodep/storage/test"
+	"github.com/micromdm/nanodep/tokenpki"
+
+	"github.com/micromdm/nanolib/storage/kv/kvmap"
+	"github.com/micromdm/nanolib/storage/kv/kvtxn"
+)
+
+func generatePKI(t *testing.T) (pemCert []byte, pemKey []byte) {
+	key, cert, err := tokenpki.SelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cryptoutil.PEMCertificate(cert.Raw), cryptoutil.PEMRSAPrivateKey(key)
+}
+
+func newKeyFile(t *testing.T, ids ...string) string {
+	var lines []string
+	for _, id := range ids {
+		line, err := GenerateLocalKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# test keys\n"+strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newLocalKeyProvider(t *testing.T, path string) *LocalKeyProvider {
+	keys, err := LoadLocalKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestEnvelope(t *testing.T) {
+	keys := newLocalKeyProvider(t, newKeyFile(t, "k1"))
+	s, err := New(inmem.New(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.TestWithStorages(t, context.Background(), s)
+}
+
+func TestEnvelopeSQLite(t *testing.T) {
+	// SQL schemas constrain the token PKI key column contents
+	db, err := sqlite.New(sqlite.WithDSN(filepath.Join(t.TempDir(), "nanodep.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := newLocalKeyProvider(t, newKeyFile(t, "k1"))
+	s, err := New(db, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.TestWithStorages(t, context.Background(), s)
+}
+
+func TestEscrowUnsupported(t *testing.T) {
+	ctx := context.Background()
+	// hide the optional interfaces of the in-memory storage
+	store := struct{ storage.AllStorage }{inmem.New()}
+	s, err := New(store, newLocalKeyProvider(t, newKeyFile(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	escrow := &storage.EscrowedBypassCode{DEPName: "a", Serial: "SERIAL1", Code: "code", PendingCode: "pending"}
+	if err = s.StoreBypassCode(ctx, escrow); !errors.Is(err, ErrEscrowUnsupported) {
+		t.Errorf("have %v, want %v", err, ErrEscrowUnsupported)
+	}
+	if _, err = s.RetrieveBypassCode(ctx, "a", "SERIAL1"); !errors.Is(err, ErrEscrowUnsupported) {
+		t.Errorf("have %v, want %v", err, ErrEscrowUnsupported)
+	}
+
+	// re-encrypting skips escrowed bypass codes
+	if err = store.StoreAuthTokens(ctx, "a", &client.OAuth1Tokens{ConsumerKey: "ck", ConsumerSecret: "cs"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Reencrypt(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	s, err := New(store, newLocalKeyProvider(t, newKeyFile(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := &client.OAuth1Tokens{ConsumerKey: "ck", ConsumerSecret: "cs", AccessToken: "at", AccessSecret: "as"}
+	if err = s.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := store.RetrieveAuthTokens(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(raw.ConsumerSecret) || !IsEncrypted(raw.AccessSecret) {
+		t.Fatal("secrets not encrypted")
+	}
+	if raw.ConsumerKey != "ck" || raw.AccessToken != "at" {
+		t.Error("non-secrets modified")
+	}
+
+	// encrypted values are bound to their DEP name
+	if err = store.StoreAuthTokens(ctx, "b", raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.RetrieveAuthTokens(ctx, "b"); err == nil {
+		t.Error("expected error decrypting secrets of another DEP name")
+	}
+
+	// escrowed bypass codes are bound to their device
+	if err = s.StoreBypassCode(ctx, &storage.EscrowedBypassCode{DEPName: "a", Serial: "SERIAL1", Code: "code"}); err != nil {
+		t.Fatal(err)
+	}
+	rawEscrow, err := store.RetrieveBypassCode(ctx, "a", "SERIAL1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(rawEscrow.Code) {
+		t.Fatal("bypass code not encrypted")
+	}
+	rawEscrow.Serial = "SERIAL2"
+	if err = store.StoreBypassCode(ctx, rawEscrow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.RetrieveBypassCode(ctx, "a", "SERIAL2"); err == nil {
+		t.Error("expected error decrypting bypass code of another device")
+	}
+
+	// unencrypted values are read as-is
+	if err = store.StoreTokenPKI(ctx, "a", []byte("cert"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := s.RetrieveStagingTokenPKI(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(key), "key"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+
+	cert1, key1 := generatePKI(t)
+	cert2, key2 := generatePKI(t)
+
+	// start with unencrypted secrets
+	tokens := &client.OAuth1Tokens{ConsumerKey: "ck", ConsumerSecret: "cs", AccessToken: "at", AccessSecret: "as"}
+	if err := store.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreTokenPKI(ctx, "a", cert1, key1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpstageTokenPKI(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreTokenPKI(ctx, "a", cert2, key2); err != nil {
+		t.Fatal(err)
+	}
+	escrow := &storage.EscrowedBypassCode{DEPName: "a", Serial: "SERIAL1", Code: "code", PendingCode: "pending"}
+	if err := store.StoreBypassCode(ctx, escrow); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(t *testing.T, s *Storage, wantKeyID string) {
+		t.Helper()
+		raw, err := store.RetrieveAuthTokens(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rawStagingKey, err := store.RetrieveStagingTokenPKI(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rawCurrentKey, err := store.RetrieveCurrentTokenPKI(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawEscrow, err := store.RetrieveBypassCode(ctx, "a", "SERIAL1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{raw.ConsumerSecret, raw.AccessSecret, string(rawStagingKey), string(rawCurrentKey), rawEscrow.Code, rawEscrow.PendingCode} {
+			if have := keyID(v); have != wantKeyID {
+				t.Errorf("key ID: have %q, want %q", have, wantKeyID)
+			}
+		}
+
+		have, err := s.RetrieveAuthTokens(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *have != *tokens {
+			t.Errorf("tokens: have %v, want %v", have, tokens)
+		}
+		haveEscrow, err := s.RetrieveBypassCode(ctx, "a", "SERIAL1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *haveEscrow != *escrow {
+			t.Errorf("escrow: have %v, want %v", haveEscrow, escrow)
+		}
+		for _, pki := range []struct {
+			retrieve func(context.Context, string) ([]byte, []byte, error)
+			cert     []byte
+			key      []byte
+		}{
+			{s.RetrieveStagingTokenPKI, cert2, key2},
+			{s.RetrieveCurrentTokenPKI, cert1, key1},
+		} {
+			cert, key, err := pki.retrieve(ctx, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(cert, pki.cert) || !bytes.Equal(key, pki.key) {
+				t.Error("token PKI mismatch")
+			}
+		}
+	}
+
+	path := newKeyFile(t, "k1")
+	s, err := New(store, newLocalKeyProvider(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := s.Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count: have %d, want %d", count, 1)
+	}
+	check(t, s, "k1")
+
+	// nothing to re-encrypt with the same key
+	count, err = s.Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("count: have %d, want %d", count, 0)
+	}
+
+	// rotate to a new current key
+	k1, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := GenerateLocalKey("k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, append([]byte(k2+"\n"), k1...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err = New(store, newLocalKeyProvider(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values wrapped by the old key can still be read
+	if _, err = s.RetrieveAuthTokens(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	count, err = s.Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count: have %d, want %d", count, 1)
+	}
+	check(t, s, "k2")
+}
+
+func TestReencryptWithoutStaging(t *testing.T) {
+	ctx := context.Background()
+	b := kvmap.New()
+	store := kv.New(kvtxn.New(b))
+
+	// a DEP name with only tokens
+	tokens := &client.OAuth1Tokens{ConsumerKey: "ck", ConsumerSecret: "cs", AccessToken: "at", AccessSecret: "as"}
+	if err := store.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	// a DEP name with only a current token PKI
+	cert, key := generatePKI(t)
+	if err := store.StoreTokenPKI(ctx, "b", cert, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpstageTokenPKI(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"cert_staging.b", "key_staging.b"} {
+		if err := b.Delete(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(store, newLocalKeyProvider(t, newKeyFile(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := s.Reencrypt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("count: have %d, want %d", count, 2)
+	}
+
+	raw, err := store.RetrieveAuthTokens(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{raw.ConsumerSecret, raw.AccessSecret} {
+		if have, want := keyID(v), "k1"; have != want {
+			t.Errorf("key ID: have %q, want %q", have, want)
+		}
+	}
+
+	_, rawKey, err := store.RetrieveCurrentTokenPKI(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := keyID(string(rawKey)), "k1"; have != want {
+		t.Errorf("key ID: have %q, want %q", have, want)
+	}
+	haveCert, haveKey, err := s.RetrieveCurrentTokenPKI(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(haveCert, cert) || !bytes.Equal(haveKey, key) {
+		t.Error("current token PKI mismatch")
+	}
+
+	// the staging token PKI stays empty
+	stagingCert, stagingKey, err := store.RetrieveStagingTokenPKI(ctx, "b")
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatal(err)
+	}
+	if len(stagingCert) > 0 || len(stagingKey) > 0 {
+		t.Error("expected empty staging token PKI")
+	}
+}
@@ -0,0 +1,198 @@
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnknownKey is returned when unwrapping a data key with a key-encryption
+// key that is not known to a KeyProvider.
+var ErrUnknownKey = errors.New("unknown key-encryption key")
+
+// KeyProvider wraps (encrypts) and unwraps (decrypts) data keys using
+// key-encryption keys (KEKs).
+type KeyProvider interface {
+	// WrapKey encrypts dataKey with the current key-encryption key.
+	// The ID of the key-encryption key is returned with the wrapped key.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrappedKey []byte, err error)
+
+	// UnwrapKey decrypts wrappedKey with the key-encryption key keyID.
+	// [ErrUnknownKey] should be returned if keyID is not known.
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error)
+
+	// CurrentKeyID returns the ID of the key-encryption key used to wrap
+	// new data keys.
+	CurrentKeyID() string
+}
+
+// KMS is an external key management service that encrypts and decrypts
+// small payloads (like data keys) with keys that never leave the service.
+type KMS interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeyProvider is a KeyProvider that wraps data keys using a KMS.
+type KMSKeyProvider struct {
+	kms   KMS
+	keyID string
+}
+
+// NewKMSKeyProvider creates a new KMSKeyProvider that wraps new data keys
+// with the KMS key keyID. Data keys wrapped by any other KMS key are
+// unwrapped with that key which allows for rotation.
+func NewKMSKeyProvider(kms KMS, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{kms: kms, keyID: keyID}
+}
+
+// WrapKey encrypts dataKey with the current KMS key.
+func (p *KMSKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	wrappedKey, err := p.kms.Encrypt(ctx, p.keyID, dataKey)
+	return p.keyID, wrappedKey, err
+}
+
+// UnwrapKey decrypts wrappedKey with the KMS key keyID.
+func (p *KMSKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	return p.kms.Decrypt(ctx, keyID, wrappedKey)
+}
+
+// CurrentKeyID returns the current KMS key ID.
+func (p *KMSKeyProvider) CurrentKeyID() string {
+	return p.keyID
+}
+
+// LocalKeyProvider is a KeyProvider with locally held AES-256 key-encryption
+// keys. Data keys are wrapped using AES-GCM.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewLocalKeyProvider creates a new LocalKeyProvider from keys which maps
+// key IDs to 32 byte AES-256 keys. New data keys are wrapped with the key
+// currentID. The other keys are only used for unwrapping.
+func NewLocalKeyProvider(currentID string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	p := &LocalKeyProvider{current: currentID, keys: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, sep) {
+			return nil, fmt.Errorf("invalid key ID: %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s: invalid key length: %d", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		p.keys[id] = aead
+	}
+	if _, ok := p.keys[currentID]; !ok {
+		return nil, fmt.Errorf("current key not found: %s", currentID)
+	}
+	return p, nil
+}
+
+// LoadLocalKeyFile loads a LocalKeyProvider from the key file at path.
+// Each non-empty line not starting with "#" is a key in the form
+// "<key-id>:<base64-encoded 32 byte key>". The first key is the current
+// key. Rotate keys by adding a new key as the first line.
+func LoadLocalKeyFile(path string) (*LocalKeyProvider, error) {
+	keyFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var currentID string
+	keys := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(keyFile))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, keyB64, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing key ID separator", lineNo)
+		}
+		if _, ok = keys[id]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key ID: %s", lineNo, id)
+		}
+		if keys[id], err = base64.StdEncoding.DecodeString(keyB64); err != nil {
+			return nil, fmt.Errorf("line %d: decoding key: %w", lineNo, err)
+		}
+		if currentID == "" {
+			currentID = id
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if currentID == "" {
+		return nil, errors.New("no keys in key file")
+	}
+	return NewLocalKeyProvider(currentID, keys)
+}
+
+// GenerateLocalKey returns a new key file line with a random key for keyID.
+func GenerateLocalKey(keyID string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return keyID + sep + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// WrapKey encrypts dataKey with the current key.
+func (p *LocalKeyProvider) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	wrappedKey, err := seal(p.keys[p.current], dataKey, []byte(p.current))
+	return p.current, wrappedKey, err
+}
+
+// UnwrapKey decrypts wrappedKey with the key keyID.
+func (p *LocalKeyProvider) UnwrapKey(_ context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrappedKey, []byte(keyID))
+}
+
+// CurrentKeyID returns the current key ID.
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with aead using a random nonce which is
+// prepended to the returned ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts ciphertext created by seal.
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
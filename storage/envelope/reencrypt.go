@@ -0,0 +1,147 @@
+package envelope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// needsReencrypt reports whether value is not empty and is either
+// unencrypted or encrypted with a data key not wrapped by the current
+// key-encryption key.
+func (s *Storage) needsReencrypt(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !IsEncrypted(value) || keyID(value) != s.keys.CurrentKeyID()
+}
+
+// ReencryptDEPName encrypts the secrets of DEP name with new data keys
+// wrapped by the current key-encryption key. Secrets which are unencrypted
+// or whose data keys were wrapped by another key-encryption key are
+// re-encrypted. Reports whether any secrets were re-encrypted.
+//
+// The wrapped storage has no way to write the current token PKI directly.
+// It is re-encrypted by storing and upstaging it as the staging token PKI
+// after which the staging token PKI is restored. A DEP name without a
+// staging token PKI is left with an empty one.
+func (s *Storage) ReencryptDEPName(ctx context.Context, name string) (bool, error) {
+	var reencrypted bool
+
+	tokens, err := s.AllStorage.RetrieveAuthTokens(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return reencrypted, fmt.Errorf("retrieving tokens: %w", err)
+	}
+	if err == nil && tokens != nil && (s.needsReencrypt(tokens.ConsumerSecret) || s.needsReencrypt(tokens.AccessSecret)) {
+		if tokens, err = s.RetrieveAuthTokens(ctx, name); err != nil {
+			return reencrypted, fmt.Errorf("retrieving tokens: %w", err)
+		}
+		if err = s.StoreAuthTokens(ctx, name, tokens); err != nil {
+			return reencrypted, fmt.Errorf("storing tokens: %w", err)
+		}
+		reencrypted = true
+	}
+
+	// escrowed bypass codes are only re-encrypted if the wrapped storage
+	// supports escrow
+	escrowStorer, _ := s.AllStorage.(storage.BypassCodeEscrowStorer)
+	var serials []string
+	if escrowStorer != nil {
+		if serials, err = escrowStorer.ListBypassCodeSerials(ctx, name); err != nil {
+			return reencrypted, fmt.Errorf("listing bypass codes: %w", err)
+		}
+	}
+	for _, serial := range serials {
+		escrow, err := escrowStorer.RetrieveBypassCode(ctx, name, serial)
+		if err != nil {
+			return reencrypted, fmt.Errorf("retrieving bypass code of %s: %w", serial, err)
+		}
+		if !s.needsReencrypt(escrow.Code) && !s.needsReencrypt(escrow.PendingCode) {
+			continue
+		}
+		if escrow.Code, err = s.decrypt(ctx, name, bypassCodeField(serial), escrow.Code); err != nil {
+			return reencrypted, fmt.Errorf("bypass code of %s: %w", serial, err)
+		}
+		if escrow.PendingCode, err = s.decrypt(ctx, name, pendingBypassCodeField(serial), escrow.PendingCode); err != nil {
+			return reencrypted, fmt.Errorf("pending bypass code of %s: %w", serial, err)
+		}
+		if err = s.StoreBypassCode(ctx, escrow); err != nil {
+			return reencrypted, fmt.Errorf("storing bypass code of %s: %w", serial, err)
+		}
+		reencrypted = true
+	}
+
+	// retrieve both the staging and current token PKI before any writes
+	// as re-encrypting the current token PKI overwrites the staging
+	stagingCert, stagingKey, err := s.AllStorage.RetrieveStagingTokenPKI(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return reencrypted, fmt.Errorf("retrieving staging token PKI: %w", err)
+	}
+	currentCert, currentKey, err := s.AllStorage.RetrieveCurrentTokenPKI(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return reencrypted, fmt.Errorf("retrieving current token PKI: %w", err)
+	}
+	if len(stagingCert) < 1 && len(currentCert) < 1 {
+		return reencrypted, nil
+	}
+	reencryptStaging := s.needsReencrypt(string(stagingKey))
+	reencryptCurrent := s.needsReencrypt(string(currentKey))
+	if !reencryptStaging && !reencryptCurrent {
+		return reencrypted, nil
+	}
+	if reencryptCurrent {
+		key, err := s.decrypt(ctx, name, fieldTokenPKIKey, string(currentKey))
+		if err != nil {
+			return reencrypted, fmt.Errorf("current token PKI: %w", err)
+		}
+		if err = s.StoreTokenPKI(ctx, name, currentCert, []byte(key)); err != nil {
+			return reencrypted, fmt.Errorf("storing current token PKI: %w", err)
+		}
+		if err = s.UpstageTokenPKI(ctx, name); err != nil {
+			return reencrypted, fmt.Errorf("upstaging current token PKI: %w", err)
+		}
+		reencrypted = true
+		// the staging token PKI was overwritten and must be restored.
+		// an empty or already re-encrypted staging token PKI is restored
+		// as it was retrieved.
+		if !reencryptStaging {
+			if err = s.AllStorage.StoreTokenPKI(ctx, name, stagingCert, stagingKey); err != nil {
+				return reencrypted, fmt.Errorf("restoring staging token PKI: %w", err)
+			}
+		}
+	}
+	if reencryptStaging {
+		key, err := s.decrypt(ctx, name, fieldTokenPKIKey, string(stagingKey))
+		if err != nil {
+			return reencrypted, fmt.Errorf("staging token PKI: %w", err)
+		}
+		if err = s.StoreTokenPKI(ctx, name, stagingCert, []byte(key)); err != nil {
+			return reencrypted, fmt.Errorf("storing staging token PKI: %w", err)
+		}
+		reencrypted = true
+	}
+	return reencrypted, nil
+}
+
+// Reencrypt re-encrypts the secrets of all DEP names using ReencryptDEPName.
+// Returns the number of DEP names with re-encrypted secrets.
+// DEP names are found using [storage.ListDEPNames] of the wrapped storage.
+func (s *Storage) Reencrypt(ctx context.Context) (int, error) {
+	names, err := storage.ListDEPNames(ctx, s.AllStorage)
+	if err != nil {
+		return 0, fmt.Errorf("listing DEP names: %w", err)
+	}
+	var count int
+	for _, name := range names {
+		reencrypted, err := s.ReencryptDEPName(ctx, name)
+		if err != nil {
+			return count, fmt.Errorf("re-encrypting %s: %w", name, err)
+		}
+		if reencrypted {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// EscrowedBypassCode is the escrowed Activation Lock bypass code of a device.
+type EscrowedBypassCode struct {
+	DEPName string `json:"dep_name"`
+	Serial  string `json:"serial_number"`
+
+	// Code is the dash-separated "human readable" form of the bypass code.
+	// It is a secret.
+	Code string `json:"code"`
+
+	// PendingCode is a bypass code the device is being Activation Locked
+	// with but which Apple has not (yet) confirmed. Code remains the code
+	// of the device until then. It is a secret.
+	PendingCode string `json:"pending_code,omitempty"`
+
+	// CreatedAt is the time the device was Activation Locked with the code.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BypassCodeEscrowStorer stores escrowed Activation Lock bypass codes.
+type BypassCodeEscrowStorer interface {
+	// StoreBypassCode stores the escrowed bypass code of a device,
+	// replacing any existing code for the device.
+	StoreBypassCode(ctx context.Context, escrow *EscrowedBypassCode) error
+
+	// RetrieveBypassCode retrieves the escrowed bypass code of the device
+	// with serial of DEP name.
+	// [ErrNotFound] is returned if no code is escrowed for the device.
+	RetrieveBypassCode(ctx context.Context, name, serial string) (*EscrowedBypassCode, error)
+
+	// ListBypassCodeSerials returns the serial numbers of the devices of
+	// DEP name with escrowed bypass codes.
+	ListBypassCodeSerials(ctx context.Context, name string) ([]string, error)
+
+	// DeleteBypassCode deletes the escrowed bypass code of the device
+	// with serial of DEP name.
+	// Deleting a code that does not exist is not an error.
+	DeleteBypassCode(ctx context.Context, name, serial string) error
+}
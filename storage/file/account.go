@@ -0,0 +1,43 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/micromdm/nanodep/http/api"
+)
+
+func (s *FileStorage) accountDetailFilename(name string) string {
+	return path.Join(s.path, name+".account.json")
+}
+
+// StoreAccountDetail saves the account detail to disk as JSON for name (DEP name).
+// A nil detail removes the account detail from disk.
+func (s *FileStorage) StoreAccountDetail(_ context.Context, name string, detail *api.AccountDetail) error {
+	if detail == nil {
+		err := os.Remove(s.accountDetailFilename(name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.accountDetailFilename(name), detailJSON, defaultFileMode)
+}
+
+// RetrieveAccountDetail reads the JSON account detail from disk for name (DEP name).
+func (s *FileStorage) RetrieveAccountDetail(_ context.Context, name string) (*api.AccountDetail, error) {
+	detail := new(api.AccountDetail)
+	err := decodeJSONfile(s.accountDetailFilename(name), detail)
+	if errors.Is(err, os.ErrNotExist) {
+		// DEP name does not exist, or account detail for such DEP name does not exist.
+		return nil, nil
+	}
+	return detail, err
+}
@@ -0,0 +1,69 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+const apiKeyFileSuffix = ".apikey.json"
+
+func (s *FileStorage) apiKeyFilename(name string) string {
+	return path.Join(s.path, name+apiKeyFileSuffix)
+}
+
+// StoreAPIKey saves the API key to disk as JSON.
+func (s *FileStorage) StoreAPIKey(_ context.Context, key *storage.APIKey) error {
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.apiKeyFilename(key.Name), keyJSON, defaultFileMode)
+}
+
+// RetrieveAPIKey reads the JSON API key called name from disk.
+func (s *FileStorage) RetrieveAPIKey(_ context.Context, name string) (*storage.APIKey, error) {
+	key := new(storage.APIKey)
+	err := decodeJSONfile(s.apiKeyFilename(name), key)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return key, err
+}
+
+// DeleteAPIKey removes the API key called name from disk.
+func (s *FileStorage) DeleteAPIKey(_ context.Context, name string) error {
+	err := os.Remove(s.apiKeyFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return err
+}
+
+// ListAPIKeys reads all API keys from disk sorted by name.
+func (s *FileStorage) ListAPIKeys(ctx context.Context) ([]storage.APIKey, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	ret := []storage.APIKey{}
+	// ReadDir returns entries sorted by filename
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), apiKeyFileSuffix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		key, err := s.RetrieveAPIKey(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *key)
+	}
+	return ret, nil
+}
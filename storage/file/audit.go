@@ -0,0 +1,84 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+func (s *FileStorage) auditFilename() string {
+	return path.Join(s.path, "audit.log")
+}
+
+// StoreAuditEvent appends event to the audit log on disk as a line of JSON.
+func (s *FileStorage) StoreAuditEvent(_ context.Context, event *storage.AuditEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	f, err := os.OpenFile(s.auditFilename(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, defaultFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(eventJSON, '\n'))
+	return err
+}
+
+// QueryAuditEvents queries and returns audit log events.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+func (s *FileStorage) QueryAuditEvents(_ context.Context, req *storage.AuditQueryRequest) (*storage.AuditQueryResult, error) {
+	var offset, limit int
+	var err error
+	var filter *storage.AuditQueryFilter
+	if req != nil {
+		if req.Pagination != nil && req.Pagination.Cursor != nil {
+			// cursor method not supported for this backend
+			return nil, storage.ErrOnlyOffset
+		}
+		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
+		if err != nil {
+			return nil, err
+		}
+		filter = req.Filter
+	} else {
+		limit = 100
+	}
+
+	ret := &storage.AuditQueryResult{Events: []storage.AuditEvent{}}
+
+	f, err := os.Open(s.auditFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		// an empty audit log is valid
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var found int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && len(ret.Events) < limit {
+		var event storage.AuditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+		if !filter.Match(&event) {
+			continue
+		}
+		// only add if past offset
+		if found >= offset {
+			ret.Events = append(ret.Events, event)
+		}
+		found++
+	}
+	return ret, scanner.Err()
+}
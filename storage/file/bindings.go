@@ -0,0 +1,47 @@
+package file
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/micromdm/nanodep/http/api"
+)
+
+const tokensFileSuffix = ".tokens.json"
+
+// FindDEPNameBindings finds the DEP names whose OAuth1 tokens have
+// consumerKey or whose account detail has serverUUID.
+func (s *FileStorage) FindDEPNameBindings(ctx context.Context, consumerKey, serverUUID string) ([]api.DEPNameBinding, error) {
+	// ReadDir returns entries sorted by filename
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var bindings []api.DEPNameBinding
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), tokensFileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		binding := api.DEPNameBinding{Name: name}
+		if consumerKey != "" {
+			tokens, err := s.RetrieveAuthTokens(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			binding.SameConsumerKey = tokens.ConsumerKey == consumerKey
+		}
+		if serverUUID != "" {
+			detail, err := s.RetrieveAccountDetail(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			binding.SameServerUUID = detail != nil && detail.ServerUuid != nil && *detail.ServerUuid == serverUUID
+		}
+		if binding.SameConsumerKey || binding.SameServerUUID {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings, nil
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// partFilenames returns the filenames of the DEP name data part.
+func (s *FileStorage) partFilenames(name, part string) []string {
+	switch part {
+	case storage.PartTokens:
+		return []string{
+			s.tokensFilename(name),
+			s.accountDetailFilename(name),
+			s.osBetaTokensFilename(name),
+		}
+	case storage.PartConfig:
+		return []string{s.configFilename(name)}
+	case storage.PartTokenPKI:
+		return []string{
+			s.tokenpkiFilename(name, "cert"),
+			s.tokenpkiFilename(name, "key"),
+			s.tokenpkiFilename(name, "staging.cert"),
+			s.tokenpkiFilename(name, "staging.key"),
+		}
+	case storage.PartAssigner:
+		return []string{s.profileFilename(name)}
+	case storage.PartCursor:
+		return []string{s.cursorFilename(name)}
+	}
+	return nil
+}
+
+// DeleteDEPName removes the files of the data parts of DEP name from disk.
+// If no parts are provided all data for the DEP name is deleted.
+func (s *FileStorage) DeleteDEPName(_ context.Context, name string, parts ...string) error {
+	if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+	if len(parts) < 1 {
+		parts = storage.AllParts
+	}
+	for _, part := range parts {
+		for _, filename := range s.partFilenames(name, part) {
+			if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListDEPNames returns the sorted names of all DEP names with files of
+// any data part on disk.
+func (s *FileStorage) ListDEPNames(_ context.Context) ([]string, error) {
+	// the filename suffixes of each data part
+	var suffixes []string
+	for _, part := range storage.AllParts {
+		for _, filename := range s.partFilenames("", part) {
+			suffixes = append(suffixes, path.Base(filename))
+		}
+	}
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if name, ok := strings.CutSuffix(entry.Name(), suffix); ok && name != "" {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	// ReadDir sorts by filename, not by name
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
@@ -0,0 +1,154 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// stagingCertFileSuffix is the filename suffix of the staging token PKI
+// certificate. It is used to find the query-able DEP names without
+// filters other than DEP names.
+const stagingCertFileSuffix = ".tokenpki.staging.cert.txt"
+
+// depNameDetails reads the metadata for name (DEP name) from disk.
+func (s *FileStorage) depNameDetails(ctx context.Context, name string) (*storage.DEPNameDetails, error) {
+	d := &storage.DEPNameDetails{Name: name}
+
+	tokens, err := s.RetrieveAuthTokens(ctx, name)
+	if err == nil {
+		d.HasTokens = true
+		d.SetConsumerKey(tokens.ConsumerKey)
+		d.AccessTokenExpiry = &tokens.AccessTokenExpiry
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	config, err := s.RetrieveConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if config != nil {
+		d.BaseURL = config.BaseURL
+	}
+
+	for _, staging := range []bool{true, false} {
+		kind := "cert"
+		if staging {
+			kind = "staging.cert"
+		}
+		pemCert, err := os.ReadFile(s.tokenpkiFilename(name, kind))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		d.SetTokenPKI(staging, pemCert)
+	}
+
+	profileUUID, modTime, err := s.RetrieveAssignerProfile(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if profileUUID != "" {
+		d.AssignerProfileUUID = profileUUID
+		d.AssignerProfileUUIDAt = &modTime
+	}
+
+	cursor, err := s.RetrieveCursor(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	d.HasCursor = cursor != ""
+
+	// use the most recent file modification as the updated time
+	var updatedAt time.Time
+	for _, part := range storage.AllParts {
+		for _, filename := range s.partFilenames(name, part) {
+			if stat, err := os.Stat(filename); err == nil && stat.ModTime().After(updatedAt) {
+				updatedAt = stat.ModTime()
+			}
+		}
+	}
+	if !updatedAt.IsZero() {
+		d.UpdatedAt = &updatedAt
+	}
+
+	return d, nil
+}
+
+// QueryDEPNames queries and returns DEP names and their details.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+// Without filters other than DEP names a DEP name needs to have a staged
+// (uploaded) certificate to be query-able. The updated timestamp is the most recent modification
+// time of the DEP name's files. The created timestamp is not tracked.
+func (s *FileStorage) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
+	offset, limit := 0, 100
+	var err error
+	var filter *storage.DEPNamesQueryFilter
+	if req != nil {
+		if req.Pagination != nil && req.Pagination.Cursor != nil {
+			// cursor method not supported for this backend
+			return nil, storage.ErrOnlyOffset
+		}
+		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
+		if err != nil {
+			return nil, err
+		}
+		filter = req.Filter
+	}
+
+	var names []string
+	if filter.IncludesUnstaged() {
+		if names, err = s.ListDEPNames(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		// ReadDir returns entries sorted by filename
+		entries, err := os.ReadDir(s.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if depName, ok := strings.CutSuffix(entry.Name(), stagingCertFileSuffix); ok && !entry.IsDir() {
+				names = append(names, depName)
+			}
+		}
+	}
+
+	ret := new(storage.DEPNamesQueryResult)
+	var found int
+	for _, depName := range names {
+		// quickly skip names to avoid reading their details
+		if !filter.MatchName(depName) {
+			continue
+		}
+
+		// only read details if the filter or the result needs them
+		var details *storage.DEPNameDetails
+		if filter.MatchesDetails() || found >= offset {
+			details, err = s.depNameDetails(ctx, depName)
+			if err != nil {
+				return nil, fmt.Errorf("reading details for %s: %w", depName, err)
+			}
+			if !filter.Match(details) {
+				continue
+			}
+		}
+
+		// only add if past offset
+		if found >= offset {
+			ret.DEPNames = append(ret.DEPNames, *details)
+		}
+		found++
+
+		// stop if hit limit
+		if len(ret.DEPNames) >= limit {
+			break
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,82 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+const bypassCodeFileInfix = ".bypasscode."
+
+func (s *FileStorage) bypassCodeFilename(name, serial string) string {
+	return path.Join(s.path, name+bypassCodeFileInfix+serial+".json")
+}
+
+// StoreBypassCode saves the escrowed bypass code to disk as JSON.
+func (s *FileStorage) StoreBypassCode(_ context.Context, escrow *storage.EscrowedBypassCode) error {
+	if escrow.Serial == "" || strings.ContainsAny(escrow.Serial, "./") {
+		return fmt.Errorf("invalid serial number: %q", escrow.Serial)
+	}
+	escrowJSON, err := json.Marshal(escrow)
+	if err != nil {
+		return err
+	}
+	// escrowed codes are secrets
+	return os.WriteFile(s.bypassCodeFilename(escrow.DEPName, escrow.Serial), escrowJSON, 0600)
+}
+
+// RetrieveBypassCode reads the JSON escrowed bypass code from disk.
+func (s *FileStorage) RetrieveBypassCode(_ context.Context, name, serial string) (*storage.EscrowedBypassCode, error) {
+	if serial == "" || strings.ContainsAny(serial, "./") {
+		return nil, storage.ErrNotFound
+	}
+	escrow := new(storage.EscrowedBypassCode)
+	err := decodeJSONfile(s.bypassCodeFilename(name, serial), escrow)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return escrow, err
+}
+
+// ListBypassCodeSerials returns the sorted serial numbers of the devices
+// of DEP name with escrowed bypass codes on disk.
+func (s *FileStorage) ListBypassCodeSerials(_ context.Context, name string) ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	// ReadDir returns entries sorted by filename
+	for _, entry := range entries {
+		serial, found := strings.CutPrefix(entry.Name(), name+bypassCodeFileInfix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		serial, found = strings.CutSuffix(serial, ".json")
+		// serial numbers never contain dots so this excludes
+		// the codes of DEP names prefixed by name
+		if !found || serial == "" || strings.Contains(serial, ".") {
+			continue
+		}
+		ret = append(ret, serial)
+	}
+	return ret, nil
+}
+
+// DeleteBypassCode removes the escrowed bypass code from disk.
+func (s *FileStorage) DeleteBypassCode(_ context.Context, name, serial string) error {
+	if serial == "" || strings.ContainsAny(serial, "./") {
+		return nil
+	}
+	err := os.Remove(s.bypassCodeFilename(name, serial))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
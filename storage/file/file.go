@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/micromdm/nanodep/client"
@@ -21,6 +22,12 @@ const defaultFileMode = 0644
 // FileStorage implements filesystem-based storage for DEP services.
 type FileStorage struct {
 	path string
+
+	// serializes appends to the audit log
+	auditMu sync.Mutex
+
+	// serializes appends to the history logs
+	historyMu sync.Mutex
 }
 
 // New creates a new FileStorage backend.
@@ -42,8 +49,20 @@ func New(path string) (*FileStorage, error) {
 	return &FileStorage{path: path}, nil
 }
 
+// Ping checks that the storage directory is accessible.
+func (s *FileStorage) Ping(_ context.Context) error {
+	f, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if !f.IsDir() {
+		return errors.New("path is not a directory")
+	}
+	return nil
+}
+
 func (s *FileStorage) tokensFilename(name string) string {
-	return path.Join(s.path, name+".tokens.json")
+	return path.Join(s.path, name+tokensFileSuffix)
 }
 
 func (s *FileStorage) configFilename(name string) string {
@@ -141,6 +160,15 @@ func (s *FileStorage) StoreAssignerProfile(_ context.Context, name string, profi
 	return os.WriteFile(s.profileFilename(name), []byte(profileUUID+"\n"), defaultFileMode)
 }
 
+// StoreAssignerProfileAt saves the assigner profile UUID to disk for name
+// (DEP name) with modTime as the file modification time.
+func (s *FileStorage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	if err := s.StoreAssignerProfile(ctx, name, profileUUID); err != nil {
+		return err
+	}
+	return os.Chtimes(s.profileFilename(name), modTime, modTime)
+}
+
 // RetrieveCursor reads the reads the DEP fetch and sync cursor from disk
 // for name (DEP name). We return an empty cursor if the cursor does not exist
 // on disk.
@@ -235,8 +263,3 @@ func (s *FileStorage) retrieveTokenPKIExtn(name, extn string) ([]byte, []byte, e
 	}
 	return certBytes, keyBytes, err
 }
-
-// QueryDEPNames queries and returns DEP names.
-func (s *FileStorage) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
-	return nil, errors.New("not implemented")
-}
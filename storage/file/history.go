@@ -0,0 +1,121 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+func (s *FileStorage) historyFilename(name string) string {
+	return path.Join(s.path, name+".history.log")
+}
+
+// StoreHistoryEntry appends entry to the history log of the DEP name on
+// disk as a line of JSON.
+func (s *FileStorage) StoreHistoryEntry(_ context.Context, entry *storage.HistoryEntry) error {
+	e := *entry
+	var err error
+	if e.ID, err = storage.NewHistoryID(e.Timestamp); err != nil {
+		return err
+	}
+	entryJSON, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	f, err := os.OpenFile(s.historyFilename(e.DEPName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, defaultFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(entryJSON, '\n'))
+	return err
+}
+
+// readHistory reads all history entries of the DEP name in chronological order.
+func (s *FileStorage) readHistory(name string) ([]storage.HistoryEntry, error) {
+	f, err := os.Open(s.historyFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		// an empty history is valid
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []storage.HistoryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry storage.HistoryEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		ret = append(ret, entry)
+	}
+	return ret, scanner.Err()
+}
+
+// QueryHistory queries and returns change history entries.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+func (s *FileStorage) QueryHistory(_ context.Context, req *storage.HistoryQueryRequest) (*storage.HistoryQueryResult, error) {
+	if req == nil {
+		req = new(storage.HistoryQueryRequest)
+	}
+	if req.Pagination != nil && req.Pagination.Cursor != nil {
+		// cursor method not supported for this backend
+		return nil, storage.ErrOnlyOffset
+	}
+	_, offset, limit, err := req.Pagination.ValidateDefaultOffsetLimit(100)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &storage.HistoryQueryResult{Entries: []storage.HistoryEntry{}}
+	if req.DEPName == "" {
+		return ret, nil
+	}
+	entries, err := s.readHistory(req.DEPName)
+	if err != nil {
+		return nil, err
+	}
+	// newest first
+	slices.Reverse(entries)
+
+	var found int
+	for _, entry := range entries {
+		if len(ret.Entries) >= limit {
+			break
+		}
+		if req.Kind != "" && entry.Kind != req.Kind {
+			continue
+		}
+		// only add if past offset
+		if found >= offset {
+			ret.Entries = append(ret.Entries, entry)
+		}
+		found++
+	}
+	return ret, nil
+}
+
+// RetrieveHistoryEntry retrieves the history entry with id of DEP name.
+func (s *FileStorage) RetrieveHistoryEntry(_ context.Context, name, id string) (*storage.HistoryEntry, error) {
+	entries, err := s.readHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return &entry, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
@@ -0,0 +1,66 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+const osBetaTokensFileSuffix = ".osbeta.json"
+
+func (s *FileStorage) osBetaTokensFilename(name string) string {
+	return path.Join(s.path, name+osBetaTokensFileSuffix)
+}
+
+// StoreOSBetaTokens saves the cached beta enrollment tokens to disk as JSON.
+func (s *FileStorage) StoreOSBetaTokens(_ context.Context, tokens *storage.CachedOSBetaTokens) error {
+	tokensJSON, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.osBetaTokensFilename(tokens.DEPName), tokensJSON, defaultFileMode)
+}
+
+// RetrieveOSBetaTokens reads the JSON cached beta enrollment tokens from disk.
+func (s *FileStorage) RetrieveOSBetaTokens(_ context.Context, name string) (*storage.CachedOSBetaTokens, error) {
+	tokens := new(storage.CachedOSBetaTokens)
+	err := decodeJSONfile(s.osBetaTokensFilename(name), tokens)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return tokens, err
+}
+
+// DeleteOSBetaTokens removes the cached beta enrollment tokens from disk.
+func (s *FileStorage) DeleteOSBetaTokens(_ context.Context, name string) error {
+	err := os.Remove(s.osBetaTokensFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ListOSBetaTokensNames returns the DEP names that have cached beta
+// enrollment tokens on disk.
+func (s *FileStorage) ListOSBetaTokensNames(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	// ReadDir returns entries sorted by filename
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), osBetaTokensFileSuffix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
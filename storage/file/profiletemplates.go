@@ -0,0 +1,67 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+const profileTemplateFileSuffix = ".profiletemplate.json"
+
+func (s *FileStorage) profileTemplateFilename(name string) string {
+	return path.Join(s.path, name+profileTemplateFileSuffix)
+}
+
+// StoreProfileTemplate saves the profile template to disk as JSON.
+func (s *FileStorage) StoreProfileTemplate(_ context.Context, template *storage.ProfileTemplate) error {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.profileTemplateFilename(template.Name), templateJSON, defaultFileMode)
+}
+
+// RetrieveProfileTemplate reads the JSON profile template called name from disk.
+func (s *FileStorage) RetrieveProfileTemplate(_ context.Context, name string) (*storage.ProfileTemplate, error) {
+	template := new(storage.ProfileTemplate)
+	err := decodeJSONfile(s.profileTemplateFilename(name), template)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return template, err
+}
+
+// DeleteProfileTemplate removes the profile template called name from disk.
+func (s *FileStorage) DeleteProfileTemplate(_ context.Context, name string) error {
+	err := os.Remove(s.profileTemplateFilename(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+	}
+	return err
+}
+
+// ListProfileTemplates returns the names of all profile templates on disk sorted by name.
+func (s *FileStorage) ListProfileTemplates(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), profileTemplateFileSuffix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		names = append(names, name)
+	}
+	// the filename suffix can change the sort order of names
+	slices.Sort(names)
+	return names, nil
+}
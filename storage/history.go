@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+)
+
+// Kinds of DEP name data recorded in the change history.
+const (
+	HistoryKindTokens   = "tokens"
+	HistoryKindConfig   = "config"
+	HistoryKindAssigner = "assigner"
+)
+
+// ErrInvalidHistoryKind is returned for unknown history kinds.
+var ErrInvalidHistoryKind = errors.New("invalid history kind")
+
+// ValidateHistoryKind checks that kind is a valid history kind.
+// An empty kind is valid and matches all kinds when querying.
+func ValidateHistoryKind(kind string) error {
+	switch kind {
+	case "", HistoryKindTokens, HistoryKindConfig, HistoryKindAssigner:
+		return nil
+	}
+	return ErrInvalidHistoryKind
+}
+
+// HistoryEntry is a single change to the tokens, config, or assigner
+// profile of a DEP name.
+type HistoryEntry struct {
+	// ID uniquely identifies the entry for the DEP name.
+	// It is assigned by the storage backend.
+	ID string `json:"id"`
+
+	// Timestamp is the time of the change.
+	Timestamp time.Time `json:"timestamp"`
+
+	DEPName string `json:"dep_name"`
+	Kind    string `json:"kind"`
+
+	// Actor is the API identity that made the change, if known.
+	Actor string `json:"actor,omitempty"`
+
+	// Previous is the JSON value before the change.
+	// It is empty if there was no previous value.
+	// Secrets are never included.
+	Previous json.RawMessage `json:"previous,omitempty"`
+
+	// Value is the JSON value after the change.
+	// Secrets are never included.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// HistoryQueryRequest is the parameters for querying the change history
+// of a DEP name.
+type HistoryQueryRequest struct {
+	DEPName string `json:"dep_name"`
+
+	// Kind limits the entries to this kind, if set.
+	Kind string `json:"kind,omitempty"`
+
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// HistoryQueryResult is the resulting paginated history query.
+// Entries are newest first.
+type HistoryQueryResult struct {
+	Entries []HistoryEntry `json:"entries"`
+
+	PaginationNextCursor
+}
+
+// HistoryStorer stores and queries the change history of DEP names.
+type HistoryStorer interface {
+	// StoreHistoryEntry appends entry to the change history.
+	// The ID of entry is ignored and assigned by the storage backend.
+	StoreHistoryEntry(ctx context.Context, entry *HistoryEntry) error
+
+	// QueryHistory queries and returns change history entries.
+	QueryHistory(ctx context.Context, req *HistoryQueryRequest) (*HistoryQueryResult, error)
+
+	// RetrieveHistoryEntry retrieves the history entry with id of DEP name.
+	// [ErrNotFound] is returned if the entry does not exist.
+	RetrieveHistoryEntry(ctx context.Context, name, id string) (*HistoryEntry, error)
+}
+
+// NewHistoryID returns a new random history entry ID for backends without
+// their own IDs. IDs sort chronologically by t.
+func NewHistoryID(t time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return t.UTC().Format("20060102150405.000000000") + "." + hex.EncodeToString(suffix), nil
+}
+
+// TokensHistory is the redacted history value of OAuth tokens.
+type TokensHistory struct {
+	// ConsumerKeyPrefix is the first few characters of the consumer key.
+	ConsumerKeyPrefix string `json:"consumer_key_prefix"`
+
+	// AccessTokenHash is the hex-encoded SHA-256 hash of the access token.
+	AccessTokenHash string `json:"access_token_hash"`
+
+	AccessTokenExpiry time.Time `json:"access_token_expiry"`
+}
+
+// NewTokensHistory redacts tokens for the change history.
+// The consumer key is truncated, the access token is hashed,
+// and the secrets are omitted.
+func NewTokensHistory(tokens *client.OAuth1Tokens) *TokensHistory {
+	d := new(DEPNameDetails)
+	d.SetConsumerKey(tokens.ConsumerKey)
+	h := sha256.Sum256([]byte(tokens.AccessToken))
+	return &TokensHistory{
+		ConsumerKeyPrefix: d.ConsumerKeyPrefix,
+		AccessTokenHash:   hex.EncodeToString(h[:]),
+		AccessTokenExpiry: tokens.AccessTokenExpiry,
+	}
+}
+
+// AssignerHistory is the history value of the assigner profile.
+type AssignerHistory struct {
+	ProfileUUID string `json:"profile_uuid"`
+}
@@ -0,0 +1,238 @@
+// Package history provides a storage wrapper that records the change
+// history of the OAuth tokens, config, and assigner profile of DEP names.
+//
+// Each change is recorded with the previous and new values, the time of
+// the change, and the API identity (actor) that made it. Secrets are
+// never recorded: the consumer key is truncated and the access token is
+// hashed.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/http/api"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// ErrRollbackUnsupported is returned when rolling back an unsupported
+// history kind.
+var ErrRollbackUnsupported = errors.New("rollback not supported for history kind")
+
+// Storage wraps storage.AllStorage and records the change history.
+// Changes are recorded after they are stored. Failing to record a change
+// is logged rather than returned as the change itself succeeded.
+type Storage struct {
+	storage.AllStorage
+	entries storage.HistoryStorer
+	actor   func(context.Context) string
+	logger  log.Logger
+}
+
+// Option configures the history storage.
+type Option func(*Storage)
+
+// WithActorFunc sets the function that returns the actor of a change
+// from the request context.
+func WithActorFunc(f func(context.Context) string) Option {
+	return func(s *Storage) {
+		s.actor = f
+	}
+}
+
+// WithLogger sets the logger for failures to record changes.
+func WithLogger(logger log.Logger) Option {
+	return func(s *Storage) {
+		s.logger = logger
+	}
+}
+
+// New creates a new Storage that records the change history of store
+// in entries.
+func New(store storage.AllStorage, entries storage.HistoryStorer, opts ...Option) *Storage {
+	s := &Storage{AllStorage: store, entries: entries, logger: log.NopLogger}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// marshalValue marshals v to JSON. Nil values (including nil pointers)
+// result in an empty value.
+func marshalValue(v interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+	return b, nil
+}
+
+// record stores a history entry of kind for name.
+// Errors are logged as the change has already been stored.
+func (s *Storage) record(ctx context.Context, name, kind string, previous, value interface{}) {
+	if err := s.storeEntry(ctx, name, kind, previous, value); err != nil {
+		ctxlog.Logger(ctx, s.logger).Info("msg", "recording history", "name", name, "kind", kind, "err", err)
+	}
+}
+
+// storeEntry stores a history entry of kind for name.
+func (s *Storage) storeEntry(ctx context.Context, name, kind string, previous, value interface{}) error {
+	entry := &storage.HistoryEntry{
+		Timestamp: time.Now().UTC(),
+		DEPName:   name,
+		Kind:      kind,
+	}
+	if s.actor != nil {
+		entry.Actor = s.actor(ctx)
+	}
+	var err error
+	if entry.Previous, err = marshalValue(previous); err != nil {
+		return err
+	}
+	if entry.Value, err = marshalValue(value); err != nil {
+		return err
+	}
+	if err = s.entries.StoreHistoryEntry(ctx, entry); err != nil {
+		return fmt.Errorf("storing %s history: %w", kind, err)
+	}
+	return nil
+}
+
+// StoreAuthTokens stores the OAuth tokens for name (DEP name) and
+// records the change with the tokens redacted.
+func (s *Storage) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
+	var previous *storage.TokensHistory
+	prevTokens, err := s.AllStorage.RetrieveAuthTokens(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("retrieving previous tokens: %w", err)
+	} else if err == nil && prevTokens != nil {
+		previous = storage.NewTokensHistory(prevTokens)
+	}
+	if err = s.AllStorage.StoreAuthTokens(ctx, name, tokens); err != nil {
+		return err
+	}
+	s.record(ctx, name, storage.HistoryKindTokens, previous, storage.NewTokensHistory(tokens))
+	return nil
+}
+
+// StoreConfig stores the config for name (DEP name) and records the change.
+func (s *Storage) StoreConfig(ctx context.Context, name string, config *client.Config) error {
+	previous, err := s.AllStorage.RetrieveConfig(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("retrieving previous config: %w", err)
+	}
+	if err = s.AllStorage.StoreConfig(ctx, name, config); err != nil {
+		return err
+	}
+	s.record(ctx, name, storage.HistoryKindConfig, previous, config)
+	return nil
+}
+
+// previousAssigner retrieves the current assigner profile of name for
+// the history. A nil value is returned if there is no assigner profile.
+func (s *Storage) previousAssigner(ctx context.Context, name string) (*storage.AssignerHistory, error) {
+	profileUUID, _, err := s.AllStorage.RetrieveAssignerProfile(ctx, name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("retrieving previous assigner profile: %w", err)
+	} else if profileUUID == "" {
+		return nil, nil
+	}
+	return &storage.AssignerHistory{ProfileUUID: profileUUID}, nil
+}
+
+// StoreAssignerProfile stores the assigner profile UUID for name (DEP name)
+// and records the change.
+func (s *Storage) StoreAssignerProfile(ctx context.Context, name string, profileUUID string) error {
+	previous, err := s.previousAssigner(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = s.AllStorage.StoreAssignerProfile(ctx, name, profileUUID); err != nil {
+		return err
+	}
+	s.record(ctx, name, storage.HistoryKindAssigner, previous, &storage.AssignerHistory{ProfileUUID: profileUUID})
+	return nil
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp if the wrapped storage supports it and
+// records the change. Otherwise the current time is used.
+func (s *Storage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	previous, err := s.previousAssigner(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = storage.StoreAssignerProfileAt(ctx, s.AllStorage, name, profileUUID, modTime); err != nil {
+		return err
+	}
+	s.record(ctx, name, storage.HistoryKindAssigner, previous, &storage.AssignerHistory{ProfileUUID: profileUUID})
+	return nil
+}
+
+// StoreHistoryEntry appends entry to the change history.
+func (s *Storage) StoreHistoryEntry(ctx context.Context, entry *storage.HistoryEntry) error {
+	return s.entries.StoreHistoryEntry(ctx, entry)
+}
+
+// QueryHistory queries and returns change history entries.
+func (s *Storage) QueryHistory(ctx context.Context, req *storage.HistoryQueryRequest) (*storage.HistoryQueryResult, error) {
+	return s.entries.QueryHistory(ctx, req)
+}
+
+// RetrieveHistoryEntry retrieves the history entry with id of DEP name.
+func (s *Storage) RetrieveHistoryEntry(ctx context.Context, name, id string) (*storage.HistoryEntry, error) {
+	return s.entries.RetrieveHistoryEntry(ctx, name, id)
+}
+
+// Ping pings the wrapped storage.
+func (s *Storage) Ping(ctx context.Context) error {
+	return storage.Ping(ctx, s.AllStorage)
+}
+
+// ListDEPNames lists all DEP names of the wrapped storage.
+func (s *Storage) ListDEPNames(ctx context.Context) ([]string, error) {
+	return storage.ListDEPNames(ctx, s.AllStorage)
+}
+
+// Rollback restores the config or assigner profile of name (DEP name) to
+// the value recorded in the history entry with id. The value is stored
+// using configStorer or assignerStorer so the rollback itself is recorded
+// as a change if they record history. The restored entry is returned.
+// [ErrRollbackUnsupported] is returned for tokens entries as their
+// secrets are not recorded.
+func Rollback(ctx context.Context, store storage.HistoryStorer, configStorer api.ConfigStorer, assignerStorer api.AssignerProfileStorer, name, id string) (*storage.HistoryEntry, error) {
+	entry, err := store.RetrieveHistoryEntry(ctx, name, id)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving history entry: %w", err)
+	}
+	if len(entry.Value) < 1 {
+		return nil, errors.New("history entry has no value")
+	}
+	switch entry.Kind {
+	case storage.HistoryKindConfig:
+		config := new(client.Config)
+		if err = json.Unmarshal(entry.Value, config); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %w", err)
+		}
+		err = configStorer.StoreConfig(ctx, name, config)
+	case storage.HistoryKindAssigner:
+		assigner := new(storage.AssignerHistory)
+		if err = json.Unmarshal(entry.Value, assigner); err != nil {
+			return nil, fmt.Errorf("unmarshal assigner profile: %w", err)
+		}
+		err = assignerStorer.StoreAssignerProfile(ctx, name, assigner.ProfileUUID)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRollbackUnsupported, entry.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storing %s: %w", entry.Kind, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,133 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+	"github.com/micromdm/nanodep/storage/test"
+)
+
+func TestHistoryStorage(t *testing.T) {
+	store := inmem.New()
+	test.TestWithStorages(t, context.Background(), New(store, store))
+}
+
+func TestRecordAndRollback(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	s := New(store, store, WithActorFunc(func(context.Context) string { return "tester" }))
+	const name = "test"
+
+	tokens := &client.OAuth1Tokens{
+		ConsumerKey:       "CK_0123456789abcdef",
+		ConsumerSecret:    "CS_secret",
+		AccessToken:       "AT_token",
+		AccessSecret:      "AS_secret",
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	if err := s.StoreAuthTokens(ctx, name, tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreConfig(ctx, name, &client.Config{BaseURL: "http://a.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreConfig(ctx, name, &client.Config{BaseURL: "http://b.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreAssignerProfile(ctx, name, "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.QueryHistory(ctx, &storage.HistoryQueryRequest{DEPName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(res.Entries), 4; have != want {
+		t.Fatalf("entry count: have %d, want %d", have, want)
+	}
+	for _, entry := range res.Entries {
+		if have, want := entry.Actor, "tester"; have != want {
+			t.Errorf("actor: have %q, want %q", have, want)
+		}
+	}
+
+	// tokens are redacted
+	tokensEntry := res.Entries[3]
+	if have, want := tokensEntry.Kind, storage.HistoryKindTokens; have != want {
+		t.Fatalf("kind: have %q, want %q", have, want)
+	}
+	for _, secret := range []string{tokens.ConsumerKey, tokens.ConsumerSecret, tokens.AccessToken, tokens.AccessSecret} {
+		if strings.Contains(string(tokensEntry.Value), secret) {
+			t.Errorf("history value contains secret: %s", secret)
+		}
+	}
+	if len(tokensEntry.Previous) > 0 {
+		t.Errorf("unexpected previous value: %s", tokensEntry.Previous)
+	}
+	if _, err = Rollback(ctx, s, s, s, name, tokensEntry.ID); !errors.Is(err, ErrRollbackUnsupported) {
+		t.Errorf("have %v, want %v", err, ErrRollbackUnsupported)
+	}
+
+	configEntry := res.Entries[1]
+	if have, want := string(configEntry.Previous), `{"base_url":"http://a.example.com"}`; have != want {
+		t.Errorf("previous: have %q, want %q", have, want)
+	}
+
+	// roll back to the first config
+	if _, err = Rollback(ctx, s, s, s, name, res.Entries[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	config, err := s.RetrieveConfig(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := config.BaseURL, "http://a.example.com"; have != want {
+		t.Errorf("base URL: have %q, want %q", have, want)
+	}
+
+	// the rollback is recorded
+	res, err = s.QueryHistory(ctx, &storage.HistoryQueryRequest{DEPName: name, Kind: storage.HistoryKindConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(res.Entries), 3; have != want {
+		t.Fatalf("entry count: have %d, want %d", have, want)
+	}
+
+	if _, err = Rollback(ctx, s, s, s, name, "invalid"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+// failingHistoryStorer fails to store history entries.
+type failingHistoryStorer struct {
+	storage.HistoryStorer
+}
+
+func (failingHistoryStorer) StoreHistoryEntry(context.Context, *storage.HistoryEntry) error {
+	return errors.New("history unavailable")
+}
+
+func TestRecordFailure(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	s := New(store, failingHistoryStorer{HistoryStorer: store})
+
+	// the change is stored even if it can't be recorded
+	if err := s.StoreConfig(ctx, "test", &client.Config{BaseURL: "http://a.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := store.RetrieveConfig(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := config.BaseURL, "http://a.example.com"; have != want {
+		t.Errorf("base URL: have %q, want %q", have, want)
+	}
+}
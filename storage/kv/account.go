@@ -0,0 +1,41 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/micromdm/nanodep/http/api"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxAccountDetail = "account_detail."
+
+// StoreAccountDetail stores the account detail for name (DEP name) as JSON, overwriting it.
+// A nil detail deletes the account detail.
+func (s *KV) StoreAccountDetail(ctx context.Context, name string, detail *api.AccountDetail) error {
+	if detail == nil {
+		return s.b.Delete(ctx, keyPfxAccountDetail+name)
+	}
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, keyPfxAccountDetail+name, detailJSON)
+}
+
+// RetrieveAccountDetail retrieves the account detail of name (DEP name).
+// If the DEP name or account detail does not exist then a nil account
+// detail and nil error will be returned.
+func (s *KV) RetrieveAccountDetail(ctx context.Context, name string) (*api.AccountDetail, error) {
+	detailJSON, err := s.b.Get(ctx, keyPfxAccountDetail+name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	detail := new(api.AccountDetail)
+	return detail, json.Unmarshal(detailJSON, detail)
+}
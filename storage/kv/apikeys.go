@@ -0,0 +1,69 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxAPIKey = "api_key."
+
+// StoreAPIKey stores key, overwriting any existing key with the same name.
+func (s *KV) StoreAPIKey(ctx context.Context, key *storage.APIKey) error {
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, keyPfxAPIKey+key.Name, keyJSON)
+}
+
+// RetrieveAPIKey retrieves the API key called name.
+func (s *KV) RetrieveAPIKey(ctx context.Context, name string) (*storage.APIKey, error) {
+	keyJSON, err := s.b.Get(ctx, keyPfxAPIKey+name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %v", storage.ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	key := new(storage.APIKey)
+	return key, json.Unmarshal(keyJSON, key)
+}
+
+// DeleteAPIKey deletes the API key called name.
+func (s *KV) DeleteAPIKey(ctx context.Context, name string) error {
+	return kv.PerformCRUDBucketTxn(ctx, s.b, func(ctx context.Context, txn kv.CRUDBucket) error {
+		found, err := txn.Has(ctx, keyPfxAPIKey+name)
+		if err != nil {
+			return err
+		} else if !found {
+			return storage.ErrNotFound
+		}
+		return txn.Delete(ctx, keyPfxAPIKey+name)
+	})
+}
+
+// ListAPIKeys returns all API keys sorted by name.
+func (s *KV) ListAPIKeys(ctx context.Context) ([]storage.APIKey, error) {
+	keys := kv.AllKeysPrefix(ctx, s.b, keyPfxAPIKey)
+	slices.Sort(keys)
+	ret := []storage.APIKey{}
+	for _, k := range keys {
+		keyJSON, err := s.b.Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		var key storage.APIKey
+		if err = json.Unmarshal(keyJSON, &key); err != nil {
+			return nil, err
+		}
+		ret = append(ret, key)
+	}
+	return ret, nil
+}
@@ -0,0 +1,92 @@
+package kv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const (
+	keyPfxAudit = "audit."
+
+	// auditKeyTimeFormat is a fixed-width, lexically sortable timestamp.
+	auditKeyTimeFormat = "20060102150405.000000000"
+)
+
+// StoreAuditEvent appends event to the audit log.
+// Each event is stored under a key that sorts chronologically.
+func (s *KV) StoreAuditEvent(ctx context.Context, event *storage.AuditEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return err
+	}
+	key := keyPfxAudit + event.Timestamp.UTC().Format(auditKeyTimeFormat) + "." + hex.EncodeToString(suffix)
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, key, eventJSON)
+}
+
+// QueryAuditEvents queries and returns audit log events.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+// Warning: all audit log keys are buffered and sorted for each query.
+func (s *KV) QueryAuditEvents(ctx context.Context, req *storage.AuditQueryRequest) (*storage.AuditQueryResult, error) {
+	var offset, limit int
+	var err error
+	var filter *storage.AuditQueryFilter
+	if req != nil {
+		if req.Pagination != nil && req.Pagination.Cursor != nil {
+			// cursor method not supported for this backend
+			return nil, storage.ErrOnlyOffset
+		}
+		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
+		if err != nil {
+			return nil, err
+		}
+		filter = req.Filter
+	} else {
+		limit = 100
+	}
+
+	keys := kv.AllKeysPrefix(ctx, s.b, keyPfxAudit)
+	slices.Sort(keys)
+
+	ret := &storage.AuditQueryResult{Events: []storage.AuditEvent{}}
+	var found int
+	for _, key := range keys {
+		eventJSON, err := s.b.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("getting %s: %w", key, err)
+		}
+		var event storage.AuditEvent
+		if err = json.Unmarshal(eventJSON, &event); err != nil {
+			return nil, fmt.Errorf("unmarshal %s: %w", key, err)
+		}
+		if !filter.Match(&event) {
+			continue
+		}
+
+		// only add if past offset
+		if found >= offset {
+			ret.Events = append(ret.Events, event)
+		}
+		found++
+
+		// stop if hit limit
+		if len(ret.Events) >= limit {
+			break
+		}
+	}
+
+	return ret, nil
+}
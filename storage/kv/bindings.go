@@ -0,0 +1,41 @@
+package kv
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/http/api"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+// FindDEPNameBindings finds the DEP names whose OAuth1 tokens have
+// consumerKey or whose account detail has serverUUID.
+func (s *KV) FindDEPNameBindings(ctx context.Context, consumerKey, serverUUID string) ([]api.DEPNameBinding, error) {
+	keys := kv.AllKeysPrefix(ctx, s.b, keyPfxConsumerKey)
+	slices.Sort(keys)
+	var bindings []api.DEPNameBinding
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, keyPfxConsumerKey)
+		binding := api.DEPNameBinding{Name: name}
+		if consumerKey != "" {
+			storedConsumerKey, err := s.b.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			binding.SameConsumerKey = string(storedConsumerKey) == consumerKey
+		}
+		if serverUUID != "" {
+			detail, err := s.RetrieveAccountDetail(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			binding.SameServerUUID = detail != nil && detail.ServerUuid != nil && *detail.ServerUuid == serverUUID
+		}
+		if binding.SameConsumerKey || binding.SameServerUUID {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings, nil
+}
@@ -0,0 +1,74 @@
+package kv
+
+import (
+	"context"
+	"slices"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+// keyPfxParts are the key prefixes of each DEP name data part.
+var keyPfxParts = map[string][]string{
+	storage.PartTokens: {
+		keyPfxConsumerKey,
+		keyPfxConsumerSecret,
+		keyPfxAccessToken,
+		keyPfxAccessSecret,
+		keyPfxAccessTokenExpiry,
+		keyPfxAccountDetail,
+		keyPfxOSBetaTokens,
+	},
+	storage.PartConfig: {keyPfxConfig},
+	storage.PartTokenPKI: {
+		keyPfxCert,
+		keyPfxCertStaging,
+		keyPfxKey,
+		keyPfxKeyStaging,
+	},
+	storage.PartAssigner: {
+		keyPfxAssignerProfile,
+		keyPfxAssignerProfileModTime,
+	},
+	storage.PartCursor: {keyPfxCursor},
+}
+
+// DeleteDEPName deletes the data parts of DEP name.
+// If no parts are provided all data for the DEP name is deleted.
+func (s *KV) DeleteDEPName(ctx context.Context, name string, parts ...string) error {
+	if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+	if len(parts) < 1 {
+		parts = storage.AllParts
+	}
+	var keys []string
+	for _, part := range parts {
+		for _, pfx := range keyPfxParts[part] {
+			keys = append(keys, pfx+name)
+		}
+	}
+	return kv.PerformCRUDBucketTxn(ctx, s.b, func(ctx context.Context, txn kv.CRUDBucket) error {
+		return kv.DeleteSlice(ctx, txn, keys)
+	})
+}
+
+// ListDEPNames returns the sorted names of all DEP names with keys of
+// any data part.
+func (s *KV) ListDEPNames(ctx context.Context) ([]string, error) {
+	found := make(map[string]struct{})
+	for _, pfxs := range keyPfxParts {
+		for _, pfx := range pfxs {
+			for _, key := range kv.AllKeysPrefix(ctx, s.b, pfx) {
+				found[key[len(pfx):]] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
@@ -0,0 +1,77 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxBypassCode = "bypass_code."
+
+// bypassCodeKey returns the key of the escrowed bypass code of the device
+// with serial of DEP name.
+func bypassCodeKey(name, serial string) string {
+	return keyPfxBypassCode + name + "." + serial
+}
+
+// StoreBypassCode stores the escrowed bypass code as JSON.
+func (s *KV) StoreBypassCode(ctx context.Context, escrow *storage.EscrowedBypassCode) error {
+	if escrow.Serial == "" || strings.ContainsAny(escrow.Serial, "./") {
+		return fmt.Errorf("invalid serial number: %q", escrow.Serial)
+	}
+	escrowJSON, err := json.Marshal(escrow)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, bypassCodeKey(escrow.DEPName, escrow.Serial), escrowJSON)
+}
+
+// RetrieveBypassCode retrieves the escrowed bypass code of the device
+// with serial of DEP name.
+func (s *KV) RetrieveBypassCode(ctx context.Context, name, serial string) (*storage.EscrowedBypassCode, error) {
+	if serial == "" || strings.ContainsAny(serial, "./") {
+		return nil, storage.ErrNotFound
+	}
+	escrowJSON, err := s.b.Get(ctx, bypassCodeKey(name, serial))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %v", storage.ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	escrow := new(storage.EscrowedBypassCode)
+	return escrow, json.Unmarshal(escrowJSON, escrow)
+}
+
+// ListBypassCodeSerials returns the sorted serial numbers of the devices
+// of DEP name with escrowed bypass codes.
+func (s *KV) ListBypassCodeSerials(ctx context.Context, name string) ([]string, error) {
+	var ret []string
+	for _, key := range kv.AllKeysPrefix(ctx, s.b, keyPfxBypassCode+name+".") {
+		serial := strings.TrimPrefix(key, keyPfxBypassCode+name+".")
+		// serial numbers never contain dots so this excludes
+		// the codes of DEP names prefixed by name
+		if serial == "" || strings.Contains(serial, ".") {
+			continue
+		}
+		ret = append(ret, serial)
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+// DeleteBypassCode deletes the escrowed bypass code of the device with
+// serial of DEP name.
+func (s *KV) DeleteBypassCode(ctx context.Context, name, serial string) error {
+	if serial == "" || strings.ContainsAny(serial, "./") {
+		return nil
+	}
+	return s.b.Delete(ctx, bypassCodeKey(name, serial))
+}
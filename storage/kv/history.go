@@ -0,0 +1,114 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxHistory = "history."
+
+// StoreHistoryEntry appends entry to the change history.
+// Each entry is stored under a key that sorts chronologically.
+// The key suffix is the entry ID.
+func (s *KV) StoreHistoryEntry(ctx context.Context, entry *storage.HistoryEntry) error {
+	e := *entry
+	var err error
+	if e.ID, err = storage.NewHistoryID(e.Timestamp); err != nil {
+		return err
+	}
+	entryJSON, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, keyPfxHistory+e.ID, entryJSON)
+}
+
+// getHistoryEntry retrieves and decodes the history entry at key.
+func (s *KV) getHistoryEntry(ctx context.Context, key string) (*storage.HistoryEntry, error) {
+	entryJSON, err := s.b.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	entry := new(storage.HistoryEntry)
+	if err = json.Unmarshal(entryJSON, entry); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", key, err)
+	}
+	return entry, nil
+}
+
+// QueryHistory queries and returns change history entries.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+// Warning: all history keys are buffered and sorted for each query.
+func (s *KV) QueryHistory(ctx context.Context, req *storage.HistoryQueryRequest) (*storage.HistoryQueryResult, error) {
+	if req == nil {
+		req = new(storage.HistoryQueryRequest)
+	}
+	if req.Pagination != nil && req.Pagination.Cursor != nil {
+		// cursor method not supported for this backend
+		return nil, storage.ErrOnlyOffset
+	}
+	_, offset, limit, err := req.Pagination.ValidateDefaultOffsetLimit(100)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := kv.AllKeysPrefix(ctx, s.b, keyPfxHistory)
+	// newest first
+	slices.Sort(keys)
+	slices.Reverse(keys)
+
+	ret := &storage.HistoryQueryResult{Entries: []storage.HistoryEntry{}}
+	var found int
+	for _, key := range keys {
+		entry, err := s.getHistoryEntry(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry.DEPName != req.DEPName || (req.Kind != "" && entry.Kind != req.Kind) {
+			continue
+		}
+
+		// only add if past offset
+		if found >= offset {
+			ret.Entries = append(ret.Entries, *entry)
+		}
+		found++
+
+		// stop if hit limit
+		if len(ret.Entries) >= limit {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+// RetrieveHistoryEntry retrieves the history entry with id of DEP name.
+func (s *KV) RetrieveHistoryEntry(ctx context.Context, name, id string) (*storage.HistoryEntry, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, storage.ErrNotFound
+	}
+	key := keyPfxHistory + id
+	if ok, err := s.b.Has(ctx, key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, storage.ErrNotFound
+	}
+	entry, err := s.getHistoryEntry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry.DEPName != name {
+		return nil, storage.ErrNotFound
+	}
+	return entry, nil
+}
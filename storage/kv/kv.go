@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/micromdm/nanodep/client"
@@ -42,6 +43,12 @@ func New(b kv.TxnBucketWithCRUD) *KV {
 	return &KV{b: b}
 }
 
+// Ping checks that the key-value store is accessible.
+func (s *KV) Ping(ctx context.Context) error {
+	_, err := s.b.Has(ctx, keyPfxConfig)
+	return err
+}
+
 // StoreAuthTokens stores the DEP OAuth tokens for name (DEP name).
 func (s *KV) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
 	expiryText, err := tokens.AccessTokenExpiry.MarshalText()
@@ -114,7 +121,13 @@ func (s *KV) RetrieveConfig(ctx context.Context, name string) (*client.Config, e
 
 // StoreAssignerProfile stores the assigner profile UUID for name (DEP name).
 func (s *KV) StoreAssignerProfile(ctx context.Context, name string, profileUUID string) error {
-	modTimeText, err := time.Now().UTC().MarshalText()
+	return s.StoreAssignerProfileAt(ctx, name, profileUUID, time.Now())
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp.
+func (s *KV) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	modTimeText, err := modTime.UTC().MarshalText()
 	if err != nil {
 		return err
 	}
@@ -235,15 +248,97 @@ func (s *KV) RetrieveCurrentTokenPKI(ctx context.Context, name string) ([]byte,
 	return tokenPKIMap[keyPfxCert+name], tokenPKIMap[keyPfxKey+name], nil
 }
 
-// QueryDEPNames queries and returns DEP names.
+// getOptional retrieves key, returning nil if it does not exist.
+func getOptional(ctx context.Context, b kv.ROBucket, key string) ([]byte, error) {
+	value, err := b.Get(ctx, key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// depNameFilterKeys are the key prefixes needed to match DEP names
+// against the DEP names query filter.
+var depNameFilterKeys = []string{
+	keyPfxConsumerKey,
+	keyPfxAccessTokenExpiry,
+	keyPfxConfig,
+}
+
+// depNameDetailsKeys are the key prefixes of all DEP name metadata.
+var depNameDetailsKeys = append(slices.Clone(depNameFilterKeys),
+	keyPfxCertStaging,
+	keyPfxCert,
+	keyPfxAssignerProfile,
+	keyPfxAssignerProfileModTime,
+	keyPfxCursor,
+)
+
+// retrieveDEPNameValues retrieves the key prefixes for name (DEP name)
+// into values, skipping those already retrieved. Missing keys are nil.
+func (s *KV) retrieveDEPNameValues(ctx context.Context, name string, values map[string][]byte, keys []string) error {
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		value, err := getOptional(ctx, s.b, key+name)
+		if err != nil {
+			return err
+		}
+		values[key] = value
+	}
+	return nil
+}
+
+// depNameDetails assembles the metadata for name (DEP name) from the
+// retrieved values. Values not retrieved are treated as missing.
+func depNameDetails(name string, values map[string][]byte) (*storage.DEPNameDetails, error) {
+	d := &storage.DEPNameDetails{Name: name}
+
+	if consumerKey := values[keyPfxConsumerKey]; consumerKey != nil {
+		d.HasTokens = true
+		d.SetConsumerKey(string(consumerKey))
+		expiry := new(time.Time)
+		if err := expiry.UnmarshalText(values[keyPfxAccessTokenExpiry]); err == nil {
+			d.AccessTokenExpiry = expiry
+		}
+	}
+
+	if configJSON := values[keyPfxConfig]; configJSON != nil {
+		config := new(client.Config)
+		if err := json.Unmarshal(configJSON, config); err != nil {
+			return nil, err
+		}
+		d.BaseURL = config.BaseURL
+	}
+
+	d.SetTokenPKI(true, values[keyPfxCertStaging])
+	d.SetTokenPKI(false, values[keyPfxCert])
+
+	d.AssignerProfileUUID = string(values[keyPfxAssignerProfile])
+	if modTimeText := values[keyPfxAssignerProfileModTime]; modTimeText != nil {
+		modTime := new(time.Time)
+		if err := modTime.UnmarshalText(modTimeText); err == nil {
+			d.AssignerProfileUUIDAt = modTime
+		}
+	}
+
+	d.HasCursor = len(values[keyPfxCursor]) > 0
+
+	return d, nil
+}
+
+// QueryDEPNames queries and returns DEP names and their details.
 // [ErrOnlyOffset] is returned if cursor pagination is attempted.
 // A default limit of 100 results is returned.
 // Uses the staged certificate upload as a key for the DEP name.
-// This means that a certificate has to have been staged (uploaded)
-// for the DEP name to be query-able.
+// This means that without filters other than DEP names a certificate
+// has to have been staged (uploaded) for the DEP name to be query-able.
+// Created and updated timestamps are not tracked by this backend.
 func (s *KV) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
-	var offset, limit int
+	offset, limit := 0, 100
 	var err error
+	var filter *storage.DEPNamesQueryFilter
 	if req != nil {
 		if req.Pagination != nil && req.Pagination.Cursor != nil {
 			// cursor method not supported for this backend
@@ -253,45 +348,63 @@ func (s *KV) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryReques
 		if err != nil {
 			return nil, err
 		}
+		filter = req.Filter
 	}
 
-	var filter []string
-	if req != nil && req.Filter != nil {
-		filter = req.Filter.DEPNames
+	var names []string
+	if filter.IncludesUnstaged() {
+		if names, err = s.ListDEPNames(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, key := range kv.AllKeysPrefix(ctx, s.b, keyPfxCertStaging) {
+			names = append(names, key[len(keyPfxCertStaging):])
+		}
+		// sort for stable pagination
+		slices.Sort(names)
 	}
 
-	var ret []string
+	ret := new(storage.DEPNamesQueryResult)
 	var found int
-	cancel := make(chan struct{})
-	for key := range s.b.KeysPrefix(ctx, keyPfxCertStaging, cancel) {
-		depName := key[len(keyPfxCertStaging):]
-
-		candidate := true
+	for _, depName := range names {
+		// quickly skip names to avoid retrieving their details
+		if !filter.MatchName(depName) {
+			continue
+		}
 
-		if len(filter) > 0 {
-			for _, filterName := range filter {
-				if filterName == depName {
-					goto afterNotFound
-				}
+		// only retrieve what the filter needs to match
+		values := make(map[string][]byte)
+		if filter.MatchesDetails() {
+			if err = s.retrieveDEPNameValues(ctx, depName, values, depNameFilterKeys); err != nil {
+				return nil, fmt.Errorf("retrieving details for %s: %w", depName, err)
 			}
-			candidate = false
-		afterNotFound:
-		} // if there is no filter, then all keys are implicitly candidates
-
-		if candidate {
-			// only add if past offset and under limit
-			if found >= offset && len(ret) < limit {
-				ret = append(ret, depName)
+			details, err := depNameDetails(depName, values)
+			if err != nil {
+				return nil, fmt.Errorf("retrieving details for %s: %w", depName, err)
 			}
-			found++
+			if !filter.Match(details) {
+				continue
+			}
+		}
 
-			// stop if hit limit
-			if len(ret) >= limit {
-				close(cancel)
-				break
+		// only add if past offset
+		if found >= offset {
+			if err = s.retrieveDEPNameValues(ctx, depName, values, depNameDetailsKeys); err != nil {
+				return nil, fmt.Errorf("retrieving details for %s: %w", depName, err)
+			}
+			details, err := depNameDetails(depName, values)
+			if err != nil {
+				return nil, fmt.Errorf("retrieving details for %s: %w", depName, err)
 			}
+			ret.DEPNames = append(ret.DEPNames, *details)
+		}
+		found++
+
+		// stop if hit limit
+		if len(ret.DEPNames) >= limit {
+			break
 		}
 	}
 
-	return &storage.DEPNamesQueryResult{DEPNames: ret}, nil
+	return ret, nil
 }
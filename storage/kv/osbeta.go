@@ -0,0 +1,54 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxOSBetaTokens = "osbeta_tokens."
+
+// StoreOSBetaTokens stores the cached beta enrollment tokens as JSON.
+func (s *KV) StoreOSBetaTokens(ctx context.Context, tokens *storage.CachedOSBetaTokens) error {
+	tokensJSON, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, keyPfxOSBetaTokens+tokens.DEPName, tokensJSON)
+}
+
+// RetrieveOSBetaTokens retrieves the cached beta enrollment tokens of
+// DEP name.
+func (s *KV) RetrieveOSBetaTokens(ctx context.Context, name string) (*storage.CachedOSBetaTokens, error) {
+	tokensJSON, err := s.b.Get(ctx, keyPfxOSBetaTokens+name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %v", storage.ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	tokens := new(storage.CachedOSBetaTokens)
+	return tokens, json.Unmarshal(tokensJSON, tokens)
+}
+
+// DeleteOSBetaTokens deletes the cached beta enrollment tokens of DEP name.
+func (s *KV) DeleteOSBetaTokens(ctx context.Context, name string) error {
+	return s.b.Delete(ctx, keyPfxOSBetaTokens+name)
+}
+
+// ListOSBetaTokensNames returns the DEP names that have cached beta
+// enrollment tokens.
+func (s *KV) ListOSBetaTokensNames(ctx context.Context) ([]string, error) {
+	var names []string
+	for _, key := range kv.AllKeysPrefix(ctx, s.b, keyPfxOSBetaTokens) {
+		names = append(names, key[len(keyPfxOSBetaTokens):])
+	}
+	slices.Sort(names)
+	return names, nil
+}
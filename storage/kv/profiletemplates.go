@@ -0,0 +1,61 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/storage/kv"
+)
+
+const keyPfxProfileTemplate = "profile_template."
+
+// StoreProfileTemplate stores template, overwriting any existing template with the same name.
+func (s *KV) StoreProfileTemplate(ctx context.Context, template *storage.ProfileTemplate) error {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	// auto-commit of storage obviates need for txn for single key
+	return s.b.Set(ctx, keyPfxProfileTemplate+template.Name, templateJSON)
+}
+
+// RetrieveProfileTemplate retrieves the profile template called name.
+func (s *KV) RetrieveProfileTemplate(ctx context.Context, name string) (*storage.ProfileTemplate, error) {
+	templateJSON, err := s.b.Get(ctx, keyPfxProfileTemplate+name)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %v", storage.ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	template := new(storage.ProfileTemplate)
+	return template, json.Unmarshal(templateJSON, template)
+}
+
+// DeleteProfileTemplate deletes the profile template called name.
+func (s *KV) DeleteProfileTemplate(ctx context.Context, name string) error {
+	return kv.PerformCRUDBucketTxn(ctx, s.b, func(ctx context.Context, txn kv.CRUDBucket) error {
+		found, err := txn.Has(ctx, keyPfxProfileTemplate+name)
+		if err != nil {
+			return err
+		} else if !found {
+			return storage.ErrNotFound
+		}
+		return txn.Delete(ctx, keyPfxProfileTemplate+name)
+	})
+}
+
+// ListProfileTemplates returns the names of all profile templates sorted by name.
+func (s *KV) ListProfileTemplates(ctx context.Context) ([]string, error) {
+	names := []string{}
+	for _, k := range kv.AllKeysPrefix(ctx, s.b, keyPfxProfileTemplate) {
+		names = append(names, strings.TrimPrefix(k, keyPfxProfileTemplate))
+	}
+	slices.Sort(names)
+	return names, nil
+}
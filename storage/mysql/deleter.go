@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// partColumns are the dep_names table columns of each DEP name data part.
+var partColumns = map[string][]string{
+	storage.PartTokens: {
+		"consumer_key",
+		"consumer_secret",
+		"access_token",
+		"access_secret",
+		"access_token_expiry",
+		"account_server_uuid",
+		"account_detail",
+		"account_detail_at",
+	},
+	storage.PartConfig: {
+		"config_base_url",
+		"config_mdm_service_discovery_url",
+	},
+	storage.PartTokenPKI: {
+		"tokenpki_cert_pem",
+		"tokenpki_key_pem",
+		"tokenpki_staging_cert_pem",
+		"tokenpki_staging_key_pem",
+	},
+	storage.PartAssigner: {
+		"assigner_profile_uuid",
+		"assigner_profile_uuid_at",
+	},
+	storage.PartCursor: {"syncer_cursor"},
+}
+
+// DeleteDEPName deletes the data parts of DEP name.
+// If all parts are selected the DEP name row is deleted, otherwise the
+// columns of the selected parts are cleared. Deleting the tokens also
+// deletes the OS beta enrollment tokens cached with them.
+func (s *MySQLStorage) DeleteDEPName(ctx context.Context, name string, parts ...string) error {
+	if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if storage.AllPartsSelected(parts) {
+		_, err = tx.ExecContext(ctx, `DELETE FROM dep_names WHERE name = ?;`, name)
+	} else {
+		var sets []string
+		for _, part := range parts {
+			for _, column := range partColumns[part] {
+				sets = append(sets, column+" = NULL")
+			}
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE dep_names SET `+strings.Join(sets, ", ")+` WHERE name = ?;`,
+			name,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if len(parts) < 1 || slices.Contains(parts, storage.PartTokens) {
+		_, err = tx.ExecContext(ctx, `DELETE FROM dep_osbeta_tokens WHERE dep_name = ?;`, name)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
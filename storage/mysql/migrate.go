@@ -0,0 +1,226 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations contains the ordered schema migrations. Each file is named
+// for the schema version it migrates to, e.g. "schema.00002.sql" migrates
+// from version 1 to version 2. Migrations must never be changed once
+// released. A new migration must also be reflected in schema.sql
+// including its version in the schema_version insert.
+//
+//go:embed schema.*.sql
+var migrations embed.FS
+
+// migrateLock is the name of the lock held while migrating.
+const migrateLock = "nanodep_schema_migrate"
+
+// migrateLockTimeout is the number of seconds to wait for the migrate lock.
+const migrateLockTimeout = 60
+
+// migration is a single embedded schema migration.
+type migration struct {
+	version int
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations sorted by version.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "schema.*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var ret []migration
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "schema."), ".sql"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name: %s", file)
+		}
+		b, err := migrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, migration{version: version, sql: string(b)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].version < ret[j].version })
+	for i, m := range ret {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("missing migration for schema version %d", i+1)
+		}
+	}
+	return ret, nil
+}
+
+// SchemaVersion returns the schema version of the embedded migrations
+// and of [Schema].
+func SchemaVersion() int {
+	m, err := loadMigrations()
+	if err != nil {
+		return 0
+	}
+	return len(m)
+}
+
+// statementSep separates SQL statements in schema files.
+var statementSep = regexp.MustCompile(`;\s*(\n|$)`)
+
+// splitStatements splits the SQL statements in schema.
+// The MySQL driver does not execute multiple statements at once by default.
+func splitStatements(schema string) []string {
+	var ret []string
+	for _, stmt := range statementSep.Split(schema, -1) {
+		var hasSQL bool
+		for _, line := range strings.Split(stmt, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "--") {
+				hasSQL = true
+				break
+			}
+		}
+		if hasSQL {
+			ret = append(ret, strings.TrimSpace(stmt))
+		}
+	}
+	return ret
+}
+
+// execStatements executes each statement in schema.
+func execStatements(ctx context.Context, conn *sql.Conn, schema string) error {
+	for _, stmt := range splitStatements(schema) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableExists reports whether table exists in the current database.
+func tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;`,
+		table,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// legacyVersion detects the schema version of databases created
+// before schema versions were tracked. These have the schema of the last
+// release without versions (version 1) or, if they lack the staging token
+// PKI columns, of an even older release (version 0).
+// Version -1 means no schema exists.
+func legacyVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	if ok, err := tableExists(ctx, conn, "dep_names"); err != nil || !ok {
+		return -1, err
+	}
+	var n int
+	err := conn.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'dep_names' AND column_name = 'tokenpki_staging_cert_pem';`,
+	).Scan(&n)
+	if err != nil || n < 1 {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// schemaVersion returns the schema version of the database.
+// Version -1 means no schema exists.
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	ok, err := tableExists(ctx, conn, "schema_version")
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		var version sql.NullInt64
+		err = conn.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version;`).Scan(&version)
+		if err != nil || version.Valid {
+			return int(version.Int64), err
+		}
+	}
+	return legacyVersion(ctx, conn)
+}
+
+// migrate checks the database schema version. If the schema is older
+// than the embedded migrations then the pending migrations are applied
+// (or [Schema] is applied to an empty database) if apply is true,
+// otherwise an error is returned. Note that MySQL cannot roll back schema
+// changes so a failed migration may need manual repair.
+func migrate(ctx context.Context, db *sql.DB, apply bool) error {
+	m, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if apply {
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?);`, migrateLock, migrateLockTimeout).Scan(&locked)
+		if err != nil {
+			return fmt.Errorf("acquiring migrate lock: %w", err)
+		} else if locked.Int64 != 1 {
+			return errors.New("timeout acquiring migrate lock")
+		}
+		defer func() {
+			var released sql.NullInt64
+			conn.QueryRowContext(context.Background(), `SELECT RELEASE_LOCK(?);`, migrateLock).Scan(&released)
+		}()
+	}
+
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version >= len(m) {
+		return nil
+	}
+	if !apply {
+		if version < 0 {
+			return errors.New("database schema not found (use the migrate=true option to create it)")
+		}
+		return fmt.Errorf("database schema version %d is older than required version %d (use the migrate=true option to migrate)", version, len(m))
+	}
+
+	if version < 0 {
+		if err = execStatements(ctx, conn, Schema); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+		return nil
+	}
+
+	_, err = conn.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version    INT NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (version)
+);`)
+	if err != nil {
+		return fmt.Errorf("creating schema_version table: %w", err)
+	}
+	for _, mig := range m[version:] {
+		if err = execStatements(ctx, conn, mig.sql); err != nil {
+			return fmt.Errorf("migrating to schema version %d: %w", mig.version, err)
+		}
+		_, err = conn.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?);`, mig.version)
+		if err != nil {
+			return fmt.Errorf("recording schema version %d: %w", mig.version, err)
+		}
+	}
+	return nil
+}
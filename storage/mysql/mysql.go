@@ -14,6 +14,7 @@ import (
 )
 
 // Schema contains the MySQL schema for the DEP storage.
+// It is at schema version [SchemaVersion].
 //
 //go:embed schema.sql
 var Schema string
@@ -33,12 +34,18 @@ type MySQLStorage struct {
 	q  *sqlc.Queries
 }
 
+// Ping checks the connection to the database.
+func (s *MySQLStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 type config struct {
 	driver          string
 	dsn             string
 	db              *sql.DB
 	connMaxLifetime time.Duration
 	connMaxIdleTime time.Duration
+	migrate         bool
 }
 
 // Option allows configuring a MySQLStorage.
@@ -88,6 +95,15 @@ func WithConnMaxIdleTime(d time.Duration) Option {
 	}
 }
 
+// WithMigrate sets whether any pending schema migrations are applied
+// when the storage is created. By default they are not and an error is
+// returned if the database schema is older than required.
+func WithMigrate(migrate bool) Option {
+	return func(c *config) {
+		c.migrate = migrate
+	}
+}
+
 // New creates and returns a new MySQLStorage.
 func New(opts ...Option) (*MySQLStorage, error) {
 	cfg := &config{
@@ -112,6 +128,9 @@ func New(opts ...Option) (*MySQLStorage, error) {
 	if err = cfg.db.Ping(); err != nil {
 		return nil, err
 	}
+	if err = migrate(context.Background(), cfg.db, cfg.migrate); err != nil {
+		return nil, err
+	}
 	return &MySQLStorage{db: cfg.db, q: sqlc.New(cfg.db)}, nil
 }
 
@@ -171,7 +190,7 @@ ON DUPLICATE KEY UPDATE
 // Returns (nil, nil) if the DEP name does not exist, or if the config
 // for the DEP name does not exist.
 func (s *MySQLStorage) RetrieveConfig(ctx context.Context, name string) (*client.Config, error) {
-	baseURL, err := s.q.GetConfigBaseURL(ctx, name)
+	configRow, err := s.q.GetConfig(ctx, name)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// If the DEP name does not exist, then the config does not exist.
@@ -179,12 +198,13 @@ func (s *MySQLStorage) RetrieveConfig(ctx context.Context, name string) (*client
 		}
 		return nil, err
 	}
-	if !baseURL.Valid {
+	if !configRow.ConfigBaseUrl.Valid {
 		// If the config_base_url is NULL, then config does not exist.
 		return nil, nil
 	}
 	return &client.Config{
-		BaseURL: baseURL.String,
+		BaseURL:                configRow.ConfigBaseUrl.String,
+		MDMServiceDiscoveryURL: configRow.ConfigMdmServiceDiscoveryUrl.String,
 	}, nil
 }
 
@@ -193,13 +213,15 @@ func (s *MySQLStorage) StoreConfig(ctx context.Context, name string, config *cli
 	_, err := s.db.ExecContext(
 		ctx, `
 INSERT INTO dep_names
-	(name, config_base_url)
+	(name, config_base_url, config_mdm_service_discovery_url)
 VALUES 
-	(?, ?) as new
+	(?, ?, ?) as new
 ON DUPLICATE KEY UPDATE
-	config_base_url = new.config_base_url;`,
+	config_base_url = new.config_base_url,
+	config_mdm_service_discovery_url = new.config_mdm_service_discovery_url;`,
 		name,
 		config.BaseURL,
+		sql.NullString{String: config.MDMServiceDiscoveryURL, Valid: config.MDMServiceDiscoveryURL != ""},
 	)
 	return err
 }
@@ -242,6 +264,25 @@ ON DUPLICATE KEY UPDATE
 	return err
 }
 
+// StoreAssignerProfileAt saves the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp.
+func (s *MySQLStorage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, assigner_profile_uuid, assigner_profile_uuid_at)
+VALUES
+	(?, ?, ?) as new
+ON DUPLICATE KEY UPDATE
+	assigner_profile_uuid = new.assigner_profile_uuid,
+	assigner_profile_uuid_at = new.assigner_profile_uuid_at;`,
+		name,
+		profileUUID,
+		modTime.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
 // RetrieveCursor reads the reads the DEP fetch and sync cursor for name (DEP name).
 //
 // Returns an empty cursor if the cursor does not exist.
@@ -334,43 +375,3 @@ func (s *MySQLStorage) RetrieveCurrentTokenPKI(ctx context.Context, name string)
 	}
 	return keypair.TokenpkiCertPem, keypair.TokenpkiKeyPem, nil
 }
-
-// QueryDEPNames queries and returns DEP names.
-func (s *MySQLStorage) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
-	var offset, limit int
-	var err error
-	if req != nil {
-		if req.Pagination != nil && req.Pagination.Cursor != nil {
-			// cursor method not supported for this backend
-			return nil, storage.ErrOnlyOffset
-		}
-		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	ret := new(storage.DEPNamesQueryResult)
-	if req != nil && req.Filter != nil && len(req.Filter.DEPNames) > 0 {
-		params := sqlc.GetDEPNamesParams{
-			DepNames: req.Filter.DEPNames,
-			Limit:    int32(limit),
-			Offset:   int32(offset),
-		}
-		ret.DEPNames, err = s.q.GetDEPNames(ctx, params)
-		if err != nil {
-			return ret, fmt.Errorf("get dep names: %w", err)
-		}
-	} else {
-		params := sqlc.GetAllDEPNamesParams{
-			Limit:  int32(limit),
-			Offset: int32(offset),
-		}
-		ret.DEPNames, err = s.q.GetAllDEPNames(ctx, params)
-		if err != nil {
-			return ret, fmt.Errorf("get all dep names: %w", err)
-		}
-	}
-
-	return ret, nil
-}
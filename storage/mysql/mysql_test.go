@@ -2,7 +2,11 @@ package mysql
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -15,10 +19,53 @@ func TestMySQLStorage(t *testing.T) {
 		t.Skip("NANODEP_MYSQL_STORAGE_TEST_DSN not set")
 	}
 
-	s, err := New(WithDSN(testDSN))
+	s, err := New(WithDSN(testDSN), WithMigrate(true))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	test.TestWithStorages(t, context.Background(), s)
 }
+
+// latestMigration returns the highest schema.NNNNN.sql migration version
+// in the package directory.
+func latestMigration(t *testing.T) int {
+	t.Helper()
+	files, err := filepath.Glob("schema.*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var latest int
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "schema."), ".sql"))
+		if err != nil {
+			t.Fatalf("invalid migration name: %s", file)
+		}
+		latest = max(latest, version)
+	}
+	return latest
+}
+
+func TestSchemaVersion(t *testing.T) {
+	version := SchemaVersion()
+	if version < 1 {
+		t.Fatal("no migrations")
+	}
+	// all migrations on disk must be embedded
+	if have, want := version, latestMigration(t); have != want {
+		t.Errorf("schema version: have %d, want %d", have, want)
+	}
+	// the full schema must be at the latest migration version
+	insert := fmt.Sprintf("INSERT INTO schema_version (version) VALUES (%d);", version)
+	if !strings.Contains(Schema, insert) {
+		t.Errorf("schema.sql missing: %s", insert)
+	}
+	if have, want := len(splitStatements(Schema)), 9; have != want {
+		t.Errorf("statements: have %d, want %d", have, want)
+	}
+	for _, stmt := range splitStatements(Schema) {
+		if strings.HasSuffix(stmt, ";") {
+			t.Errorf("statement not split: %s", stmt)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreOSBetaTokens stores the cached beta enrollment tokens, overwriting
+// any existing cached tokens for the DEP name.
+func (s *MySQLStorage) StoreOSBetaTokens(ctx context.Context, tokens *storage.CachedOSBetaTokens) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_osbeta_tokens
+	(dep_name, response, seed_for_it_turned_off, fetched_at)
+VALUES
+	(?, ?, ?, ?) as new
+ON DUPLICATE KEY UPDATE
+	response = new.response,
+	seed_for_it_turned_off = new.seed_for_it_turned_off,
+	fetched_at = new.fetched_at;`,
+		tokens.DEPName,
+		sql.NullString{String: string(tokens.Response), Valid: len(tokens.Response) > 0},
+		tokens.SeedForITTurnedOff,
+		tokens.FetchedAt.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
+// RetrieveOSBetaTokens retrieves the cached beta enrollment tokens of
+// DEP name.
+func (s *MySQLStorage) RetrieveOSBetaTokens(ctx context.Context, name string) (*storage.CachedOSBetaTokens, error) {
+	tokens := &storage.CachedOSBetaTokens{DEPName: name}
+	var response sql.NullString
+	var fetchedAt string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT response, seed_for_it_turned_off, fetched_at FROM dep_osbeta_tokens WHERE dep_name = ?;`,
+		name,
+	).Scan(&response, &tokens.SeedForITTurnedOff, &fetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if response.Valid {
+		tokens.Response = []byte(response.String)
+	}
+	tokens.FetchedAt, err = time.Parse(timestampFormat, fetchedAt)
+	return tokens, err
+}
+
+// DeleteOSBetaTokens deletes the cached beta enrollment tokens of DEP name.
+func (s *MySQLStorage) DeleteOSBetaTokens(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM dep_osbeta_tokens WHERE dep_name = ?;`, name)
+	return err
+}
+
+// ListOSBetaTokensNames returns the DEP names that have cached beta
+// enrollment tokens.
+func (s *MySQLStorage) ListOSBetaTokensNames(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT dep_name FROM dep_osbeta_tokens ORDER BY dep_name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -1,5 +1,11 @@
--- name: GetConfigBaseURL :one
-SELECT config_base_url FROM dep_names WHERE name = ?;
+-- name: GetConfig :one
+SELECT
+  config_base_url,
+  config_mdm_service_discovery_url
+FROM
+  dep_names
+WHERE
+  name = ?;
 
 -- name: GetSyncerCursor :one
 SELECT syncer_cursor FROM dep_names WHERE name = ?;
@@ -51,16 +57,3 @@ FROM
   dep_names
 WHERE
   name = ?;
-
--- name: GetAllDEPNames :many
-SELECT name FROM dep_names WHERE tokenpki_staging_cert_pem IS NOT NULL LIMIT ? OFFSET ?;
-
--- name: GetDEPNames :many
-SELECT
-  name
-FROM
-  dep_names
-WHERE
-  name IN (sqlc.slice('dep_names')) AND
-  tokenpki_staging_cert_pem IS NOT NULL
-LIMIT ? OFFSET ?;
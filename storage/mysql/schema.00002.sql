@@ -0,0 +1,19 @@
+CREATE TABLE dep_audit_log (
+    id BIGINT NOT NULL AUTO_INCREMENT,
+
+    created_at   TIMESTAMP NOT NULL,
+    dep_name     VARCHAR(255) NOT NULL,
+    method       VARCHAR(16) NOT NULL,
+    endpoint     VARCHAR(255) NOT NULL,
+    identity     VARCHAR(255) NULL,
+    client_ip    VARCHAR(64) NULL,
+    -- JSON array of device serial numbers
+    serials      TEXT NULL,
+    profile_uuid VARCHAR(255) NULL,
+    status       INT NOT NULL,
+
+    PRIMARY KEY (id),
+
+    INDEX (dep_name, created_at),
+    INDEX (created_at)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE profile_templates (
+    name     VARCHAR(255) NOT NULL,
+    -- DEP profile JSON with optional ${VARIABLE} placeholders
+    template TEXT NOT NULL,
+
+    updated_at TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (name)
+);
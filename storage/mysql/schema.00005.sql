@@ -0,0 +1,29 @@
+-- Allow token PKI private keys encrypted by the envelope storage wrapper.
+-- The original CHECK was unnamed and its generated name differs between
+-- MySQL and MariaDB so it is looked up by the column it checks.
+SET @nanodep_key_chk = (
+    SELECT tc.constraint_name
+    FROM information_schema.table_constraints tc
+    JOIN information_schema.check_constraints cc
+        ON cc.constraint_schema = tc.constraint_schema AND cc.constraint_name = tc.constraint_name
+    WHERE tc.table_schema = DATABASE()
+        AND tc.table_name = 'dep_names'
+        AND tc.constraint_type = 'CHECK'
+        AND cc.check_clause LIKE '%tokenpki_key_pem%'
+    LIMIT 1
+);
+
+SET @nanodep_stmt = IF(
+    @nanodep_key_chk IS NULL,
+    'DO 0',
+    CONCAT('ALTER TABLE dep_names DROP CONSTRAINT `', @nanodep_key_chk, '`')
+);
+
+PREPARE nanodep_stmt FROM @nanodep_stmt;
+
+EXECUTE nanodep_stmt;
+
+DEALLOCATE PREPARE nanodep_stmt;
+
+ALTER TABLE dep_names ADD CONSTRAINT dep_names_tokenpki_key_pem_chk
+    CHECK (tokenpki_key_pem IS NULL OR SUBSTRING(tokenpki_key_pem FROM 1 FOR 5) = '-----' OR SUBSTRING(tokenpki_key_pem FROM 1 FOR 12) = 'nanodep-enc:');
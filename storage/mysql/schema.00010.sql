@@ -0,0 +1,5 @@
+ALTER TABLE dep_names
+    ADD COLUMN account_server_uuid VARCHAR(255) NULL,
+    ADD COLUMN account_detail      TEXT NULL,
+    ADD COLUMN account_detail_at   TIMESTAMP NULL,
+    ADD INDEX (account_server_uuid);
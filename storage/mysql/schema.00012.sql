@@ -0,0 +1,2 @@
+-- device serial numbers of audit events may exceed 64 KiB
+ALTER TABLE dep_audit_log MODIFY serials MEDIUMTEXT NULL;
@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"context"
+	"time"
+)
+
+// QueryDEPNamesUpdatedSince returns the DEP names updated at or after since.
+// The update timestamps have a granularity of one second.
+func (s *MySQLStorage) QueryDEPNamesUpdatedSince(ctx context.Context, since time.Time) ([]string, time.Time, error) {
+	// Unix timestamps are independent of both the session time zone
+	// (in which TIMESTAMP columns are compared) and the DSN's parseTime.
+	var nowUnix int64
+	if err := s.db.QueryRowContext(ctx, `SELECT UNIX_TIMESTAMP();`).Scan(&nowUnix); err != nil {
+		return nil, time.Time{}, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT name FROM dep_names WHERE updated_at >= FROM_UNIXTIME(?) ORDER BY name;`,
+		since.Unix(),
+	)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, time.Time{}, err
+		}
+		names = append(names, name)
+	}
+	return names, time.Unix(nowUnix, 0).UTC(), rows.Err()
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CachedOSBetaTokens is the cached DEP API beta enrollment tokens
+// response of a DEP name.
+type CachedOSBetaTokens struct {
+	DEPName string `json:"dep_name"`
+
+	// Response is the JSON DEP API response.
+	// It is empty if AppleSeed for IT is turned off.
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// SeedForITTurnedOff is true if the DEP API reported that the
+	// organization does not allow beta access.
+	SeedForITTurnedOff bool `json:"seed_for_it_turned_off,omitempty"`
+
+	// FetchedAt is the time the response was fetched from the DEP API.
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// OSBetaTokensCacheStorer stores cached DEP API beta enrollment tokens.
+type OSBetaTokensCacheStorer interface {
+	// StoreOSBetaTokens stores the cached beta enrollment tokens of a
+	// DEP name, replacing any existing cached tokens.
+	StoreOSBetaTokens(ctx context.Context, tokens *CachedOSBetaTokens) error
+
+	// RetrieveOSBetaTokens retrieves the cached beta enrollment tokens
+	// of DEP name.
+	// [ErrNotFound] is returned if no tokens are cached.
+	RetrieveOSBetaTokens(ctx context.Context, name string) (*CachedOSBetaTokens, error)
+
+	// DeleteOSBetaTokens deletes the cached beta enrollment tokens of
+	// DEP name. Deleting tokens that are not cached is not an error.
+	DeleteOSBetaTokens(ctx context.Context, name string) error
+
+	// ListOSBetaTokensNames returns the DEP names that have cached beta
+	// enrollment tokens.
+	ListOSBetaTokensNames(ctx context.Context) ([]string, error)
+}
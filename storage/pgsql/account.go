@@ -0,0 +1,78 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/micromdm/nanodep/http/api"
+)
+
+// StoreAccountDetail saves the account detail for name (DEP name).
+// A nil detail clears the account detail.
+func (s *PSQLStorage) StoreAccountDetail(ctx context.Context, name string, detail *api.AccountDetail) error {
+	if detail == nil {
+		_, err := s.db.ExecContext(
+			ctx,
+			`UPDATE dep_names SET account_server_uuid = NULL, account_detail = NULL, account_detail_at = NULL WHERE name = $1;`,
+			name,
+		)
+		return err
+	}
+	detailJSON, err := json.Marshal(detail.AccountDetailJson)
+	if err != nil {
+		return err
+	}
+	var serverUUID sql.NullString
+	if detail.ServerUuid != nil {
+		serverUUID = sql.NullString{String: *detail.ServerUuid, Valid: true}
+	}
+	_, err = s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, account_server_uuid, account_detail, account_detail_at)
+VALUES
+	($1, $2, $3, $4)
+ON CONFLICT (name) DO UPDATE
+SET
+	account_server_uuid = EXCLUDED.account_server_uuid,
+	account_detail = EXCLUDED.account_detail,
+	account_detail_at = EXCLUDED.account_detail_at;`,
+		name,
+		serverUUID,
+		string(detailJSON),
+		detail.FetchedAt,
+	)
+	return err
+}
+
+// RetrieveAccountDetail reads the account detail of a DEP name.
+//
+// Returns (nil, nil) if the DEP name does not exist, or if the account
+// detail for the DEP name does not exist.
+func (s *PSQLStorage) RetrieveAccountDetail(ctx context.Context, name string) (*api.AccountDetail, error) {
+	var detailJSON sql.NullString
+	var detailAt sql.NullTime
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT account_detail, account_detail_at FROM dep_names WHERE name = $1;`,
+		name,
+	).Scan(&detailJSON, &detailAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !detailJSON.Valid {
+		return nil, nil
+	}
+	detail := new(api.AccountDetail)
+	if err = json.Unmarshal([]byte(detailJSON.String), &detail.AccountDetailJson); err != nil {
+		return nil, err
+	}
+	if detailAt.Valid {
+		detail.FetchedAt = detailAt.Time.UTC()
+	}
+	return detail, nil
+}
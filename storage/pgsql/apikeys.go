@@ -0,0 +1,123 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreAPIKey stores key, overwriting any existing key with the same name.
+func (s *PSQLStorage) StoreAPIKey(ctx context.Context, key *storage.APIKey) error {
+	scopes, depNames, err := marshalAPIKeyLists(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx, `
+INSERT INTO api_keys
+	(name, secret_hash, scopes, dep_names, created_at)
+VALUES
+	($1, $2, $3, $4, $5)
+ON CONFLICT (name) DO UPDATE
+SET
+	secret_hash = EXCLUDED.secret_hash,
+	scopes = EXCLUDED.scopes,
+	dep_names = EXCLUDED.dep_names,
+	created_at = EXCLUDED.created_at;`,
+		key.Name,
+		key.SecretHash,
+		scopes,
+		depNames,
+		key.CreatedAt,
+	)
+	return err
+}
+
+// marshalAPIKeyLists JSON encodes the scopes and DEP names of key.
+func marshalAPIKeyLists(key *storage.APIKey) (string, sql.NullString, error) {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return "", sql.NullString{}, err
+	}
+	var depNames sql.NullString
+	if len(key.DEPNames) > 0 {
+		depNamesJSON, err := json.Marshal(key.DEPNames)
+		if err != nil {
+			return "", sql.NullString{}, err
+		}
+		depNames = sql.NullString{String: string(depNamesJSON), Valid: true}
+	}
+	return string(scopes), depNames, nil
+}
+
+// RetrieveAPIKey retrieves the API key called name.
+func (s *PSQLStorage) RetrieveAPIKey(ctx context.Context, name string) (*storage.APIKey, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT name, secret_hash, scopes, dep_names, created_at FROM api_keys WHERE name = $1;`,
+		name,
+	)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	return key, err
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*storage.APIKey, error) {
+	key := new(storage.APIKey)
+	var scopes string
+	var depNames sql.NullString
+	err := row.Scan(&key.Name, &key.SecretHash, &scopes, &depNames, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, err
+	}
+	if depNames.Valid {
+		if err = json.Unmarshal([]byte(depNames.String), &key.DEPNames); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// DeleteAPIKey deletes the API key called name.
+func (s *PSQLStorage) DeleteAPIKey(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE name = $1;`, name)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if rows < 1 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// ListAPIKeys returns all API keys sorted by name.
+func (s *PSQLStorage) ListAPIKeys(ctx context.Context) ([]storage.APIKey, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT name, secret_hash, scopes, dep_names, created_at FROM api_keys ORDER BY name;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []storage.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *key)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,128 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreAuditEvent appends event to the audit log.
+func (s *PSQLStorage) StoreAuditEvent(ctx context.Context, event *storage.AuditEvent) error {
+	var serials sql.NullString
+	if len(event.Serials) > 0 {
+		serialsJSON, err := json.Marshal(event.Serials)
+		if err != nil {
+			return err
+		}
+		serials = sql.NullString{String: string(serialsJSON), Valid: true}
+	}
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_audit_log
+	(created_at, dep_name, method, endpoint, identity, client_ip, serials, profile_uuid, status, dry_run)
+VALUES
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`,
+		event.Timestamp,
+		event.DEPName,
+		event.Method,
+		event.Endpoint,
+		sql.NullString{String: event.Identity, Valid: event.Identity != ""},
+		sql.NullString{String: event.ClientIP, Valid: event.ClientIP != ""},
+		serials,
+		sql.NullString{String: event.ProfileUUID, Valid: event.ProfileUUID != ""},
+		event.Status,
+		event.DryRun,
+	)
+	return err
+}
+
+// QueryAuditEvents queries and returns audit log events.
+func (s *PSQLStorage) QueryAuditEvents(ctx context.Context, req *storage.AuditQueryRequest) (*storage.AuditQueryResult, error) {
+	var offset, limit int
+	var err error
+	var filter *storage.AuditQueryFilter
+	if req != nil {
+		if req.Pagination != nil && req.Pagination.Cursor != nil {
+			// cursor method not supported for this backend
+			return nil, storage.ErrOnlyOffset
+		}
+		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
+		if err != nil {
+			return nil, err
+		}
+		filter = req.Filter
+	} else {
+		limit = 100
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if filter != nil {
+		if len(filter.DEPNames) > 0 {
+			where = append(where, "dep_name = ANY("+arg(pq.Array(filter.DEPNames))+"::varchar[])")
+		}
+		if filter.Since != nil {
+			where = append(where, "created_at >= "+arg(*filter.Since))
+		}
+		if filter.Until != nil {
+			where = append(where, "created_at < "+arg(*filter.Until))
+		}
+	}
+
+	query := `
+SELECT
+  created_at, dep_name, method, endpoint, identity, client_ip, serials, profile_uuid, status, dry_run
+FROM
+  dep_audit_log`
+	if len(where) > 0 {
+		query += "\nWHERE\n  " + strings.Join(where, " AND\n  ")
+	}
+	query += "\nORDER BY id\nLIMIT " + arg(limit) + " OFFSET " + arg(offset) + ";"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	ret := &storage.AuditQueryResult{Events: []storage.AuditEvent{}}
+	for rows.Next() {
+		var event storage.AuditEvent
+		var identity, clientIP, serials, profileUUID sql.NullString
+		err = rows.Scan(
+			&event.Timestamp,
+			&event.DEPName,
+			&event.Method,
+			&event.Endpoint,
+			&identity,
+			&clientIP,
+			&serials,
+			&profileUUID,
+			&event.Status,
+			&event.DryRun,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if serials.Valid {
+			if err = json.Unmarshal([]byte(serials.String), &event.Serials); err != nil {
+				return nil, err
+			}
+		}
+		event.Identity = identity.String
+		event.ClientIP = clientIP.String
+		event.ProfileUUID = profileUUID.String
+		ret.Events = append(ret.Events, event)
+	}
+	return ret, rows.Err()
+}
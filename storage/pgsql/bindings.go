@@ -0,0 +1,48 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/micromdm/nanodep/http/api"
+)
+
+// FindDEPNameBindings finds the DEP names whose OAuth1 tokens have
+// consumerKey or whose account detail has serverUUID.
+func (s *PSQLStorage) FindDEPNameBindings(ctx context.Context, consumerKey, serverUUID string) ([]api.DEPNameBinding, error) {
+	// empty values are NULL so they never match
+	consumerKeyArg := sql.NullString{String: consumerKey, Valid: consumerKey != ""}
+	serverUUIDArg := sql.NullString{String: serverUUID, Valid: serverUUID != ""}
+	rows, err := s.db.QueryContext(
+		ctx, `
+SELECT
+	name,
+	consumer_key = $1,
+	account_server_uuid = $2
+FROM
+	dep_names
+WHERE
+	consumer_key = $1 OR
+	account_server_uuid = $2
+ORDER BY
+	name;`,
+		consumerKeyArg,
+		serverUUIDArg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bindings []api.DEPNameBinding
+	for rows.Next() {
+		var binding api.DEPNameBinding
+		var sameConsumerKey, sameServerUUID sql.NullBool
+		if err = rows.Scan(&binding.Name, &sameConsumerKey, &sameServerUUID); err != nil {
+			return nil, err
+		}
+		binding.SameConsumerKey = sameConsumerKey.Bool
+		binding.SameServerUUID = sameServerUUID.Bool
+		bindings = append(bindings, binding)
+	}
+	return bindings, rows.Err()
+}
@@ -0,0 +1,116 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// nullJSON converts a JSON value to a nullable column.
+func nullJSON(v []byte) sql.NullString {
+	return sql.NullString{String: string(v), Valid: len(v) > 0}
+}
+
+// StoreHistoryEntry appends entry to the change history.
+func (s *PSQLStorage) StoreHistoryEntry(ctx context.Context, entry *storage.HistoryEntry) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_history
+	(created_at, dep_name, kind, actor, previous_value, value)
+VALUES
+	($1, $2, $3, $4, $5, $6);`,
+		entry.Timestamp,
+		entry.DEPName,
+		entry.Kind,
+		sql.NullString{String: entry.Actor, Valid: entry.Actor != ""},
+		nullJSON(entry.Previous),
+		nullJSON(entry.Value),
+	)
+	return err
+}
+
+const historyColumns = `id, created_at, dep_name, kind, actor, previous_value, value`
+
+func scanHistoryEntry(row interface{ Scan(...any) error }) (*storage.HistoryEntry, error) {
+	entry := new(storage.HistoryEntry)
+	var id int64
+	var actor, previous, value sql.NullString
+	err := row.Scan(&id, &entry.Timestamp, &entry.DEPName, &entry.Kind, &actor, &previous, &value)
+	if err != nil {
+		return nil, err
+	}
+	entry.ID = strconv.FormatInt(id, 10)
+	entry.Actor = actor.String
+	if previous.Valid {
+		entry.Previous = []byte(previous.String)
+	}
+	if value.Valid {
+		entry.Value = []byte(value.String)
+	}
+	return entry, nil
+}
+
+// QueryHistory queries and returns change history entries.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+func (s *PSQLStorage) QueryHistory(ctx context.Context, req *storage.HistoryQueryRequest) (*storage.HistoryQueryResult, error) {
+	if req == nil {
+		req = new(storage.HistoryQueryRequest)
+	}
+	if req.Pagination != nil && req.Pagination.Cursor != nil {
+		// cursor method not supported for this backend
+		return nil, storage.ErrOnlyOffset
+	}
+	_, offset, limit, err := req.Pagination.ValidateDefaultOffsetLimit(100)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + historyColumns + ` FROM dep_history WHERE dep_name = $1`
+	args := []interface{}{req.DEPName}
+	if req.Kind != "" {
+		args = append(args, req.Kind)
+		query += ` AND kind = $` + strconv.Itoa(len(args))
+	}
+	args = append(args, limit, offset)
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args)) + `;`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	ret := &storage.HistoryQueryResult{Entries: []storage.HistoryEntry{}}
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret.Entries = append(ret.Entries, *entry)
+	}
+	return ret, rows.Err()
+}
+
+// RetrieveHistoryEntry retrieves the history entry with id of DEP name.
+func (s *PSQLStorage) RetrieveHistoryEntry(ctx context.Context, name, id string) (*storage.HistoryEntry, error) {
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id: %v", storage.ErrNotFound, err)
+	}
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+historyColumns+` FROM dep_history WHERE id = $1 AND dep_name = $2;`,
+		idInt,
+		name,
+	)
+	entry, err := scanHistoryEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	return entry, err
+}
@@ -0,0 +1,180 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations contains the ordered schema migrations. Each file is named
+// for the schema version it migrates to, e.g. "schema.00002.sql" migrates
+// from version 1 to version 2. Migrations must never be changed once
+// released. A new migration must also be reflected in schema.sql
+// including its version in the schema_version insert.
+//
+//go:embed schema.*.sql
+var migrations embed.FS
+
+// migrateLockKey is the advisory lock key held while migrating.
+const migrateLockKey = 0x6e616e6f646570 // "nanodep"
+
+// migration is a single embedded schema migration.
+type migration struct {
+	version int
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations sorted by version.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "schema.*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var ret []migration
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "schema."), ".sql"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name: %s", file)
+		}
+		b, err := migrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, migration{version: version, sql: string(b)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].version < ret[j].version })
+	for i, m := range ret {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("missing migration for schema version %d", i+1)
+		}
+	}
+	return ret, nil
+}
+
+// SchemaVersion returns the schema version of the embedded migrations
+// and of [Schema].
+func SchemaVersion() int {
+	m, err := loadMigrations()
+	if err != nil {
+		return 0
+	}
+	return len(m)
+}
+
+// tableExists reports whether table exists in the current schema.
+func tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1;`,
+		table,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// legacyVersion detects the schema version of databases created
+// before schema versions were tracked. These have the schema of the last
+// release without versions (version 0).
+// Version -1 means no schema exists.
+func legacyVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	if ok, err := tableExists(ctx, conn, "dep_names"); err != nil || !ok {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// schemaVersion returns the schema version of the database.
+// Version -1 means no schema exists.
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	ok, err := tableExists(ctx, conn, "schema_version")
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		var version sql.NullInt64
+		err = conn.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version;`).Scan(&version)
+		if err != nil || version.Valid {
+			return int(version.Int64), err
+		}
+	}
+	return legacyVersion(ctx, conn)
+}
+
+// migrate checks the database schema version. If the schema is older
+// than the embedded migrations then the pending migrations are applied
+// (or [Schema] is applied to an empty database) if apply is true,
+// otherwise an error is returned. Each migration is applied in its own
+// transaction.
+func migrate(ctx context.Context, db *sql.DB, apply bool) error {
+	m, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if apply {
+		if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrateLockKey); err != nil {
+			return fmt.Errorf("acquiring migrate lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrateLockKey)
+	}
+
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version >= len(m) {
+		return nil
+	}
+	if !apply {
+		if version < 0 {
+			return errors.New("database schema not found (use the migrate=true option to create it)")
+		}
+		return fmt.Errorf("database schema version %d is older than required version %d (use the migrate=true option to migrate)", version, len(m))
+	}
+
+	if version < 0 {
+		if err = execTx(ctx, conn, Schema); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+		return nil
+	}
+
+	for _, mig := range m[version:] {
+		err = execTx(ctx, conn, `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version    INTEGER NOT NULL,
+    applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (version)
+);
+`+mig.sql+fmt.Sprintf("\nINSERT INTO schema_version (version) VALUES (%d);", mig.version))
+		if err != nil {
+			return fmt.Errorf("migrating to schema version %d: %w", mig.version, err)
+		}
+	}
+	return nil
+}
+
+// execTx executes the (multi-statement) query in a transaction.
+func execTx(ctx context.Context, conn *sql.Conn, query string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreOSBetaTokens stores the cached beta enrollment tokens, overwriting
+// any existing cached tokens for the DEP name.
+func (s *PSQLStorage) StoreOSBetaTokens(ctx context.Context, tokens *storage.CachedOSBetaTokens) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_osbeta_tokens
+	(dep_name, response, seed_for_it_turned_off, fetched_at)
+VALUES
+	($1, $2, $3, $4)
+ON CONFLICT (dep_name) DO UPDATE
+SET
+	response = EXCLUDED.response,
+	seed_for_it_turned_off = EXCLUDED.seed_for_it_turned_off,
+	fetched_at = EXCLUDED.fetched_at;`,
+		tokens.DEPName,
+		sql.NullString{String: string(tokens.Response), Valid: len(tokens.Response) > 0},
+		tokens.SeedForITTurnedOff,
+		tokens.FetchedAt,
+	)
+	return err
+}
+
+// RetrieveOSBetaTokens retrieves the cached beta enrollment tokens of
+// DEP name.
+func (s *PSQLStorage) RetrieveOSBetaTokens(ctx context.Context, name string) (*storage.CachedOSBetaTokens, error) {
+	tokens := &storage.CachedOSBetaTokens{DEPName: name}
+	var response sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT response, seed_for_it_turned_off, fetched_at FROM dep_osbeta_tokens WHERE dep_name = $1;`,
+		name,
+	).Scan(&response, &tokens.SeedForITTurnedOff, &tokens.FetchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if response.Valid {
+		tokens.Response = []byte(response.String)
+	}
+	tokens.FetchedAt = tokens.FetchedAt.UTC()
+	return tokens, nil
+}
+
+// DeleteOSBetaTokens deletes the cached beta enrollment tokens of DEP name.
+func (s *PSQLStorage) DeleteOSBetaTokens(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM dep_osbeta_tokens WHERE dep_name = $1;`, name)
+	return err
+}
+
+// ListOSBetaTokensNames returns the DEP names that have cached beta
+// enrollment tokens.
+func (s *PSQLStorage) ListOSBetaTokensNames(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT dep_name FROM dep_osbeta_tokens ORDER BY dep_name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
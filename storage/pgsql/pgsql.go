@@ -14,16 +14,28 @@ import (
 	"github.com/micromdm/nanodep/storage/pgsql/sqlc"
 )
 
+// Schema contains the PostgreSQL schema for the DEP storage.
+// It is at schema version [SchemaVersion].
+//
+//go:embed schema.sql
+var Schema string
+
 // PSQL implements storage.AllStorage using PSQL.
 type PSQLStorage struct {
 	db *sql.DB
 	q  *sqlc.Queries
 }
 
+// Ping checks the connection to the database.
+func (s *PSQLStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 type config struct {
-	driver string
-	dsn    string
-	db     *sql.DB
+	driver  string
+	dsn     string
+	db      *sql.DB
+	migrate bool
 }
 
 // Function callback to configure PSQLStorage
@@ -51,6 +63,15 @@ func WithDB(db *sql.DB) Option {
 	}
 }
 
+// WithMigrate sets whether any pending schema migrations are applied
+// when the storage is created. By default they are not and an error is
+// returned if the database schema is older than required.
+func WithMigrate(migrate bool) Option {
+	return func(c *config) {
+		c.migrate = migrate
+	}
+}
+
 // Create a new PSQLStorage instance
 func New(opts ...Option) (*PSQLStorage, error) {
 	cfg := &config{driver: "postgres"}
@@ -68,6 +89,9 @@ func New(opts ...Option) (*PSQLStorage, error) {
 	if err = cfg.db.Ping(); err != nil {
 		return nil, err
 	}
+	if err = migrate(context.Background(), cfg.db, cfg.migrate); err != nil {
+		return nil, err
+	}
 	return &PSQLStorage{db: cfg.db, q: sqlc.New(cfg.db)}, nil
 
 }
@@ -111,7 +135,7 @@ func (s *PSQLStorage) StoreAuthTokens(ctx context.Context, name string, tokens *
 // Returns (nil, nil) if the DEP name does not exist, or if the config
 // for the DEP name does not exist.
 func (s *PSQLStorage) RetrieveConfig(ctx context.Context, name string) (*client.Config, error) {
-	baseURL, err := s.q.GetConfigBaseURL(ctx, name)
+	configRow, err := s.q.GetConfig(ctx, name)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// If the DEP name does not exist, then the config does not exist.
@@ -119,12 +143,13 @@ func (s *PSQLStorage) RetrieveConfig(ctx context.Context, name string) (*client.
 		}
 		return nil, err
 	}
-	if !baseURL.Valid {
+	if !configRow.ConfigBaseUrl.Valid {
 		// If the config_base_url is NULL, then config does not exist.
 		return nil, nil
 	}
 	return &client.Config{
-		BaseURL: baseURL.String,
+		BaseURL:                configRow.ConfigBaseUrl.String,
+		MDMServiceDiscoveryURL: configRow.ConfigMdmServiceDiscoveryUrl.String,
 	}, nil
 }
 
@@ -133,6 +158,10 @@ func (s *PSQLStorage) StoreConfig(ctx context.Context, name string, config *clie
 	return s.q.StoreConfig(ctx, sqlc.StoreConfigParams{
 		Name:          name,
 		ConfigBaseUrl: sql.NullString{String: config.BaseURL, Valid: true},
+		ConfigMdmServiceDiscoveryUrl: sql.NullString{
+			String: config.MDMServiceDiscoveryURL,
+			Valid:  config.MDMServiceDiscoveryURL != "",
+		},
 	})
 }
 
@@ -165,6 +194,26 @@ func (s *PSQLStorage) StoreAssignerProfile(ctx context.Context, name string, pro
 	})
 }
 
+// StoreAssignerProfileAt saves the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp.
+func (s *PSQLStorage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names (
+  name, assigner_profile_uuid,
+  assigner_profile_uuid_at
+) VALUES (
+  $1, $2, $3
+) ON CONFLICT (name) DO UPDATE SET
+assigner_profile_uuid = excluded.assigner_profile_uuid,
+assigner_profile_uuid_at = excluded.assigner_profile_uuid_at;`,
+		name,
+		profileUUID,
+		modTime,
+	)
+	return err
+}
+
 // RetrieveCursor reads the reads the DEP fetch and sync cursor for name (DEP name).
 //
 // Returns an empty cursor if the cursor does not exist.
@@ -241,43 +290,3 @@ func (s *PSQLStorage) RetrieveCurrentTokenPKI(ctx context.Context, name string)
 	}
 	return keypair.TokenpkiCertPem, keypair.TokenpkiKeyPem, nil
 }
-
-// QueryDEPNames queries and returns DEP names.
-func (s *PSQLStorage) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
-	var offset, limit int
-	var err error
-	if req != nil {
-		if req.Pagination != nil && req.Pagination.Cursor != nil {
-			// cursor method not supported for this backend
-			return nil, storage.ErrOnlyOffset
-		}
-		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	ret := new(storage.DEPNamesQueryResult)
-	if req != nil && req.Filter != nil && len(req.Filter.DEPNames) > 0 {
-		params := sqlc.GetDEPNamesParams{
-			DepNames: req.Filter.DEPNames,
-			Limit:    int32(limit),
-			Offset:   int32(offset),
-		}
-		ret.DEPNames, err = s.q.GetDEPNames(ctx, params)
-		if err != nil {
-			return ret, fmt.Errorf("get dep names: %w", err)
-		}
-	} else {
-		params := sqlc.GetAllDEPNamesParams{
-			Limit:  int32(limit),
-			Offset: int32(offset),
-		}
-		ret.DEPNames, err = s.q.GetAllDEPNames(ctx, params)
-		if err != nil {
-			return ret, fmt.Errorf("get all dep names: %w", err)
-		}
-	}
-
-	return ret, nil
-}
@@ -0,0 +1,75 @@
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreProfileTemplate stores template, overwriting any existing template with the same name.
+func (s *PSQLStorage) StoreProfileTemplate(ctx context.Context, template *storage.ProfileTemplate) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO profile_templates
+	(name, template, updated_at)
+VALUES
+	($1, $2, $3)
+ON CONFLICT (name) DO UPDATE
+SET
+	template = EXCLUDED.template,
+	updated_at = EXCLUDED.updated_at;`,
+		template.Name,
+		string(template.Template),
+		template.UpdatedAt,
+	)
+	return err
+}
+
+// RetrieveProfileTemplate retrieves the profile template called name.
+func (s *PSQLStorage) RetrieveProfileTemplate(ctx context.Context, name string) (*storage.ProfileTemplate, error) {
+	template := new(storage.ProfileTemplate)
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT name, template, updated_at FROM profile_templates WHERE name = $1;`,
+		name,
+	).Scan(&template.Name, &template.Template, &template.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	}
+	return template, err
+}
+
+// DeleteProfileTemplate deletes the profile template called name.
+func (s *PSQLStorage) DeleteProfileTemplate(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM profile_templates WHERE name = $1;`, name)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if rows < 1 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// ListProfileTemplates returns the names of all profile templates sorted by name.
+func (s *PSQLStorage) ListProfileTemplates(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM profile_templates ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -1,6 +1,12 @@
 
--- name: GetConfigBaseURL :one
-SELECT config_base_url FROM dep_names WHERE name = $1;
+-- name: GetConfig :one
+SELECT
+  config_base_url,
+  config_mdm_service_discovery_url
+FROM
+  dep_names
+WHERE
+  name = $1;
 
 -- name: GetSyncerCursor :one
 SELECT syncer_cursor FROM dep_names WHERE name = $1;
@@ -71,10 +77,11 @@ INSERT INTO dep_names (
 
 -- name: StoreConfig :exec
 INSERT INTO dep_names (
-  name, config_base_url
-) VALUES ($1, $2) 
+  name, config_base_url, config_mdm_service_discovery_url
+) VALUES ($1, $2, $3)
 ON conflict (name) DO UPDATE SET
-config_base_url = excluded.config_base_url;
+config_base_url = excluded.config_base_url,
+config_mdm_service_discovery_url = excluded.config_mdm_service_discovery_url;
 
 
 -- name: StoreAssignerProfile :exec
@@ -104,16 +111,3 @@ INSERT INTO dep_names (
 ) ON CONFLICT (name) DO UPDATE SET
 tokenpki_staging_cert_pem = excluded.tokenpki_staging_cert_pem,
 tokenpki_staging_key_pem = excluded.tokenpki_staging_key_pem;
-
--- name: GetAllDEPNames :many
-SELECT name FROM dep_names WHERE tokenpki_staging_cert_pem IS NOT NULL LIMIT $1 OFFSET $2;
-
--- name: GetDEPNames :many
-SELECT
-  name
-FROM
-  dep_names
-WHERE
-  tokenpki_staging_cert_pem IS NOT NULL AND
-  name = ANY(sqlc.arg('dep_names')::varchar[])
-LIMIT $1 OFFSET $2;
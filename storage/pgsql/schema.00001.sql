@@ -0,0 +1,19 @@
+CREATE TABLE dep_audit_log (
+    id BIGSERIAL NOT NULL,
+
+    created_at   TIMESTAMPTZ NOT NULL,
+    dep_name     VARCHAR(255) NOT NULL,
+    method       VARCHAR(16) NOT NULL,
+    endpoint     VARCHAR(255) NOT NULL,
+    identity     VARCHAR(255) NULL,
+    client_ip    VARCHAR(64) NULL,
+    -- JSON array of device serial numbers
+    serials      TEXT NULL,
+    profile_uuid VARCHAR(255) NULL,
+    status       INTEGER NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX dep_audit_log_dep_name_created_at_idx ON dep_audit_log (dep_name, created_at);
+CREATE INDEX dep_audit_log_created_at_idx ON dep_audit_log (created_at);
@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+    name        VARCHAR(255) NOT NULL,
+    -- hex-encoded SHA-256 hash of the API key secret
+    secret_hash CHAR(64) NOT NULL,
+    -- JSON array of scopes
+    scopes      TEXT NOT NULL,
+    -- JSON array of permitted DEP names (all if NULL)
+    dep_names   TEXT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (name)
+);
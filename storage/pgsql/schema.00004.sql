@@ -0,0 +1,18 @@
+-- Allow token PKI private keys encrypted by the envelope storage wrapper.
+-- The original CHECK was unnamed so its generated name is looked up.
+DO $$
+DECLARE
+    chk name;
+BEGIN
+    SELECT conname INTO chk FROM pg_constraint
+    WHERE conrelid = 'dep_names'::regclass
+        AND contype = 'c'
+        AND pg_get_constraintdef(oid) LIKE '%tokenpki_key_pem%';
+    IF chk IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE dep_names DROP CONSTRAINT %I', chk);
+    END IF;
+END
+$$;
+
+ALTER TABLE dep_names ADD CONSTRAINT dep_names_tokenpki_key_pem_check
+    CHECK (tokenpki_key_pem IS NULL OR SUBSTRING(tokenpki_key_pem FROM 1 FOR 5) = '-----' OR SUBSTRING(tokenpki_key_pem FROM 1 FOR 12) = 'nanodep-enc:');
@@ -0,0 +1,16 @@
+CREATE TABLE dep_history (
+    id BIGSERIAL NOT NULL,
+
+    created_at     TIMESTAMPTZ NOT NULL,
+    dep_name       VARCHAR(255) NOT NULL,
+    -- tokens, config, or assigner
+    kind           VARCHAR(16) NOT NULL,
+    actor          VARCHAR(255) NULL,
+    -- JSON values before and after the change (secrets redacted)
+    previous_value TEXT NULL,
+    value          TEXT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX dep_history_dep_name_kind_id_idx ON dep_history (dep_name, kind, id);
@@ -0,0 +1,11 @@
+CREATE TABLE dep_bypass_codes (
+    dep_name      VARCHAR(255) NOT NULL,
+    serial_number VARCHAR(64) NOT NULL,
+
+    -- Activation Lock bypass code (a secret)
+    bypass_code   TEXT NOT NULL,
+
+    created_at    TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (dep_name, serial_number)
+);
@@ -0,0 +1 @@
+ALTER TABLE dep_names ADD COLUMN config_mdm_service_discovery_url TEXT NULL;
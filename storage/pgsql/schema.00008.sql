@@ -0,0 +1,11 @@
+CREATE TABLE dep_osbeta_tokens (
+    dep_name VARCHAR(255) NOT NULL,
+
+    -- JSON DEP API response
+    response               TEXT NULL,
+    seed_for_it_turned_off BOOLEAN NOT NULL DEFAULT FALSE,
+
+    fetched_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (dep_name)
+);
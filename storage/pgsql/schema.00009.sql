@@ -0,0 +1,6 @@
+ALTER TABLE dep_names
+    ADD COLUMN account_server_uuid VARCHAR(255) NULL,
+    ADD COLUMN account_detail      TEXT NULL,
+    ADD COLUMN account_detail_at   TIMESTAMPTZ NULL;
+
+CREATE INDEX dep_names_account_server_uuid_idx ON dep_names (account_server_uuid);
@@ -0,0 +1 @@
+ALTER TABLE dep_audit_log ADD COLUMN dry_run BOOLEAN NOT NULL DEFAULT FALSE;
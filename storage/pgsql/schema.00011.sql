@@ -0,0 +1,2 @@
+-- codes devices are being Activation Locked with before Apple confirms them
+ALTER TABLE dep_bypass_codes ADD COLUMN pending_code TEXT NULL;
@@ -9,8 +9,14 @@ CREATE TABLE dep_names (
 	access_secret       TEXT NULL,
 	access_token_expiry TIMESTAMPTZ NULL,
 
+    -- Account detail fetched with the OAuth1 tokens
+    account_server_uuid VARCHAR(255) NULL,
+    account_detail      TEXT NULL,
+    account_detail_at   TIMESTAMPTZ NULL,
+
     -- Config
-    config_base_url VARCHAR(255) NULL,
+    config_base_url                  VARCHAR(255) NULL,
+    config_mdm_service_discovery_url TEXT NULL,
 
     -- Token PKI
     tokenpki_cert_pem         TEXT NULL,
@@ -32,9 +38,12 @@ CREATE TABLE dep_names (
     PRIMARY KEY (name),
 
     CHECK (tokenpki_cert_pem IS NULL OR SUBSTRING(tokenpki_cert_pem FROM 1 FOR 27) = '-----BEGIN CERTIFICATE-----'),
-    CHECK (tokenpki_key_pem IS NULL OR SUBSTRING(tokenpki_key_pem FROM 1 FOR  5) = '-----')
+    CONSTRAINT dep_names_tokenpki_key_pem_check
+        CHECK (tokenpki_key_pem IS NULL OR SUBSTRING(tokenpki_key_pem FROM 1 FOR  5) = '-----' OR SUBSTRING(tokenpki_key_pem FROM 1 FOR 12) = 'nanodep-enc:')
 );
 
+CREATE INDEX dep_names_account_server_uuid_idx ON dep_names (account_server_uuid);
+
 
 CREATE  FUNCTION update_updated_at()
 RETURNS TRIGGER AS $$
@@ -50,3 +59,102 @@ CREATE TRIGGER update_updated_at_on_change
         dep_names
     FOR EACH ROW
 EXECUTE PROCEDURE update_updated_at();
+
+
+CREATE TABLE dep_audit_log (
+    id BIGSERIAL NOT NULL,
+
+    created_at   TIMESTAMPTZ NOT NULL,
+    dep_name     VARCHAR(255) NOT NULL,
+    method       VARCHAR(16) NOT NULL,
+    endpoint     VARCHAR(255) NOT NULL,
+    identity     VARCHAR(255) NULL,
+    client_ip    VARCHAR(64) NULL,
+    -- JSON array of device serial numbers
+    serials      TEXT NULL,
+    profile_uuid VARCHAR(255) NULL,
+    status       INTEGER NOT NULL,
+    dry_run      BOOLEAN NOT NULL DEFAULT FALSE,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX dep_audit_log_dep_name_created_at_idx ON dep_audit_log (dep_name, created_at);
+CREATE INDEX dep_audit_log_created_at_idx ON dep_audit_log (created_at);
+
+CREATE TABLE api_keys (
+    name        VARCHAR(255) NOT NULL,
+    -- hex-encoded SHA-256 hash of the API key secret
+    secret_hash CHAR(64) NOT NULL,
+    -- JSON array of scopes
+    scopes      TEXT NOT NULL,
+    -- JSON array of permitted DEP names (all if NULL)
+    dep_names   TEXT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE profile_templates (
+    name     VARCHAR(255) NOT NULL,
+    -- DEP profile JSON with optional ${VARIABLE} placeholders
+    template TEXT NOT NULL,
+
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE dep_history (
+    id BIGSERIAL NOT NULL,
+
+    created_at     TIMESTAMPTZ NOT NULL,
+    dep_name       VARCHAR(255) NOT NULL,
+    -- tokens, config, or assigner
+    kind           VARCHAR(16) NOT NULL,
+    actor          VARCHAR(255) NULL,
+    -- JSON values before and after the change (secrets redacted)
+    previous_value TEXT NULL,
+    value          TEXT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX dep_history_dep_name_kind_id_idx ON dep_history (dep_name, kind, id);
+
+CREATE TABLE dep_bypass_codes (
+    dep_name      VARCHAR(255) NOT NULL,
+    serial_number VARCHAR(64) NOT NULL,
+
+    -- Activation Lock bypass code (a secret)
+    bypass_code   TEXT NOT NULL,
+    -- unconfirmed bypass code the device is being locked with (a secret)
+    pending_code  TEXT NULL,
+
+    created_at    TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (dep_name, serial_number)
+);
+
+CREATE TABLE dep_osbeta_tokens (
+    dep_name VARCHAR(255) NOT NULL,
+
+    -- JSON DEP API response
+    response               TEXT NULL,
+    seed_for_it_turned_off BOOLEAN NOT NULL DEFAULT FALSE,
+
+    fetched_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (dep_name)
+);
+
+CREATE TABLE schema_version (
+    version    INTEGER NOT NULL,
+    applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (version)
+);
+
+-- must match the latest schema.NNNNN.sql migration
+INSERT INTO schema_version (version) VALUES (11);
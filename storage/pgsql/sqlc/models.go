@@ -9,20 +9,21 @@ import (
 )
 
 type DepName struct {
-	Name                   string
-	ConsumerKey            sql.NullString
-	ConsumerSecret         sql.NullString
-	AccessToken            sql.NullString
-	AccessSecret           sql.NullString
-	AccessTokenExpiry      sql.NullTime
-	ConfigBaseUrl          sql.NullString
-	TokenpkiCertPem        []byte
-	TokenpkiKeyPem         []byte
-	TokenpkiStagingCertPem []byte
-	TokenpkiStagingKeyPem  []byte
-	SyncerCursor           sql.NullString
-	AssignerProfileUuid    sql.NullString
-	AssignerProfileUuidAt  sql.NullTime
-	CreatedAt              sql.NullTime
-	UpdatedAt              sql.NullTime
+	Name                         string
+	ConsumerKey                  sql.NullString
+	ConsumerSecret               sql.NullString
+	AccessToken                  sql.NullString
+	AccessSecret                 sql.NullString
+	AccessTokenExpiry            sql.NullTime
+	ConfigBaseUrl                sql.NullString
+	ConfigMdmServiceDiscoveryUrl sql.NullString
+	TokenpkiCertPem              []byte
+	TokenpkiKeyPem               []byte
+	TokenpkiStagingCertPem       []byte
+	TokenpkiStagingKeyPem        []byte
+	SyncerCursor                 sql.NullString
+	AssignerProfileUuid          sql.NullString
+	AssignerProfileUuidAt        sql.NullTime
+	CreatedAt                    sql.NullTime
+	UpdatedAt                    sql.NullTime
 }
@@ -8,42 +8,8 @@ package sqlc
 import (
 	"context"
 	"database/sql"
-
-	"github.com/lib/pq"
 )
 
-const getAllDEPNames = `-- name: GetAllDEPNames :many
-SELECT name FROM dep_names WHERE tokenpki_staging_cert_pem IS NOT NULL LIMIT $1 OFFSET $2
-`
-
-type GetAllDEPNamesParams struct {
-	Limit  int32
-	Offset int32
-}
-
-func (q *Queries) GetAllDEPNames(ctx context.Context, arg GetAllDEPNamesParams) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, getAllDEPNames, arg.Limit, arg.Offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		items = append(items, name)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
 const getAssignerProfile = `-- name: GetAssignerProfile :one
 SELECT
   assigner_profile_uuid,
@@ -100,15 +66,26 @@ func (q *Queries) GetAuthTokens(ctx context.Context, name string) (GetAuthTokens
 	return i, err
 }
 
-const getConfigBaseURL = `-- name: GetConfigBaseURL :one
-SELECT config_base_url FROM dep_names WHERE name = $1
+const getConfig = `-- name: GetConfig :one
+SELECT
+  config_base_url,
+  config_mdm_service_discovery_url
+FROM
+  dep_names
+WHERE
+  name = $1
 `
 
-func (q *Queries) GetConfigBaseURL(ctx context.Context, name string) (sql.NullString, error) {
-	row := q.db.QueryRowContext(ctx, getConfigBaseURL, name)
-	var config_base_url sql.NullString
-	err := row.Scan(&config_base_url)
-	return config_base_url, err
+type GetConfigRow struct {
+	ConfigBaseUrl                sql.NullString
+	ConfigMdmServiceDiscoveryUrl sql.NullString
+}
+
+func (q *Queries) GetConfig(ctx context.Context, name string) (GetConfigRow, error) {
+	row := q.db.QueryRowContext(ctx, getConfig, name)
+	var i GetConfigRow
+	err := row.Scan(&i.ConfigBaseUrl, &i.ConfigMdmServiceDiscoveryUrl)
+	return i, err
 }
 
 const getCurrentKeypair = `-- name: GetCurrentKeypair :one
@@ -133,46 +110,6 @@ func (q *Queries) GetCurrentKeypair(ctx context.Context, name string) (GetCurren
 	return i, err
 }
 
-const getDEPNames = `-- name: GetDEPNames :many
-SELECT
-  name
-FROM
-  dep_names
-WHERE
-  tokenpki_staging_cert_pem IS NOT NULL AND
-  name = ANY($3::varchar[])
-LIMIT $1 OFFSET $2
-`
-
-type GetDEPNamesParams struct {
-	Limit    int32
-	Offset   int32
-	DepNames []string
-}
-
-func (q *Queries) GetDEPNames(ctx context.Context, arg GetDEPNamesParams) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, getDEPNames, arg.Limit, arg.Offset, pq.Array(arg.DepNames))
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		items = append(items, name)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
 const getStagingKeypair = `-- name: GetStagingKeypair :one
 SELECT
   tokenpki_staging_cert_pem,
@@ -265,19 +202,21 @@ func (q *Queries) StoreAuthTokens(ctx context.Context, arg StoreAuthTokensParams
 
 const storeConfig = `-- name: StoreConfig :exec
 INSERT INTO dep_names (
-  name, config_base_url
-) VALUES ($1, $2) 
+  name, config_base_url, config_mdm_service_discovery_url
+) VALUES ($1, $2, $3)
 ON conflict (name) DO UPDATE SET
-config_base_url = excluded.config_base_url
+config_base_url = excluded.config_base_url,
+config_mdm_service_discovery_url = excluded.config_mdm_service_discovery_url
 `
 
 type StoreConfigParams struct {
-	Name          string
-	ConfigBaseUrl sql.NullString
+	Name                         string
+	ConfigBaseUrl                sql.NullString
+	ConfigMdmServiceDiscoveryUrl sql.NullString
 }
 
 func (q *Queries) StoreConfig(ctx context.Context, arg StoreConfigParams) error {
-	_, err := q.db.ExecContext(ctx, storeConfig, arg.Name, arg.ConfigBaseUrl)
+	_, err := q.db.ExecContext(ctx, storeConfig, arg.Name, arg.ConfigBaseUrl, arg.ConfigMdmServiceDiscoveryUrl)
 	return err
 }
 
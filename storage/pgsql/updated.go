@@ -0,0 +1,32 @@
+package pgsql
+
+import (
+	"context"
+	"time"
+)
+
+// QueryDEPNamesUpdatedSince returns the DEP names updated at or after since.
+func (s *PSQLStorage) QueryDEPNamesUpdatedSince(ctx context.Context, since time.Time) ([]string, time.Time, error) {
+	var now time.Time
+	if err := s.db.QueryRowContext(ctx, `SELECT CURRENT_TIMESTAMP;`).Scan(&now); err != nil {
+		return nil, time.Time{}, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT name FROM dep_names WHERE updated_at >= $1 ORDER BY name;`,
+		since,
+	)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, time.Time{}, err
+		}
+		names = append(names, name)
+	}
+	return names, now.UTC(), rows.Err()
+}
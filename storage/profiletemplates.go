@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ProfileTemplate is a named DEP profile JSON template.
+type ProfileTemplate struct {
+	Name string `json:"name"`
+
+	// Template is the DEP profile JSON which may contain "${VARIABLE}"
+	// placeholders to be substituted when defining the profile.
+	Template []byte `json:"template"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProfileTemplateStorer stores and retrieves DEP profile templates.
+type ProfileTemplateStorer interface {
+	// StoreProfileTemplate stores template, overwriting any existing
+	// template with the same name.
+	StoreProfileTemplate(ctx context.Context, template *ProfileTemplate) error
+
+	// RetrieveProfileTemplate retrieves the profile template called name.
+	// [ErrNotFound] is returned if the template does not exist.
+	RetrieveProfileTemplate(ctx context.Context, name string) (*ProfileTemplate, error)
+
+	// DeleteProfileTemplate deletes the profile template called name.
+	// [ErrNotFound] is returned if the template does not exist.
+	DeleteProfileTemplate(ctx context.Context, name string) error
+
+	// ListProfileTemplates returns the names of all profile templates sorted by name.
+	ListProfileTemplates(ctx context.Context) ([]string, error)
+}
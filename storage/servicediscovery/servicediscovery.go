@@ -0,0 +1,103 @@
+// Package servicediscovery provides a storage wrapper that re-applies
+// the account-driven enrollment MDM service discovery URL of DEP names
+// when their OAuth tokens are renewed.
+package servicediscovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+// Assigner assigns the account-driven enrollment profile of a DEP name.
+type Assigner interface {
+	AssignAccountDrivenEnrollmentProfile(ctx context.Context, name string, mdmServiceDiscoveryURL string) error
+}
+
+// Storage wraps storage.AllStorage and re-applies the MDM service
+// discovery URL of a DEP name when its OAuth tokens are stored.
+type Storage struct {
+	storage.AllStorage
+	assigner Assigner
+	logger   log.Logger
+}
+
+// Option configures the service discovery storage.
+type Option func(*Storage)
+
+// WithLogger sets the logger.
+func WithLogger(logger log.Logger) Option {
+	return func(s *Storage) {
+		s.logger = logger
+	}
+}
+
+// New creates a new Storage that uses assigner to re-apply the MDM
+// service discovery URL of DEP names stored in store.
+func New(store storage.AllStorage, assigner Assigner, opts ...Option) *Storage {
+	s := &Storage{
+		AllStorage: store,
+		assigner:   assigner,
+		logger:     log.NopLogger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// StoreAuthTokens stores the OAuth tokens for name (DEP name) and then
+// assigns the MDM service discovery URL from the config of name, if any.
+// Failing to assign the URL is logged but is not an error as the tokens
+// have already been stored.
+func (s *Storage) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
+	if err := s.AllStorage.StoreAuthTokens(ctx, name, tokens); err != nil {
+		return err
+	}
+	logger := ctxlog.Logger(ctx, s.logger).With("name", name)
+	if applied, err := s.reapply(ctx, name); err != nil {
+		logger.Info("msg", "re-applying MDM service discovery URL", "err", err)
+	} else if applied {
+		logger.Debug("msg", "re-applied MDM service discovery URL")
+	}
+	return nil
+}
+
+// reapply assigns the MDM service discovery URL from the config of name.
+// Reports whether a URL was assigned.
+func (s *Storage) reapply(ctx context.Context, name string) (bool, error) {
+	config, err := s.AllStorage.RetrieveConfig(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("retrieving config: %w", err)
+	}
+	if config == nil || config.MDMServiceDiscoveryURL == "" {
+		return false, nil
+	}
+	if err = s.assigner.AssignAccountDrivenEnrollmentProfile(ctx, name, config.MDMServiceDiscoveryURL); err != nil {
+		return false, fmt.Errorf("assigning account-driven enrollment profile: %w", err)
+	}
+	return true, nil
+}
+
+// Ping pings the wrapped storage.
+func (s *Storage) Ping(ctx context.Context) error {
+	return storage.Ping(ctx, s.AllStorage)
+}
+
+// ListDEPNames lists all DEP names of the wrapped storage.
+func (s *Storage) ListDEPNames(ctx context.Context) ([]string, error) {
+	return storage.ListDEPNames(ctx, s.AllStorage)
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp if the wrapped storage supports it.
+// Otherwise the current time is used.
+func (s *Storage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	return storage.StoreAssignerProfileAt(ctx, s.AllStorage, name, profileUUID, modTime)
+}
@@ -0,0 +1,104 @@
+package servicediscovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage"
+	"github.com/micromdm/nanodep/storage/inmem"
+	"github.com/micromdm/nanodep/storage/test"
+)
+
+type fakeAssigner struct {
+	urls map[string]string
+	err  error
+}
+
+func (f *fakeAssigner) AssignAccountDrivenEnrollmentProfile(_ context.Context, name string, url string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.urls == nil {
+		f.urls = make(map[string]string)
+	}
+	f.urls[name] = url
+	return nil
+}
+
+func TestServiceDiscoveryStorage(t *testing.T) {
+	test.TestWithStorages(t, context.Background(), New(inmem.New(), &fakeAssigner{}))
+}
+
+func TestReapply(t *testing.T) {
+	ctx := context.Background()
+	assigner := &fakeAssigner{}
+	s := New(inmem.New(), assigner)
+	const url = "https://mdm.example.com/.well-known/com.apple.remotemanagement"
+
+	tokens := &client.OAuth1Tokens{
+		ConsumerKey:       "CK_0123456789abcdef",
+		ConsumerSecret:    "CS_secret",
+		AccessToken:       "AT_token",
+		AccessSecret:      "AS_secret",
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	// no config: nothing to re-apply
+	if err := s.StoreAuthTokens(ctx, "a", tokens); err != nil {
+		t.Fatal(err)
+	}
+	if len(assigner.urls) > 0 {
+		t.Errorf("unexpected assignment: %v", assigner.urls)
+	}
+
+	if err := s.StoreConfig(ctx, "b", &client.Config{MDMServiceDiscoveryURL: url}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreAuthTokens(ctx, "b", tokens); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := assigner.urls["b"], url; have != want {
+		t.Errorf("url: have %q, want %q", have, want)
+	}
+
+	// failing to re-apply does not fail storing the tokens
+	assigner.err = errors.New("assign error")
+	if err := s.StoreAuthTokens(ctx, "b", tokens); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	ctx := context.Background()
+	var s any = New(inmem.New(), &fakeAssigner{})
+
+	pinger, ok := s.(storage.Pinger)
+	if !ok {
+		t.Fatal("storage does not implement storage.Pinger")
+	}
+	if err := pinger.Ping(ctx); err != nil {
+		t.Error(err)
+	}
+
+	ts, ok := s.(storage.AssignerProfileTimestampStorer)
+	if !ok {
+		t.Fatal("storage does not implement storage.AssignerProfileTimestampStorer")
+	}
+	modTime := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if err := ts.StoreAssignerProfileAt(ctx, "a", "profile", modTime); err != nil {
+		t.Fatal(err)
+	}
+	profileUUID, haveModTime, err := s.(storage.AllStorage).RetrieveAssignerProfile(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := profileUUID, "profile"; have != want {
+		t.Errorf("profile UUID: have %q, want %q", have, want)
+	}
+	if !haveModTime.Equal(modTime) {
+		t.Errorf("mod time: have %v, want %v", haveModTime, modTime)
+	}
+}
@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// parseNullTimestamp parses a nullable timestamp column.
+func parseNullTimestamp(ts sql.NullString) (*time.Time, error) {
+	if !ts.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(timestampFormat, ts.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// QueryDEPNames queries and returns DEP names and their details.
+// [ErrOnlyOffset] is returned if cursor pagination is attempted.
+// A default limit of 100 results is returned.
+// Without filters other than DEP names a DEP name needs to have a staged
+// (uploaded) certificate to be query-able.
+func (s *SQLiteStorage) QueryDEPNames(ctx context.Context, req *storage.DEPNamesQueryRequest) (*storage.DEPNamesQueryResult, error) {
+	offset, limit := 0, 100
+	var err error
+	var filter *storage.DEPNamesQueryFilter
+	if req != nil {
+		if req.Pagination != nil && req.Pagination.Cursor != nil {
+			// cursor method not supported for this backend
+			return nil, storage.ErrOnlyOffset
+		}
+		_, offset, limit, err = req.Pagination.ValidateDefaultOffsetLimit(100)
+		if err != nil {
+			return nil, err
+		}
+		filter = req.Filter
+	}
+
+	var where []string
+	if !filter.IncludesUnstaged() {
+		where = append(where, "tokenpki_staging_cert_pem IS NOT NULL")
+	}
+	var args []interface{}
+	if filter != nil {
+		if len(filter.DEPNames) > 0 {
+			where = append(where, "name IN ("+strings.Repeat(",?", len(filter.DEPNames))[1:]+")")
+			for _, name := range filter.DEPNames {
+				args = append(args, name)
+			}
+		}
+		if filter.HasTokens != nil {
+			if *filter.HasTokens {
+				where = append(where, "consumer_key IS NOT NULL")
+			} else {
+				where = append(where, "consumer_key IS NULL")
+			}
+		}
+		if filter.ExpiringBefore != nil {
+			where = append(where, "access_token_expiry < ?")
+			args = append(args, filter.ExpiringBefore.UTC().Format(timestampFormat))
+		}
+		if filter.BaseURL != nil {
+			where = append(where, "COALESCE(config_base_url, '') = ?")
+			args = append(args, *filter.BaseURL)
+		}
+		if filter.NamePrefix != "" {
+			// SQLite LIKE is case-insensitive so compare the prefix instead
+			where = append(where, "SUBSTR(name, 1, LENGTH(?)) = ?")
+			args = append(args, filter.NamePrefix, filter.NamePrefix)
+		}
+	}
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(
+		ctx, `
+SELECT
+  name,
+  consumer_key,
+  access_token_expiry,
+  config_base_url,
+  tokenpki_staging_cert_pem,
+  tokenpki_cert_pem,
+  assigner_profile_uuid,
+  assigner_profile_uuid_at,
+  syncer_cursor,
+  created_at,
+  updated_at
+FROM
+  dep_names
+WHERE
+  `+strings.Join(where, " AND\n  ")+`
+ORDER BY name
+LIMIT ? OFFSET ?;`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query dep names: %w", err)
+	}
+	defer rows.Close()
+
+	ret := new(storage.DEPNamesQueryResult)
+	for rows.Next() {
+		var d storage.DEPNameDetails
+		var consumerKey, expiry, baseURL, stagingCert, cert, profileUUID, profileUUIDAt, cursor, createdAt, updatedAt sql.NullString
+		err = rows.Scan(
+			&d.Name,
+			&consumerKey,
+			&expiry,
+			&baseURL,
+			&stagingCert,
+			&cert,
+			&profileUUID,
+			&profileUUIDAt,
+			&cursor,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if consumerKey.Valid {
+			d.HasTokens = true
+			d.SetConsumerKey(consumerKey.String)
+		}
+		d.BaseURL = baseURL.String
+		d.SetTokenPKI(true, []byte(stagingCert.String))
+		d.SetTokenPKI(false, []byte(cert.String))
+		d.AssignerProfileUUID = profileUUID.String
+		d.HasCursor = cursor.String != ""
+		for _, ts := range []struct {
+			dst **time.Time
+			src sql.NullString
+		}{
+			{&d.AccessTokenExpiry, expiry},
+			{&d.AssignerProfileUUIDAt, profileUUIDAt},
+			{&d.CreatedAt, createdAt},
+			{&d.UpdatedAt, updatedAt},
+		} {
+			if *ts.dst, err = parseNullTimestamp(ts.src); err != nil {
+				return nil, err
+			}
+		}
+		ret.DEPNames = append(ret.DEPNames, d)
+	}
+	return ret, rows.Err()
+}
+
+// ListDEPNames returns the sorted names of all DEP names.
+func (s *SQLiteStorage) ListDEPNames(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM dep_names ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreBypassCode stores the escrowed bypass code, overwriting any
+// existing code for the device.
+func (s *SQLiteStorage) StoreBypassCode(ctx context.Context, escrow *storage.EscrowedBypassCode) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_bypass_codes
+	(dep_name, serial_number, bypass_code, pending_code, created_at)
+VALUES
+	(?, ?, ?, ?, ?)
+ON CONFLICT (dep_name, serial_number) DO UPDATE SET
+	bypass_code = excluded.bypass_code,
+	pending_code = excluded.pending_code,
+	created_at = excluded.created_at;`,
+		escrow.DEPName,
+		escrow.Serial,
+		escrow.Code,
+		sql.NullString{String: escrow.PendingCode, Valid: escrow.PendingCode != ""},
+		escrow.CreatedAt.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
+// RetrieveBypassCode retrieves the escrowed bypass code of the device
+// with serial of DEP name.
+func (s *SQLiteStorage) RetrieveBypassCode(ctx context.Context, name, serial string) (*storage.EscrowedBypassCode, error) {
+	escrow := &storage.EscrowedBypassCode{DEPName: name, Serial: serial}
+	var pendingCode sql.NullString
+	var createdAt string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT bypass_code, pending_code, created_at FROM dep_bypass_codes WHERE dep_name = ? AND serial_number = ?;`,
+		name, serial,
+	).Scan(&escrow.Code, &pendingCode, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	escrow.PendingCode = pendingCode.String
+	escrow.CreatedAt, err = time.Parse(timestampFormat, createdAt)
+	return escrow, err
+}
+
+// ListBypassCodeSerials returns the sorted serial numbers of the devices
+// of DEP name with escrowed bypass codes.
+func (s *SQLiteStorage) ListBypassCodeSerials(ctx context.Context, name string) ([]string, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT serial_number FROM dep_bypass_codes WHERE dep_name = ? ORDER BY serial_number;`,
+		name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []string
+	for rows.Next() {
+		var serial string
+		if err = rows.Scan(&serial); err != nil {
+			return nil, err
+		}
+		ret = append(ret, serial)
+	}
+	return ret, rows.Err()
+}
+
+// DeleteBypassCode deletes the escrowed bypass code of the device with
+// serial of DEP name.
+func (s *SQLiteStorage) DeleteBypassCode(ctx context.Context, name, serial string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM dep_bypass_codes WHERE dep_name = ? AND serial_number = ?;`,
+		name, serial,
+	)
+	return err
+}
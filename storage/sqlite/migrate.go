@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations contains the schema migrations. Each file is named for the
+// schema version it migrates to, e.g. "00002.sql" migrates from version 1
+// to version 2. Migrations must never be changed once released.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migration is a single embedded schema migration.
+type migration struct {
+	version int
+	sql     string
+}
+
+// loadMigrations returns the embedded migrations sorted by version.
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var ret []migration
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(path.Base(file), ".sql"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name: %s", file)
+		}
+		b, err := migrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, migration{version: version, sql: string(b)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].version < ret[j].version })
+	for i, m := range ret {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("missing migration for schema version %d", i+1)
+		}
+	}
+	return ret, nil
+}
+
+// SchemaVersion returns the schema version of the embedded migrations.
+func SchemaVersion() int {
+	m, err := loadMigrations()
+	if err != nil {
+		return 0
+	}
+	return len(m)
+}
+
+// currentVersion returns the schema version of the database.
+// Version 0 means no schema exists.
+func currentVersion(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}) (int, error) {
+	var version int
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version;`).Scan(&version)
+	return version, err
+}
+
+// migrate applies any embedded migrations newer than the schema version
+// of the database if apply is true, otherwise an error is returned if
+// there are any. Each migration is applied in its own transaction.
+// An error is returned if the database schema is newer than the
+// embedded migrations.
+func migrate(ctx context.Context, db *sql.DB, apply bool) error {
+	m, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	var version int
+	if apply {
+		_, err = db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version    INTEGER NOT NULL PRIMARY KEY,
+    applied_at TEXT DEFAULT CURRENT_TIMESTAMP
+);`)
+		if err != nil {
+			return fmt.Errorf("creating schema_version table: %w", err)
+		}
+		version, err = currentVersion(ctx, db)
+	} else {
+		var n int
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version';`).Scan(&n)
+		if err == nil && n > 0 {
+			version, err = currentVersion(ctx, db)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version > len(m) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(m))
+	}
+	if !apply && version < len(m) {
+		return fmt.Errorf("database schema version %d is older than required version %d (remove the migrate=false option to migrate)", version, len(m))
+	}
+	for _, mig := range m[version:] {
+		if err = applyMigration(ctx, db, mig); err != nil {
+			return fmt.Errorf("migrating to schema version %d: %w", mig.version, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies mig in a transaction. The schema version is checked
+// again inside the transaction in case another process migrated first.
+func applyMigration(ctx context.Context, db *sql.DB, mig migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	version, err := currentVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if version >= mig.version {
+		return nil
+	}
+	if _, err = tx.ExecContext(ctx, mig.sql); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?);`, mig.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
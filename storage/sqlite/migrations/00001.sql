@@ -0,0 +1,87 @@
+-- Timestamps are TEXT columns in "YYYY-MM-DD HH:MM:SS" (UTC) format, the
+-- same format as CURRENT_TIMESTAMP. They are not declared as TIMESTAMP so
+-- that the driver returns them unchanged.
+
+CREATE TABLE dep_names (
+    name TEXT NOT NULL,
+
+    -- OAuth1 Tokens
+    consumer_key        TEXT NULL,
+    consumer_secret     TEXT NULL,
+    access_token        TEXT NULL,
+    access_secret       TEXT NULL,
+    access_token_expiry TEXT NULL,
+
+    -- Config
+    config_base_url TEXT NULL,
+
+    -- Token PKI
+    tokenpki_cert_pem         TEXT NULL,
+    tokenpki_key_pem          TEXT NULL,
+    tokenpki_staging_cert_pem TEXT NULL,
+    tokenpki_staging_key_pem  TEXT NULL,
+
+    -- Syncer
+    -- From Apple docs: "The string can be up to 1000 characters".
+    syncer_cursor TEXT NULL,
+
+    -- Assigner
+    assigner_profile_uuid    TEXT NULL,
+    assigner_profile_uuid_at TEXT NULL,
+
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (name),
+
+    CHECK (tokenpki_cert_pem IS NULL OR SUBSTR(tokenpki_cert_pem, 1, 27) = '-----BEGIN CERTIFICATE-----'),
+    CHECK (tokenpki_key_pem IS NULL OR SUBSTR(tokenpki_key_pem, 1, 5) = '-----' OR SUBSTR(tokenpki_key_pem, 1, 12) = 'nanodep-enc:')
+);
+
+CREATE TRIGGER dep_names_updated_at AFTER UPDATE ON dep_names
+FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE dep_names SET updated_at = CURRENT_TIMESTAMP WHERE name = NEW.name;
+END;
+
+CREATE TABLE dep_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+    created_at   TEXT NOT NULL,
+    dep_name     TEXT NOT NULL,
+    method       TEXT NOT NULL,
+    endpoint     TEXT NOT NULL,
+    identity     TEXT NULL,
+    client_ip    TEXT NULL,
+    -- JSON array of device serial numbers
+    serials      TEXT NULL,
+    profile_uuid TEXT NULL,
+    status       INTEGER NOT NULL
+);
+
+CREATE INDEX dep_audit_log_dep_name_created_at ON dep_audit_log (dep_name, created_at);
+CREATE INDEX dep_audit_log_created_at ON dep_audit_log (created_at);
+
+CREATE TABLE api_keys (
+    name        TEXT NOT NULL,
+    -- hex-encoded SHA-256 hash of the API key secret
+    secret_hash TEXT NOT NULL,
+    -- JSON array of scopes
+    scopes      TEXT NOT NULL,
+    -- JSON array of permitted DEP names (all if NULL)
+    dep_names   TEXT NULL,
+
+    created_at TEXT NOT NULL,
+
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE profile_templates (
+    name     TEXT NOT NULL,
+    -- DEP profile JSON with optional ${VARIABLE} placeholders
+    template TEXT NOT NULL,
+
+    updated_at TEXT NOT NULL,
+
+    PRIMARY KEY (name)
+);
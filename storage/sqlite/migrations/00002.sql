@@ -0,0 +1,14 @@
+CREATE TABLE dep_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+
+    created_at     TEXT NOT NULL,
+    dep_name       TEXT NOT NULL,
+    -- tokens, config, or assigner
+    kind           TEXT NOT NULL,
+    actor          TEXT NULL,
+    -- JSON values before and after the change (secrets redacted)
+    previous_value TEXT NULL,
+    value          TEXT NULL
+);
+
+CREATE INDEX dep_history_dep_name_kind_id ON dep_history (dep_name, kind, id);
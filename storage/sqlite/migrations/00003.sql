@@ -0,0 +1,11 @@
+CREATE TABLE dep_bypass_codes (
+    dep_name      TEXT NOT NULL,
+    serial_number TEXT NOT NULL,
+
+    -- Activation Lock bypass code (a secret)
+    bypass_code   TEXT NOT NULL,
+
+    created_at    TEXT NOT NULL,
+
+    PRIMARY KEY (dep_name, serial_number)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE dep_osbeta_tokens (
+    dep_name TEXT NOT NULL,
+
+    -- JSON DEP API response
+    response               TEXT NULL,
+    seed_for_it_turned_off INTEGER NOT NULL DEFAULT 0,
+
+    fetched_at TEXT NOT NULL,
+
+    PRIMARY KEY (dep_name)
+);
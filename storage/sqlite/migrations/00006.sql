@@ -0,0 +1,5 @@
+ALTER TABLE dep_names ADD COLUMN account_server_uuid TEXT NULL;
+ALTER TABLE dep_names ADD COLUMN account_detail TEXT NULL;
+ALTER TABLE dep_names ADD COLUMN account_detail_at TEXT NULL;
+
+CREATE INDEX dep_names_account_server_uuid ON dep_names (account_server_uuid);
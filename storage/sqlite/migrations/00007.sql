@@ -0,0 +1 @@
+ALTER TABLE dep_audit_log ADD COLUMN dry_run INTEGER NOT NULL DEFAULT 0;
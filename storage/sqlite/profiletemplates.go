@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/micromdm/nanodep/storage"
+)
+
+// StoreProfileTemplate stores template, overwriting any existing template with the same name.
+func (s *SQLiteStorage) StoreProfileTemplate(ctx context.Context, template *storage.ProfileTemplate) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO profile_templates
+	(name, template, updated_at)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	template = excluded.template,
+	updated_at = excluded.updated_at;`,
+		template.Name,
+		string(template.Template),
+		template.UpdatedAt.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
+// RetrieveProfileTemplate retrieves the profile template called name.
+func (s *SQLiteStorage) RetrieveProfileTemplate(ctx context.Context, name string) (*storage.ProfileTemplate, error) {
+	template := new(storage.ProfileTemplate)
+	var updatedAt string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT name, template, updated_at FROM profile_templates WHERE name = ?;`,
+		name,
+	).Scan(&template.Name, &template.Template, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	template.UpdatedAt, err = time.Parse(timestampFormat, updatedAt)
+	return template, err
+}
+
+// DeleteProfileTemplate deletes the profile template called name.
+func (s *SQLiteStorage) DeleteProfileTemplate(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM profile_templates WHERE name = ?;`, name)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if rows < 1 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// ListProfileTemplates returns the names of all profile templates sorted by name.
+func (s *SQLiteStorage) ListProfileTemplates(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM profile_templates ORDER BY name;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
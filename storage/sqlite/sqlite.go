@@ -0,0 +1,383 @@
+// Package sqlite implements a NanoDEP storage backend using SQLite.
+// It uses a CGO-free SQLite driver and has the same schema semantics as
+// the MySQL backend.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanodep/client"
+	"github.com/micromdm/nanodep/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStorage implements a storage.AllStorage using SQLite.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// Ping checks the connection to the database.
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+type config struct {
+	driver  string
+	dsn     string
+	db      *sql.DB
+	migrate bool
+}
+
+// Option allows configuring a SQLiteStorage.
+type Option func(*config)
+
+// WithDSN sets the storage SQLite data source name.
+// This is typically the path to the database file.
+func WithDSN(dsn string) Option {
+	return func(c *config) {
+		c.dsn = dsn
+	}
+}
+
+// WithDriver sets a custom SQLite driver for the storage.
+//
+// Default driver is "sqlite".
+// Value is ignored if WithDB is used.
+func WithDriver(driver string) Option {
+	return func(c *config) {
+		c.driver = driver
+	}
+}
+
+// WithDB sets a custom SQLite *sql.DB to the storage.
+//
+// If set, driver passed via WithDriver is ignored.
+func WithDB(db *sql.DB) Option {
+	return func(c *config) {
+		c.db = db
+	}
+}
+
+// WithMigrate sets whether any pending schema migrations are applied
+// when the storage is created. This is the default. If disabled then an
+// error is returned if the database schema is older than required.
+func WithMigrate(migrate bool) Option {
+	return func(c *config) {
+		c.migrate = migrate
+	}
+}
+
+// defaultBusyTimeout is the busy timeout pragma added to DSNs without one.
+// This allows multiple processes (e.g. depserver and depsyncer) to share
+// a database file.
+const defaultBusyTimeout = "_pragma=busy_timeout(5000)"
+
+// New creates and returns a new SQLiteStorage.
+// Any schema migrations are applied to the database unless disabled
+// with WithMigrate.
+//
+// SQLite only supports a single writer so the database is limited to one
+// open connection unless WithDB is used.
+func New(opts ...Option) (*SQLiteStorage, error) {
+	cfg := &config{
+		driver:  "sqlite",
+		migrate: true,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var err error
+	if cfg.db == nil {
+		dsn := cfg.dsn
+		if !strings.Contains(dsn, "busy_timeout") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&" + defaultBusyTimeout
+			} else {
+				dsn += "?" + defaultBusyTimeout
+			}
+		}
+		cfg.db, err = sql.Open(cfg.driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		cfg.db.SetMaxOpenConns(1)
+	}
+	if err = cfg.db.Ping(); err != nil {
+		return nil, err
+	}
+	if err = migrate(context.Background(), cfg.db, cfg.migrate); err != nil {
+		return nil, err
+	}
+	return &SQLiteStorage{db: cfg.db}, nil
+}
+
+// timestampFormat is the format of CURRENT_TIMESTAMP.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// RetrieveAuthTokens reads the DEP OAuth tokens for name (DEP name).
+func (s *SQLiteStorage) RetrieveAuthTokens(ctx context.Context, name string) (*client.OAuth1Tokens, error) {
+	var consumerKey, consumerSecret, accessToken, accessSecret, accessTokenExpiry sql.NullString
+	err := s.db.QueryRowContext(
+		ctx, `
+SELECT
+  consumer_key,
+  consumer_secret,
+  access_token,
+  access_secret,
+  access_token_expiry
+FROM
+  dep_names
+WHERE
+  name = ?;`,
+		name,
+	).Scan(&consumerKey, &consumerSecret, &accessToken, &accessSecret, &accessTokenExpiry)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+		}
+		return nil, err
+	}
+	if !consumerKey.Valid { // all auth token fields are set together
+		return nil, fmt.Errorf("consumer key not valid: %w", storage.ErrNotFound)
+	}
+	accessTokenExpiryTime, err := time.Parse(timestampFormat, accessTokenExpiry.String)
+	if err != nil {
+		return nil, err
+	}
+	return &client.OAuth1Tokens{
+		ConsumerKey:       consumerKey.String,
+		ConsumerSecret:    consumerSecret.String,
+		AccessToken:       accessToken.String,
+		AccessSecret:      accessSecret.String,
+		AccessTokenExpiry: accessTokenExpiryTime,
+	}, nil
+}
+
+// StoreAuthTokens saves the DEP OAuth tokens for the DEP name.
+func (s *SQLiteStorage) StoreAuthTokens(ctx context.Context, name string, tokens *client.OAuth1Tokens) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, consumer_key, consumer_secret, access_token, access_secret, access_token_expiry)
+VALUES
+	(?, ?, ?, ?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	consumer_key = excluded.consumer_key,
+	consumer_secret = excluded.consumer_secret,
+	access_token = excluded.access_token,
+	access_secret = excluded.access_secret,
+	access_token_expiry = excluded.access_token_expiry;`,
+		name,
+		tokens.ConsumerKey,
+		tokens.ConsumerSecret,
+		tokens.AccessToken,
+		tokens.AccessSecret,
+		tokens.AccessTokenExpiry.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
+// RetrieveConfig reads the JSON DEP config of a DEP name.
+//
+// Returns (nil, nil) if the DEP name does not exist, or if the config
+// for the DEP name does not exist.
+func (s *SQLiteStorage) RetrieveConfig(ctx context.Context, name string) (*client.Config, error) {
+	var baseURL, serviceDiscoveryURL sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT config_base_url, config_mdm_service_discovery_url FROM dep_names WHERE name = ?;`,
+		name,
+	).Scan(&baseURL, &serviceDiscoveryURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// If the DEP name does not exist, then the config does not exist.
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !baseURL.Valid {
+		// If the config_base_url is NULL, then config does not exist.
+		return nil, nil
+	}
+	return &client.Config{
+		BaseURL:                baseURL.String,
+		MDMServiceDiscoveryURL: serviceDiscoveryURL.String,
+	}, nil
+}
+
+// StoreConfig saves the DEP config for name (DEP name).
+func (s *SQLiteStorage) StoreConfig(ctx context.Context, name string, config *client.Config) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, config_base_url, config_mdm_service_discovery_url)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	config_base_url = excluded.config_base_url,
+	config_mdm_service_discovery_url = excluded.config_mdm_service_discovery_url;`,
+		name,
+		config.BaseURL,
+		sql.NullString{String: config.MDMServiceDiscoveryURL, Valid: config.MDMServiceDiscoveryURL != ""},
+	)
+	return err
+}
+
+// RetrieveAssignerProfile reads the assigner profile UUID and its timestamp for name (DEP name).
+//
+// Returns an empty profile UUID if it does not exist.
+func (s *SQLiteStorage) RetrieveAssignerProfile(ctx context.Context, name string) (profileUUID string, modTime time.Time, err error) {
+	var uuid, uuidAt sql.NullString
+	err = s.db.QueryRowContext(
+		ctx,
+		`SELECT assigner_profile_uuid, assigner_profile_uuid_at FROM dep_names WHERE name = ?;`,
+		name,
+	).Scan(&uuid, &uuidAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// an 'empty' profile UUID is valid, return nil error
+			return "", time.Time{}, nil
+		}
+		return "", time.Time{}, err
+	}
+	if uuid.Valid {
+		profileUUID = uuid.String
+	}
+	if uuidAt.Valid {
+		modTime, err = time.Parse(timestampFormat, uuidAt.String)
+	}
+	return
+}
+
+// StoreAssignerProfile saves the assigner profile UUID for name (DEP name).
+func (s *SQLiteStorage) StoreAssignerProfile(ctx context.Context, name string, profileUUID string) error {
+	return s.StoreAssignerProfileAt(ctx, name, profileUUID, time.Now())
+}
+
+// StoreAssignerProfileAt saves the assigner profile UUID for name (DEP name)
+// with modTime as its timestamp.
+func (s *SQLiteStorage) StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, assigner_profile_uuid, assigner_profile_uuid_at)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	assigner_profile_uuid = excluded.assigner_profile_uuid,
+	assigner_profile_uuid_at = excluded.assigner_profile_uuid_at;`,
+		name,
+		profileUUID,
+		modTime.UTC().Format(timestampFormat),
+	)
+	return err
+}
+
+// RetrieveCursor reads the reads the DEP fetch and sync cursor for name (DEP name).
+//
+// Returns an empty cursor if the cursor does not exist.
+func (s *SQLiteStorage) RetrieveCursor(ctx context.Context, name string) (string, error) {
+	var cursor sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT syncer_cursor FROM dep_names WHERE name = ?;`,
+		name,
+	).Scan(&cursor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return cursor.String, nil
+}
+
+// StoreCursor saves the DEP fetch and sync cursor for name (DEP name).
+func (s *SQLiteStorage) StoreCursor(ctx context.Context, name, cursor string) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, syncer_cursor)
+VALUES
+	(?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	syncer_cursor = excluded.syncer_cursor;`,
+		name,
+		cursor,
+	)
+	return err
+}
+
+// StoreTokenPKI stores the staging PEM bytes in pemCert and pemKey for name (DEP name).
+func (s *SQLiteStorage) StoreTokenPKI(ctx context.Context, name string, pemCert []byte, pemKey []byte) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+INSERT INTO dep_names
+	(name, tokenpki_staging_cert_pem, tokenpki_staging_key_pem)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET
+	tokenpki_staging_cert_pem = excluded.tokenpki_staging_cert_pem,
+	tokenpki_staging_key_pem = excluded.tokenpki_staging_key_pem;`,
+		name,
+		// stored as text (not blobs) for the schema checks
+		string(pemCert),
+		string(pemKey),
+	)
+	return err
+}
+
+// UpstageTokenPKI copies the staging PKI certificate and private key to the
+// current PKI certificate and private key.
+func (s *SQLiteStorage) UpstageTokenPKI(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(
+		ctx, `
+UPDATE
+  dep_names
+SET
+  tokenpki_cert_pem = tokenpki_staging_cert_pem,
+  tokenpki_key_pem = tokenpki_staging_key_pem
+WHERE
+  name = ?;`,
+		name,
+	)
+	return err
+}
+
+// retrieveKeypair returns the PEM bytes of the certificate and key columns for name (DEP name).
+func (s *SQLiteStorage) retrieveKeypair(ctx context.Context, name, certColumn, keyColumn string) ([]byte, []byte, error) {
+	var pemCert, pemKey []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+certColumn+`, `+keyColumn+` FROM dep_names WHERE name = ?;`,
+		name,
+	).Scan(&pemCert, &pemKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("%v: %w", err, storage.ErrNotFound)
+		}
+		return nil, nil, err
+	}
+	if pemCert == nil { // the certificate and key are set together
+		return nil, nil, fmt.Errorf("empty certificate: %w", storage.ErrNotFound)
+	}
+	return pemCert, pemKey, nil
+}
+
+// RetrieveStagingTokenPKI returns the PEM bytes for the staged DEP
+// token exchange certificate and private key using name (DEP name).
+func (s *SQLiteStorage) RetrieveStagingTokenPKI(ctx context.Context, name string) ([]byte, []byte, error) {
+	return s.retrieveKeypair(ctx, name, "tokenpki_staging_cert_pem", "tokenpki_staging_key_pem")
+}
+
+// RetrieveCurrentTokenPKI returns the PEM bytes for the previously-upstaged DEP
+// token exchange certificate and private key using name (DEP name).
+func (s *SQLiteStorage) RetrieveCurrentTokenPKI(ctx context.Context, name string) (pemCert []byte, pemKey []byte, err error) {
+	return s.retrieveKeypair(ctx, name, "tokenpki_cert_pem", "tokenpki_key_pem")
+}
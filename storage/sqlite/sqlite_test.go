@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/micromdm/nanodep/storage/test"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	s, err := New(WithDSN(filepath.Join(t.TempDir(), "nanodep.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.TestWithStorages(t, context.Background(), s)
+}
+
+func TestMigrate(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "nanodep.db")
+	s, err := New(WithDSN(dsn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	version, err := currentVersion(ctx, s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := version, SchemaVersion(); have != want {
+		t.Errorf("schema version: have %d, want %d", have, want)
+	}
+
+	// reopening an up to date database is a no-op
+	if err = s.StoreCursor(ctx, "a", "cursor"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = New(WithDSN(dsn)); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := s.RetrieveCursor(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cursor, "cursor"; have != want {
+		t.Errorf("cursor: have %q, want %q", have, want)
+	}
+
+	// an older (here: empty) schema is refused without migrating
+	if _, err = New(WithDSN(filepath.Join(t.TempDir(), "empty.db")), WithMigrate(false)); err == nil {
+		t.Error("expected error opening older schema")
+	}
+
+	// a newer schema is refused
+	if _, err = s.db.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?);`, SchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(WithDSN(dsn)); err == nil {
+		t.Error("expected error opening newer schema")
+	}
+}
@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+)
+
+// QueryDEPNamesUpdatedSince returns the DEP names updated at or after since.
+// The update timestamps have a granularity of one second.
+func (s *SQLiteStorage) QueryDEPNamesUpdatedSince(ctx context.Context, since time.Time) ([]string, time.Time, error) {
+	// SQLite's CURRENT_TIMESTAMP (and so updated_at) is always UTC
+	var nowUnix int64
+	if err := s.db.QueryRowContext(ctx, `SELECT CAST(strftime('%s', 'now') AS INTEGER);`).Scan(&nowUnix); err != nil {
+		return nil, time.Time{}, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT name FROM dep_names WHERE updated_at >= ? ORDER BY name;`,
+		since.UTC().Format(timestampFormat),
+	)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, time.Time{}, err
+		}
+		names = append(names, name)
+	}
+	return names, time.Unix(nowUnix, 0).UTC(), rows.Err()
+}
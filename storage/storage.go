@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/micromdm/nanodep/client"
 	"github.com/micromdm/nanodep/http/api"
@@ -11,6 +13,43 @@ import (
 // ErrNotFound is returned by AllStorage when a requested resource is not found.
 var ErrNotFound = errors.New("resource not found")
 
+// Pinger checks the connectivity of a storage backend.
+// Storage backends may optionally implement it.
+type Pinger interface {
+	// Ping returns an error if the storage backend is not reachable.
+	Ping(ctx context.Context) error
+}
+
+// Ping pings store if it implements [Pinger].
+// Storage backends that do not implement Pinger are assumed to be reachable.
+// Storage wrappers can use this to forward to the storage they wrap.
+func Ping(ctx context.Context, store interface{}) error {
+	if p, ok := store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// AssignerProfileTimestampStorer stores assigner profiles with an explicit
+// timestamp instead of the current time. Used for copying DEP names
+// between storage backends.
+type AssignerProfileTimestampStorer interface {
+	// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+	// with modTime as its timestamp.
+	StoreAssignerProfileAt(ctx context.Context, name string, profileUUID string, modTime time.Time) error
+}
+
+// StoreAssignerProfileAt stores the assigner profile UUID for name (DEP name)
+// in store with modTime as its timestamp if store implements
+// [AssignerProfileTimestampStorer]. Otherwise the current time is used.
+// Storage wrappers can use this to forward to the storage they wrap.
+func StoreAssignerProfileAt(ctx context.Context, store api.AssignerProfileStorer, name string, profileUUID string, modTime time.Time) error {
+	if ts, ok := store.(AssignerProfileTimestampStorer); ok {
+		return ts.StoreAssignerProfileAt(ctx, name, profileUUID, modTime)
+	}
+	return store.StoreAssignerProfile(ctx, name, profileUUID)
+}
+
 // AllStorage represents all possible required storage used by NanoDEP.
 type AllStorage interface {
 	client.AuthTokensRetriever
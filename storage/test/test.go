@@ -4,6 +4,7 @@ package test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"math/rand"
 	"reflect"
@@ -13,6 +14,8 @@ import (
 
 	"github.com/micromdm/nanodep/client"
 	"github.com/micromdm/nanodep/cryptoutil"
+	"github.com/micromdm/nanodep/godep"
+	"github.com/micromdm/nanodep/http/api"
 	"github.com/micromdm/nanodep/storage"
 	"github.com/micromdm/nanodep/tokenpki"
 )
@@ -21,6 +24,14 @@ import (
 func TestWithStorages(t *testing.T, ctx context.Context, store storage.AllStorage) {
 	depName1, depName2 := genRandName(4), genRandName(4)
 
+	t.Run("ping", func(t *testing.T) {
+		if p, ok := store.(storage.Pinger); ok {
+			if err := p.Ping(ctx); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
 	t.Run("empty", func(t *testing.T) {
 		TestEmpty(t, ctx, depName1, store)
 	})
@@ -37,6 +48,82 @@ func TestWithStorages(t *testing.T, ctx context.Context, store storage.AllStorag
 		TestQueryDEPNames(t, ctx, store)
 	})
 
+	t.Run("audit", func(t *testing.T) {
+		st, ok := store.(storage.AuditStorer)
+		q, ok2 := store.(storage.AuditQuery)
+		if ok && ok2 {
+			TestAudit(t, ctx, st, q)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		if h, ok := store.(storage.HistoryStorer); ok {
+			TestHistory(t, ctx, h)
+		}
+	})
+
+	t.Run("bypass-code-escrow", func(t *testing.T) {
+		if e, ok := store.(storage.BypassCodeEscrowStorer); ok {
+			TestBypassCodeEscrow(t, ctx, e)
+		}
+	})
+
+	t.Run("osbeta-tokens-cache", func(t *testing.T) {
+		if c, ok := store.(storage.OSBetaTokensCacheStorer); ok {
+			TestOSBetaTokensCache(t, ctx, c)
+		}
+	})
+
+	t.Run("account-detail", func(t *testing.T) {
+		if a, ok := store.(api.AccountDetailStore); ok {
+			TestAccountDetail(t, ctx, a, store)
+		}
+	})
+
+	t.Run("dep-name-bindings", func(t *testing.T) {
+		f, ok := store.(api.DEPNameBindingsFinder)
+		a, ok2 := store.(api.AccountDetailStorer)
+		if ok && ok2 {
+			TestDEPNameBindings(t, ctx, f, a, store)
+		}
+	})
+
+	t.Run("api-keys", func(t *testing.T) {
+		if k, ok := store.(storage.APIKeyStorer); ok {
+			TestAPIKeys(t, ctx, k)
+		}
+	})
+
+	t.Run("delete-dep-name", func(t *testing.T) {
+		if d, ok := store.(storage.DEPNameDeleter); ok {
+			TestDeleteDEPName(t, ctx, d, store)
+		}
+	})
+
+	t.Run("profile-templates", func(t *testing.T) {
+		if pt, ok := store.(storage.ProfileTemplateStorer); ok {
+			TestProfileTemplates(t, ctx, pt)
+		}
+	})
+
+	t.Run("assigner-profile-at", func(t *testing.T) {
+		if ts, ok := store.(storage.AssignerProfileTimestampStorer); ok {
+			TestAssignerProfileAt(t, ctx, ts, store)
+		}
+	})
+
+	t.Run("dep-names-updated", func(t *testing.T) {
+		if q, ok := store.(storage.DEPNamesUpdatedQuery); ok {
+			TestDEPNamesUpdated(t, ctx, q, store)
+		}
+	})
+
+	t.Run("list-dep-names", func(t *testing.T) {
+		if l, ok := store.(storage.DEPNamesLister); ok {
+			TestListDEPNames(t, ctx, l, store)
+		}
+	})
+
 }
 
 // TestEmpty tests retrieval methods on an empty/missing name.
@@ -106,7 +193,7 @@ func TestWitName(t *testing.T, ctx context.Context, name string, s storage.AllSt
 	if r == nil {
 		t.Fatal("result is nil")
 	}
-	if have, want := r.DEPNames, []string{name}; !reflect.DeepEqual(have, want) {
+	if have, want := r.Names(), []string{name}; !reflect.DeepEqual(have, want) {
 		t.Errorf("query DEP names: have: %v, want: %v", have, want)
 	}
 
@@ -156,7 +243,8 @@ func TestWitName(t *testing.T, ctx context.Context, name string, s storage.AllSt
 		t.Fatalf("config mismatch: %+v vs. %+v", config, config2)
 	}
 	config2 = &client.Config{
-		BaseURL: "https://config2.example.com",
+		BaseURL:                "https://config2.example.com",
+		MDMServiceDiscoveryURL: "https://mdm.example.com/.well-known/com.apple.remotemanagement",
 	}
 	err = s.StoreConfig(ctx, name, config2)
 	checkErr(t, err)
@@ -309,12 +397,569 @@ func TestQueryDEPNames(t *testing.T, ctx context.Context, s storage.AllStorage)
 		t.Fatal("result empty")
 	}
 
-	slices.Sort(resp.DEPNames)
+	names := resp.Names()
+	slices.Sort(names)
 	slices.Sort(depNames)
 
-	if have, want := resp.DEPNames, depNames; !reflect.DeepEqual(have, want) {
+	if have, want := names, depNames; !reflect.DeepEqual(have, want) {
 		t.Errorf("slices not equal; have: %v, want %v", have, want)
 	}
+
+	// details are returned for each DEP name
+	for _, d := range resp.DEPNames {
+		if !d.HasStagingTokenPKI || d.StagingCertExpiry == nil {
+			t.Errorf("expected staging token PKI for %s", d.Name)
+		}
+		if d.HasTokens || d.HasCurrentTokenPKI || d.HasCursor {
+			t.Errorf("unexpected details for %s: %+v", d.Name, d)
+		}
+	}
+
+	// setup some data to filter on
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	checkErr(t, s.StoreAuthTokens(ctx, depNames[0], &client.OAuth1Tokens{
+		ConsumerKey:       "CK_9af2f8218b150c351ad802c6f3d66abe",
+		ConsumerSecret:    "CS_9af2f8218b150c351ad802c6f3d66abe",
+		AccessToken:       "AT_9af2f8218b150c351ad802c6f3d66abe",
+		AccessSecret:      "AS_9af2f8218b150c351ad802c6f3d66abe",
+		AccessTokenExpiry: expiry,
+	}))
+	baseURL := "https://" + depNames[1] + ".example.com/"
+	checkErr(t, s.StoreConfig(ctx, depNames[1], &client.Config{BaseURL: baseURL}))
+	checkErr(t, s.StoreAssignerProfile(ctx, depNames[2], "43277A13FBCA0CFC"))
+	checkErr(t, s.StoreCursor(ctx, depNames[2], "MTY1NzI5NzA4Nzk3Ny0x"))
+
+	query := func(filter *storage.DEPNamesQueryFilter) []storage.DEPNameDetails {
+		t.Helper()
+		filter.DEPNames = depNames
+		resp, err := s.QueryDEPNames(ctx, &storage.DEPNamesQueryRequest{Filter: filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("result empty")
+		}
+		return resp.DEPNames
+	}
+
+	hasTokens := true
+	details := query(&storage.DEPNamesQueryFilter{HasTokens: &hasTokens})
+	if len(details) != 1 || details[0].Name != depNames[0] {
+		t.Fatalf("has tokens: unexpected results: %+v", details)
+	}
+	d := details[0]
+	if d.AccessTokenExpiry == nil || !d.AccessTokenExpiry.Equal(expiry) {
+		t.Errorf("access token expiry: have %v, want %v", d.AccessTokenExpiry, expiry)
+	}
+	if have, want := d.ConsumerKeyPrefix, "CK_9af2f8218"; have != want {
+		t.Errorf("consumer key prefix: have %q, want %q", have, want)
+	}
+
+	hasTokens = false
+	if have, want := len(query(&storage.DEPNamesQueryFilter{HasTokens: &hasTokens})), len(depNames)-1; have != want {
+		t.Errorf("has no tokens: have %d results, want %d", have, want)
+	}
+
+	before := expiry.Add(time.Minute)
+	if have, want := len(query(&storage.DEPNamesQueryFilter{ExpiringBefore: &before})), 1; have != want {
+		t.Errorf("expiring before: have %d results, want %d", have, want)
+	}
+	before = expiry.Add(-time.Minute)
+	if have, want := len(query(&storage.DEPNamesQueryFilter{ExpiringBefore: &before})), 0; have != want {
+		t.Errorf("expiring before: have %d results, want %d", have, want)
+	}
+
+	details = query(&storage.DEPNamesQueryFilter{BaseURL: &baseURL})
+	if len(details) != 1 || details[0].Name != depNames[1] || details[0].BaseURL != baseURL {
+		t.Errorf("base URL: unexpected results: %+v", details)
+	}
+
+	details = query(&storage.DEPNamesQueryFilter{NamePrefix: depNames[2]})
+	if len(details) != 1 || details[0].Name != depNames[2] {
+		t.Fatalf("name prefix: unexpected results: %+v", details)
+	}
+	d = details[0]
+	if d.AssignerProfileUUID != "43277A13FBCA0CFC" || d.AssignerProfileUUIDAt == nil || !d.HasCursor {
+		t.Errorf("unexpected details: %+v", d)
+	}
+
+	if have, want := len(query(&storage.DEPNamesQueryFilter{NamePrefix: "go\\_test%"})), 0; have != want {
+		t.Errorf("name prefix wildcards: have %d results, want %d", have, want)
+	}
+
+	// DEP names without a staging token PKI are only matched by filters
+	// other than DEP names
+	tokenOnly := genRandName(4)
+	checkErr(t, s.StoreAuthTokens(ctx, tokenOnly, &client.OAuth1Tokens{
+		ConsumerKey:       "CK_" + tokenOnly,
+		AccessTokenExpiry: expiry,
+	}))
+	resp, err = s.QueryDEPNames(ctx, &storage.DEPNamesQueryRequest{Filter: &storage.DEPNamesQueryFilter{DEPNames: []string{tokenOnly}}})
+	checkErr(t, err)
+	if len(resp.DEPNames) != 0 {
+		t.Errorf("token only: expected no results: %+v", resp.DEPNames)
+	}
+	hasTokens = true
+	resp, err = s.QueryDEPNames(ctx, &storage.DEPNamesQueryRequest{Filter: &storage.DEPNamesQueryFilter{DEPNames: []string{tokenOnly}, HasTokens: &hasTokens}})
+	checkErr(t, err)
+	if len(resp.DEPNames) != 1 || resp.DEPNames[0].Name != tokenOnly || !resp.DEPNames[0].HasTokens || resp.DEPNames[0].HasStagingTokenPKI {
+		t.Errorf("token only: unexpected results: %+v", resp.DEPNames)
+	}
+	resp, err = s.QueryDEPNames(ctx, &storage.DEPNamesQueryRequest{Filter: &storage.DEPNamesQueryFilter{NamePrefix: tokenOnly}})
+	checkErr(t, err)
+	if have, want := resp.Names(), []string{tokenOnly}; !slices.Equal(have, want) {
+		t.Errorf("token only name prefix: have %v, want %v", have, want)
+	}
+}
+
+// TestAudit stores and queries audit log events.
+func TestAudit(t *testing.T, ctx context.Context, st storage.AuditStorer, q storage.AuditQuery) {
+	name1, name2 := genRandName(4), genRandName(4)
+
+	// some backends only store second-granularity timestamps
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	events := []*storage.AuditEvent{
+		{
+			Timestamp: ts.Add(-time.Hour),
+			DEPName:   name1,
+			Method:    "POST",
+			Endpoint:  "/profile",
+			Identity:  "test",
+			ClientIP:  "127.0.0.1",
+			Status:    200,
+		},
+		{
+			Timestamp:   ts,
+			DEPName:     name1,
+			Method:      "PUT",
+			Endpoint:    "/profile/devices",
+			Serials:     []string{"SERIAL1", "SERIAL2"},
+			ProfileUUID: "abc123",
+			Status:      200,
+			DryRun:      true,
+		},
+		{
+			Timestamp: ts,
+			DEPName:   name2,
+			Method:    "PUT",
+			Endpoint:  "/v1/config/",
+			Status:    400,
+		},
+	}
+	for _, event := range events {
+		if err := st.StoreAuditEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := func(filter *storage.AuditQueryFilter) []storage.AuditEvent {
+		t.Helper()
+		resp, err := q.QueryAuditEvents(ctx, &storage.AuditQueryRequest{Filter: filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("result empty")
+		}
+		return resp.Events
+	}
+
+	ret := query(&storage.AuditQueryFilter{DEPNames: []string{name1, name2}})
+	if have, want := len(ret), len(events); have != want {
+		t.Fatalf("event count: have %d, want %d", have, want)
+	}
+
+	ret = query(&storage.AuditQueryFilter{DEPNames: []string{name1}})
+	if have, want := len(ret), 2; have != want {
+		t.Fatalf("event count: have %d, want %d", have, want)
+	}
+	for i, event := range ret {
+		if !event.Timestamp.Equal(events[i].Timestamp) {
+			t.Errorf("timestamp mismatch: have %v, want %v", event.Timestamp, events[i].Timestamp)
+		}
+		event.Timestamp = events[i].Timestamp
+		if have, want := event, *events[i]; !reflect.DeepEqual(have, want) {
+			t.Errorf("event mismatch: have %+v, want %+v", have, want)
+		}
+	}
+
+	since := ts.Add(-time.Minute)
+	ret = query(&storage.AuditQueryFilter{DEPNames: []string{name1}, Since: &since})
+	if have, want := len(ret), 1; have != want {
+		t.Fatalf("event count: have %d, want %d", have, want)
+	}
+	if have, want := ret[0].Endpoint, "/profile/devices"; have != want {
+		t.Errorf("endpoint: have %q, want %q", have, want)
+	}
+
+	ret = query(&storage.AuditQueryFilter{DEPNames: []string{name1, name2}, Until: &since})
+	if have, want := len(ret), 1; have != want {
+		t.Fatalf("event count: have %d, want %d", have, want)
+	}
+	if have, want := ret[0].Endpoint, "/profile"; have != want {
+		t.Errorf("endpoint: have %q, want %q", have, want)
+	}
+}
+
+// TestHistory stores, queries, and retrieves change history entries.
+func TestHistory(t *testing.T, ctx context.Context, s storage.HistoryStorer) {
+	name1, name2 := genRandName(4), genRandName(4)
+
+	// some backends only store second-granularity timestamps
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	entries := []*storage.HistoryEntry{
+		{
+			Timestamp: ts.Add(-2 * time.Hour),
+			DEPName:   name1,
+			Kind:      storage.HistoryKindConfig,
+			Actor:     "test",
+			Value:     []byte(`{"base_url":"http://a.example.com"}`),
+		},
+		{
+			Timestamp: ts.Add(-time.Hour),
+			DEPName:   name1,
+			Kind:      storage.HistoryKindAssigner,
+			Value:     []byte(`{"profile_uuid":"abc123"}`),
+		},
+		{
+			Timestamp: ts,
+			DEPName:   name1,
+			Kind:      storage.HistoryKindConfig,
+			Actor:     "test",
+			Previous:  []byte(`{"base_url":"http://a.example.com"}`),
+			Value:     []byte(`{"base_url":"http://b.example.com"}`),
+		},
+		{
+			Timestamp: ts,
+			DEPName:   name2,
+			Kind:      storage.HistoryKindConfig,
+			Value:     []byte(`{}`),
+		},
+	}
+	for _, entry := range entries {
+		if err := s.StoreHistoryEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := func(req *storage.HistoryQueryRequest) []storage.HistoryEntry {
+		t.Helper()
+		resp, err := s.QueryHistory(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil {
+			t.Fatal("result empty")
+		}
+		return resp.Entries
+	}
+
+	ret := query(&storage.HistoryQueryRequest{DEPName: name1})
+	if have, want := len(ret), 3; have != want {
+		t.Fatalf("entry count: have %d, want %d", have, want)
+	}
+	// newest first
+	for i, entry := range ret {
+		want := *entries[2-i]
+		if entry.ID == "" {
+			t.Error("empty entry ID")
+		}
+		if !entry.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("timestamp mismatch: have %v, want %v", entry.Timestamp, want.Timestamp)
+		}
+		entry.ID, entry.Timestamp = "", want.Timestamp
+		if !reflect.DeepEqual(entry, want) {
+			t.Errorf("entry mismatch: have %+v, want %+v", entry, want)
+		}
+	}
+
+	ret = query(&storage.HistoryQueryRequest{DEPName: name1, Kind: storage.HistoryKindConfig})
+	if have, want := len(ret), 2; have != want {
+		t.Fatalf("entry count: have %d, want %d", have, want)
+	}
+
+	lim, ofs := 1, 1
+	ret = query(&storage.HistoryQueryRequest{
+		DEPName:    name1,
+		Pagination: &storage.Pagination{Limit: &lim, Offset: &ofs},
+	})
+	if have, want := len(ret), 1; have != want {
+		t.Fatalf("entry count: have %d, want %d", have, want)
+	}
+	if have, want := ret[0].Kind, storage.HistoryKindAssigner; have != want {
+		t.Errorf("kind: have %q, want %q", have, want)
+	}
+
+	entry, err := s.RetrieveHistoryEntry(ctx, name1, ret[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(entry.Value), `{"profile_uuid":"abc123"}`; have != want {
+		t.Errorf("value: have %q, want %q", have, want)
+	}
+
+	// entries are only retrievable for their DEP name
+	if _, err = s.RetrieveHistoryEntry(ctx, name2, ret[0].ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+	if _, err = s.RetrieveHistoryEntry(ctx, name1, "1234"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+// TestBypassCodeEscrow stores, retrieves, lists, and deletes escrowed bypass codes.
+func TestBypassCodeEscrow(t *testing.T, ctx context.Context, s storage.BypassCodeEscrowStorer) {
+	name := genRandName(4)
+
+	// some backends only store second-granularity timestamps
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := s.RetrieveBypassCode(ctx, name, "SERIAL1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+
+	serials, err := s.ListBypassCodeSerials(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(serials), 0; have != want {
+		t.Errorf("serial count: have %d, want %d", have, want)
+	}
+
+	for _, escrow := range []*storage.EscrowedBypassCode{
+		{DEPName: name, Serial: "SERIAL2", Code: "AAAAA-BBBBB-CCCC-DDDD-EEEE-FFFF", CreatedAt: ts},
+		{DEPName: name, Serial: "SERIAL1", Code: "00000-11111-2222-3333-4444-5555", CreatedAt: ts},
+		// replaces the first code
+		{DEPName: name, Serial: "SERIAL2", Code: "GGGGG-HHHHH-JJJJ-KKKK-LLLL-MMMM", CreatedAt: ts.Add(time.Hour)},
+		// a DEP name prefixed by name
+		{DEPName: name + ".x", Serial: "SERIAL3", Code: "00000-11111-2222-3333-4444-5555", CreatedAt: ts},
+	} {
+		if err = s.StoreBypassCode(ctx, escrow); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	escrow, err := s.RetrieveBypassCode(ctx, name, "SERIAL2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &storage.EscrowedBypassCode{
+		DEPName:   name,
+		Serial:    "SERIAL2",
+		Code:      "GGGGG-HHHHH-JJJJ-KKKK-LLLL-MMMM",
+		CreatedAt: ts.Add(time.Hour),
+	}
+	if !escrow.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("created at mismatch: have %v, want %v", escrow.CreatedAt, want.CreatedAt)
+	}
+	escrow.CreatedAt = want.CreatedAt
+	if !reflect.DeepEqual(escrow, want) {
+		t.Errorf("escrow mismatch: have %+v, want %+v", escrow, want)
+	}
+
+	// codes are only retrievable for their DEP name
+	if _, err = s.RetrieveBypassCode(ctx, name, "SERIAL3"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+
+	serials, err = s.ListBypassCodeSerials(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := serials, []string{"SERIAL1", "SERIAL2"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("serials: have %v, want %v", have, want)
+	}
+
+	// pending codes are kept alongside the code until cleared
+	for _, pendingCode := range []string{"NNNNN-PPPPP-QQQQ-RRRR-TTTT-VVVV", ""} {
+		escrow.PendingCode = pendingCode
+		if err = s.StoreBypassCode(ctx, escrow); err != nil {
+			t.Fatal(err)
+		}
+		have, err := s.RetrieveBypassCode(ctx, name, "SERIAL2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have.Code != want.Code || have.PendingCode != pendingCode {
+			t.Errorf("codes: have %q and %q, want %q and %q", have.Code, have.PendingCode, want.Code, pendingCode)
+		}
+	}
+
+	// deleting a code twice is not an error
+	for i := 0; i < 2; i++ {
+		if err = s.DeleteBypassCode(ctx, name, "SERIAL1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = s.RetrieveBypassCode(ctx, name, "SERIAL1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+	serials, err = s.ListBypassCodeSerials(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := serials, []string{"SERIAL2"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("serials: have %v, want %v", have, want)
+	}
+}
+
+// TestAPIKeys stores, retrieves, lists, and deletes API keys.
+func TestAPIKeys(t *testing.T, ctx context.Context, s storage.APIKeyStorer) {
+	name := genRandName(4)
+
+	if _, err := s.RetrieveAPIKey(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := &storage.APIKey{
+		Name:       name,
+		SecretHash: "ad9e5b6f2d0a5d6d1b4e4f3b1c4d0e4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e",
+		Scopes:     []string{"proxy:read"},
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	checkErr(t, s.StoreAPIKey(ctx, key))
+
+	// overwrite
+	key.Scopes = []string{"proxy:read", "proxy:write"}
+	key.DEPNames = []string{"a", "b"}
+	checkErr(t, s.StoreAPIKey(ctx, key))
+
+	key2, err := s.RetrieveAPIKey(ctx, name)
+	checkErr(t, err)
+	if !key2.CreatedAt.Equal(key.CreatedAt) {
+		t.Errorf("created at mismatch: have %v, want %v", key2.CreatedAt, key.CreatedAt)
+	}
+	key2.CreatedAt = key.CreatedAt
+	if !reflect.DeepEqual(key2, key) {
+		t.Errorf("API key mismatch: have %+v, want %+v", key2, key)
+	}
+
+	keys, err := s.ListAPIKeys(ctx)
+	checkErr(t, err)
+	if !slices.ContainsFunc(keys, func(k storage.APIKey) bool { return k.Name == name }) {
+		t.Errorf("API key %s not listed", name)
+	}
+
+	checkErr(t, s.DeleteAPIKey(ctx, name))
+
+	if _, err := s.RetrieveAPIKey(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.DeleteAPIKey(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestDeleteDEPName deletes parts of and then all data of a DEP name.
+func TestDeleteDEPName(t *testing.T, ctx context.Context, d storage.DEPNameDeleter, s storage.AllStorage) {
+	name := genRandName(4)
+
+	// the OS beta tokens cache is deleted with the DEP name if supported
+	osBeta, _ := s.(storage.OSBetaTokensCacheStorer)
+
+	// deleting a non-existent DEP name is not an error
+	checkErr(t, d.DeleteDEPName(ctx, name))
+
+	pemCert, pemKey := generatePKI(t, "basicdn", 1)
+	checkErr(t, s.StoreTokenPKI(ctx, name, pemCert, pemKey))
+	checkErr(t, s.UpstageTokenPKI(ctx, name))
+	checkErr(t, s.StoreAuthTokens(ctx, name, &client.OAuth1Tokens{
+		ConsumerKey:       "CK_9af2f8218b150c351ad802c6f3d66abe",
+		ConsumerSecret:    "CS_9af2f8218b150c351ad802c6f3d66abe",
+		AccessToken:       "AT_9af2f8218b150c351ad802c6f3d66abe",
+		AccessSecret:      "AS_9af2f8218b150c351ad802c6f3d66abe",
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}))
+	checkErr(t, s.StoreConfig(ctx, name, &client.Config{BaseURL: "https://example.com/"}))
+	checkErr(t, s.StoreAssignerProfile(ctx, name, "43277A13FBCA0CFC"))
+	checkErr(t, s.StoreCursor(ctx, name, "MTY1NzI5NzA4Nzk3Ny0x"))
+	if osBeta != nil {
+		checkErr(t, osBeta.StoreOSBetaTokens(ctx, &storage.CachedOSBetaTokens{
+			DEPName:   name,
+			Response:  json.RawMessage(`{"betaEnrollmentTokens":[]}`),
+			FetchedAt: time.Now().UTC().Truncate(time.Second),
+		}))
+	}
+
+	if err := d.DeleteDEPName(ctx, name, "bogus"); err == nil {
+		t.Error("expected error for invalid part")
+	}
+
+	// delete only some parts
+	checkErr(t, d.DeleteDEPName(ctx, name, storage.PartCursor, storage.PartConfig))
+
+	cursor, err := s.RetrieveCursor(ctx, name)
+	checkErr(t, err)
+	if cursor != "" {
+		t.Errorf("expected empty cursor: %s", cursor)
+	}
+	config, err := s.RetrieveConfig(ctx, name)
+	checkErr(t, err)
+	if config != nil && config.BaseURL != "" {
+		t.Errorf("expected empty config: %+v", config)
+	}
+	if _, err = s.RetrieveAuthTokens(ctx, name); err != nil {
+		t.Errorf("expected tokens to remain: %v", err)
+	}
+	profileUUID, _, err := s.RetrieveAssignerProfile(ctx, name)
+	checkErr(t, err)
+	if profileUUID == "" {
+		t.Error("expected assigner profile to remain")
+	}
+	if osBeta != nil {
+		if _, err = osBeta.RetrieveOSBetaTokens(ctx, name); err != nil {
+			t.Errorf("expected OS beta tokens to remain: %v", err)
+		}
+	}
+
+	// delete everything
+	checkErr(t, s.StoreConfig(ctx, name, &client.Config{BaseURL: "https://example.com/"}))
+	checkErr(t, d.DeleteDEPName(ctx, name))
+
+	if _, err = s.RetrieveAuthTokens(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, err = s.RetrieveCurrentTokenPKI(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, err = s.RetrieveStagingTokenPKI(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	profileUUID, _, err = s.RetrieveAssignerProfile(ctx, name)
+	checkErr(t, err)
+	if profileUUID != "" {
+		t.Errorf("expected empty assigner profile: %s", profileUUID)
+	}
+	config, err = s.RetrieveConfig(ctx, name)
+	checkErr(t, err)
+	if config != nil && config.BaseURL != "" {
+		t.Errorf("expected empty config: %+v", config)
+	}
+	cursor, err = s.RetrieveCursor(ctx, name)
+	checkErr(t, err)
+	if cursor != "" {
+		t.Errorf("expected empty cursor: %s", cursor)
+	}
+	if osBeta == nil {
+		return
+	}
+	if _, err = osBeta.RetrieveOSBetaTokens(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// deleting only the tokens deletes the OS beta tokens cached with them
+	checkErr(t, osBeta.StoreOSBetaTokens(ctx, &storage.CachedOSBetaTokens{
+		DEPName:            name,
+		SeedForITTurnedOff: true,
+		FetchedAt:          time.Now().UTC().Truncate(time.Second),
+	}))
+	checkErr(t, d.DeleteDEPName(ctx, name, storage.PartTokens))
+	if _, err = osBeta.RetrieveOSBetaTokens(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
 
 func checkTokens(t *testing.T, t1 *client.OAuth1Tokens, t2 *client.OAuth1Tokens) {
@@ -369,3 +1014,295 @@ func genRandName(length int) string {
 	}
 	return "go_test_dep_name." + string(result)
 }
+
+// TestProfileTemplates stores, retrieves, lists, and deletes profile templates.
+func TestProfileTemplates(t *testing.T, ctx context.Context, s storage.ProfileTemplateStorer) {
+	name := genRandName(4)
+
+	if _, err := s.RetrieveProfileTemplate(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	template := &storage.ProfileTemplate{
+		Name:      name,
+		Template:  []byte(`{"profile_name":"test"}`),
+		UpdatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	checkErr(t, s.StoreProfileTemplate(ctx, template))
+
+	// overwrite
+	template.Template = []byte(`{"profile_name":"${DEP_NAME}","url":"https://mdm.example.com/${DEP_NAME}"}`)
+	checkErr(t, s.StoreProfileTemplate(ctx, template))
+
+	template2, err := s.RetrieveProfileTemplate(ctx, name)
+	checkErr(t, err)
+	if !template2.UpdatedAt.Equal(template.UpdatedAt) {
+		t.Errorf("updated at mismatch: have %v, want %v", template2.UpdatedAt, template.UpdatedAt)
+	}
+	if have, want := string(template2.Template), string(template.Template); have != want {
+		t.Errorf("template mismatch: have %q, want %q", have, want)
+	}
+
+	names, err := s.ListProfileTemplates(ctx)
+	checkErr(t, err)
+	if !slices.Contains(names, name) {
+		t.Errorf("profile template %s not listed", name)
+	}
+
+	checkErr(t, s.DeleteProfileTemplate(ctx, name))
+
+	if _, err := s.RetrieveProfileTemplate(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.DeleteProfileTemplate(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestAssignerProfileAt stores an assigner profile with an explicit timestamp.
+func TestAssignerProfileAt(t *testing.T, ctx context.Context, ts storage.AssignerProfileTimestampStorer, s storage.AllStorage) {
+	name := genRandName(4)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := ts.StoreAssignerProfileAt(ctx, name, "profile-at", modTime)
+	checkErr(t, err)
+	profileUUID, haveModTime, err := s.RetrieveAssignerProfile(ctx, name)
+	checkErr(t, err)
+	if have, want := profileUUID, "profile-at"; have != want {
+		t.Errorf("profile UUID: have %q, want %q", have, want)
+	}
+	if !haveModTime.Equal(modTime) {
+		t.Errorf("timestamp: have %v, want %v", haveModTime, modTime)
+	}
+	if d, ok := s.(storage.DEPNameDeleter); ok {
+		checkErr(t, d.DeleteDEPName(ctx, name))
+	}
+}
+
+// TestOSBetaTokensCache stores and retrieves cached beta enrollment tokens.
+func TestOSBetaTokensCache(t *testing.T, ctx context.Context, s storage.OSBetaTokensCacheStorer) {
+	name := genRandName(4)
+
+	// some backends only store second-granularity timestamps
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := s.RetrieveOSBetaTokens(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+
+	for _, want := range []*storage.CachedOSBetaTokens{
+		{DEPName: name, Response: []byte(`{"betaEnrollmentTokens":[{"os":"iOS","token":"abc"}]}`), FetchedAt: ts},
+		// replaces the first tokens
+		{DEPName: name, SeedForITTurnedOff: true, FetchedAt: ts.Add(time.Hour)},
+	} {
+		if err := s.StoreOSBetaTokens(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := s.RetrieveOSBetaTokens(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tokens.FetchedAt.Equal(want.FetchedAt) {
+			t.Errorf("fetched at mismatch: have %v, want %v", tokens.FetchedAt, want.FetchedAt)
+		}
+		if have, want := string(tokens.Response), string(want.Response); have != want {
+			t.Errorf("response mismatch: have %q, want %q", have, want)
+		}
+		if have, want := tokens.SeedForITTurnedOff, want.SeedForITTurnedOff; have != want {
+			t.Errorf("turned off mismatch: have %v, want %v", have, want)
+		}
+	}
+
+	names, err := s.ListOSBetaTokensNames(ctx)
+	checkErr(t, err)
+	if !slices.Contains(names, name) {
+		t.Errorf("listed names missing %q: %v", name, names)
+	}
+
+	checkErr(t, s.DeleteOSBetaTokens(ctx, name))
+	if _, err = s.RetrieveOSBetaTokens(ctx, name); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("have %v, want %v", err, storage.ErrNotFound)
+	}
+	names, err = s.ListOSBetaTokensNames(ctx)
+	checkErr(t, err)
+	if slices.Contains(names, name) {
+		t.Errorf("listed names contain deleted %q", name)
+	}
+
+	// deleting tokens that are not cached is not an error
+	checkErr(t, s.DeleteOSBetaTokens(ctx, name))
+}
+
+func TestAccountDetail(t *testing.T, ctx context.Context, a api.AccountDetailStore, s storage.AllStorage) {
+	name := genRandName(4)
+
+	detail, err := a.RetrieveAccountDetail(ctx, name)
+	checkErr(t, err)
+	if detail != nil {
+		t.Errorf("expected nil account detail: %+v", detail)
+	}
+
+	// some backends only store second-granularity timestamps
+	ts := time.Now().UTC().Truncate(time.Second)
+
+	serverUUID, orgName, orgType := "4A0B1136DA3447E89C2486F4D342E5BB", "Example Org", godep.AccountDetailJsonOrgTypeOrg
+	for _, want := range []*api.AccountDetail{
+		{AccountDetailJson: godep.AccountDetailJson{ServerUuid: &serverUUID}, FetchedAt: ts},
+		// replaces the first account detail
+		{AccountDetailJson: godep.AccountDetailJson{ServerUuid: &serverUUID, OrgName: &orgName, OrgType: &orgType}, FetchedAt: ts.Add(time.Hour)},
+	} {
+		checkErr(t, a.StoreAccountDetail(ctx, name, want))
+		detail, err = a.RetrieveAccountDetail(ctx, name)
+		checkErr(t, err)
+		if detail == nil {
+			t.Fatal("expected account detail")
+		}
+		if !detail.FetchedAt.Equal(want.FetchedAt) {
+			t.Errorf("fetched at mismatch: have %v, want %v", detail.FetchedAt, want.FetchedAt)
+		}
+		if !reflect.DeepEqual(detail.AccountDetailJson, want.AccountDetailJson) {
+			t.Errorf("account detail mismatch: have %+v, want %+v", detail.AccountDetailJson, want.AccountDetailJson)
+		}
+	}
+
+	// storing a nil account detail clears it
+	checkErr(t, a.StoreAccountDetail(ctx, name, nil))
+	detail, err = a.RetrieveAccountDetail(ctx, name)
+	checkErr(t, err)
+	if detail != nil {
+		t.Errorf("expected nil account detail: %+v", detail)
+	}
+
+	// the account detail is deleted with the tokens
+	d, ok := s.(storage.DEPNameDeleter)
+	if !ok {
+		return
+	}
+	checkErr(t, a.StoreAccountDetail(ctx, name, &api.AccountDetail{AccountDetailJson: godep.AccountDetailJson{ServerUuid: &serverUUID}, FetchedAt: ts}))
+	checkErr(t, d.DeleteDEPName(ctx, name, storage.PartTokens))
+	detail, err = a.RetrieveAccountDetail(ctx, name)
+	checkErr(t, err)
+	if detail != nil {
+		t.Errorf("expected nil account detail: %+v", detail)
+	}
+}
+
+// TestDEPNameBindings tests finding the DEP names bound to the same DEP server.
+func TestDEPNameBindings(t *testing.T, ctx context.Context, f api.DEPNameBindingsFinder, a api.AccountDetailStorer, s storage.AllStorage) {
+	names := []string{genRandName(8), genRandName(8), genRandName(8)}
+	consumerKey, serverUUID := "CK_"+genRandName(16), "UUID_"+genRandName(16)
+
+	newTokens := func(consumerKey string) *client.OAuth1Tokens {
+		return &client.OAuth1Tokens{
+			ConsumerKey:       consumerKey,
+			ConsumerSecret:    "CS_9af2f8218b150c351ad802c6f3d66abe",
+			AccessToken:       "AT_9af2f8218b150c351ad802c6f3d66abe",
+			AccessSecret:      "AS_9af2f8218b150c351ad802c6f3d66abe",
+			AccessTokenExpiry: time.Now().UTC(),
+		}
+	}
+	otherServerUUID := "UUID_" + genRandName(16)
+	for i, detailServerUUID := range []string{serverUUID, serverUUID, otherServerUUID} {
+		tokensConsumerKey := consumerKey
+		if i == 1 {
+			tokensConsumerKey = "CK_" + genRandName(16)
+		}
+		checkErr(t, s.StoreAuthTokens(ctx, names[i], newTokens(tokensConsumerKey)))
+		checkErr(t, a.StoreAccountDetail(ctx, names[i], &api.AccountDetail{
+			AccountDetailJson: godep.AccountDetailJson{ServerUuid: &detailServerUUID},
+			FetchedAt:         time.Now().UTC(),
+		}))
+	}
+
+	for _, tc := range []struct {
+		consumerKey string
+		serverUUID  string
+		want        map[string]api.DEPNameBinding
+	}{
+		{consumerKey, serverUUID, map[string]api.DEPNameBinding{
+			names[0]: {Name: names[0], SameConsumerKey: true, SameServerUUID: true},
+			names[1]: {Name: names[1], SameServerUUID: true},
+			names[2]: {Name: names[2], SameConsumerKey: true},
+		}},
+		{consumerKey, "", map[string]api.DEPNameBinding{
+			names[0]: {Name: names[0], SameConsumerKey: true},
+			names[2]: {Name: names[2], SameConsumerKey: true},
+		}},
+		{"", otherServerUUID, map[string]api.DEPNameBinding{
+			names[2]: {Name: names[2], SameServerUUID: true},
+		}},
+		{"", "", map[string]api.DEPNameBinding{}},
+	} {
+		bindings, err := f.FindDEPNameBindings(ctx, tc.consumerKey, tc.serverUUID)
+		checkErr(t, err)
+		have := make(map[string]api.DEPNameBinding)
+		for _, binding := range bindings {
+			// skip DEP names stored by other tests
+			if slices.Contains(names, binding.Name) {
+				have[binding.Name] = binding
+			}
+		}
+		if !reflect.DeepEqual(have, tc.want) {
+			t.Errorf("bindings mismatch for %q, %q: have %+v, want %+v", tc.consumerKey, tc.serverUUID, have, tc.want)
+		}
+	}
+
+	// bindings are deleted with the tokens
+	d, ok := s.(storage.DEPNameDeleter)
+	if !ok {
+		return
+	}
+	for _, name := range names {
+		checkErr(t, d.DeleteDEPName(ctx, name, storage.PartTokens))
+	}
+	bindings, err := f.FindDEPNameBindings(ctx, consumerKey, serverUUID)
+	checkErr(t, err)
+	if len(bindings) > 0 {
+		t.Errorf("expected no bindings: %+v", bindings)
+	}
+}
+
+// TestDEPNamesUpdated tests querying for updated DEP names.
+func TestDEPNamesUpdated(t *testing.T, ctx context.Context, q storage.DEPNamesUpdatedQuery, s storage.AllStorage) {
+	name := genRandName(8)
+
+	_, since, err := q.QueryDEPNamesUpdatedSince(ctx, time.Now())
+	checkErr(t, err)
+
+	checkErr(t, s.StoreConfig(ctx, name, &client.Config{BaseURL: "https://" + name + ".example.com/"}))
+
+	names, now, err := q.QueryDEPNamesUpdatedSince(ctx, since)
+	checkErr(t, err)
+	if !slices.Contains(names, name) {
+		t.Errorf("expected updated DEP name %q in %v", name, names)
+	}
+	if now.Before(since) {
+		t.Errorf("now before since: %v < %v", now, since)
+	}
+
+	// a later update time excludes the DEP name
+	names, _, err = q.QueryDEPNamesUpdatedSince(ctx, now.Add(time.Hour))
+	checkErr(t, err)
+	if slices.Contains(names, name) {
+		t.Errorf("unexpected updated DEP name %q in %v", name, names)
+	}
+}
+
+// TestListDEPNames tests listing DEP names without a token PKI.
+func TestListDEPNames(t *testing.T, ctx context.Context, l storage.DEPNamesLister, s storage.AllStorage) {
+	name := genRandName(8)
+
+	checkErr(t, s.StoreAuthTokens(ctx, name, &client.OAuth1Tokens{
+		ConsumerKey:       "CK_" + name,
+		AccessTokenExpiry: time.Now().Add(time.Hour).UTC(),
+	}))
+
+	names, err := l.ListDEPNames(ctx)
+	checkErr(t, err)
+	if !slices.Contains(names, name) {
+		t.Errorf("expected DEP name %q in %v", name, names)
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("DEP names not sorted: %v", names)
+	}
+}
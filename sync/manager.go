@@ -0,0 +1,318 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanodep/godep"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// ErrNotRunning is returned when a DEP name has no running syncer.
+var ErrNotRunning = errors.New("syncer not running")
+
+// ManagerStorage is the storage required for the syncers and assigners
+// of a Manager.
+type ManagerStorage interface {
+	CursorStorage
+	AssignerProfileRetriever
+}
+
+// DiscoverFunc returns the DEP names to sync.
+type DiscoverFunc func(ctx context.Context) ([]string, error)
+
+// ManagerCallback is called every time a fetch or sync operation completes
+// for DEP name.
+type ManagerCallback func(ctx context.Context, name string, isFetch bool, resp *godep.FetchDeviceResponseJson) error
+
+// Manager runs a continuous Syncer and Assigner for each of multiple DEP
+// names. DEP names are either configured up front or periodically
+// discovered. Individual DEP names can be asked to sync immediately.
+type Manager struct {
+	client       *godep.Client
+	store        ManagerStorage
+	logger       log.Logger
+	duration     time.Duration
+	syncerOpts   []SyncerOption
+	assignerOpts []AssignerOption
+	callback     ManagerCallback
+	names        []string
+	discover     DiscoverFunc
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cbWG    sync.WaitGroup
+	ctx     context.Context
+	running map[string]*managedSyncer
+}
+
+// managedSyncer is a running syncer of a DEP name.
+type managedSyncer struct {
+	syncNow  chan struct{}
+	fetchNow chan struct{}
+	cancel   context.CancelFunc
+}
+
+type ManagerOption func(*Manager)
+
+// WithManagerLogger configures logger for the manager and its syncers
+// and assigners.
+func WithManagerLogger(logger log.Logger) ManagerOption {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// WithManagerDuration sets the duration between sync cycles of each syncer.
+// This is also the interval between DEP name discoveries.
+func WithManagerDuration(duration time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.duration = duration
+	}
+}
+
+// WithSyncerOptions adds opts to each syncer.
+func WithSyncerOptions(opts ...SyncerOption) ManagerOption {
+	return func(m *Manager) {
+		m.syncerOpts = append(m.syncerOpts, opts...)
+	}
+}
+
+// WithAssignerOptions adds opts to each assigner.
+func WithAssignerOptions(opts ...AssignerOption) ManagerOption {
+	return func(m *Manager) {
+		m.assignerOpts = append(m.assignerOpts, opts...)
+	}
+}
+
+// WithManagerCallback sets the callback function to call for each fetch
+// and sync of every DEP name. It is called in addition to the assigner.
+func WithManagerCallback(cb ManagerCallback) ManagerOption {
+	return func(m *Manager) {
+		m.callback = cb
+	}
+}
+
+// WithDEPNames configures the DEP names to sync.
+func WithDEPNames(names ...string) ManagerOption {
+	return func(m *Manager) {
+		m.names = append(m.names, names...)
+	}
+}
+
+// WithDiscovery configures the manager to sync the DEP names returned by
+// discover. Syncers are started for newly discovered DEP names and stopped
+// for DEP names no longer discovered. DEP names configured with
+// [WithDEPNames] are always synced.
+func WithDiscovery(discover DiscoverFunc) ManagerOption {
+	return func(m *Manager) {
+		m.discover = discover
+	}
+}
+
+// NewManager creates a new Manager using client and store.
+func NewManager(client *godep.Client, store ManagerStorage, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		client:   client,
+		store:    store,
+		logger:   log.NopLogger,
+		duration: 30 * time.Minute,
+		running:  make(map[string]*managedSyncer),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// Run starts the syncers and, if configured, the DEP name discovery.
+// Run blocks until ctx is cancelled, all syncers have stopped, and all
+// in-flight assigner and callback calls have finished.
+func (m *Manager) Run(ctx context.Context) error {
+	if m.duration <= 0 {
+		return errors.New("invalid duration")
+	}
+
+	m.mu.Lock()
+	m.ctx = ctx
+	for _, name := range m.names {
+		m.start(name)
+	}
+	m.mu.Unlock()
+
+	var ticker *time.Ticker
+	if m.discover != nil {
+		ticker = time.NewTicker(m.duration)
+		defer ticker.Stop()
+		m.discoverNames(ctx)
+	}
+
+	if ticker != nil {
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				m.discoverNames(ctx)
+			case <-ctx.Done():
+				break loop
+			}
+		}
+	} else {
+		<-ctx.Done()
+	}
+
+	m.wg.Wait()
+	m.cbWG.Wait()
+	return ctx.Err()
+}
+
+// discoverNames starts syncers for newly discovered DEP names and stops
+// syncers for DEP names that are no longer discovered.
+func (m *Manager) discoverNames(ctx context.Context) {
+	names, err := m.discover(ctx)
+	if err != nil {
+		m.logger.Info("msg", "discovering DEP names", "err", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil || m.ctx.Err() != nil {
+		return
+	}
+	for _, name := range names {
+		m.start(name)
+	}
+	for name, s := range m.running {
+		if !slices.Contains(names, name) && !slices.Contains(m.names, name) {
+			m.logger.Info("msg", "stopping syncer", "name", name)
+			s.cancel()
+			delete(m.running, name)
+		}
+	}
+}
+
+// start starts the syncer and assigner of DEP name if not already running.
+// The mutex must be held.
+func (m *Manager) start(name string) {
+	if _, ok := m.running[name]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	s := &managedSyncer{
+		// buffered so that requests made during a sync are not lost
+		syncNow:  make(chan struct{}, 1),
+		fetchNow: make(chan struct{}, 1),
+		cancel:   cancel,
+	}
+	m.running[name] = s
+
+	assigner := NewAssigner(
+		m.client,
+		name,
+		m.store,
+		append([]AssignerOption{WithAssignerLogger(m.logger.With("component", "assigner"))}, m.assignerOpts...)...,
+	)
+
+	callback := func(ctx context.Context, isFetch bool, resp *godep.FetchDeviceResponseJson) error {
+		// finish processing the response even if we're shutting down
+		ctx = context.WithoutCancel(ctx)
+		m.cbWG.Add(1)
+		go func() {
+			defer m.cbWG.Done()
+			err := assigner.ProcessDeviceResponse(ctx, resp)
+			if err != nil {
+				m.logger.Info("msg", "assigner process device response", "name", name, "err", err)
+			}
+		}()
+		if m.callback != nil {
+			m.cbWG.Add(1)
+			go func() {
+				defer m.cbWG.Done()
+				err := m.callback(ctx, name, isFetch, resp)
+				if err != nil {
+					m.logger.Info("msg", "syncer callback", "name", name, "err", err)
+				}
+			}()
+		}
+		return nil
+	}
+
+	syncerOpts := []SyncerOption{
+		WithLogger(m.logger.With("component", "syncer")),
+		WithDuration(m.duration),
+		WithSyncNow(s.syncNow),
+		WithFetchNow(s.fetchNow),
+		WithCallback(callback),
+	}
+	syncer := NewSyncer(m.client, name, m.store, append(syncerOpts, m.syncerOpts...)...)
+
+	m.logger.Info("msg", "starting syncer", "name", name)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := syncer.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			m.logger.Info("msg", "syncer run", "name", name, "err", err)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.running[name] == s {
+			delete(m.running, name)
+		}
+	}()
+}
+
+// Names returns the sorted DEP names with running syncers.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.running))
+	for name := range m.running {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SyncNow asks the syncer of DEP name to perform an immediate sync.
+// If fetch is true the syncer clears its stored cursor and fetches all
+// devices again. If DEP name has no running syncer then DEP names are
+// discovered (if configured) before ErrNotRunning is returned.
+func (m *Manager) SyncNow(ctx context.Context, name string, fetch bool) error {
+	s := m.syncer(name)
+	if s == nil && m.discover != nil {
+		m.discoverNames(ctx)
+		s = m.syncer(name)
+	}
+	if s == nil {
+		return ErrNotRunning
+	}
+
+	c := s.syncNow
+	if fetch {
+		// the syncer clears its cursor itself so that it does not race
+		// with a sync in progress
+		c = s.fetchNow
+	}
+
+	// a pending request is already buffered if the send would block
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (m *Manager) syncer(name string) *managedSyncer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running[name]
+}
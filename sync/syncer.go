@@ -42,6 +42,9 @@ type Syncer struct {
 	// in "continuous" mode this is a channel that is selected on to interrupt
 	// the duration wait to immediately perform the next sync operation(s).
 	syncNow <-chan struct{}
+	// in "continuous" mode this is a channel that is selected on to clear
+	// the cursor and immediately perform a full fetch of all devices.
+	fetchNow <-chan struct{}
 }
 
 type SyncerOption func(*Syncer)
@@ -71,6 +74,15 @@ func WithSyncNow(syncNow <-chan struct{}) SyncerOption {
 	}
 }
 
+// WithFetchNow specifies the channel to select on which will advise the
+// syncer to end its sync wait, clear its (stored) cursor, and perform an
+// immediate full fetch of all devices.
+func WithFetchNow(fetchNow <-chan struct{}) SyncerOption {
+	return func(syncer *Syncer) {
+		syncer.fetchNow = fetchNow
+	}
+}
+
 // WithLimit sets the device sync limit for each fetch and sync.
 func WithLimit(limit int) SyncerOption {
 	return func(syncer *Syncer) {
@@ -218,7 +230,9 @@ func (s *Syncer) Run(ctx context.Context) error {
 			}
 
 			if cursor != resp.Cursor {
-				err = s.store.StoreCursor(ctx, s.name, resp.Cursor)
+				// persist the cursor of the processed response even if
+				// we're shutting down so the devices are not synced again
+				err = s.store.StoreCursor(context.WithoutCancel(ctx), s.name, resp.Cursor)
 				if err != nil {
 					return err
 				}
@@ -242,6 +256,16 @@ func (s *Syncer) Run(ctx context.Context) error {
 		case <-ticker.C:
 		case <-s.syncNow:
 			logger.Debug("msg", "device sync: explicit sync requested")
+		case <-s.fetchNow:
+			logger.Debug("msg", "device sync: explicit full fetch requested")
+			// note: this will re-fetch the entire device list
+			cursor = ""
+			doFetch = true
+			// clear the stored cursor so a restarted syncer also re-fetches
+			err = s.store.StoreCursor(context.WithoutCancel(ctx), s.name, cursor)
+			if err != nil {
+				return err
+			}
 		case <-ctx.Done():
 			return ctx.Err()
 		}